@@ -20,6 +20,7 @@ import (
 	"github.com/go-chi/cors"
 	"github.com/jamesolaitan/accessgraph/internal/api/graphql"
 	"github.com/jamesolaitan/accessgraph/internal/config"
+	"github.com/jamesolaitan/accessgraph/internal/graph"
 	redactlog "github.com/jamesolaitan/accessgraph/internal/log"
 	"github.com/jamesolaitan/accessgraph/internal/store"
 )
@@ -45,7 +46,7 @@ func main() {
 	}
 
 	// Initialize store
-	st, err := store.New(cfg.SQLitePath)
+	st, err := store.New(cfg.DatabaseURL)
 	if err != nil {
 		log.Fatalf("Failed to open store: %v", err)
 	}
@@ -53,6 +54,16 @@ func main() {
 
 	// Create GraphQL resolver
 	resolver := graphql.NewResolver(st, cfg)
+	if cfg.AttackWeightsPath != "" {
+		weights, err := graph.LoadWeights(cfg.AttackWeightsPath)
+		if err != nil {
+			log.Fatalf("Failed to load attack weights: %v", err)
+		}
+		if err := resolver.SetWeights(weights); err != nil {
+			log.Fatalf("Failed to set attack weights: %v", err)
+		}
+		log.Printf("Attack weights: %s", cfg.AttackWeightsPath)
+	}
 
 	// Create router
 	r := chi.NewRouter()
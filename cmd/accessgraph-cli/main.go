@@ -7,10 +7,13 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/jamesolaitan/accessgraph/internal/config"
 	"github.com/jamesolaitan/accessgraph/internal/graph"
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
 	redactlog "github.com/jamesolaitan/accessgraph/internal/log"
 	"github.com/jamesolaitan/accessgraph/internal/policy"
 	"github.com/jamesolaitan/accessgraph/internal/reco"
@@ -39,12 +42,26 @@ func main() {
 	switch command {
 	case "snapshots":
 		handleSnapshots(ctx, cfg)
+	case "db":
+		handleDB(ctx, cfg)
 	case "findings":
 		handleFindings(ctx, cfg)
 	case "graph":
 		handleGraph(ctx, cfg)
 	case "attack-path":
 		handleAttackPath(ctx, cfg)
+	case "blast-radius":
+		handleBlastRadius(ctx, cfg)
+	case "who-can-access":
+		handleWhoCanAccess(ctx, cfg)
+	case "choke-points":
+		handleChokePoints(ctx, cfg)
+	case "role-chains":
+		handleRoleChains(ctx, cfg)
+	case "query":
+		handleQuery(ctx, cfg)
+	case "analyze":
+		handleAnalyze(ctx, cfg)
 	case "recommend":
 		handleRecommend(ctx, cfg)
 	default:
@@ -60,23 +77,35 @@ func printUsage() {
 Usage:
   accessgraph-cli snapshots ls
   accessgraph-cli snapshots diff --a <idA> --b <idB>
+  accessgraph-cli snapshots report --snapshot <id> [--format table|json]
+  accessgraph-cli snapshots rm --snapshot <id> [--vacuum]
+  accessgraph-cli snapshots label --snapshot <id> --label <label>
+  accessgraph-cli snapshots prune [--keep-last N] [--keep-daily-days D] [--dry-run] [--no-vacuum]
+  accessgraph-cli db status [--format table|json]
+  accessgraph-cli db migrate
   accessgraph-cli findings --snapshot <id> [--format table|json]
-  accessgraph-cli graph path --from <principalID> --to <resourceID>
+  accessgraph-cli graph path --from <principalID> --to <resourceID> [--allow-edges K1,K2] [--deny-edges K3]
   accessgraph-cli graph export --snapshot <id> --format cypher --out <file>
-  accessgraph-cli attack-path --from <id> [--to <id>] [--tag sensitive] [--max-hops 8] [--out path.md] [--sarif findings.sarif]
+  accessgraph-cli attack-path --from <id> [--to <id>] [--tag sensitive] [--max-hops 8] [--k 1] [--all] [--allow-edges K1,K2] [--deny-edges K3] [--weights weights.yaml] [--out path.md] [--sarif findings.sarif]
+  accessgraph-cli blast-radius --from <principalID> [--max-hops 8] [--format table|json] [--allow-edges K1,K2] [--deny-edges K3] [--out blast.md]
+  accessgraph-cli who-can-access --resource <resourceID> [--max-hops 8] [--format table|json] [--allow-edges K1,K2] [--deny-edges K3] [--weights weights.yaml] [--out review.md] [--sarif review.sarif]
+  accessgraph-cli choke-points [--max-hops 8] [--top 20] [--path-limit 100] [--format table|json] [--allow-edges K1,K2] [--deny-edges K3]
+  accessgraph-cli role-chains [--from <principalID>] [--max-depth 8] [--limit 100] [--format table|json]
+  accessgraph-cli query [--format table|json] '<MATCH ... RETURN ... [LIMIT n]>'
+  accessgraph-cli analyze [--top 10] [--format table|json] [--allow-edges K1,K2] [--deny-edges K3]
   accessgraph-cli recommend --snapshot <id> --policy <policyId> [--target <id>] [--tag sensitive] [--cap 20] [--out reco.json]
 `)
 }
 
 func handleSnapshots(ctx context.Context, cfg *config.Config) {
 	if len(os.Args) < 3 {
-		fmt.Println("Usage: accessgraph-cli snapshots <ls|diff>")
+		fmt.Println("Usage: accessgraph-cli snapshots <ls|diff|report|rm|label|prune>")
 		os.Exit(1)
 	}
 
 	subcommand := os.Args[2]
 
-	st, err := store.New(cfg.SQLitePath)
+	st, err := store.New(cfg.DatabaseURL)
 	if err != nil {
 		log.Fatalf("Failed to open store: %v", err)
 	}
@@ -180,6 +209,191 @@ func handleSnapshots(ctx context.Context, cfg *config.Config) {
 			}
 		}
 
+	case "report":
+		fs := flag.NewFlagSet("report", flag.ExitOnError)
+		snapshotID := fs.String("snapshot", "", "Snapshot ID")
+		format := fs.String("format", "table", "Output format (table|json)")
+		if err := fs.Parse(os.Args[3:]); err != nil {
+			log.Fatalf("Failed to parse flags: %v", err)
+		}
+
+		if *snapshotID == "" {
+			fmt.Println("Usage: accessgraph-cli snapshots report --snapshot <id> [--format table|json]")
+			os.Exit(1)
+		}
+
+		report, err := st.GetReport(ctx, *snapshotID)
+		if err != nil {
+			log.Fatalf("Failed to get validation report for %s: %v", *snapshotID, err)
+		}
+
+		if *format == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(report); err != nil {
+				log.Fatalf("Failed to encode report: %v", err)
+			}
+			return
+		}
+
+		fmt.Printf("Validation report for %s: %s\n\n", *snapshotID, report.Summary())
+		if report.Empty() {
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KIND\tENTITY\tMESSAGE\tSOURCE")
+		for _, issue := range report.Issues {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", issue.Kind, issue.EntityID, issue.Message, issue.Provenance)
+		}
+		w.Flush()
+
+	case "rm":
+		fs := flag.NewFlagSet("rm", flag.ExitOnError)
+		snapshotID := fs.String("snapshot", "", "Snapshot ID")
+		vacuum := fs.Bool("vacuum", false, "Return freed space to the file system")
+		if err := fs.Parse(os.Args[3:]); err != nil {
+			log.Fatalf("Failed to parse flags: %v", err)
+		}
+
+		if *snapshotID == "" {
+			fmt.Println("Usage: accessgraph-cli snapshots rm --snapshot <id> [--vacuum]")
+			os.Exit(1)
+		}
+
+		if err := st.DeleteSnapshot(ctx, *snapshotID); err != nil {
+			log.Fatalf("Failed to delete snapshot: %v", err)
+		}
+		fmt.Printf("Deleted snapshot %s\n", *snapshotID)
+
+		if *vacuum {
+			if err := st.Vacuum(ctx); err != nil {
+				log.Fatalf("Failed to vacuum: %v", err)
+			}
+		}
+
+	case "label":
+		fs := flag.NewFlagSet("label", flag.ExitOnError)
+		snapshotID := fs.String("snapshot", "", "Snapshot ID")
+		label := fs.String("label", "", "New label")
+		if err := fs.Parse(os.Args[3:]); err != nil {
+			log.Fatalf("Failed to parse flags: %v", err)
+		}
+
+		if *snapshotID == "" || *label == "" {
+			fmt.Println("Usage: accessgraph-cli snapshots label --snapshot <id> --label <label>")
+			os.Exit(1)
+		}
+
+		if err := st.UpdateLabel(ctx, *snapshotID, *label); err != nil {
+			log.Fatalf("Failed to update label: %v", err)
+		}
+		fmt.Printf("Labeled snapshot %s: %s\n", *snapshotID, *label)
+
+	case "prune":
+		fs := flag.NewFlagSet("prune", flag.ExitOnError)
+		keepLast := fs.Int("keep-last", 0, "Keep the N most recent snapshots")
+		keepDaily := fs.Int("keep-daily-days", 0, "Keep the most recent snapshot of each of the last D days")
+		dryRun := fs.Bool("dry-run", false, "List the snapshots that would be deleted without deleting them")
+		noVacuum := fs.Bool("no-vacuum", false, "Skip returning freed space to the file system")
+		if err := fs.Parse(os.Args[3:]); err != nil {
+			log.Fatalf("Failed to parse flags: %v", err)
+		}
+
+		if *keepLast <= 0 && *keepDaily <= 0 {
+			fmt.Println("Usage: accessgraph-cli snapshots prune [--keep-last N] [--keep-daily-days D] [--dry-run] [--no-vacuum]")
+			os.Exit(1)
+		}
+
+		policy := store.RetentionPolicy{KeepLast: *keepLast, KeepDailyDays: *keepDaily}
+		expired, err := st.PruneSnapshots(ctx, policy, *dryRun)
+		if err != nil {
+			log.Fatalf("Failed to prune snapshots: %v", err)
+		}
+
+		verb := "Deleted"
+		if *dryRun {
+			verb = "Would delete"
+		}
+		fmt.Printf("%s %d snapshots\n", verb, len(expired))
+		for _, snap := range expired {
+			fmt.Printf("  - %s (%s)\n", snap.ID, snap.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+
+		if !*dryRun && !*noVacuum && len(expired) > 0 {
+			if err := st.Vacuum(ctx); err != nil {
+				log.Fatalf("Failed to vacuum: %v", err)
+			}
+		}
+
+	default:
+		fmt.Printf("Unknown subcommand: %s\n", subcommand)
+		os.Exit(1)
+	}
+}
+
+func handleDB(ctx context.Context, cfg *config.Config) {
+	if len(os.Args) < 3 {
+		fmt.Println("Usage: accessgraph-cli db <status|migrate>")
+		os.Exit(1)
+	}
+
+	subcommand := os.Args[2]
+
+	// Open rather than New, so that status shows pending migrations before
+	// they are applied
+	st, err := store.Open(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to open store: %v", err)
+	}
+	defer st.Close()
+
+	switch subcommand {
+	case "status":
+		fs := flag.NewFlagSet("status", flag.ExitOnError)
+		format := fs.String("format", "table", "Output format (table|json)")
+		if err := fs.Parse(os.Args[3:]); err != nil {
+			log.Fatalf("Failed to parse flags: %v", err)
+		}
+
+		status, err := st.SchemaStatus(ctx)
+		if err != nil {
+			log.Fatalf("Failed to get schema status: %v", err)
+		}
+
+		if *format == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(status); err != nil {
+				log.Fatalf("Failed to encode schema status: %v", err)
+			}
+			return
+		}
+
+		fmt.Printf("Schema version %d of %d (%d pending)\n\n", status.Version, status.Latest, len(status.Pending))
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, m := range status.Applied {
+			fmt.Fprintf(w, "%d\t%s\t%s\n", m.Version, m.Name, m.AppliedAt.Format("2006-01-02 15:04:05"))
+		}
+		for _, m := range status.Pending {
+			fmt.Fprintf(w, "%d\t%s\tpending\n", m.Version, m.Name)
+		}
+		w.Flush()
+
+	case "migrate":
+		applied, err := st.Migrate(ctx)
+		for _, m := range applied {
+			fmt.Printf("Applied migration %d: %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if len(applied) == 0 {
+			fmt.Printf("Schema is up to date (version %d)\n", st.LatestVersion())
+		}
+
 	default:
 		fmt.Printf("Unknown subcommand: %s\n", subcommand)
 		os.Exit(1)
@@ -199,7 +413,7 @@ func handleFindings(ctx context.Context, cfg *config.Config) {
 		os.Exit(1)
 	}
 
-	st, err := store.New(cfg.SQLitePath)
+	st, err := store.New(cfg.DatabaseURL)
 	if err != nil {
 		log.Fatalf("Failed to open store: %v", err)
 	}
@@ -258,16 +472,17 @@ func handleGraphPath(ctx context.Context, cfg *config.Config) {
 	fs := flag.NewFlagSet("path", flag.ExitOnError)
 	from := fs.String("from", "", "Source node ID")
 	to := fs.String("to", "", "Destination node ID")
+	edgeFilter := edgeFilterFlags(fs)
 	if err := fs.Parse(os.Args[3:]); err != nil {
 		log.Fatalf("Failed to parse flags: %v", err)
 	}
 
 	if *from == "" || *to == "" {
-		fmt.Println("Usage: accessgraph-cli graph path --from <principalID> --to <resourceID>")
+		fmt.Println("Usage: accessgraph-cli graph path --from <principalID> --to <resourceID> [--allow-edges K1,K2] [--deny-edges K3]")
 		os.Exit(1)
 	}
 
-	st, err := store.New(cfg.SQLitePath)
+	st, err := store.New(cfg.DatabaseURL)
 	if err != nil {
 		log.Fatalf("Failed to open store: %v", err)
 	}
@@ -289,7 +504,7 @@ func handleGraphPath(ctx context.Context, cfg *config.Config) {
 		log.Fatalf("Failed to load snapshot: %v", err)
 	}
 
-	nodes, edges, err := g.ShortestPath(*from, *to, defaultMaxHops)
+	nodes, edges, err := g.ShortestPath(*from, *to, defaultMaxHops, edgeFilter())
 	if err != nil {
 		log.Fatalf("Failed to find path: %v", err)
 	}
@@ -299,7 +514,7 @@ func handleGraphPath(ctx context.Context, cfg *config.Config) {
 	for i, node := range nodes {
 		fmt.Printf("%d. %s [%s]\n", i+1, node.ID, node.Kind)
 		if i < len(edges) {
-			fmt.Printf("   --[%s]-->\n", edges[i].Kind)
+			fmt.Printf("   --[%s]-->\n", edgeLabel(edges[i]))
 		}
 	}
 }
@@ -318,7 +533,7 @@ func handleGraphExport(ctx context.Context, cfg *config.Config) {
 		os.Exit(1)
 	}
 
-	st, err := store.New(cfg.SQLitePath)
+	st, err := store.New(cfg.DatabaseURL)
 	if err != nil {
 		log.Fatalf("Failed to open store: %v", err)
 	}
@@ -357,16 +572,20 @@ func handleAttackPath(ctx context.Context, cfg *config.Config) {
 	outMD := fs.String("out", "", "Output Markdown file")
 	outSARIF := fs.String("sarif", "", "Output SARIF file")
 	formatFlag := fs.String("format", "table", "Output format (table|json)")
+	weightsPath := fs.String("weights", cfg.AttackWeightsPath, "YAML file of attack path weights (default: built-in)")
+	k := fs.Int("k", 0, "Number of alternative paths, cheapest first (default 1; with --all, the path limit, default 100)")
+	all := fs.Bool("all", false, "Enumerate all simple paths within --max-hops")
+	edgeFilter := edgeFilterFlags(fs)
 	if err := fs.Parse(os.Args[2:]); err != nil {
 		log.Fatalf("Failed to parse flags: %v", err)
 	}
 
 	if *from == "" {
-		fmt.Println("Usage: accessgraph-cli attack-path --from <id> [--to <id>] [--tag sensitive] [--max-hops 8] [--out path.md] [--sarif findings.sarif]")
+		fmt.Println("Usage: accessgraph-cli attack-path --from <id> [--to <id>] [--tag sensitive] [--max-hops 8] [--k 1] [--all] [--allow-edges K1,K2] [--deny-edges K3] [--weights weights.yaml] [--out path.md] [--sarif findings.sarif]")
 		os.Exit(1)
 	}
 
-	st, err := store.New(cfg.SQLitePath)
+	st, err := store.New(cfg.DatabaseURL)
 	if err != nil {
 		log.Fatalf("Failed to open store: %v", err)
 	}
@@ -388,53 +607,88 @@ func handleAttackPath(ctx context.Context, cfg *config.Config) {
 		log.Fatalf("Failed to load snapshot: %v", err)
 	}
 
+	if *weightsPath != "" {
+		weights, err := graph.LoadWeights(*weightsPath)
+		if err != nil {
+			log.Fatalf("Failed to load weights: %v", err)
+		}
+		if err := g.SetWeights(weights); err != nil {
+			log.Fatalf("Failed to set weights: %v", err)
+		}
+	}
+
 	// Build tags
 	tags := []string{}
 	if *tag != "" {
 		tags = append(tags, *tag)
 	}
 
-	// Find attack path
-	result, err := g.FindAttackPath(*from, *to, tags, *maxHops)
+	// Find attack paths
+	var results []*graph.AttackPathResult
+	switch {
+	case *all:
+		results, err = g.AllAttackPaths(*from, *to, tags, *maxHops, *k, edgeFilter())
+	case *k > 1:
+		results, err = g.FindAttackPaths(*from, *to, tags, *k, *maxHops, edgeFilter())
+	default:
+		var result *graph.AttackPathResult
+		result, err = g.FindAttackPath(*from, *to, tags, *maxHops, edgeFilter())
+		if err == nil && result.Found {
+			results = []*graph.AttackPathResult{result}
+		}
+	}
 	if err != nil {
 		log.Fatalf("Failed to find attack path: %v", err)
 	}
 
-	if !result.Found {
+	if len(results) == 0 {
 		fmt.Println("No attack path found")
 		os.Exit(0)
 	}
+	result := results[0]
 
-	// Determine effective target ID (from flag or last node in path)
+	// Determine effective target ID (from flag or last node in the best path)
 	targetID := *to
 	if targetID == "" && len(result.Nodes) > 0 {
 		targetID = result.Nodes[len(result.Nodes)-1].ID
 	}
 
-	// Display path
+	// Display paths; a single path keeps the original output shape
 	if *formatFlag == "json" {
+		out := make([]map[string]interface{}, len(results))
+		for i, r := range results {
+			out[i] = map[string]interface{}{
+				"found":      r.Found,
+				"nodes":      r.Nodes,
+				"edges":      r.Edges,
+				"hops":       len(r.Nodes) - 1,
+				"cost":       r.Cost,
+				"likelihood": r.Likelihood,
+			}
+		}
+
 		enc := json.NewEncoder(os.Stdout)
 		enc.SetIndent("", "  ")
-		if err := enc.Encode(map[string]interface{}{
-			"found": result.Found,
-			"nodes": result.Nodes,
-			"edges": result.Edges,
-			"hops":  len(result.Nodes) - 1,
-		}); err != nil {
+		var v interface{} = out
+		if len(out) == 1 && !*all && *k <= 1 {
+			v = out[0]
+		}
+		if err := enc.Encode(v); err != nil {
 			log.Fatalf("Failed to encode output: %v", err)
 		}
 	} else {
-		fmt.Printf("Attack Path: %s → %s (hops: %d)\n\n", *from, targetID, len(result.Nodes)-1)
-
-		for i, node := range result.Nodes {
-			fmt.Printf("%d. %s [%s]\n", i+1, node.ID, node.Kind)
-			if i < len(result.Edges) {
-				fmt.Printf("   --[%s]-->\n", result.Edges[i].Kind)
+		for i, r := range results {
+			if len(results) > 1 {
+				fmt.Printf("Path %d of %d\n", i+1, len(results))
+			}
+			printAttackPath(*from, r)
+			if i < len(results)-1 {
+				fmt.Println()
 			}
 		}
 	}
 
-	// Export to Markdown if requested
+	// Export the best path to Markdown if requested
 	if *outMD != "" {
 		markdown, err := graph.ExportMarkdownAttackPath(*from, targetID, result.Nodes, result.Edges)
 		if err != nil {
@@ -448,7 +702,7 @@ func handleAttackPath(ctx context.Context, cfg *config.Config) {
 		fmt.Printf("\nMarkdown report saved to: %s\n", *outMD)
 	}
 
-	// Export to SARIF if requested
+	// Export the best path to SARIF if requested
 	if *outSARIF != "" {
 		sarif, err := graph.ExportSARIFAttackPath(*from, targetID, result.Nodes, result.Edges)
 		if err != nil {
@@ -463,6 +717,554 @@ func handleAttackPath(ctx context.Context, cfg *config.Config) {
 	}
 }
 
+func handleBlastRadius(ctx context.Context, cfg *config.Config) {
+	fs := flag.NewFlagSet("blast-radius", flag.ExitOnError)
+	from := fs.String("from", "", "Principal ID")
+	maxHops := fs.Int("max-hops", defaultMaxHops, "Maximum hops")
+	outMD := fs.String("out", "", "Output Markdown file")
+	formatFlag := fs.String("format", "table", "Output format (table|json)")
+	edgeFilter := edgeFilterFlags(fs)
+	if err := fs.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	if *from == "" {
+		fmt.Println("Usage: accessgraph-cli blast-radius --from <principalID> [--max-hops 8] [--format table|json] [--allow-edges K1,K2] [--deny-edges K3] [--out blast.md]")
+		os.Exit(1)
+	}
+
+	st, err := store.New(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to open store: %v", err)
+	}
+	defer st.Close()
+
+	// Get most recent snapshot
+	snapshots, err := st.ListSnapshots(ctx)
+	if err != nil {
+		log.Fatalf("Failed to list snapshots: %v", err)
+	}
+	if len(snapshots) == 0 {
+		log.Fatal("No snapshots found")
+	}
+
+	g, err := st.LoadSnapshot(ctx, snapshots[0].ID)
+	if err != nil {
+		log.Fatalf("Failed to load snapshot: %v", err)
+	}
+
+	br, err := g.BlastRadius(*from, *maxHops, edgeFilter())
+	if err != nil {
+		log.Fatalf("Failed to compute blast radius: %v", err)
+	}
+
+	if *formatFlag == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(br); err != nil {
+			log.Fatalf("Failed to encode output: %v", err)
+		}
+	} else {
+		fmt.Printf("Blast Radius: %s (%d resources, %d sensitive, max hops: %d)\n\n",
+			br.Principal, len(br.Resources), br.Sensitive, br.MaxHops)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TYPE\tRESOURCES\tSENSITIVE")
+		for _, summary := range br.ByType {
+			fmt.Fprintf(w, "%s\t%d\t%d\n", summary.Type, summary.Resources, summary.Sensitive)
+		}
+		w.Flush()
+		fmt.Println()
+
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "RESOURCE\tTYPE\tHOPS\tSENSITIVE\tACTIONS")
+		for _, res := range br.Resources {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%t\t%s\n",
+				res.Node.ID, res.Type, res.Hops, res.Sensitive, strings.Join(res.Actions, ","))
+		}
+		w.Flush()
+	}
+
+	if *outMD != "" {
+		markdown, err := graph.ExportMarkdownBlastRadius(br)
+		if err != nil {
+			log.Fatalf("Failed to export Markdown: %v", err)
+		}
+
+		if err := os.WriteFile(*outMD, []byte(markdown), 0o600); err != nil {
+			log.Fatalf("Failed to write Markdown file: %v", err)
+		}
+
+		fmt.Printf("\nMarkdown report saved to: %s\n", *outMD)
+	}
+}
+
+func handleWhoCanAccess(ctx context.Context, cfg *config.Config) {
+	fs := flag.NewFlagSet("who-can-access", flag.ExitOnError)
+	resource := fs.String("resource", "", "Resource ID")
+	maxHops := fs.Int("max-hops", defaultMaxHops, "Maximum hops")
+	outMD := fs.String("out", "", "Output Markdown file")
+	outSARIF := fs.String("sarif", "", "Output SARIF file")
+	formatFlag := fs.String("format", "table", "Output format (table|json)")
+	weightsPath := fs.String("weights", cfg.AttackWeightsPath, "YAML file of attack path weights (default: built-in)")
+	edgeFilter := edgeFilterFlags(fs)
+	if err := fs.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	if *resource == "" {
+		fmt.Println("Usage: accessgraph-cli who-can-access --resource <resourceID> [--max-hops 8] [--format table|json] [--allow-edges K1,K2] [--deny-edges K3] [--weights weights.yaml] [--out review.md] [--sarif review.sarif]")
+		os.Exit(1)
+	}
+
+	st, err := store.New(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to open store: %v", err)
+	}
+	defer st.Close()
+
+	// Get most recent snapshot
+	snapshots, err := st.ListSnapshots(ctx)
+	if err != nil {
+		log.Fatalf("Failed to list snapshots: %v", err)
+	}
+	if len(snapshots) == 0 {
+		log.Fatal("No snapshots found")
+	}
+
+	g, err := st.LoadSnapshot(ctx, snapshots[0].ID)
+	if err != nil {
+		log.Fatalf("Failed to load snapshot: %v", err)
+	}
+
+	if *weightsPath != "" {
+		weights, err := graph.LoadWeights(*weightsPath)
+		if err != nil {
+			log.Fatalf("Failed to load weights: %v", err)
+		}
+		if err := g.SetWeights(weights); err != nil {
+			log.Fatalf("Failed to set weights: %v", err)
+		}
+	}
+
+	access, err := g.WhoCanAccess(*resource, *maxHops, edgeFilter())
+	if err != nil {
+		log.Fatalf("Failed to compute access: %v", err)
+	}
+
+	if *formatFlag == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(access); err != nil {
+			log.Fatalf("Failed to encode output: %v", err)
+		}
+	} else {
+		fmt.Printf("Who Can Access: %s (%d principals, max hops: %d)\n\n",
+			access.Resource.ID, len(access.Principals), access.MaxHops)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PRINCIPAL\tHOPS\tCOST\tLIKELIHOOD\tACTIONS")
+		for _, p := range access.Principals {
+			fmt.Fprintf(w, "%s\t%d\t%.2f\t%.2f\t%s\n",
+				p.Node.ID, p.Hops, p.Path.Cost, p.Path.Likelihood, strings.Join(p.Actions, ","))
+		}
+		w.Flush()
+	}
+
+	if *outMD != "" {
+		markdown, err := graph.ExportMarkdownResourceAccess(access)
+		if err != nil {
+			log.Fatalf("Failed to export Markdown: %v", err)
+		}
+
+		if err := os.WriteFile(*outMD, []byte(markdown), 0o600); err != nil {
+			log.Fatalf("Failed to write Markdown file: %v", err)
+		}
+
+		fmt.Printf("\nMarkdown report saved to: %s\n", *outMD)
+	}
+
+	if *outSARIF != "" {
+		sarif, err := graph.ExportSARIFResourceAccess(access)
+		if err != nil {
+			log.Fatalf("Failed to export SARIF: %v", err)
+		}
+
+		if err := os.WriteFile(*outSARIF, []byte(sarif), 0o600); err != nil {
+			log.Fatalf("Failed to write SARIF file: %v", err)
+		}
+
+		fmt.Printf("SARIF report saved to: %s\n", *outSARIF)
+	}
+}
+
+func handleChokePoints(ctx context.Context, cfg *config.Config) {
+	fs := flag.NewFlagSet("choke-points", flag.ExitOnError)
+	maxHops := fs.Int("max-hops", defaultMaxHops, "Maximum hops")
+	top := fs.Int("top", graph.DefaultChokePoints, "Maximum choke points to list")
+	pathLimit := fs.Int("path-limit", graph.DefaultPathLimit, "Maximum attack paths to enumerate per principal")
+	formatFlag := fs.String("format", "table", "Output format (table|json)")
+	edgeFilter := edgeFilterFlags(fs)
+	if err := fs.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	if fs.NArg() > 0 {
+		fmt.Println("Usage: accessgraph-cli choke-points [--max-hops 8] [--top 20] [--path-limit 100] [--format table|json] [--allow-edges K1,K2] [--deny-edges K3]")
+		os.Exit(1)
+	}
+
+	st, err := store.New(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to open store: %v", err)
+	}
+	defer st.Close()
+
+	// Get most recent snapshot
+	snapshots, err := st.ListSnapshots(ctx)
+	if err != nil {
+		log.Fatalf("Failed to list snapshots: %v", err)
+	}
+	if len(snapshots) == 0 {
+		log.Fatal("No snapshots found")
+	}
+
+	g, err := st.LoadSnapshot(ctx, snapshots[0].ID)
+	if err != nil {
+		log.Fatalf("Failed to load snapshot: %v", err)
+	}
+
+	analysis, err := g.ChokePoints(*maxHops, *pathLimit, edgeFilter())
+	if err != nil {
+		log.Fatalf("Failed to compute choke points: %v", err)
+	}
+	if *top > 0 && len(analysis.ChokePoints) > *top {
+		analysis.ChokePoints = analysis.ChokePoints[:*top]
+	}
+
+	if *formatFlag == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(analysis); err != nil {
+			log.Fatalf("Failed to encode output: %v", err)
+		}
+		return
+	}
+
+	fmt.Printf("Choke Points: %d principal → sensitive resource pairs, %d attack paths (max hops: %d)\n",
+		analysis.Pairs, analysis.Paths, analysis.MaxHops)
+	if analysis.Truncated {
+		fmt.Println("Path enumeration hit --path-limit; counts are lower bounds")
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RANK\tPAIRS CUT\tPATHS\tKIND\tREMEDIATION")
+	for i, point := range analysis.ChokePoints {
+		kind := point.Kind
+		if point.Node != nil {
+			kind = string(point.Node.Kind)
+		}
+		if point.Edge != nil {
+			kind = point.Edge.Kind
+		}
+		fmt.Fprintf(w, "%d\t%d\t%d\t%s\t%s\n", i+1, point.PairsCut, point.Paths, kind, point.Remediation)
+	}
+	w.Flush()
+}
+
+func handleRoleChains(ctx context.Context, cfg *config.Config) {
+	fs := flag.NewFlagSet("role-chains", flag.ExitOnError)
+	from := fs.String("from", "", "Principal ID (default: every principal)")
+	maxDepth := fs.Int("max-depth", defaultMaxHops, "Maximum role assumptions per chain")
+	limit := fs.Int("limit", graph.DefaultPathLimit, "Maximum chains to list")
+	formatFlag := fs.String("format", "table", "Output format (table|json)")
+	if err := fs.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	if fs.NArg() > 0 {
+		fmt.Println("Usage: accessgraph-cli role-chains [--from <principalID>] [--max-depth 8] [--limit 100] [--format table|json]")
+		os.Exit(1)
+	}
+
+	st, err := store.New(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to open store: %v", err)
+	}
+	defer st.Close()
+
+	// Get most recent snapshot
+	snapshots, err := st.ListSnapshots(ctx)
+	if err != nil {
+		log.Fatalf("Failed to list snapshots: %v", err)
+	}
+	if len(snapshots) == 0 {
+		log.Fatal("No snapshots found")
+	}
+
+	g, err := st.LoadSnapshot(ctx, snapshots[0].ID)
+	if err != nil {
+		log.Fatalf("Failed to load snapshot: %v", err)
+	}
+
+	chains, err := g.RoleChains(*from, *maxDepth, *limit)
+	if err != nil {
+		log.Fatalf("Failed to compute role chains: %v", err)
+	}
+
+	if *formatFlag == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(chains); err != nil {
+			log.Fatalf("Failed to encode output: %v", err)
+		}
+		return
+	}
+
+	fmt.Printf("Role Chains: %d (max depth: %d)\n", len(chains), *maxDepth)
+	fmt.Println("Assumptions marked * use role session credentials and are capped at a one-hour session")
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PRINCIPAL\tDEPTH\tSESSION\tCHAIN")
+	for _, chain := range chains {
+		roles := make([]string, len(chain.Steps))
+		for i, step := range chain.Steps {
+			roles[i] = step.Role
+			if step.Chained {
+				roles[i] += "*"
+			}
+		}
+		last := chain.Steps[len(chain.Steps)-1]
+		session := time.Duration(last.MaxSessionSeconds) * time.Second
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", chain.Principal, chain.Depth, session, strings.Join(roles, " → "))
+	}
+	w.Flush()
+}
+
+func handleQuery(ctx context.Context, cfg *config.Config) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	formatFlag := fs.String("format", "table", "Output format (table|json)")
+	if err := fs.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	if fs.NArg() == 0 {
+		fmt.Println("Usage: accessgraph-cli query [--format table|json] '<MATCH ... RETURN ... [LIMIT n]>'")
+		os.Exit(1)
+	}
+
+	st, err := store.New(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to open store: %v", err)
+	}
+	defer st.Close()
+
+	// Get most recent snapshot
+	snapshots, err := st.ListSnapshots(ctx)
+	if err != nil {
+		log.Fatalf("Failed to list snapshots: %v", err)
+	}
+	if len(snapshots) == 0 {
+		log.Fatal("No snapshots found")
+	}
+
+	g, err := st.LoadSnapshot(ctx, snapshots[0].ID)
+	if err != nil {
+		log.Fatalf("Failed to load snapshot: %v", err)
+	}
+
+	result, err := g.Query(ctx, strings.Join(fs.Args(), " "))
+	if err != nil {
+		log.Fatalf("Query failed: %v", err)
+	}
+
+	if *formatFlag == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			log.Fatalf("Failed to encode output: %v", err)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(result.Columns, "\t"))
+	for _, row := range result.Rows {
+		cells := make([]string, len(row))
+		for i, v := range row {
+			cells[i] = queryCell(v)
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	w.Flush()
+
+	fmt.Printf("\nRows: %d", len(result.Rows))
+	if result.Truncated {
+		fmt.Print(" (truncated at LIMIT or the expansion budget)")
+	}
+	fmt.Println()
+}
+
+// queryCell renders a query value: nodes by ID, relationships as chains of
+// edges and absent properties as null
+func queryCell(v graph.QueryValue) string {
+	switch v.Kind {
+	case graph.QueryValueNode:
+		return v.Node.ID
+	case graph.QueryValueValue:
+		if v.Value == nil {
+			return "null"
+		}
+		return *v.Value
+	}
+
+	if len(v.Edges) == 0 {
+		return "[]"
+	}
+	// Edges walked against their direction start a new segment
+	var sb strings.Builder
+	for i, edge := range v.Edges {
+		if i == 0 || edge.Src != v.Edges[i-1].Dst {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(edge.Src)
+		}
+		fmt.Fprintf(&sb, " -[%s]-> %s", edgeLabel(edge), edge.Dst)
+	}
+	return sb.String()
+}
+
+// printAttackPath prints one attack path as a numbered list of nodes
+func handleAnalyze(ctx context.Context, cfg *config.Config) {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	top := fs.Int("top", graph.DefaultAnalysisTop, "Maximum entries per ranking and islands to list")
+	formatFlag := fs.String("format", "table", "Output format (table|json)")
+	edgeFilter := edgeFilterFlags(fs)
+	if err := fs.Parse(os.Args[2:]); err != nil {
+		log.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	if fs.NArg() > 0 {
+		fmt.Println("Usage: accessgraph-cli analyze [--top 10] [--format table|json] [--allow-edges K1,K2] [--deny-edges K3]")
+		os.Exit(1)
+	}
+
+	st, err := store.New(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to open store: %v", err)
+	}
+	defer st.Close()
+
+	// Get most recent snapshot
+	snapshots, err := st.ListSnapshots(ctx)
+	if err != nil {
+		log.Fatalf("Failed to list snapshots: %v", err)
+	}
+	if len(snapshots) == 0 {
+		log.Fatal("No snapshots found")
+	}
+
+	g, err := st.LoadSnapshot(ctx, snapshots[0].ID)
+	if err != nil {
+		log.Fatalf("Failed to load snapshot: %v", err)
+	}
+
+	report, err := st.GetReport(ctx, snapshots[0].ID)
+	if err != nil {
+		log.Fatalf("Failed to get validation report: %v", err)
+	}
+
+	analysis := g.Analyze(*top, edgeFilter())
+	analysis.AddReport(report)
+
+	if *formatFlag == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(analysis); err != nil {
+			log.Fatalf("Failed to encode output: %v", err)
+		}
+		return
+	}
+
+	fmt.Printf("Analysis of %s: %d nodes, %d edges, %d components (largest: %d nodes)\n",
+		snapshots[0].ID, analysis.Nodes, analysis.Edges, analysis.Components, analysis.Largest)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	printScores := func(title string, scores []graph.NodeScore) {
+		fmt.Fprintf(w, "\n%s\n", title)
+		fmt.Fprintln(w, "RANK\tSCORE\tKIND\tNODE")
+		for i, s := range scores {
+			fmt.Fprintf(w, "%d\t%.4f\t%s\t%s\n", i+1, s.Score, s.Node.Kind, s.Node.ID)
+		}
+	}
+	printScores("Most powerful principals (PageRank):", analysis.Powerful)
+	printScores("Privilege brokers (betweenness):", analysis.Brokers)
+
+	fmt.Fprintf(w, "\nIsolated islands:\n")
+	fmt.Fprintln(w, "SIZE\tNODES")
+	for _, c := range analysis.Islands {
+		nodes := c.Nodes
+		more := ""
+		if len(nodes) > 3 {
+			nodes, more = nodes[:3], fmt.Sprintf(", ... (%d more)", len(c.Nodes)-3)
+		}
+		fmt.Fprintf(w, "%d\t%s%s\n", c.Size, strings.Join(nodes, ", "), more)
+	}
+
+	fmt.Fprintf(w, "\nOrphaned policies (attached to nothing): %d\n", len(analysis.OrphanedPolicies))
+	for _, n := range analysis.OrphanedPolicies {
+		fmt.Fprintf(w, "  %s\n", n.ID)
+	}
+	fmt.Fprintf(w, "\nUnused roles (no trusted principal or binding): %d\n", len(analysis.UnusedRoles))
+	for _, n := range analysis.UnusedRoles {
+		fmt.Fprintf(w, "  %s\n", n.ID)
+	}
+
+	fmt.Fprintf(w, "\nDangling bindings: %d\n", len(analysis.DanglingBindings))
+	if len(analysis.DanglingBindings) > 0 {
+		fmt.Fprintln(w, "ROLE\tSUBJECT\tREASON\tSOURCE")
+		for _, b := range analysis.DanglingBindings {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", b.Role, b.Subject, b.Reason, b.Source)
+		}
+	}
+	w.Flush()
+}
+
+func printAttackPath(from string, result *graph.AttackPathResult) {
+	targetID := result.Nodes[len(result.Nodes)-1].ID
+	fmt.Printf("Attack Path: %s → %s (hops: %d, cost: %.2f, likelihood: %.2f)\n\n",
+		from, targetID, len(result.Nodes)-1, result.Cost, result.Likelihood)
+
+	for i, node := range result.Nodes {
+		fmt.Printf("%d. %s [%s]\n", i+1, node.ID, node.Kind)
+		if i < len(result.Edges) {
+			if result.Edges[i].Src == node.ID {
+				fmt.Printf("   --[%s]-->\n", edgeLabel(result.Edges[i]))
+			} else {
+				// Reverse edge, e.g. BINDS_TO from a role to this subject
+				fmt.Printf("   <--[%s]--\n", edgeLabel(result.Edges[i]))
+			}
+		}
+	}
+}
+
+// edgeLabel names an edge's kind, and for escalation edges the techniques
+func edgeLabel(edge ingest.Edge) string {
+	techniques := graph.EdgeTechniques(edge)
+	if len(techniques) == 0 {
+		return edge.Kind
+	}
+
+	names := make([]string, len(techniques))
+	for i, technique := range techniques {
+		names[i] = technique.ID
+	}
+	return fmt.Sprintf("%s: %s", edge.Kind, strings.Join(names, ", "))
+}
+
 func handleRecommend(ctx context.Context, cfg *config.Config) {
 	fs := flag.NewFlagSet("recommend", flag.ExitOnError)
 	snapshotID := fs.String("snapshot", "", "Snapshot ID")
@@ -481,7 +1283,7 @@ func handleRecommend(ctx context.Context, cfg *config.Config) {
 		os.Exit(1)
 	}
 
-	st, err := store.New(cfg.SQLitePath)
+	st, err := store.New(cfg.DatabaseURL)
 	if err != nil {
 		log.Fatalf("Failed to open store: %v", err)
 	}
@@ -544,3 +1346,24 @@ func handleRecommend(ctx context.Context, cfg *config.Config) {
 		fmt.Printf("JSON Patch:\n%s\n", rec.PatchJSON)
 	}
 }
+
+// edgeFilterFlags registers --allow-edges and --deny-edges on fs and returns
+// a function that builds the filter once fs has been parsed
+func edgeFilterFlags(fs *flag.FlagSet) func() graph.EdgeFilter {
+	allow := fs.String("allow-edges", "", "Comma-separated edge kinds to follow (default: all)")
+	deny := fs.String("deny-edges", "", "Comma-separated edge kinds never to follow")
+	return func() graph.EdgeFilter {
+		return graph.EdgeFilter{Allow: splitList(*allow), Deny: splitList(*deny)}
+	}
+}
+
+// splitList splits a comma-separated flag value, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -2,13 +2,15 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"runtime"
+	"time"
 
 	"github.com/jamesolaitan/accessgraph/internal/config"
-	"github.com/jamesolaitan/accessgraph/internal/graph"
 	"github.com/jamesolaitan/accessgraph/internal/ingest"
 	logpkg "github.com/jamesolaitan/accessgraph/internal/log"
 	"github.com/jamesolaitan/accessgraph/internal/store"
@@ -19,9 +21,15 @@ func main() {
 
 	var (
 		awsDir     = flag.String("aws", "", "Path to AWS JSON directory")
+		awsRoot    = flag.String("aws-accounts", "", "Path to a directory of per-account AWS JSON folders, parsed concurrently")
+		workers    = flag.Int("workers", runtime.NumCPU(), "Number of AWS accounts parsed concurrently with --aws-accounts")
 		k8sDir     = flag.String("k8s", "", "Path to Kubernetes YAML directory")
 		tfPlanPath = flag.String("tf", "", "Path to Terraform plan JSON (optional)")
 		snapshotID = flag.String("snapshot", "", "Snapshot ID (required)")
+		strict     = flag.Bool("strict", false, "Fail ingestion if validation finds any issue")
+		reportPath = flag.String("report", "", "Write the validation report as JSON to this file (optional)")
+		overwrite  = flag.Bool("overwrite", false, "Replace an existing snapshot with the same ID")
+		progress   = flag.Int("progress", 100000, "Log progress every this many nodes and edges written (0 disables)")
 	)
 
 	flag.Parse()
@@ -45,79 +53,127 @@ func main() {
 
 	log.Printf("Starting ingestion for snapshot: %s", logpkg.Redact(*snapshotID))
 
-	// Initialize graph
-	g := graph.New()
+	// The label is decided up front because the snapshot row is written before
+	// parsing starts
+	label := *snapshotID
+	if *tfPlanPath != "" {
+		if _, err := os.Stat(*tfPlanPath); err == nil {
+			label = *snapshotID + "-iac"
+		}
+	}
 
-	var allNodes []ingest.Node
-	var allEdges []ingest.Edge
+	log.Printf("Saving snapshot to: %s", store.Describe(cfg.DatabaseURL))
+	st, err := store.New(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to open store: %v", err)
+	}
+	defer st.Close()
 
-	// Parse AWS if provided
-	if *awsDir != "" {
-		log.Printf("Parsing AWS IAM from: %s", *awsDir)
-		result, err := ingest.ParseAWS(*awsDir)
-		if err != nil {
-			log.Fatalf("Failed to parse AWS: %v", err)
-		}
-		allNodes = append(allNodes, result.Nodes...)
-		allEdges = append(allEdges, result.Edges...)
-		log.Printf("Parsed %d AWS nodes and %d edges", len(result.Nodes), len(result.Edges))
+	ctx := context.Background()
+	begin := st.BeginSnapshot
+	if *overwrite {
+		begin = st.ReplaceSnapshot
 	}
+	w, err := begin(ctx, *snapshotID, label)
+	if err != nil {
+		log.Fatalf("Failed to start snapshot: %v", err)
+	}
+	defer func() { _ = w.Rollback() }()
 
-	// Parse K8s if provided
-	if *k8sDir != "" {
-		log.Printf("Parsing Kubernetes RBAC from: %s", *k8sDir)
-		result, err := ingest.ParseK8s(*k8sDir)
-		if err != nil {
-			log.Fatalf("Failed to parse K8s: %v", err)
-		}
-		allNodes = append(allNodes, result.Nodes...)
-		allEdges = append(allEdges, result.Edges...)
-		log.Printf("Parsed %d K8s nodes and %d edges", len(result.Nodes), len(result.Edges))
+	if *progress > 0 {
+		w.OnProgress(*progress, func(p store.Progress) {
+			log.Printf("Written %d nodes and %d edges in %s", p.Nodes, p.Edges, p.Elapsed.Round(time.Millisecond))
+		})
 	}
 
-	// Parse Terraform if provided
-	label := *snapshotID
-	if *tfPlanPath != "" {
-		log.Printf("Parsing Terraform plan from: %s", *tfPlanPath)
-		result, isTF, err := ingest.ParseTerraform(*tfPlanPath)
-		if err != nil {
-			log.Fatalf("Failed to parse Terraform: %v", err)
+	// Parsers stream into a bounded pipeline that the snapshot writer drains,
+	// so memory stays proportional to the distinct entities rather than the
+	// input size. Nodes seen by several parsers are merged as they are written.
+	produce := func(sink ingest.Sink) error {
+		if *awsDir != "" {
+			log.Printf("Parsing AWS IAM from: %s", *awsDir)
+			if err := ingest.StreamAWS(*awsDir, sink); err != nil {
+				return fmt.Errorf("parsing AWS: %w", err)
+			}
 		}
-		if isTF {
-			allNodes = append(allNodes, result.Nodes...)
-			allEdges = append(allEdges, result.Edges...)
-			label = *snapshotID + "-iac"
-			log.Printf("Parsed %d Terraform nodes and %d edges", len(result.Nodes), len(result.Edges))
+
+		if *awsRoot != "" {
+			log.Printf("Parsing AWS accounts from: %s (%d workers)", *awsRoot, *workers)
+			if err := ingest.StreamAWSAccounts(*awsRoot, *workers, sink); err != nil {
+				return fmt.Errorf("parsing AWS accounts: %w", err)
+			}
+		}
+
+		if *k8sDir != "" {
+			log.Printf("Parsing Kubernetes RBAC from: %s", *k8sDir)
+			if err := ingest.StreamK8s(*k8sDir, sink); err != nil {
+				return fmt.Errorf("parsing K8s: %w", err)
+			}
+		}
+
+		if *tfPlanPath != "" {
+			log.Printf("Parsing Terraform plan from: %s", *tfPlanPath)
+			if _, err := ingest.StreamTerraform(*tfPlanPath, sink); err != nil {
+				return fmt.Errorf("parsing Terraform: %w", err)
+			}
 		}
-	}
 
-	// Build graph
-	log.Println("Building graph...")
-	for _, node := range allNodes {
-		g.AddNode(node)
+		return nil
 	}
 
-	for _, edge := range allEdges {
-		if err := g.AddEdge(edge); err != nil {
-			// Skip edges with missing nodes
-			continue
+	var issues []ingest.Issue
+	consume := func(item ingest.Item) error {
+		switch {
+		case item.Node != nil:
+			return w.AddNode(*item.Node)
+		case item.Edge != nil:
+			return w.AddEdge(*item.Edge)
+		case item.Issue != nil:
+			issues = append(issues, *item.Issue)
 		}
+		return nil
 	}
 
-	log.Printf("Graph built: %d nodes, %d edges", len(allNodes), len(allEdges))
+	if err := ingest.Run(ctx, ingest.DefaultBuffer, produce, consume); err != nil {
+		log.Fatalf("Ingestion failed: %v", err)
+	}
 
-	// Save to SQLite
-	log.Printf("Saving snapshot to: %s", cfg.SQLitePath)
-	st, err := store.New(cfg.SQLitePath)
+	// Dangling edges can only be identified once every node has been written
+	dangling, err := w.DropDanglingEdges()
 	if err != nil {
-		log.Fatalf("Failed to open store: %v", err)
+		log.Fatalf("Failed to check edges: %v", err)
 	}
-	defer st.Close()
 
-	ctx := context.Background()
-	if err := st.SaveSnapshot(ctx, *snapshotID, label, g); err != nil {
+	report := ingest.NewReport(issues, w.Conflicts(), dangling, w.HasNode)
+	log.Printf("Validation: %s", report.Summary())
+	for _, issue := range report.Issues {
+		log.Printf("  %s", issue)
+	}
+
+	if *reportPath != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to marshal validation report: %v", err)
+		}
+		if err := os.WriteFile(*reportPath, data, 0o600); err != nil {
+			log.Fatalf("Failed to write validation report: %v", err)
+		}
+		log.Printf("Validation report saved to: %s", *reportPath)
+	}
+
+	if *strict && !report.Empty() {
+		log.Fatalf("Strict mode: refusing to save snapshot with %s", report.Summary())
+	}
+
+	// The report commits with the snapshot, so a replaced snapshot never
+	// keeps its old report or loses its new one
+	if err := w.SaveReport(report); err != nil {
+		log.Fatalf("Failed to save validation report: %v", err)
+	}
+	if err := w.Commit(); err != nil {
 		log.Fatalf("Failed to save snapshot: %v", err)
 	}
+	log.Printf("Graph saved: %d nodes, %d edges", w.NodeCount(), w.EdgeCount())
 
 	log.Printf("Successfully saved snapshot: %s", *snapshotID)
 }
@@ -2,6 +2,57 @@
 
 package graphql
 
+type Analysis struct {
+	Nodes            int                `json:"nodes"`
+	Edges            int                `json:"edges"`
+	Powerful         []*NodeScore       `json:"powerful"`
+	Brokers          []*NodeScore       `json:"brokers"`
+	Components       int                `json:"components"`
+	Largest          int                `json:"largest"`
+	Islands          []*Component       `json:"islands"`
+	OrphanedPolicies []*Node            `json:"orphanedPolicies"`
+	UnusedRoles      []*Node            `json:"unusedRoles"`
+	DanglingBindings []*DanglingBinding `json:"danglingBindings"`
+}
+
+type BlastRadius struct {
+	Principal string                 `json:"principal"`
+	MaxHops   int                    `json:"maxHops"`
+	Resources []*ReachableResource   `json:"resources"`
+	ByType    []*ResourceTypeSummary `json:"byType"`
+	Sensitive int                    `json:"sensitive"`
+}
+
+type ChokePoint struct {
+	Kind        string `json:"kind"`
+	Node        *Node  `json:"node,omitempty"`
+	Edge        *Edge  `json:"edge,omitempty"`
+	Paths       int    `json:"paths"`
+	PairsCut    int    `json:"pairsCut"`
+	Remediation string `json:"remediation"`
+}
+
+type ChokePointAnalysis struct {
+	MaxHops     int           `json:"maxHops"`
+	Pairs       int           `json:"pairs"`
+	Paths       int           `json:"paths"`
+	Truncated   bool          `json:"truncated"`
+	ChokePoints []*ChokePoint `json:"chokePoints"`
+}
+
+type Component struct {
+	Size  int      `json:"size"`
+	Nodes []string `json:"nodes"`
+}
+
+type DanglingBinding struct {
+	Binding *string `json:"binding,omitempty"`
+	Role    string  `json:"role"`
+	Subject string  `json:"subject"`
+	Reason  string  `json:"reason"`
+	Source  *string `json:"source,omitempty"`
+}
+
 type DiffSummary struct {
 	Added   int `json:"added"`
 	Removed int `json:"removed"`
@@ -9,9 +60,16 @@ type DiffSummary struct {
 }
 
 type Edge struct {
-	From string `json:"from"`
-	To   string `json:"to"`
-	Kind string `json:"kind"`
+	From       string        `json:"from"`
+	To         string        `json:"to"`
+	Kind       string        `json:"kind"`
+	Provenance []*Provenance `json:"provenance"`
+	Technique  *string       `json:"technique,omitempty"`
+}
+
+type EdgeFilter struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
 }
 
 type Export struct {
@@ -41,21 +99,64 @@ type Neighbor struct {
 }
 
 type Node struct {
-	ID        string      `json:"id"`
-	Kind      string      `json:"kind"`
-	Labels    []string    `json:"labels"`
-	Props     []*Kv       `json:"props"`
-	Neighbors []*Neighbor `json:"neighbors"`
+	ID         string        `json:"id"`
+	Kind       string        `json:"kind"`
+	Labels     []string      `json:"labels"`
+	Props      []*Kv         `json:"props"`
+	Provenance []*Provenance `json:"provenance"`
+	Neighbors  []*Neighbor   `json:"neighbors"`
+}
+
+type NodeScore struct {
+	Node  *Node   `json:"node"`
+	Score float64 `json:"score"`
 }
 
 type Path struct {
-	Nodes []*Node `json:"nodes"`
-	Edges []*Edge `json:"edges"`
+	Nodes      []*Node `json:"nodes"`
+	Edges      []*Edge `json:"edges"`
+	Cost       float64 `json:"cost"`
+	Likelihood float64 `json:"likelihood"`
+}
+
+type PrincipalAccess struct {
+	Node    *Node    `json:"node"`
+	Hops    int      `json:"hops"`
+	Actions []string `json:"actions"`
+	Path    *Path    `json:"path"`
+}
+
+type Provenance struct {
+	Source string  `json:"source"`
+	File   *string `json:"file,omitempty"`
+	Path   *string `json:"path,omitempty"`
+	Line   *int    `json:"line,omitempty"`
 }
 
 type Query struct {
 }
 
+type QueryResult struct {
+	Columns   []string        `json:"columns"`
+	Rows      [][]*QueryValue `json:"rows"`
+	Truncated bool            `json:"truncated"`
+}
+
+type QueryValue struct {
+	Kind  string  `json:"kind"`
+	Node  *Node   `json:"node,omitempty"`
+	Edges []*Edge `json:"edges,omitempty"`
+	Value *string `json:"value,omitempty"`
+}
+
+type ReachableResource struct {
+	Node      *Node    `json:"node"`
+	Type      string   `json:"type"`
+	Hops      int      `json:"hops"`
+	Actions   []string `json:"actions"`
+	Sensitive bool     `json:"sensitive"`
+}
+
 type Recommendation struct {
 	PolicyID           string   `json:"policyId"`
 	SuggestedActions   []string `json:"suggestedActions"`
@@ -64,6 +165,31 @@ type Recommendation struct {
 	Rationale          string   `json:"rationale"`
 }
 
+type ResourceAccess struct {
+	Resource   *Node              `json:"resource"`
+	MaxHops    int                `json:"maxHops"`
+	Principals []*PrincipalAccess `json:"principals"`
+}
+
+type ResourceTypeSummary struct {
+	Type      string `json:"type"`
+	Resources int    `json:"resources"`
+	Sensitive int    `json:"sensitive"`
+}
+
+type RoleChain struct {
+	Principal string           `json:"principal"`
+	Depth     int              `json:"depth"`
+	Steps     []*RoleChainStep `json:"steps"`
+}
+
+type RoleChainStep struct {
+	Role              string `json:"role"`
+	Edge              *Edge  `json:"edge"`
+	Chained           bool   `json:"chained"`
+	MaxSessionSeconds int    `json:"maxSessionSeconds"`
+}
+
 type Snapshot struct {
 	ID        string  `json:"id"`
 	CreatedAt string  `json:"createdAt"`
@@ -77,3 +203,17 @@ type SnapshotDiff struct {
 	RemovedEdges []*Edge      `json:"removedEdges"`
 	Summary      *DiffSummary `json:"summary"`
 }
+
+type Subgraph struct {
+	Roots     []string        `json:"roots"`
+	Depth     int             `json:"depth"`
+	Nodes     []*SubgraphNode `json:"nodes"`
+	Edges     []*Edge         `json:"edges"`
+	Truncated bool            `json:"truncated"`
+}
+
+type SubgraphNode struct {
+	Node      *Node `json:"node"`
+	Depth     int   `json:"depth"`
+	Truncated bool  `json:"truncated"`
+}
@@ -2,7 +2,10 @@ package graphql
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
 	lru "github.com/hashicorp/golang-lru/v2"
 	"github.com/jamesolaitan/accessgraph/internal/config"
@@ -17,12 +20,14 @@ import (
 // Defined at the consumer side so the resolver is testable without a real database.
 type DataStore interface {
 	ListSnapshots(ctx context.Context) ([]store.Snapshot, error)
+	GetSnapshot(ctx context.Context, id string) (*store.Snapshot, error)
 	LoadSnapshot(ctx context.Context, id string) (*graph.Graph, error)
 	SearchPrincipals(ctx context.Context, snapshotID, query string, limit int) ([]ingest.Node, error)
 	GetNode(ctx context.Context, snapshotID, nodeID string) (*ingest.Node, error)
 	GetEdges(ctx context.Context, snapshotID string) ([]ingest.Edge, error)
 	CountNodes(ctx context.Context, snapshotID string) (int, error)
 	CountEdges(ctx context.Context, snapshotID string) (int, error)
+	GetReport(ctx context.Context, snapshotID string) (ingest.Report, error)
 }
 
 // PolicyEvaluator defines the policy evaluation operations the resolver depends on.
@@ -36,20 +41,33 @@ type PolicyEvaluator interface {
 const maxCachedGraphs = 16
 
 type graphCache struct {
-	cache *lru.Cache[string, *graph.Graph]
+	cache *lru.Cache[string, cachedGraph]
+}
+
+// cachedGraph is a loaded graph with the creation time of the snapshot it
+// was loaded from, which changes when the snapshot is replaced
+type cachedGraph struct {
+	createdAt time.Time
+	graph     *graph.Graph
 }
 
 func newGraphCache() *graphCache {
-	c, _ := lru.New[string, *graph.Graph](maxCachedGraphs)
+	c, _ := lru.New[string, cachedGraph](maxCachedGraphs)
 	return &graphCache{cache: c}
 }
 
-func (c *graphCache) get(snapshotID string) (*graph.Graph, bool) {
-	return c.cache.Get(snapshotID)
+// get returns the graph cached for snap, if it was loaded from this version
+// of the snapshot
+func (c *graphCache) get(snap *store.Snapshot) (*graph.Graph, bool) {
+	cached, ok := c.cache.Get(snap.ID)
+	if !ok || !cached.createdAt.Equal(snap.CreatedAt) {
+		return nil, false
+	}
+	return cached.graph, true
 }
 
-func (c *graphCache) set(snapshotID string, g *graph.Graph) {
-	c.cache.Add(snapshotID, g)
+func (c *graphCache) set(snap *store.Snapshot, g *graph.Graph) {
+	c.cache.Add(snap.ID, cachedGraph{createdAt: snap.CreatedAt, graph: g})
 }
 
 // Resolver is the root GraphQL resolver
@@ -58,6 +76,7 @@ type Resolver struct {
 	evaluator PolicyEvaluator
 	config    *config.Config
 	cache     *graphCache
+	weights   graph.Weights
 }
 
 // NewResolver creates a new resolver
@@ -67,7 +86,18 @@ func NewResolver(store DataStore, cfg *config.Config) *Resolver {
 		evaluator: policy.NewClient(cfg.OPAUrl),
 		config:    cfg,
 		cache:     newGraphCache(),
+		weights:   graph.DefaultWeights(),
+	}
+}
+
+// SetWeights sets the weights attack paths are priced with. Call it before
+// serving queries, as graphs already cached keep their weights.
+func (r *Resolver) SetWeights(w graph.Weights) error {
+	if err := w.Validate(); err != nil {
+		return err
 	}
+	r.weights = w
+	return nil
 }
 
 // Default values for query parameters
@@ -77,9 +107,20 @@ const (
 	DefaultRecommendCap = 20
 )
 
-// loadGraph loads a graph from cache or store, caching the result.
+// loadGraph loads a graph from cache or store, caching the result. Cached
+// graphs are frozen, as concurrent requests share them; use Update to derive
+// a changed copy. The snapshot row is checked first, as another process may
+// have deleted or replaced the snapshot since it was cached: a deleted
+// snapshot fails with store.ErrSnapshotNotFound, a replaced one is reloaded.
 func (r *Resolver) loadGraph(ctx context.Context, snapshotID string) (*graph.Graph, error) {
-	if g, ok := r.cache.get(snapshotID); ok {
+	snap, err := r.store.GetSnapshot(ctx, snapshotID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", store.ErrSnapshotNotFound, snapshotID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if g, ok := r.cache.get(snap); ok {
 		return g, nil
 	}
 
@@ -87,8 +128,12 @@ func (r *Resolver) loadGraph(ctx context.Context, snapshotID string) (*graph.Gra
 	if err != nil {
 		return nil, err
 	}
+	if err := g.SetWeights(r.weights); err != nil {
+		return nil, err
+	}
+	g.Freeze()
 
-	r.cache.set(snapshotID, g)
+	r.cache.set(snap, g)
 	return g, nil
 }
 
@@ -158,7 +203,7 @@ func (r *queryResolver) Node(ctx context.Context, id string) (*Node, error) {
 		return result, nil // Return node without neighbors on graph load error
 	}
 
-	neighbors, edgeKinds, err := g.GetNeighbors(id, nil)
+	neighbors, err := g.GetNeighbors(id, nil, graph.EdgeFilter{})
 	if err != nil {
 		return result, nil // Return node without neighbors on error
 	}
@@ -166,10 +211,10 @@ func (r *queryResolver) Node(ctx context.Context, id string) (*Node, error) {
 	result.Neighbors = make([]*Neighbor, len(neighbors))
 	for i, neighbor := range neighbors {
 		result.Neighbors[i] = &Neighbor{
-			ID:       neighbor.ID,
-			Kind:     string(neighbor.Kind),
-			Labels:   neighbor.Labels,
-			EdgeKind: edgeKinds[i],
+			ID:       neighbor.Node.ID,
+			Kind:     string(neighbor.Node.Kind),
+			Labels:   neighbor.Node.Labels,
+			EdgeKind: neighbor.Edge.Kind,
 		}
 	}
 
@@ -177,7 +222,7 @@ func (r *queryResolver) Node(ctx context.Context, id string) (*Node, error) {
 }
 
 // ShortestPath finds the shortest path between two nodes
-func (r *queryResolver) ShortestPath(ctx context.Context, from string, to string, maxHops *int) (*Path, error) {
+func (r *queryResolver) ShortestPath(ctx context.Context, from string, to string, maxHops *int, edgeFilter *EdgeFilter) (*Path, error) {
 	snapshotID, err := r.getLatestSnapshotID(ctx)
 	if err != nil {
 		return nil, err
@@ -193,29 +238,12 @@ func (r *queryResolver) ShortestPath(ctx context.Context, from string, to string
 		hops = *maxHops
 	}
 
-	nodes, edges, err := g.ShortestPath(from, to, hops)
+	nodes, edges, err := g.ShortestPath(from, to, hops, edgeFilterFromGraphQL(edgeFilter))
 	if err != nil {
 		return nil, err
 	}
 
-	pathNodes := make([]*Node, len(nodes))
-	for i, node := range nodes {
-		pathNodes[i] = nodeToGraphQL(node)
-	}
-
-	pathEdges := make([]*Edge, len(edges))
-	for i, edge := range edges {
-		pathEdges[i] = &Edge{
-			From: edge.Src,
-			To:   edge.Dst,
-			Kind: edge.Kind,
-		}
-	}
-
-	return &Path{
-		Nodes: pathNodes,
-		Edges: pathEdges,
-	}, nil
+	return pathToGraphQL(g, nodes, edges), nil
 }
 
 // Findings returns policy violations for a snapshot
@@ -309,21 +337,13 @@ func (r *queryResolver) SnapshotDiff(ctx context.Context, a string, b string) (*
 
 	for key, edge := range edgeMapB {
 		if _, exists := edgeMapA[key]; !exists {
-			addedEdges = append(addedEdges, &Edge{
-				From: edge.Src,
-				To:   edge.Dst,
-				Kind: edge.Kind,
-			})
+			addedEdges = append(addedEdges, edgeToGraphQL(edge))
 		}
 	}
 
 	for key, edge := range edgeMapA {
 		if _, exists := edgeMapB[key]; !exists {
-			removedEdges = append(removedEdges, &Edge{
-				From: edge.Src,
-				To:   edge.Dst,
-				Kind: edge.Kind,
-			})
+			removedEdges = append(removedEdges, edgeToGraphQL(edge))
 		}
 	}
 
@@ -347,17 +367,82 @@ func nodeToGraphQL(node ingest.Node) *Node {
 	}
 
 	return &Node{
-		ID:     node.ID,
-		Kind:   string(node.Kind),
-		Labels: node.Labels,
-		Props:  props,
+		ID:         node.ID,
+		Kind:       string(node.Kind),
+		Labels:     node.Labels,
+		Props:      props,
+		Provenance: provenanceToGraphQL(node.Provenance),
+	}
+}
+
+func edgeToGraphQL(edge ingest.Edge) *Edge {
+	e := &Edge{
+		From:       edge.Src,
+		To:         edge.Dst,
+		Kind:       edge.Kind,
+		Provenance: provenanceToGraphQL(edge.Provenance),
+	}
+	if technique := edge.Props["technique"]; edge.Kind == ingest.EdgeCanEscalateTo && technique != "" {
+		e.Technique = &technique
 	}
+	return e
+}
+
+// pathToGraphQL converts a path, priced under g's weights
+func pathToGraphQL(g *graph.Graph, nodes []ingest.Node, edges []ingest.Edge) *Path {
+	pathNodes := make([]*Node, len(nodes))
+	for i, node := range nodes {
+		pathNodes[i] = nodeToGraphQL(node)
+	}
+
+	pathEdges := make([]*Edge, len(edges))
+	for i, edge := range edges {
+		pathEdges[i] = edgeToGraphQL(edge)
+	}
+
+	cost, likelihood := g.PathCost(edges)
+	return &Path{
+		Nodes:      pathNodes,
+		Edges:      pathEdges,
+		Cost:       cost,
+		Likelihood: likelihood,
+	}
+}
+
+// edgeFilterFromGraphQL converts an optional EdgeFilter argument; nil allows
+// every edge kind
+func edgeFilterFromGraphQL(f *EdgeFilter) graph.EdgeFilter {
+	if f == nil {
+		return graph.EdgeFilter{}
+	}
+	return graph.EdgeFilter{Allow: f.Allow, Deny: f.Deny}
+}
+
+func provenanceToGraphQL(prov []ingest.Provenance) []*Provenance {
+	result := make([]*Provenance, len(prov))
+	for i, p := range prov {
+		gp := &Provenance{Source: p.Source}
+		if p.File != "" {
+			file := p.File
+			gp.File = &file
+		}
+		if p.Path != "" {
+			path := p.Path
+			gp.Path = &path
+		}
+		if p.Line > 0 {
+			line := p.Line
+			gp.Line = &line
+		}
+		result[i] = gp
+	}
+	return result
 }
 
 // ============ Phase 2 Resolvers ============
 
 // AttackPath finds an attack path from a principal to a resource
-func (r *queryResolver) AttackPath(ctx context.Context, from string, to *string, tags []string, maxHops *int) (*Path, error) {
+func (r *queryResolver) AttackPath(ctx context.Context, from string, to *string, tags []string, maxHops *int, edgeFilter *EdgeFilter) (*Path, error) {
 	snapshotID, err := r.getLatestSnapshotID(ctx)
 	if err != nil {
 		return nil, err
@@ -378,7 +463,7 @@ func (r *queryResolver) AttackPath(ctx context.Context, from string, to *string,
 		toID = *to
 	}
 
-	result, err := g.FindAttackPath(from, toID, tags, hops)
+	result, err := g.FindAttackPath(from, toID, tags, hops, edgeFilterFromGraphQL(edgeFilter))
 	if err != nil {
 		return nil, err
 	}
@@ -387,24 +472,51 @@ func (r *queryResolver) AttackPath(ctx context.Context, from string, to *string,
 		return nil, fmt.Errorf("no attack path found")
 	}
 
-	pathNodes := make([]*Node, len(result.Nodes))
-	for i, node := range result.Nodes {
-		pathNodes[i] = nodeToGraphQL(node)
+	return pathToGraphQL(g, result.Nodes, result.Edges), nil
+}
+
+// AttackPaths finds alternative attack paths from a principal, cheapest first
+func (r *queryResolver) AttackPaths(ctx context.Context, from string, to *string, tags []string, k *int, maxHops *int, edgeFilter *EdgeFilter, allSimple *bool) ([]*Path, error) {
+	snapshotID, err := r.getLatestSnapshotID(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	pathEdges := make([]*Edge, len(result.Edges))
-	for i, edge := range result.Edges {
-		pathEdges[i] = &Edge{
-			From: edge.Src,
-			To:   edge.Dst,
-			Kind: edge.Kind,
-		}
+	g, err := r.loadGraph(ctx, snapshotID)
+	if err != nil {
+		return nil, err
 	}
 
-	return &Path{
-		Nodes: pathNodes,
-		Edges: pathEdges,
-	}, nil
+	hops := DefaultMaxHops
+	if maxHops != nil && *maxHops > 0 {
+		hops = *maxHops
+	}
+
+	toID := ""
+	if to != nil {
+		toID = *to
+	}
+
+	count := 0
+	if k != nil {
+		count = *k
+	}
+
+	var results []*graph.AttackPathResult
+	if allSimple != nil && *allSimple {
+		results, err = g.AllAttackPaths(from, toID, tags, hops, count, edgeFilterFromGraphQL(edgeFilter))
+	} else {
+		results, err = g.FindAttackPaths(from, toID, tags, count, hops, edgeFilterFromGraphQL(edgeFilter))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]*Path, len(results))
+	for i, result := range results {
+		paths[i] = pathToGraphQL(g, result.Nodes, result.Edges)
+	}
+	return paths, nil
 }
 
 // Recommend generates least-privilege recommendations for a policy
@@ -471,7 +583,7 @@ func (r *queryResolver) ExportMarkdownAttackPath(ctx context.Context, from strin
 	}
 
 	// Find the attack path
-	result, err := g.FindAttackPath(from, to, nil, DefaultMaxHops)
+	result, err := g.FindAttackPath(from, to, nil, DefaultMaxHops, graph.EdgeFilter{})
 	if err != nil {
 		return nil, err
 	}
@@ -505,7 +617,7 @@ func (r *queryResolver) ExportSarifAttackPath(ctx context.Context, from string,
 	}
 
 	// Find the attack path
-	result, err := g.FindAttackPath(from, to, nil, DefaultMaxHops)
+	result, err := g.FindAttackPath(from, to, nil, DefaultMaxHops, graph.EdgeFilter{})
 	if err != nil {
 		return nil, err
 	}
@@ -525,3 +637,479 @@ func (r *queryResolver) ExportSarifAttackPath(ctx context.Context, from string,
 		Content:  sarif,
 	}, nil
 }
+
+// BlastRadius returns every resource a principal can reach
+func (r *queryResolver) BlastRadius(ctx context.Context, principal string, maxHops *int, edgeFilter *EdgeFilter) (*BlastRadius, error) {
+	snapshotID, err := r.getLatestSnapshotID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := r.loadGraph(ctx, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	hops := DefaultMaxHops
+	if maxHops != nil && *maxHops > 0 {
+		hops = *maxHops
+	}
+
+	br, err := g.BlastRadius(principal, hops, edgeFilterFromGraphQL(edgeFilter))
+	if err != nil {
+		return nil, err
+	}
+
+	return blastRadiusToGraphQL(br), nil
+}
+
+// ExportMarkdownBlastRadius exports a principal's blast radius as Markdown
+func (r *queryResolver) ExportMarkdownBlastRadius(ctx context.Context, principal string, maxHops *int) (*Export, error) {
+	snapshotID, err := r.getLatestSnapshotID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := r.loadGraph(ctx, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	hops := DefaultMaxHops
+	if maxHops != nil && *maxHops > 0 {
+		hops = *maxHops
+	}
+
+	br, err := g.BlastRadius(principal, hops, graph.EdgeFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	markdown, err := graph.ExportMarkdownBlastRadius(br)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Export{
+		Filename: fmt.Sprintf("blast-radius-%s.md", snapshotID),
+		Content:  markdown,
+	}, nil
+}
+
+func blastRadiusToGraphQL(br *graph.BlastRadius) *BlastRadius {
+	resources := make([]*ReachableResource, len(br.Resources))
+	for i, res := range br.Resources {
+		resources[i] = &ReachableResource{
+			Node:      nodeToGraphQL(res.Node),
+			Type:      res.Type,
+			Hops:      res.Hops,
+			Actions:   res.Actions,
+			Sensitive: res.Sensitive,
+		}
+	}
+
+	byType := make([]*ResourceTypeSummary, len(br.ByType))
+	for i, summary := range br.ByType {
+		byType[i] = &ResourceTypeSummary{
+			Type:      summary.Type,
+			Resources: summary.Resources,
+			Sensitive: summary.Sensitive,
+		}
+	}
+
+	return &BlastRadius{
+		Principal: br.Principal,
+		MaxHops:   br.MaxHops,
+		Resources: resources,
+		ByType:    byType,
+		Sensitive: br.Sensitive,
+	}
+}
+
+// WhoCanAccess returns every principal that can reach a resource
+func (r *queryResolver) WhoCanAccess(ctx context.Context, resource string, maxHops *int, edgeFilter *EdgeFilter) (*ResourceAccess, error) {
+	_, access, err := r.resourceAccess(ctx, resource, maxHops, edgeFilterFromGraphQL(edgeFilter))
+	if err != nil {
+		return nil, err
+	}
+
+	return resourceAccessToGraphQL(access), nil
+}
+
+// ExportMarkdownResourceAccess exports the principals that can reach a
+// resource as a Markdown access review
+func (r *queryResolver) ExportMarkdownResourceAccess(ctx context.Context, resource string, maxHops *int) (*Export, error) {
+	snapshotID, access, err := r.resourceAccess(ctx, resource, maxHops, graph.EdgeFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	markdown, err := graph.ExportMarkdownResourceAccess(access)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Export{
+		Filename: fmt.Sprintf("access-review-%s.md", snapshotID),
+		Content:  markdown,
+	}, nil
+}
+
+// ExportSarifResourceAccess exports the principals that can reach a resource
+// as SARIF
+func (r *queryResolver) ExportSarifResourceAccess(ctx context.Context, resource string, maxHops *int) (*Export, error) {
+	snapshotID, access, err := r.resourceAccess(ctx, resource, maxHops, graph.EdgeFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	sarif, err := graph.ExportSARIFResourceAccess(access)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Export{
+		Filename: fmt.Sprintf("access-review-%s.sarif", snapshotID),
+		Content:  sarif,
+	}, nil
+}
+
+// resourceAccess runs WhoCanAccess against the latest snapshot
+func (r *queryResolver) resourceAccess(ctx context.Context, resource string, maxHops *int, filter graph.EdgeFilter) (string, *graph.ResourceAccess, error) {
+	snapshotID, err := r.getLatestSnapshotID(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	g, err := r.loadGraph(ctx, snapshotID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	hops := DefaultMaxHops
+	if maxHops != nil && *maxHops > 0 {
+		hops = *maxHops
+	}
+
+	access, err := g.WhoCanAccess(resource, hops, filter)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return snapshotID, access, nil
+}
+
+func resourceAccessToGraphQL(access *graph.ResourceAccess) *ResourceAccess {
+	principals := make([]*PrincipalAccess, len(access.Principals))
+	for i, p := range access.Principals {
+		nodes := make([]*Node, len(p.Path.Nodes))
+		for j, node := range p.Path.Nodes {
+			nodes[j] = nodeToGraphQL(node)
+		}
+		edges := make([]*Edge, len(p.Path.Edges))
+		for j, edge := range p.Path.Edges {
+			edges[j] = edgeToGraphQL(edge)
+		}
+
+		principals[i] = &PrincipalAccess{
+			Node:    nodeToGraphQL(p.Node),
+			Hops:    p.Hops,
+			Actions: p.Actions,
+			Path: &Path{
+				Nodes:      nodes,
+				Edges:      edges,
+				Cost:       p.Path.Cost,
+				Likelihood: p.Path.Likelihood,
+			},
+		}
+	}
+
+	return &ResourceAccess{
+		Resource:   nodeToGraphQL(access.Resource),
+		MaxHops:    access.MaxHops,
+		Principals: principals,
+	}
+}
+
+// ChokePoints ranks the nodes and edges whose removal cuts the most attack
+// paths to sensitive resources
+func (r *queryResolver) ChokePoints(ctx context.Context, maxHops *int, limit *int, edgeFilter *EdgeFilter) (*ChokePointAnalysis, error) {
+	snapshotID, err := r.getLatestSnapshotID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := r.loadGraph(ctx, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	hops := DefaultMaxHops
+	if maxHops != nil && *maxHops > 0 {
+		hops = *maxHops
+	}
+
+	top := graph.DefaultChokePoints
+	if limit != nil && *limit > 0 {
+		top = *limit
+	}
+
+	analysis, err := g.ChokePoints(hops, graph.DefaultPathLimit, edgeFilterFromGraphQL(edgeFilter))
+	if err != nil {
+		return nil, err
+	}
+
+	points := analysis.ChokePoints
+	if len(points) > top {
+		points = points[:top]
+	}
+
+	result := &ChokePointAnalysis{
+		MaxHops:     analysis.MaxHops,
+		Pairs:       analysis.Pairs,
+		Paths:       analysis.Paths,
+		Truncated:   analysis.Truncated,
+		ChokePoints: make([]*ChokePoint, len(points)),
+	}
+	for i, point := range points {
+		cp := &ChokePoint{
+			Kind:        point.Kind,
+			Paths:       point.Paths,
+			PairsCut:    point.PairsCut,
+			Remediation: point.Remediation,
+		}
+		if point.Node != nil {
+			cp.Node = nodeToGraphQL(*point.Node)
+		}
+		if point.Edge != nil {
+			cp.Edge = edgeToGraphQL(*point.Edge)
+		}
+		result.ChokePoints[i] = cp
+	}
+
+	return result, nil
+}
+
+// Subgraph returns the neighbourhood of the given roots as a self-contained
+// set of nodes and edges
+func (r *queryResolver) Subgraph(ctx context.Context, rootIds []string, depth *int, nodeKinds []string, edgeKinds []string, limit *int) (*Subgraph, error) {
+	snapshotID, err := r.getLatestSnapshotID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := r.loadGraph(ctx, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	d := graph.DefaultBFSDepth
+	if depth != nil && *depth > 0 {
+		d = *depth
+	}
+
+	n := graph.DefaultSubgraphLimit
+	if limit != nil && *limit > 0 {
+		n = *limit
+	}
+
+	kinds := make([]ingest.Kind, len(nodeKinds))
+	for i, k := range nodeKinds {
+		kinds[i] = ingest.Kind(k)
+	}
+
+	sub, err := g.Subgraph(rootIds, d, kinds, graph.EdgeFilter{Allow: edgeKinds}, n)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Subgraph{
+		Roots:     sub.Roots,
+		Depth:     sub.Depth,
+		Nodes:     make([]*SubgraphNode, len(sub.Nodes)),
+		Edges:     make([]*Edge, len(sub.Edges)),
+		Truncated: sub.Truncated,
+	}
+	for i, node := range sub.Nodes {
+		result.Nodes[i] = &SubgraphNode{
+			Node:      nodeToGraphQL(node.Node),
+			Depth:     node.Depth,
+			Truncated: node.Truncated,
+		}
+	}
+	for i, edge := range sub.Edges {
+		result.Edges[i] = edgeToGraphQL(edge)
+	}
+
+	return result, nil
+}
+
+// Analyze ranks principals by power and nodes by brokerage, finds the
+// islands of the graph and reports orphaned policies, unused roles and
+// dangling bindings, including those dropped at ingest
+func (r *queryResolver) Analyze(ctx context.Context, top *int, edgeFilter *EdgeFilter) (*Analysis, error) {
+	snapshotID, err := r.getLatestSnapshotID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := r.loadGraph(ctx, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := r.store.GetReport(ctx, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	n := graph.DefaultAnalysisTop
+	if top != nil && *top > 0 {
+		n = *top
+	}
+
+	analysis := g.Analyze(n, edgeFilterFromGraphQL(edgeFilter))
+	analysis.AddReport(report)
+
+	return analysisToGraphQL(analysis), nil
+}
+
+// analysisToGraphQL converts a graph analysis to its GraphQL form
+func analysisToGraphQL(analysis *graph.Analysis) *Analysis {
+	scores := func(ranked []graph.NodeScore) []*NodeScore {
+		out := make([]*NodeScore, len(ranked))
+		for i, s := range ranked {
+			out[i] = &NodeScore{Node: nodeToGraphQL(s.Node), Score: s.Score}
+		}
+		return out
+	}
+	nodes := func(list []ingest.Node) []*Node {
+		out := make([]*Node, len(list))
+		for i, n := range list {
+			out[i] = nodeToGraphQL(n)
+		}
+		return out
+	}
+
+	result := &Analysis{
+		Nodes:            analysis.Nodes,
+		Edges:            analysis.Edges,
+		Powerful:         scores(analysis.Powerful),
+		Brokers:          scores(analysis.Brokers),
+		Components:       analysis.Components,
+		Largest:          analysis.Largest,
+		Islands:          make([]*Component, len(analysis.Islands)),
+		OrphanedPolicies: nodes(analysis.OrphanedPolicies),
+		UnusedRoles:      nodes(analysis.UnusedRoles),
+		DanglingBindings: make([]*DanglingBinding, len(analysis.DanglingBindings)),
+	}
+	for i, c := range analysis.Islands {
+		result.Islands[i] = &Component{Size: c.Size, Nodes: c.Nodes}
+	}
+	for i, b := range analysis.DanglingBindings {
+		db := &DanglingBinding{Role: b.Role, Subject: b.Subject, Reason: b.Reason}
+		if b.Binding != "" {
+			db.Binding = &b.Binding
+		}
+		if b.Source != "" {
+			db.Source = &b.Source
+		}
+		result.DanglingBindings[i] = db
+	}
+	return result
+}
+
+// RoleChains lists the chains of role assumptions from a principal
+func (r *queryResolver) RoleChains(ctx context.Context, from *string, maxDepth *int, limit *int) ([]*RoleChain, error) {
+	snapshotID, err := r.getLatestSnapshotID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := r.loadGraph(ctx, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	fromID := ""
+	if from != nil {
+		fromID = *from
+	}
+
+	depth := DefaultMaxHops
+	if maxDepth != nil && *maxDepth > 0 {
+		depth = *maxDepth
+	}
+
+	chainLimit := graph.DefaultPathLimit
+	if limit != nil && *limit > 0 {
+		chainLimit = *limit
+	}
+
+	chains, err := g.RoleChains(fromID, depth, chainLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*RoleChain, len(chains))
+	for i, chain := range chains {
+		steps := make([]*RoleChainStep, len(chain.Steps))
+		for j, step := range chain.Steps {
+			steps[j] = &RoleChainStep{
+				Role:              step.Role,
+				Edge:              edgeToGraphQL(step.Edge),
+				Chained:           step.Chained,
+				MaxSessionSeconds: step.MaxSessionSeconds,
+			}
+		}
+		result[i] = &RoleChain{
+			Principal: chain.Principal,
+			Depth:     chain.Depth,
+			Steps:     steps,
+		}
+	}
+
+	return result, nil
+}
+
+// Query runs a pattern query against the latest snapshot
+func (r *queryResolver) Query(ctx context.Context, q string) (*QueryResult, error) {
+	snapshotID, err := r.getLatestSnapshotID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := r.loadGraph(ctx, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := g.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([][]*QueryValue, len(result.Rows))
+	for i, row := range result.Rows {
+		rows[i] = make([]*QueryValue, len(row))
+		for j, v := range row {
+			value := &QueryValue{Kind: v.Kind, Value: v.Value}
+			if v.Node != nil {
+				value.Node = nodeToGraphQL(*v.Node)
+			}
+			if v.Edges != nil {
+				value.Edges = make([]*Edge, len(v.Edges))
+				for k, edge := range v.Edges {
+					value.Edges[k] = edgeToGraphQL(edge)
+				}
+			}
+			rows[i][j] = value
+		}
+	}
+
+	return &QueryResult{
+		Columns:   result.Columns,
+		Rows:      rows,
+		Truncated: result.Truncated,
+	}, nil
+}
@@ -2,7 +2,11 @@ package graphql
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,6 +20,7 @@ import (
 
 type mockStore struct {
 	snapshots  []store.Snapshot
+	report     ingest.Report
 	nodes      map[string]map[string]*ingest.Node // snapshotID -> nodeID -> Node
 	edges      map[string][]ingest.Edge           // snapshotID -> edges
 	principals map[string][]ingest.Node           // snapshotID -> matching nodes
@@ -34,6 +39,15 @@ func (m *mockStore) ListSnapshots(_ context.Context) ([]store.Snapshot, error) {
 	return m.snapshots, nil
 }
 
+func (m *mockStore) GetSnapshot(_ context.Context, id string) (*store.Snapshot, error) {
+	for _, snap := range m.snapshots {
+		if snap.ID == id {
+			return &snap, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
 func (m *mockStore) LoadSnapshot(_ context.Context, id string) (*graph.Graph, error) {
 	if m.graph != nil {
 		return m.graph, nil
@@ -74,6 +88,10 @@ func (m *mockStore) CountEdges(_ context.Context, snapshotID string) (int, error
 	return len(m.edges[snapshotID]), nil
 }
 
+func (m *mockStore) GetReport(_ context.Context, _ string) (ingest.Report, error) {
+	return m.report, nil
+}
+
 // --- Mock PolicyEvaluator ---
 
 type mockEvaluator struct {
@@ -92,6 +110,7 @@ func newTestResolver(s DataStore, e PolicyEvaluator) *Resolver {
 		store:     s,
 		evaluator: e,
 		cache:     newGraphCache(),
+		weights:   graph.DefaultWeights(),
 	}
 }
 
@@ -162,7 +181,7 @@ func TestShortestPath_PathFound(t *testing.T) {
 	r := newTestResolver(ms, &mockEvaluator{})
 	qr := &queryResolver{r}
 
-	path, err := qr.ShortestPath(context.Background(), "role1", "resource1", nil)
+	path, err := qr.ShortestPath(context.Background(), "role1", "resource1", nil, nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -174,6 +193,316 @@ func TestShortestPath_PathFound(t *testing.T) {
 	if len(path.Edges) != 2 {
 		t.Errorf("expected 2 edges in path, got %d", len(path.Edges))
 	}
+
+	// ATTACHED_POLICY (0.05) + APPLIES_TO (0.1) under the default weights
+	if math.Abs(path.Cost-0.15) > 1e-9 {
+		t.Errorf("expected cost 0.15, got %v", path.Cost)
+	}
+	if math.Abs(path.Likelihood-math.Exp(-0.15)) > 1e-9 {
+		t.Errorf("expected likelihood exp(-0.15), got %v", path.Likelihood)
+	}
+}
+
+func TestAttackPaths_ReturnsAlternatives(t *testing.T) {
+	g := graph.New()
+	for _, id := range []string{"role1", "policy1", "policy2", "resource1"} {
+		g.AddNode(ingest.Node{ID: id, Kind: ingest.KindPrincipal, Labels: []string{"aws"}})
+	}
+	g.AddEdge(ingest.Edge{Src: "role1", Dst: "policy1", Kind: ingest.EdgeAttachedPolicy})
+	g.AddEdge(ingest.Edge{Src: "policy1", Dst: "resource1", Kind: ingest.EdgeAppliesTo})
+	g.AddEdge(ingest.Edge{Src: "role1", Dst: "policy2", Kind: ingest.EdgeAssumesRole})
+	g.AddEdge(ingest.Edge{Src: "policy2", Dst: "resource1", Kind: ingest.EdgeAppliesTo})
+
+	ms := newMockStore()
+	ms.snapshots = []store.Snapshot{defaultSnapshot()}
+	ms.graph = g
+
+	r := newTestResolver(ms, &mockEvaluator{})
+	qr := &queryResolver{r}
+
+	to := "resource1"
+	for _, allSimple := range []bool{false, true} {
+		paths, err := qr.AttackPaths(context.Background(), "role1", &to, nil, nil, nil, nil, &allSimple)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(paths) != 2 {
+			t.Fatalf("allSimple=%t: expected 2 paths, got %d", allSimple, len(paths))
+		}
+		if paths[0].Nodes[1].ID != "policy1" || paths[0].Cost > paths[1].Cost {
+			t.Errorf("allSimple=%t: expected cheaper path via policy1 first", allSimple)
+		}
+	}
+}
+
+func TestBlastRadius_SummarisesResources(t *testing.T) {
+	g := graph.New()
+	g.AddNode(ingest.Node{ID: "role1", Kind: ingest.KindPrincipal, Labels: []string{"aws"}})
+	g.AddNode(ingest.Node{ID: "policy1", Kind: ingest.KindPolicy, Labels: []string{"aws"}})
+	g.AddNode(ingest.Node{ID: "arn:aws:s3:::bucket", Kind: ingest.KindResource, Labels: []string{"aws"}})
+	g.AddEdge(ingest.Edge{Src: "role1", Dst: "policy1", Kind: ingest.EdgeAttachedPolicy})
+	g.AddEdge(ingest.Edge{Src: "policy1", Dst: "arn:aws:s3:::bucket", Kind: ingest.EdgeAppliesTo, Props: map[string]string{"action": "s3:GetObject"}})
+
+	ms := newMockStore()
+	ms.snapshots = []store.Snapshot{defaultSnapshot()}
+	ms.graph = g
+
+	r := newTestResolver(ms, &mockEvaluator{})
+	qr := &queryResolver{r}
+
+	br, err := qr.BlastRadius(context.Background(), "role1", nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(br.Resources) != 1 || br.Resources[0].Hops != 2 || br.Resources[0].Actions[0] != "s3:GetObject" {
+		t.Errorf("unexpected resources: %+v", br.Resources)
+	}
+	if len(br.ByType) != 1 || br.ByType[0].Type != "s3" || br.ByType[0].Resources != 1 {
+		t.Errorf("unexpected summary: %+v", br.ByType)
+	}
+
+	export, err := qr.ExportMarkdownBlastRadius(context.Background(), "role1", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if export.Filename != "blast-radius-snap-1.md" {
+		t.Errorf("unexpected filename %s", export.Filename)
+	}
+}
+
+func TestWhoCanAccess_ListsPrincipals(t *testing.T) {
+	g := graph.New()
+	g.AddNode(ingest.Node{ID: "role1", Kind: ingest.KindPrincipal, Labels: []string{"aws"}})
+	g.AddNode(ingest.Node{ID: "role2", Kind: ingest.KindPrincipal, Labels: []string{"aws"}})
+	g.AddNode(ingest.Node{ID: "policy1", Kind: ingest.KindPolicy, Labels: []string{"aws"}})
+	g.AddNode(ingest.Node{ID: "arn:aws:s3:::bucket", Kind: ingest.KindResource, Labels: []string{"aws"}})
+	g.AddEdge(ingest.Edge{Src: "role1", Dst: "policy1", Kind: ingest.EdgeAttachedPolicy})
+	g.AddEdge(ingest.Edge{Src: "role2", Dst: "role1", Kind: ingest.EdgeAssumesRole})
+	g.AddEdge(ingest.Edge{Src: "policy1", Dst: "arn:aws:s3:::bucket", Kind: ingest.EdgeAppliesTo, Props: map[string]string{"action": "s3:*"}})
+
+	ms := newMockStore()
+	ms.snapshots = []store.Snapshot{defaultSnapshot()}
+	ms.graph = g
+
+	r := newTestResolver(ms, &mockEvaluator{})
+	qr := &queryResolver{r}
+
+	access, err := qr.WhoCanAccess(context.Background(), "arn:aws:s3:::bucket", nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(access.Principals) != 2 {
+		t.Fatalf("expected 2 principals, got %d", len(access.Principals))
+	}
+	first := access.Principals[0]
+	if first.Node.ID != "role1" || first.Hops != 2 || len(first.Path.Edges) != 2 || first.Actions[0] != "s3:*" {
+		t.Errorf("unexpected first principal: %+v", first)
+	}
+	if access.Principals[1].Node.ID != "role2" || access.Principals[1].Hops != 3 {
+		t.Errorf("unexpected second principal: %+v", access.Principals[1])
+	}
+
+	maxHops := 2
+	access, err = qr.WhoCanAccess(context.Background(), "arn:aws:s3:::bucket", &maxHops, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(access.Principals) != 1 {
+		t.Errorf("expected 1 principal within 2 hops, got %d", len(access.Principals))
+	}
+
+	export, err := qr.ExportSarifResourceAccess(context.Background(), "arn:aws:s3:::bucket", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if export.Filename != "access-review-snap-1.sarif" || !strings.Contains(export.Content, `"level": "error"`) {
+		t.Errorf("unexpected export %s: %s", export.Filename, export.Content)
+	}
+}
+
+func TestChokePoints_RanksSharedPolicy(t *testing.T) {
+	g := graph.New()
+	g.AddNode(ingest.Node{ID: "role1", Kind: ingest.KindPrincipal, Labels: []string{"aws"}})
+	g.AddNode(ingest.Node{ID: "role2", Kind: ingest.KindPrincipal, Labels: []string{"aws"}})
+	g.AddNode(ingest.Node{ID: "policy1", Kind: ingest.KindPolicy, Labels: []string{"aws"}})
+	g.AddNode(ingest.Node{ID: "bucket", Kind: ingest.KindResource, Labels: []string{"aws"}, Props: map[string]string{"sensitive": "true"}})
+	g.AddEdge(ingest.Edge{Src: "role1", Dst: "policy1", Kind: ingest.EdgeAttachedPolicy})
+	g.AddEdge(ingest.Edge{Src: "role2", Dst: "policy1", Kind: ingest.EdgeAttachedPolicy})
+	g.AddEdge(ingest.Edge{Src: "policy1", Dst: "bucket", Kind: ingest.EdgeAppliesTo})
+
+	ms := newMockStore()
+	ms.snapshots = []store.Snapshot{defaultSnapshot()}
+	ms.graph = g
+
+	r := newTestResolver(ms, &mockEvaluator{})
+	qr := &queryResolver{r}
+
+	limit := 2
+	analysis, err := qr.ChokePoints(context.Background(), nil, &limit, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if analysis.Pairs != 2 || analysis.Paths != 2 {
+		t.Errorf("expected 2 pairs and 2 paths, got %d and %d", analysis.Pairs, analysis.Paths)
+	}
+	if len(analysis.ChokePoints) != 2 {
+		t.Fatalf("expected 2 choke points, got %d", len(analysis.ChokePoints))
+	}
+	// The shared policy and its grant each cut both pairs
+	for _, cp := range analysis.ChokePoints {
+		if cp.PairsCut != 2 {
+			t.Errorf("expected choke point to cut 2 pairs, got %+v", cp)
+		}
+	}
+	if cp := analysis.ChokePoints[1]; cp.Kind != "node" || cp.Node == nil || cp.Node.ID != "policy1" || cp.Edge != nil {
+		t.Errorf("expected policy1 node choke point, got %+v", cp)
+	}
+}
+
+func TestRoleChains_MarksChainedSessions(t *testing.T) {
+	g := graph.New()
+	g.AddNode(ingest.Node{ID: "arn:aws:iam::111111111111:user/alice", Kind: ingest.KindPrincipal, Labels: []string{"aws"}})
+	g.AddNode(ingest.Node{ID: "arn:aws:iam::111111111111:role/A", Kind: ingest.KindPrincipal, Labels: []string{"aws"}})
+	g.AddNode(ingest.Node{ID: "arn:aws:iam::111111111111:role/B", Kind: ingest.KindPrincipal, Labels: []string{"aws"}})
+	g.AddEdge(ingest.Edge{Src: "arn:aws:iam::111111111111:user/alice", Dst: "arn:aws:iam::111111111111:role/A", Kind: ingest.EdgeAssumesRole})
+	g.AddEdge(ingest.Edge{Src: "arn:aws:iam::111111111111:role/A", Dst: "arn:aws:iam::111111111111:role/B", Kind: ingest.EdgeAssumesRole})
+
+	ms := newMockStore()
+	ms.snapshots = []store.Snapshot{defaultSnapshot()}
+	ms.graph = g
+
+	r := newTestResolver(ms, &mockEvaluator{})
+	qr := &queryResolver{r}
+
+	from := "arn:aws:iam::111111111111:user/alice"
+	chains, err := qr.RoleChains(context.Background(), &from, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(chains) != 2 || chains[1].Depth != 2 {
+		t.Fatalf("expected chains of depth 1 and 2, got %+v", chains)
+	}
+	if chains[1].Steps[0].Chained || !chains[1].Steps[1].Chained || chains[1].Steps[1].MaxSessionSeconds != 3600 {
+		t.Errorf("expected only the second assumption to be chained, got %+v %+v", chains[1].Steps[0], chains[1].Steps[1])
+	}
+}
+
+func TestQuery_ReturnsRows(t *testing.T) {
+	g := graph.New()
+	g.AddNode(ingest.Node{ID: "role1", Kind: ingest.KindPrincipal, Labels: []string{"aws"}})
+	g.AddNode(ingest.Node{ID: "policy1", Kind: ingest.KindPolicy, Labels: []string{"aws"}, Props: map[string]string{"name": "Admin"}})
+	g.AddEdge(ingest.Edge{Src: "role1", Dst: "policy1", Kind: ingest.EdgeAttachedPolicy})
+
+	ms := newMockStore()
+	ms.snapshots = []store.Snapshot{defaultSnapshot()}
+	ms.graph = g
+
+	r := newTestResolver(ms, &mockEvaluator{})
+	qr := &queryResolver{r}
+
+	result, err := qr.Query(context.Background(), `MATCH (p:PRINCIPAL)-[e]->(pol) RETURN p, e, pol.name`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(result.Columns) != 3 || len(result.Rows) != 1 {
+		t.Fatalf("expected one row of 3 columns, got %+v", result)
+	}
+	row := result.Rows[0]
+	if row[0].Node == nil || row[0].Node.ID != "role1" {
+		t.Errorf("expected role1, got %+v", row[0])
+	}
+	if len(row[1].Edges) != 1 || row[1].Edges[0].Kind != ingest.EdgeAttachedPolicy {
+		t.Errorf("expected the ATTACHED_POLICY edge, got %+v", row[1])
+	}
+	if row[2].Value == nil || *row[2].Value != "Admin" {
+		t.Errorf("expected policy name Admin, got %+v", row[2])
+	}
+
+	if _, err := qr.Query(context.Background(), "MATCH (p RETURN p"); err == nil {
+		t.Error("expected a parse error")
+	}
+}
+
+func TestSubgraph_ReturnsNeighbourhood(t *testing.T) {
+	g := graph.New()
+	g.AddNode(ingest.Node{ID: "user1", Kind: ingest.KindPrincipal, Labels: []string{"aws"}})
+	g.AddNode(ingest.Node{ID: "policy1", Kind: ingest.KindPolicy, Labels: []string{"aws"}})
+	g.AddNode(ingest.Node{ID: "perm1", Kind: ingest.KindPerm, Labels: []string{"aws"}})
+	g.AddEdge(ingest.Edge{Src: "user1", Dst: "policy1", Kind: ingest.EdgeAttachedPolicy})
+	g.AddEdge(ingest.Edge{Src: "policy1", Dst: "perm1", Kind: ingest.EdgeAllowsAction})
+
+	ms := newMockStore()
+	ms.snapshots = []store.Snapshot{defaultSnapshot()}
+	ms.graph = g
+
+	r := newTestResolver(ms, &mockEvaluator{})
+	qr := &queryResolver{r}
+
+	depth := 1
+	result, err := qr.Subgraph(context.Background(), []string{"user1"}, &depth, nil, []string{ingest.EdgeAttachedPolicy}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(result.Nodes) != 2 || len(result.Edges) != 1 || result.Truncated {
+		t.Fatalf("expected 2 nodes and 1 edge, got %+v", result)
+	}
+	if result.Nodes[1].Node.ID != "policy1" || result.Nodes[1].Depth != 1 || result.Nodes[1].Truncated {
+		t.Errorf("expected policy1 at depth 1 with nothing left out, got %+v", result.Nodes[1])
+	}
+
+	result, err = qr.Subgraph(context.Background(), []string{"user1"}, &depth, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Nodes[1].Truncated {
+		t.Error("expected policy1 to be marked truncated when perm1 lies beyond depth")
+	}
+
+	if _, err := qr.Subgraph(context.Background(), []string{"missing"}, nil, nil, nil, nil); err == nil {
+		t.Error("expected an error for an unknown root")
+	}
+}
+
+func TestAnalyze_MergesReport(t *testing.T) {
+	g := graph.New()
+	g.AddNode(ingest.Node{ID: "user1", Kind: ingest.KindPrincipal, Labels: []string{"aws"}})
+	g.AddNode(ingest.Node{ID: "policy1", Kind: ingest.KindPolicy, Labels: []string{"aws"}})
+	g.AddNode(ingest.Node{ID: "policy2", Kind: ingest.KindPolicy, Labels: []string{"aws"}})
+	g.AddEdge(ingest.Edge{Src: "user1", Dst: "policy1", Kind: ingest.EdgeAttachedPolicy})
+
+	ms := newMockStore()
+	ms.snapshots = []store.Snapshot{defaultSnapshot()}
+	ms.graph = g
+	ms.report = ingest.Report{Issues: []ingest.Issue{{
+		Kind:     ingest.IssueDanglingEdge,
+		EntityID: "k8s:role:view|k8s:group:devs|" + ingest.EdgeBindsTo,
+		Message:  "BINDS_TO edge references unknown destination k8s:group:devs",
+	}}}
+
+	r := newTestResolver(ms, &mockEvaluator{})
+	qr := &queryResolver{r}
+
+	result, err := qr.Analyze(context.Background(), nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result.Nodes != 3 || result.Components != 2 || result.Largest != 2 {
+		t.Errorf("expected 3 nodes in 2 components, the largest of 2, got %+v", result)
+	}
+	if len(result.OrphanedPolicies) != 1 || result.OrphanedPolicies[0].ID != "policy2" {
+		t.Errorf("expected policy2 to be orphaned, got %+v", result.OrphanedPolicies)
+	}
+	if len(result.DanglingBindings) != 1 || result.DanglingBindings[0].Subject != "k8s:group:devs" || result.DanglingBindings[0].Binding != nil {
+		t.Errorf("expected the dropped binding to k8s:group:devs, got %+v", result.DanglingBindings)
+	}
 }
 
 func TestFindings_ReturnsViolations(t *testing.T) {
@@ -250,6 +579,49 @@ func TestLoadGraph_CacheHit(t *testing.T) {
 	if g1 != g2 {
 		t.Error("expected cache to return the same graph instance")
 	}
+
+	// Cached graphs are shared by concurrent requests, so they are frozen
+	if !g1.Frozen() {
+		t.Error("expected cached graph to be frozen")
+	}
+	if err := g1.MarkSensitive("node1"); !errors.Is(err, graph.ErrFrozen) {
+		t.Errorf("expected ErrFrozen mutating a cached graph, got %v", err)
+	}
+}
+
+func TestLoadGraph_ReloadsReplacedSnapshot(t *testing.T) {
+	ms := newMockStore()
+	ms.snapshots = []store.Snapshot{defaultSnapshot()}
+	ms.graph = graph.New()
+	ms.graph.AddNode(ingest.Node{ID: "old", Kind: ingest.KindPrincipal})
+
+	r := newTestResolver(ms, &mockEvaluator{})
+	ctx := context.Background()
+
+	if _, err := r.loadGraph(ctx, "snap-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Another process replaces the snapshot, as ingest --overwrite does
+	replaced := defaultSnapshot()
+	replaced.CreatedAt = replaced.CreatedAt.Add(time.Millisecond)
+	ms.snapshots = []store.Snapshot{replaced}
+	ms.graph = graph.New()
+	ms.graph.AddNode(ingest.Node{ID: "new", Kind: ingest.KindPrincipal})
+
+	g, err := r.loadGraph(ctx, "snap-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := g.GetNode("new"); !ok {
+		t.Error("expected the replaced snapshot's contents, got the cached graph")
+	}
+
+	// and then deletes it
+	ms.snapshots = nil
+	if _, err := r.loadGraph(ctx, "snap-1"); !errors.Is(err, store.ErrSnapshotNotFound) {
+		t.Errorf("expected ErrSnapshotNotFound for a deleted snapshot, got %v", err)
+	}
 }
 
 // countingMockStore wraps mockStore and counts LoadSnapshot calls.
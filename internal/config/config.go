@@ -11,6 +11,7 @@ type Config struct {
 	Offline            bool
 	OPAUrl             string
 	SQLitePath         string
+	DatabaseURL        string // Store data source: DATABASE_URL, or SQLitePath if unset
 	Port               string
 	LogFormat          string // "text" or "json"
 	ReadTimeout        time.Duration
@@ -18,6 +19,7 @@ type Config struct {
 	IdleTimeout        time.Duration
 	DevMode            bool
 	CORSAllowedOrigins string
+	AttackWeightsPath  string // YAML file of attack path weights; defaults if empty
 }
 
 // Load loads configuration from environment variables with defaults
@@ -37,6 +39,12 @@ func Load() *Config {
 		sqlitePath = "./graph.db"
 	}
 
+	// A postgres:// URL lets several API replicas share one database
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		databaseURL = sqlitePath
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -75,10 +83,13 @@ func Load() *Config {
 
 	corsOrigins := os.Getenv("CORS_ALLOWED_ORIGINS")
 
+	attackWeightsPath := os.Getenv("ATTACK_WEIGHTS")
+
 	return &Config{
 		Offline:            offline,
 		OPAUrl:             opaURL,
 		SQLitePath:         sqlitePath,
+		DatabaseURL:        databaseURL,
 		Port:               port,
 		LogFormat:          logFormat,
 		ReadTimeout:        readTimeout,
@@ -86,5 +97,6 @@ func Load() *Config {
 		IdleTimeout:        idleTimeout,
 		DevMode:            devMode,
 		CORSAllowedOrigins: corsOrigins,
+		AttackWeightsPath:  attackWeightsPath,
 	}
 }
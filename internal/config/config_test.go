@@ -46,6 +46,15 @@ func TestLoadWithEnv(t *testing.T) {
 		t.Errorf("Expected custom SQLite path, got %s", cfg.SQLitePath)
 	}
 
+	if cfg.DatabaseURL != "/custom/path.db" {
+		t.Errorf("Expected the database to default to the SQLite path, got %s", cfg.DatabaseURL)
+	}
+
+	t.Setenv("DATABASE_URL", "postgres://accessgraph@db:5432/accessgraph")
+	if cfg := Load(); cfg.DatabaseURL != "postgres://accessgraph@db:5432/accessgraph" {
+		t.Errorf("Expected DATABASE_URL to take precedence, got %s", cfg.DatabaseURL)
+	}
+
 	if cfg.Port != "9090" {
 		t.Errorf("Expected custom port, got %s", cfg.Port)
 	}
@@ -0,0 +1,182 @@
+package graph
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+// ResourceAccess lists the principals that can reach a resource
+type ResourceAccess struct {
+	Resource ingest.Node `json:"resource"`
+	MaxHops  int         `json:"maxHops"`
+	// Principals are sorted by path cost, then hops, then ID
+	Principals []PrincipalAccess `json:"principals"`
+}
+
+// PrincipalAccess is one principal that can reach a resource
+type PrincipalAccess struct {
+	Node ingest.Node `json:"node"`
+	// Hops is the length of Path
+	Hops int `json:"hops"`
+	// Actions are the actions the principal is granted on the resource by
+	// any route within reach, sorted
+	Actions []string `json:"actions"`
+	// Path is the cheapest attack path from the principal to the resource
+	Path AttackPathResult `json:"path"`
+}
+
+// WhoCanAccess returns every principal privilege can flow from to a resource
+// within maxHops, following only edges allowed by filter. It searches
+// backwards from the resource over the same weighted privilege flow as
+// FindAttackPath, bounding hops during the search, so each principal's Path
+// is the one FindAttackPath would price cheapest within maxHops.
+func (g *Graph) WhoCanAccess(resourceID string, maxHops int, filter EdgeFilter) (*ResourceAccess, error) {
+	target, ok := g.nodeIndex[resourceID]
+	if !ok {
+		return nil, fmt.Errorf("resource not found: %s", resourceID)
+	}
+
+	if maxHops <= 0 {
+		maxHops = DefaultMaxHops
+	}
+
+	v := g.flowView(filter)
+	back := reversed{v}
+	actions := g.grantedActionsTo(target, maxHops, back)
+	shortest := hopBoundedFrom(back, int64(target), maxHops)
+
+	access := &ResourceAccess{
+		Resource:   g.node(target),
+		MaxHops:    maxHops,
+		Principals: []PrincipalAccess{},
+	}
+
+	for i := range g.nodeIDs {
+		n := int32(i)
+		if g.nodeKind(n) != ingest.KindPrincipal || n == target {
+			continue
+		}
+
+		nodePath := shortest.To(int64(n))
+		if len(nodePath) < 2 {
+			continue
+		}
+		slices.Reverse(nodePath)
+
+		nodes, edges, err := g.resolvePath(nodePath, v)
+		if err != nil {
+			return nil, err
+		}
+
+		granted := []string{}
+		for action := range actions[int64(n)] {
+			granted = append(granted, action)
+		}
+		sort.Strings(granted)
+
+		access.Principals = append(access.Principals, PrincipalAccess{
+			Node:    nodes[0],
+			Hops:    len(edges),
+			Actions: granted,
+			Path:    *g.attackPathResult(nodes, edges),
+		})
+	}
+
+	sort.Slice(access.Principals, func(i, j int) bool {
+		a, b := access.Principals[i], access.Principals[j]
+		if a.Path.Cost != b.Path.Cost {
+			return a.Path.Cost < b.Path.Cost
+		}
+		if a.Hops != b.Hops {
+			return a.Hops < b.Hops
+		}
+		return a.Node.ID < b.Node.ID
+	})
+
+	return access, nil
+}
+
+// grantedActionsTo maps every node within maxHops of target to the actions
+// it is granted on target. Each edge into target grants its action to every
+// node that reaches the edge's source in at most maxHops-1 hops.
+func (g *Graph) grantedActionsTo(target int32, maxHops int, back reversed) map[int64]map[string]bool {
+	actions := make(map[int64]map[string]bool)
+
+	granters := back.From(int64(target))
+	for granters.Next() {
+		u := granters.Node()
+		uID := g.nodeIDs[u.ID()]
+
+		var granted []string
+		for idx := range back.view.steps(int32(u.ID()), target) {
+			if action := g.grantedAction(g.edge(idx), uID); action != "" {
+				granted = append(granted, action)
+			}
+		}
+		if len(granted) == 0 {
+			continue
+		}
+
+		depth := map[int64]int{u.ID(): 0}
+		queue := []graph.Node{u}
+		for len(queue) > 0 {
+			x := queue[0]
+			queue = queue[1:]
+
+			if actions[x.ID()] == nil {
+				actions[x.ID()] = make(map[string]bool)
+			}
+			for _, action := range granted {
+				actions[x.ID()][action] = true
+			}
+
+			if depth[x.ID()] == maxHops-1 {
+				continue
+			}
+			next := back.From(x.ID())
+			for next.Next() {
+				y := next.Node()
+				if _, seen := depth[y.ID()]; !seen && y.ID() != int64(target) {
+					depth[y.ID()] = depth[x.ID()] + 1
+					queue = append(queue, y)
+				}
+			}
+		}
+	}
+
+	return actions
+}
+
+// reversed presents a view with every edge turned around, so that searching
+// from a target finds the paths that lead to it
+type reversed struct {
+	view
+}
+
+func (r reversed) From(id int64) graph.Nodes {
+	return r.view.To(id)
+}
+
+func (r reversed) To(id int64) graph.Nodes {
+	return r.view.From(id)
+}
+
+func (r reversed) HasEdgeFromTo(uid, vid int64) bool {
+	return r.view.HasEdgeFromTo(vid, uid)
+}
+
+func (r reversed) Edge(uid, vid int64) graph.Edge {
+	if !r.HasEdgeFromTo(uid, vid) {
+		return nil
+	}
+	return simple.Edge{F: r.Node(uid), T: r.Node(vid)}
+}
+
+func (r reversed) Weight(xid, yid int64) (float64, bool) {
+	return r.view.Weight(yid, xid)
+}
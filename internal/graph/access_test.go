@@ -0,0 +1,115 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+func TestWhoCanAccess(t *testing.T) {
+	g := newBlastRadiusGraph(t)
+
+	access, err := g.WhoCanAccess("arn:aws:s3:::data", 8, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("WhoCanAccess failed: %v", err)
+	}
+
+	// Both roles reach the bucket at the same cost, so they sort by ID
+	want := []struct {
+		id      string
+		hops    int
+		actions []string
+	}{
+		{"arn:aws:iam::111111111111:role/Admin", 3, []string{"s3:PutObject"}},
+		{"arn:aws:iam::111111111111:role/Dev", 3, []string{"s3:GetObject", "s3:PutObject"}},
+	}
+
+	if len(access.Principals) != len(want) {
+		t.Fatalf("Expected %d principals, got %d: %+v", len(want), len(access.Principals), access.Principals)
+	}
+	for i, w := range want {
+		got := access.Principals[i]
+		if got.Node.ID != w.id || got.Hops != w.hops || !reflect.DeepEqual(got.Actions, w.actions) {
+			t.Errorf("Principal %d: expected %s %d %v, got %s %d %v", i, w.id, w.hops, w.actions, got.Node.ID, got.Hops, got.Actions)
+		}
+
+		path := got.Path
+		if !path.Found || len(path.Nodes) != w.hops+1 || path.Nodes[0].ID != w.id || path.Nodes[w.hops].ID != "arn:aws:s3:::data" {
+			t.Errorf("Principal %d: unexpected path %+v", i, path)
+		}
+		if path.Cost <= 0 || path.Likelihood <= 0 {
+			t.Errorf("Principal %d: expected cost and likelihood, got %v %v", i, path.Cost, path.Likelihood)
+		}
+	}
+
+	// The reverse search must agree with the forward one
+	forward, err := g.FindAttackPath("arn:aws:iam::111111111111:role/Dev", "arn:aws:s3:::data", nil, 8, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("FindAttackPath failed: %v", err)
+	}
+	if forward.Cost != access.Principals[1].Path.Cost {
+		t.Errorf("Expected cost %v to match FindAttackPath, got %v", forward.Cost, access.Principals[1].Path.Cost)
+	}
+}
+
+func TestWhoCanAccessLimits(t *testing.T) {
+	g := newBlastRadiusGraph(t)
+
+	// Dev only reaches the write policy through Admin, one hop too far
+	access, err := g.WhoCanAccess("arn:aws:s3:::data", 3, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("WhoCanAccess failed: %v", err)
+	}
+	if len(access.Principals) != 2 {
+		t.Fatalf("Expected 2 principals within 3 hops, got %d", len(access.Principals))
+	}
+	if got := access.Principals[1].Actions; !reflect.DeepEqual(got, []string{"s3:GetObject"}) {
+		t.Errorf("Expected only s3:GetObject within 3 hops, got %v", got)
+	}
+
+	access, err = g.WhoCanAccess("arn:aws:kms:us-east-1:111111111111:key/k", 8, EdgeFilter{Deny: []string{ingest.EdgeAssumesRole}})
+	if err != nil {
+		t.Fatalf("WhoCanAccess failed: %v", err)
+	}
+	if len(access.Principals) != 1 || access.Principals[0].Node.ID != "arn:aws:iam::111111111111:role/Admin" {
+		t.Errorf("Expected only Admin without role assumption, got %+v", access.Principals)
+	}
+
+	access, err = g.WhoCanAccess("arn:aws:s3:::unreachable", 8, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("WhoCanAccess failed: %v", err)
+	}
+	if len(access.Principals) != 0 {
+		t.Errorf("Expected no principals, got %+v", access.Principals)
+	}
+
+	if _, err := g.WhoCanAccess("missing", 8, EdgeFilter{}); err == nil {
+		t.Error("Expected error for unknown resource")
+	}
+}
+
+func TestWhoCanAccessHopLimit(t *testing.T) {
+	g := newHopLimitGraph(t)
+
+	// The cheapest route from P is four hops, but its direct edge is within
+	// the limit
+	access, err := g.WhoCanAccess("T", 2, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("WhoCanAccess failed: %v", err)
+	}
+	if len(access.Principals) != 1 {
+		t.Fatalf("Expected P within 2 hops, got %+v", access.Principals)
+	}
+	if got := access.Principals[0]; got.Node.ID != "P" || got.Hops != 1 {
+		t.Errorf("Expected P over the direct edge, got %s in %d hops", got.Node.ID, got.Hops)
+	}
+
+	access, err = g.WhoCanAccess("T", 8, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("WhoCanAccess failed: %v", err)
+	}
+	if len(access.Principals) != 1 || access.Principals[0].Hops != 4 {
+		t.Errorf("Expected P over the cheaper four-hop route within 8 hops, got %+v", access.Principals)
+	}
+}
@@ -0,0 +1,285 @@
+package graph
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/network"
+	"gonum.org/v1/gonum/graph/topo"
+)
+
+// DefaultAnalysisTop is how many ranked entries Analyze keeps by default
+const DefaultAnalysisTop = 10
+
+// PageRank parameters
+const (
+	pageRankDamping   = 0.85
+	pageRankTolerance = 1e-6
+)
+
+// Analysis summarises the structure of a graph: who holds the most power,
+// which nodes broker the most privilege flow, which parts are cut off from
+// the rest, and which policies, roles and bindings lead nowhere
+type Analysis struct {
+	Nodes int `json:"nodes"`
+	Edges int `json:"edges"`
+	// Powerful ranks principals by PageRank over reversed privilege flow, so
+	// that a principal scores highly when it reaches much that is itself
+	// reachable from little else
+	Powerful []NodeScore `json:"powerful"`
+	// Brokers ranks nodes by betweenness centrality over privilege flow: how
+	// many shortest privilege paths pass through them
+	Brokers []NodeScore `json:"brokers"`
+	// Components counts the weakly connected components of the graph and
+	// Largest is the size of the biggest
+	Components int `json:"components"`
+	Largest    int `json:"largest"`
+	// Islands are the components other than the largest, biggest first
+	Islands []Component `json:"islands"`
+	// OrphanedPolicies are policies attached to no principal
+	OrphanedPolicies []ingest.Node `json:"orphanedPolicies"`
+	// UnusedRoles are IAM roles no principal or AWS service can assume and
+	// Kubernetes roles bound to no subject
+	UnusedRoles []ingest.Node `json:"unusedRoles"`
+	// DanglingBindings are Kubernetes role bindings that grant nothing
+	DanglingBindings []DanglingBinding `json:"danglingBindings"`
+}
+
+// NodeScore is a node and its centrality score
+type NodeScore struct {
+	Node  ingest.Node `json:"node"`
+	Score float64     `json:"score"`
+}
+
+// Component is a weakly connected component, with node IDs in sorted order
+type Component struct {
+	Size  int      `json:"size"`
+	Nodes []string `json:"nodes"`
+}
+
+// DanglingBinding is a role binding that grants its subject nothing, either
+// because the role has no rules or because the role or subject was never
+// ingested. Binding is empty when the binding edge was dropped at ingest.
+type DanglingBinding struct {
+	Binding string `json:"binding,omitempty"`
+	Role    string `json:"role"`
+	Subject string `json:"subject"`
+	Reason  string `json:"reason"`
+	Source  string `json:"source,omitempty"`
+}
+
+// Analyze computes centrality, connectivity and hygiene findings for the
+// graph. Centrality follows only edges allowed by filter; at most top entries
+// of each ranking and top islands are kept (DefaultAnalysisTop if top <= 0).
+// The hygiene findings are not capped. Betweenness runs in O(V·E), so a
+// frozen graph computes it once per filter and keeps it.
+func (g *Graph) Analyze(top int, filter EdgeFilter) *Analysis {
+	if top <= 0 {
+		top = DefaultAnalysisTop
+	}
+
+	analysis := &Analysis{
+		Nodes:            g.NodeCount(),
+		Edges:            g.EdgeCount(),
+		Powerful:         []NodeScore{},
+		Brokers:          []NodeScore{},
+		Islands:          []Component{},
+		OrphanedPolicies: []ingest.Node{},
+		UnusedRoles:      []ingest.Node{},
+		DanglingBindings: []DanglingBinding{},
+	}
+	if g.NodeCount() == 0 {
+		return analysis
+	}
+
+	flow := g.flowView(filter)
+	analysis.Powerful = g.rankNodes(network.PageRankSparse(reversed{flow}, pageRankDamping, pageRankTolerance), top, func(n ingest.Node) bool {
+		return n.Kind == ingest.KindPrincipal
+	})
+	analysis.Brokers = g.rankNodes(g.betweenness(filter), top, nil)
+
+	g.analyzeComponents(analysis, top)
+	g.analyzeHygiene(analysis)
+
+	return analysis
+}
+
+// centralityEntry is a betweenness result cached on a frozen graph
+type centralityEntry struct {
+	once   sync.Once
+	scores map[int64]float64
+}
+
+// betweenness returns the betweenness centrality of each node over the
+// privilege flow filter allows. A frozen graph cannot change, so it caches
+// the result per filter and concurrent callers share one computation; the
+// scores must not be modified.
+func (g *Graph) betweenness(filter EdgeFilter) map[int64]float64 {
+	if !g.Frozen() {
+		return network.Betweenness(g.flowView(filter))
+	}
+
+	key := strings.Join(filter.Allow, ",") + "|" + strings.Join(filter.Deny, ",")
+	cached, _ := g.centrality.LoadOrStore(key, &centralityEntry{})
+	entry := cached.(*centralityEntry)
+	entry.once.Do(func() {
+		entry.scores = network.Betweenness(g.flowView(filter))
+	})
+	return entry.scores
+}
+
+// rankNodes returns the top nodes by score that keep accepts (all if keep is
+// nil), dropping zero scores and breaking ties by node ID
+func (g *Graph) rankNodes(scores map[int64]float64, top int, keep func(ingest.Node) bool) []NodeScore {
+	ranked := []NodeScore{}
+	for id, score := range scores {
+		if score <= 0 {
+			continue
+		}
+		node := g.node(int32(id))
+		if keep != nil && !keep(node) {
+			continue
+		}
+		ranked = append(ranked, NodeScore{Node: node, Score: score})
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Node.ID < ranked[j].Node.ID
+	})
+	if len(ranked) > top {
+		ranked = ranked[:top]
+	}
+	return ranked
+}
+
+// analyzeComponents fills in the weakly connected components of analysis
+func (g *Graph) analyzeComponents(analysis *Analysis, top int) {
+	var components []Component
+	for _, cc := range topo.ConnectedComponents(graph.Undirect{G: g.view(EdgeFilter{})}) {
+		ids := make([]string, len(cc))
+		for i, n := range cc {
+			ids[i] = g.nodeIDs[n.ID()]
+		}
+		sort.Strings(ids)
+		components = append(components, Component{Size: len(ids), Nodes: ids})
+	}
+
+	sort.Slice(components, func(i, j int) bool {
+		if components[i].Size != components[j].Size {
+			return components[i].Size > components[j].Size
+		}
+		return components[i].Nodes[0] < components[j].Nodes[0]
+	})
+
+	analysis.Components = len(components)
+	analysis.Largest = components[0].Size
+	islands := components[1:]
+	if len(islands) > top {
+		islands = islands[:top]
+	}
+	analysis.Islands = append(analysis.Islands, islands...)
+}
+
+// analyzeHygiene fills in the orphaned policies, unused roles and dangling
+// bindings of analysis
+func (g *Graph) analyzeHygiene(analysis *Analysis) {
+	for _, n := range g.sortedNodes() {
+		kind := g.nodeKind(n)
+		switch {
+		case kind == ingest.KindPolicy:
+			if !g.hasLineTo(n, ingest.EdgeAttachedPolicy) {
+				analysis.OrphanedPolicies = append(analysis.OrphanedPolicies, g.node(n))
+			}
+		case kind == ingest.KindPrincipal && isRoleARN(g.nodeIDs[n]):
+			// A role only an AWS service can assume, such as a Lambda or
+			// ECS execution role, is still in use
+			if _, service := g.propOf(n, "trusted_services"); !service && !g.hasLineTo(n, ingest.EdgeAssumesRole) {
+				analysis.UnusedRoles = append(analysis.UnusedRoles, g.node(n))
+			}
+		case kind == ingest.KindRole:
+			if !g.hasLineFrom(n, ingest.EdgeBindsTo) {
+				analysis.UnusedRoles = append(analysis.UnusedRoles, g.node(n))
+			} else if !g.hasLineFrom(n, ingest.EdgeAllowsAction) {
+				for _, idx := range g.linesFrom(n) {
+					edge := g.edge(int(idx))
+					if edge.Kind != ingest.EdgeBindsTo {
+						continue
+					}
+					analysis.DanglingBindings = append(analysis.DanglingBindings, DanglingBinding{
+						Binding: edge.Props["binding"],
+						Role:    edge.Src,
+						Subject: edge.Dst,
+						Reason:  "role grants no permissions",
+						Source:  edgeSource(edge),
+					})
+				}
+			}
+		}
+	}
+}
+
+// hasLineTo reports whether an edge of kind enters n
+func (g *Graph) hasLineTo(n int32, kind string) bool {
+	for _, idx := range g.linesTo(n) {
+		if g.edgeKind(int(idx)) == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// hasLineFrom reports whether an edge of kind leaves n
+func (g *Graph) hasLineFrom(n int32, kind string) bool {
+	for _, idx := range g.linesFrom(n) {
+		if g.edgeKind(int(idx)) == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// edgeSource returns where an edge was first ingested from, if known
+func edgeSource(edge ingest.Edge) string {
+	if len(edge.Provenance) == 0 {
+		return ""
+	}
+	return edge.Provenance[0].String()
+}
+
+// AddReport adds the role bindings an ingest report shows were dropped for
+// referencing a role or subject that was never ingested
+func (a *Analysis) AddReport(report ingest.Report) {
+	for _, issue := range report.Issues {
+		if issue.Kind != ingest.IssueDanglingEdge {
+			continue
+		}
+		parts := strings.Split(issue.EntityID, "|")
+		if len(parts) != 3 || parts[2] != ingest.EdgeBindsTo {
+			continue
+		}
+
+		binding := DanglingBinding{
+			Role:    parts[0],
+			Subject: parts[1],
+			Reason:  strings.TrimPrefix(issue.Message, ingest.EdgeBindsTo+" edge "),
+		}
+		if issue.Provenance != (ingest.Provenance{}) {
+			binding.Source = issue.Provenance.String()
+		}
+		a.DanglingBindings = append(a.DanglingBindings, binding)
+	}
+
+	sort.SliceStable(a.DanglingBindings, func(i, j int) bool {
+		x, y := a.DanglingBindings[i], a.DanglingBindings[j]
+		if x.Role != y.Role {
+			return x.Role < y.Role
+		}
+		return x.Subject < y.Subject
+	})
+}
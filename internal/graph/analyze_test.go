@@ -0,0 +1,226 @@
+package graph
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+// newAnalysisGraph builds an account in which alice and bob share a policy
+// and alice can also assume Admin, beside a few pieces that lead nowhere: an
+// unattached policy, a role nobody trusts, and Kubernetes roles that are
+// unbound or grant nothing.
+func newAnalysisGraph(t *testing.T) *Graph {
+	t.Helper()
+
+	const (
+		alice  = "arn:aws:iam::111111111111:user/alice"
+		bob    = "arn:aws:iam::111111111111:user/bob"
+		admin  = "arn:aws:iam::111111111111:role/Admin"
+		unused = "arn:aws:iam::111111111111:role/Unused"
+	)
+
+	g := New()
+	for _, n := range []ingest.Node{
+		{ID: alice, Kind: ingest.KindPrincipal},
+		{ID: bob, Kind: ingest.KindPrincipal},
+		{ID: admin, Kind: ingest.KindPrincipal},
+		{ID: unused, Kind: ingest.KindPrincipal},
+		{ID: "policy/Shared", Kind: ingest.KindPolicy},
+		{ID: "policy/Admin", Kind: ingest.KindPolicy},
+		{ID: "policy/Orphan", Kind: ingest.KindPolicy},
+		{ID: "shared#s3:GetObject", Kind: ingest.KindPerm},
+		{ID: "admin#*", Kind: ingest.KindPerm},
+		{ID: "orphan#s3:*", Kind: ingest.KindPerm},
+		{ID: "arn:aws:s3:::reports", Kind: ingest.KindResource},
+		{ID: "arn:aws:s3:::secrets", Kind: ingest.KindResource, Props: map[string]string{"sensitive": "true"}},
+		{ID: "arn:aws:s3:::old", Kind: ingest.KindResource},
+		{ID: "k8s:role:empty", Kind: ingest.KindRole},
+		{ID: "k8s:role:unbound", Kind: ingest.KindRole},
+		{ID: "k8s:sa:default:idle", Kind: ingest.KindPrincipal},
+	} {
+		g.AddNode(n)
+	}
+
+	for _, e := range []ingest.Edge{
+		{Src: alice, Dst: "policy/Shared", Kind: ingest.EdgeAttachedPolicy},
+		{Src: bob, Dst: "policy/Shared", Kind: ingest.EdgeAttachedPolicy},
+		{Src: "policy/Shared", Dst: "shared#s3:GetObject", Kind: ingest.EdgeAllowsAction},
+		{Src: "shared#s3:GetObject", Dst: "arn:aws:s3:::reports", Kind: ingest.EdgeAppliesTo},
+		{Src: alice, Dst: admin, Kind: ingest.EdgeAssumesRole},
+		{Src: admin, Dst: "policy/Admin", Kind: ingest.EdgeAttachedPolicy},
+		{Src: "policy/Admin", Dst: "admin#*", Kind: ingest.EdgeAllowsAction},
+		{Src: "admin#*", Dst: "arn:aws:s3:::secrets", Kind: ingest.EdgeAppliesTo},
+		{Src: "admin#*", Dst: "arn:aws:s3:::reports", Kind: ingest.EdgeAppliesTo},
+		{Src: "policy/Orphan", Dst: "orphan#s3:*", Kind: ingest.EdgeAllowsAction},
+		{Src: "orphan#s3:*", Dst: "arn:aws:s3:::old", Kind: ingest.EdgeAppliesTo},
+		{Src: "k8s:role:empty", Dst: "k8s:sa:default:idle", Kind: ingest.EdgeBindsTo, Props: map[string]string{"binding": "k8s:binding:idle"}},
+	} {
+		if err := g.AddEdge(e); err != nil {
+			t.Fatalf("Failed to add edge: %v", err)
+		}
+	}
+	return g
+}
+
+// nodeIDs returns the IDs of nodes, in order
+func nodeIDs(nodes []ingest.Node) string {
+	ids := make([]string, len(nodes))
+	for i, n := range nodes {
+		ids[i] = n.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestAnalyze(t *testing.T) {
+	g := newAnalysisGraph(t)
+	analysis := g.Analyze(0, EdgeFilter{})
+
+	if analysis.Nodes != 16 || analysis.Edges != 12 {
+		t.Errorf("Expected 16 nodes and 12 edges, got %d and %d", analysis.Nodes, analysis.Edges)
+	}
+
+	// alice reaches everything bob does and Admin's permissions besides
+	if len(analysis.Powerful) == 0 || analysis.Powerful[0].Node.ID != "arn:aws:iam::111111111111:user/alice" {
+		t.Errorf("Expected alice to be the most powerful principal, got %+v", analysis.Powerful)
+	}
+	for _, s := range analysis.Powerful {
+		if s.Node.Kind != ingest.KindPrincipal {
+			t.Errorf("Expected only principals to be ranked by power, got %s", s.Node.ID)
+		}
+	}
+
+	// Admin lies on every path from alice to its policy's permissions
+	brokers := make(map[string]float64)
+	for _, s := range analysis.Brokers {
+		brokers[s.Node.ID] = s.Score
+	}
+	if brokers["arn:aws:iam::111111111111:role/Admin"] <= 0 {
+		t.Errorf("Expected Admin to broker privilege flow, got %+v", analysis.Brokers)
+	}
+	if _, ok := brokers["arn:aws:iam::111111111111:user/bob"]; ok {
+		t.Error("Expected bob, who only starts paths, not to be a broker")
+	}
+
+	if analysis.Components != 5 || analysis.Largest != 9 {
+		t.Errorf("Expected 5 components, the largest of 9, got %d and %d", analysis.Components, analysis.Largest)
+	}
+	var islands []string
+	for _, c := range analysis.Islands {
+		islands = append(islands, strings.Join(c.Nodes, "+"))
+	}
+	want := "arn:aws:s3:::old+orphan#s3:*+policy/Orphan," +
+		"k8s:role:empty+k8s:sa:default:idle," +
+		"arn:aws:iam::111111111111:role/Unused," +
+		"k8s:role:unbound"
+	if got := strings.Join(islands, ","); got != want {
+		t.Errorf("Expected islands %s, got %s", want, got)
+	}
+
+	if got := nodeIDs(analysis.OrphanedPolicies); got != "policy/Orphan" {
+		t.Errorf("Expected policy/Orphan to be orphaned, got %s", got)
+	}
+	if got := nodeIDs(analysis.UnusedRoles); got != "arn:aws:iam::111111111111:role/Unused,k8s:role:unbound" {
+		t.Errorf("Expected Unused and unbound roles, got %s", got)
+	}
+	if len(analysis.DanglingBindings) != 1 {
+		t.Fatalf("Expected 1 dangling binding, got %+v", analysis.DanglingBindings)
+	}
+	if b := analysis.DanglingBindings[0]; b.Binding != "k8s:binding:idle" || b.Role != "k8s:role:empty" || b.Subject != "k8s:sa:default:idle" {
+		t.Errorf("Unexpected dangling binding %+v", b)
+	}
+}
+
+func TestAnalyzeServiceRoles(t *testing.T) {
+	g := newAnalysisGraph(t)
+	g.AddNode(ingest.Node{
+		ID:    "arn:aws:iam::111111111111:role/LambdaExec",
+		Kind:  ingest.KindPrincipal,
+		Props: map[string]string{"trusted_services": "lambda.amazonaws.com"},
+	})
+
+	// Only Lambda can assume the role, which still makes it in use
+	analysis := g.Analyze(0, EdgeFilter{})
+	if got := nodeIDs(analysis.UnusedRoles); got != "arn:aws:iam::111111111111:role/Unused,k8s:role:unbound" {
+		t.Errorf("Expected service roles not to be unused, got %s", got)
+	}
+}
+
+func TestAnalyzeCachesBetweenness(t *testing.T) {
+	g := newAnalysisGraph(t)
+	filter := EdgeFilter{Deny: []string{ingest.EdgeAssumesRole}}
+
+	unfrozen := g.betweenness(filter)
+	g.Freeze()
+	first, second := g.betweenness(filter), g.betweenness(filter)
+	if reflect.ValueOf(first).Pointer() != reflect.ValueOf(second).Pointer() {
+		t.Error("Expected a frozen graph to reuse its betweenness scores")
+	}
+	if !reflect.DeepEqual(first, unfrozen) {
+		t.Errorf("Expected cached scores to match, got %v and %v", first, unfrozen)
+	}
+	if other := g.betweenness(EdgeFilter{}); reflect.ValueOf(other).Pointer() == reflect.ValueOf(first).Pointer() {
+		t.Error("Expected scores to be cached per filter")
+	}
+}
+
+func TestAnalyzeTop(t *testing.T) {
+	g := newAnalysisGraph(t)
+	analysis := g.Analyze(1, EdgeFilter{})
+
+	if len(analysis.Powerful) != 1 || len(analysis.Brokers) != 1 || len(analysis.Islands) != 1 {
+		t.Errorf("Expected one entry per ranking, got %d, %d and %d",
+			len(analysis.Powerful), len(analysis.Brokers), len(analysis.Islands))
+	}
+	if analysis.Components != 5 {
+		t.Errorf("Expected all 5 components to be counted, got %d", analysis.Components)
+	}
+
+	// Without ASSUMES_ROLE, alice's reach is bob's
+	denied := g.Analyze(0, EdgeFilter{Deny: []string{ingest.EdgeAssumesRole}})
+	for _, s := range denied.Brokers {
+		if s.Node.ID == "arn:aws:iam::111111111111:role/Admin" {
+			t.Errorf("Expected Admin not to broker when ASSUMES_ROLE is denied, got %v", s.Score)
+		}
+	}
+}
+
+func TestAnalyzeEmpty(t *testing.T) {
+	analysis := New().Analyze(0, EdgeFilter{})
+	if analysis.Components != 0 || len(analysis.Islands) != 0 || len(analysis.Powerful) != 0 {
+		t.Errorf("Expected an empty analysis, got %+v", analysis)
+	}
+}
+
+func TestAnalysisAddReport(t *testing.T) {
+	analysis := newAnalysisGraph(t).Analyze(0, EdgeFilter{})
+
+	dropped := ingest.Edge{Src: "k8s:role:admin", Dst: "k8s:user:alice", Kind: ingest.EdgeBindsTo}
+	analysis.AddReport(ingest.Report{Issues: []ingest.Issue{
+		{
+			Kind:       ingest.IssueDanglingEdge,
+			EntityID:   dropped.Key(),
+			Message:    "BINDS_TO edge references unknown destination k8s:user:alice",
+			Provenance: ingest.Provenance{Source: ingest.SourceK8s, File: "bindings.yaml"},
+		},
+		{
+			Kind:     ingest.IssueDanglingEdge,
+			EntityID: "a|b|" + ingest.EdgeAttachedPolicy,
+			Message:  "ATTACHED_POLICY edge references unknown destination b",
+		},
+		{Kind: ingest.IssueUnknownField, EntityID: "x", Message: "unknown field"},
+	}})
+
+	if len(analysis.DanglingBindings) != 2 {
+		t.Fatalf("Expected 2 dangling bindings, got %+v", analysis.DanglingBindings)
+	}
+	b := analysis.DanglingBindings[0]
+	if b.Role != "k8s:role:admin" || b.Subject != "k8s:user:alice" || b.Binding != "" {
+		t.Errorf("Expected the dropped binding first, got %+v", b)
+	}
+	if b.Reason != "references unknown destination k8s:user:alice" || !strings.Contains(b.Source, "bindings.yaml") {
+		t.Errorf("Unexpected reason or source: %+v", b)
+	}
+}
@@ -10,93 +10,101 @@ import (
 
 // AttackPathResult represents the result of an attack path query
 type AttackPathResult struct {
-	Nodes []ingest.Node
-	Edges []ingest.Edge
-	Found bool
+	Nodes []ingest.Node `json:"nodes"`
+	Edges []ingest.Edge `json:"edges"`
+	Found bool          `json:"found"`
+	// Cost is the total edge cost under the graph's Weights and Likelihood
+	// is exp(-Cost); both are zero when no path is found
+	Cost       float64 `json:"cost"`
+	Likelihood float64 `json:"likelihood"`
 }
 
-// FindAttackPath finds the shortest path from a principal to a target resource
+// FindAttackPath finds the cheapest path along which privilege flows from a
+// principal to a target resource, following only edges allowed by filter.
+// Edges are walked along their PrivilegeFlow orientation rather than as
+// stored, edges that grant nothing are never followed, and each edge is
+// priced by the graph's Weights, so the most realistic path wins.
 // If toID is empty and tags includes "sensitive", it finds the nearest sensitive resource
-func (g *Graph) FindAttackPath(fromID, toID string, tags []string, maxHops int) (*AttackPathResult, error) {
+func (g *Graph) FindAttackPath(fromID, toID string, tags []string, maxHops int, filter EdgeFilter) (*AttackPathResult, error) {
 	if maxHops <= 0 {
 		maxHops = DefaultMaxHops
 	}
 
 	// Validate source node exists
-	if _, ok := g.nodes[fromID]; !ok {
+	if _, ok := g.nodeIndex[fromID]; !ok {
 		return nil, fmt.Errorf("source node not found: %s", fromID)
 	}
 
 	// If toID is provided, use direct shortest path
 	if toID != "" {
 		// Check if target exists
-		if _, ok := g.nodes[toID]; !ok {
+		if _, ok := g.nodeIndex[toID]; !ok {
 			return nil, fmt.Errorf("destination node not found: %s", toID)
 		}
 
-		nodes, edges, err := g.ShortestPath(fromID, toID, maxHops)
+		nodes, edges, err := g.PrivilegePath(fromID, toID, maxHops, filter)
 		if err != nil {
 			return &AttackPathResult{Found: false}, nil
 		}
-		return &AttackPathResult{
-			Nodes: nodes,
-			Edges: edges,
-			Found: true,
-		}, nil
+		return g.attackPathResult(nodes, edges), nil
 	}
 
 	// If toID is empty and tags includes "sensitive", find nearest sensitive resource
 	if slices.Contains(tags, "sensitive") {
-		return g.findNearestSensitiveResource(fromID, maxHops)
+		return g.findNearestSensitiveResource(fromID, maxHops, filter)
 	}
 
 	return nil, fmt.Errorf("target ID or 'sensitive' tag required")
 }
 
-// findNearestSensitiveResource finds the shortest path to any sensitive resource
-func (g *Graph) findNearestSensitiveResource(fromID string, maxHops int) (*AttackPathResult, error) {
-	// Find all sensitive resources
+// findNearestSensitiveResource finds the cheapest path to any sensitive
+// resource with a single traversal from the source. Equal costs are broken by
+// fewer hops, then by target ID.
+func (g *Graph) findNearestSensitiveResource(fromID string, maxHops int, filter EdgeFilter) (*AttackPathResult, error) {
+	// Find all sensitive resources (sorted for determinism)
 	sensitiveResources := g.findSensitiveResources()
 	if len(sensitiveResources) == 0 {
 		return &AttackPathResult{Found: false}, nil
 	}
 
-	// Sort for determinism
-	sort.Strings(sensitiveResources)
-
-	// Try to find shortest path to any sensitive resource
-	var shortestPath *AttackPathResult
-	shortestLength := maxHops + 1
-
-	for _, targetID := range sensitiveResources {
-		nodes, edges, err := g.ShortestPath(fromID, targetID, maxHops)
-		if err != nil {
-			continue
-		}
+	pairs, err := g.PrivilegePaths([]string{fromID}, sensitiveResources, maxHops, filter)
+	if err != nil {
+		return nil, err
+	}
 
-		// Check if this is the shortest path found so far
-		if len(nodes) < shortestLength {
-			shortestLength = len(nodes)
-			shortestPath = &AttackPathResult{
-				Nodes: nodes,
-				Edges: edges,
-				Found: true,
-			}
+	var best *AttackPathResult
+	for _, pair := range pairs {
+		candidate := g.attackPathResult(pair.Nodes, pair.Edges)
+		if best == nil || candidate.Cost < best.Cost ||
+			(candidate.Cost == best.Cost && len(candidate.Nodes) < len(best.Nodes)) {
+			best = candidate
 		}
 	}
 
-	if shortestPath == nil {
+	if best == nil {
 		return &AttackPathResult{Found: false}, nil
 	}
 
-	return shortestPath, nil
+	return best, nil
+}
+
+// attackPathResult wraps a found path with its cost and likelihood
+func (g *Graph) attackPathResult(nodes []ingest.Node, edges []ingest.Edge) *AttackPathResult {
+	cost, likelihood := g.PathCost(edges)
+	return &AttackPathResult{
+		Nodes:      nodes,
+		Edges:      edges,
+		Found:      true,
+		Cost:       cost,
+		Likelihood: likelihood,
+	}
 }
 
 // findSensitiveResources returns IDs of all nodes marked as sensitive (sorted)
 func (g *Graph) findSensitiveResources() []string {
 	var sensitive []string
-	for id, node := range g.nodes {
-		if val, ok := node.data.Props["sensitive"]; ok && val == "true" {
+	for i, id := range g.nodeIDs {
+		if val, ok := g.propOf(int32(i), "sensitive"); ok && val == "true" {
 			sensitive = append(sensitive, id)
 		}
 	}
@@ -104,9 +112,10 @@ func (g *Graph) findSensitiveResources() []string {
 	return sensitive
 }
 
-// GetEdgeDetails returns detailed information about an edge
-func (g *Graph) GetEdgeDetails(srcID, dstID string) (*ingest.Edge, error) {
-	if edge, found := g.lookupEdge(srcID, dstID); found {
+// GetEdgeDetails returns detailed information about the first edge from src
+// to dst that filter allows
+func (g *Graph) GetEdgeDetails(srcID, dstID string, filter EdgeFilter) (*ingest.Edge, error) {
+	if edge, found := g.lookupEdge(srcID, dstID, filter); found {
 		return &edge, nil
 	}
 	return nil, fmt.Errorf("edge not found from %s to %s", srcID, dstID)
@@ -114,15 +123,16 @@ func (g *Graph) GetEdgeDetails(srcID, dstID string) (*ingest.Edge, error) {
 
 // MarkSensitive marks a node as sensitive
 func (g *Graph) MarkSensitive(nodeID string) error {
-	node, ok := g.nodes[nodeID]
+	if g.Frozen() {
+		return ErrFrozen
+	}
+
+	n, ok := g.nodeIndex[nodeID]
 	if !ok {
 		return fmt.Errorf("node not found: %s", nodeID)
 	}
 
-	if node.data.Props == nil {
-		node.data.Props = make(map[string]string)
-	}
-	node.data.Props["sensitive"] = "true"
+	g.nodeProps.set(int(n), g.syms.intern("sensitive"), g.syms.intern("true"))
 
 	return nil
 }
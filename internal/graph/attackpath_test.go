@@ -67,7 +67,7 @@ func TestFindAttackPath(t *testing.T) {
 
 	// Test finding path with explicit target
 	t.Run("Find path to explicit target", func(t *testing.T) {
-		result, err := g.FindAttackPath(principal.ID, resource.ID, nil, 8)
+		result, err := g.FindAttackPath(principal.ID, resource.ID, nil, 8, EdgeFilter{})
 		if err != nil {
 			t.Fatalf("FindAttackPath failed: %v", err)
 		}
@@ -95,7 +95,7 @@ func TestFindAttackPath(t *testing.T) {
 
 	// Test maxHops limit
 	t.Run("Respect maxHops limit", func(t *testing.T) {
-		result, err := g.FindAttackPath(principal.ID, resource.ID, nil, 1)
+		result, err := g.FindAttackPath(principal.ID, resource.ID, nil, 1, EdgeFilter{})
 		if err != nil {
 			t.Fatalf("FindAttackPath failed: %v", err)
 		}
@@ -107,7 +107,7 @@ func TestFindAttackPath(t *testing.T) {
 
 	// Test no path found
 	t.Run("No path to non-existent node", func(t *testing.T) {
-		_, err := g.FindAttackPath(principal.ID, "arn:aws:s3:::nonexistent", nil, 8)
+		_, err := g.FindAttackPath(principal.ID, "arn:aws:s3:::nonexistent", nil, 8, EdgeFilter{})
 		if err == nil {
 			t.Fatal("Expected error for non-existent target")
 		}
@@ -121,7 +121,7 @@ func TestFindAttackPath(t *testing.T) {
 		}
 
 		// Find path without explicit target, using sensitive tag
-		result, err := g.FindAttackPath(principal.ID, "", []string{"sensitive"}, 8)
+		result, err := g.FindAttackPath(principal.ID, "", []string{"sensitive"}, 8, EdgeFilter{})
 		if err != nil {
 			t.Fatalf("FindAttackPath failed: %v", err)
 		}
@@ -208,7 +208,7 @@ func TestFindNearestSensitiveResource(t *testing.T) {
 	}
 
 	// Test that nearest is found
-	result, err := g.FindAttackPath(principal.ID, "", []string{"sensitive"}, 8)
+	result, err := g.FindAttackPath(principal.ID, "", []string{"sensitive"}, 8, EdgeFilter{})
 	if err != nil {
 		t.Fatalf("FindAttackPath failed: %v", err)
 	}
@@ -306,3 +306,155 @@ func TestMarkSensitive(t *testing.T) {
 		t.Error("Expected error when marking non-existent node")
 	}
 }
+
+func TestFindAttackPathFollowsPrivilegeFlow(t *testing.T) {
+	g := New()
+
+	for _, n := range []ingest.Node{
+		{ID: "k8s:sa:default:app", Kind: ingest.KindPrincipal},
+		{ID: "k8s:ns:default", Kind: ingest.KindNS},
+		{ID: "k8s:role:reader", Kind: ingest.KindRole},
+		{ID: "k8s:role:reader#rule0#get#secrets", Kind: ingest.KindPerm},
+		{ID: "arn:aws:iam::111111111111:role/App", Kind: ingest.KindPrincipal},
+		{ID: "arn:aws:iam::222222222222:root", Kind: ingest.KindAccount},
+		{ID: "arn:aws:iam::222222222222:role/Admin", Kind: ingest.KindPrincipal},
+	} {
+		g.AddNode(n)
+	}
+
+	for _, e := range []ingest.Edge{
+		{Src: "k8s:sa:default:app", Dst: "k8s:ns:default", Kind: ingest.EdgeInNamespace},
+		{Src: "k8s:role:reader", Dst: "k8s:sa:default:app", Kind: ingest.EdgeBindsTo},
+		{Src: "k8s:role:reader", Dst: "k8s:role:reader#rule0#get#secrets", Kind: ingest.EdgeAllowsAction},
+		{Src: "arn:aws:iam::111111111111:role/App", Dst: "arn:aws:iam::222222222222:root", Kind: ingest.EdgeTrustsCrossAccount},
+		{Src: "arn:aws:iam::222222222222:role/Admin", Dst: "arn:aws:iam::222222222222:root", Kind: ingest.EdgeInAccount},
+	} {
+		if err := g.AddEdge(e); err != nil {
+			t.Fatalf("Failed to add edge: %v", err)
+		}
+	}
+
+	t.Run("Subject reaches role permissions", func(t *testing.T) {
+		result, err := g.FindAttackPath("k8s:sa:default:app", "k8s:role:reader#rule0#get#secrets", nil, 8, EdgeFilter{})
+		if err != nil {
+			t.Fatalf("FindAttackPath failed: %v", err)
+		}
+		if !result.Found || len(result.Nodes) != 3 {
+			t.Fatalf("Expected 3-node path, got %+v", result)
+		}
+		if result.Nodes[1].ID != "k8s:role:reader" {
+			t.Errorf("Expected path through role, got %s", result.Nodes[1].ID)
+		}
+		// Edges are returned as stored
+		if e := result.Edges[0]; e.Kind != ingest.EdgeBindsTo || e.Src != "k8s:role:reader" {
+			t.Errorf("Expected stored BINDS_TO edge, got %+v", e)
+		}
+	})
+
+	t.Run("Does not wander into accounts", func(t *testing.T) {
+		result, err := g.FindAttackPath("arn:aws:iam::111111111111:role/App", "arn:aws:iam::222222222222:role/Admin", nil, 8, EdgeFilter{})
+		if err != nil {
+			t.Fatalf("FindAttackPath failed: %v", err)
+		}
+		if result.Found {
+			t.Errorf("Expected no path through account node, got %v", result.Nodes)
+		}
+	})
+
+	t.Run("Role does not flow to subject", func(t *testing.T) {
+		result, err := g.FindAttackPath("k8s:role:reader", "k8s:sa:default:app", nil, 8, EdgeFilter{})
+		if err != nil {
+			t.Fatalf("FindAttackPath failed: %v", err)
+		}
+		if result.Found {
+			t.Errorf("Expected no path from role to subject, got %v", result.Nodes)
+		}
+	})
+
+	t.Run("ShortestPath keeps stored direction", func(t *testing.T) {
+		if _, _, err := g.ShortestPath("k8s:sa:default:app", "k8s:role:reader#rule0#get#secrets", 8, EdgeFilter{}); err == nil {
+			t.Error("Expected no stored-direction path from subject to permission")
+		}
+	})
+}
+
+func TestPrivilegeFlow(t *testing.T) {
+	tests := map[string]Flow{
+		ingest.EdgeAssumesRole:        FlowForward,
+		ingest.EdgeBindsTo:            FlowReverse,
+		ingest.EdgeTrustsCrossAccount: FlowNone,
+		ingest.EdgeInAccount:          FlowNone,
+		"CUSTOM":                      FlowForward,
+	}
+	for kind, want := range tests {
+		if got := PrivilegeFlow(kind); got != want {
+			t.Errorf("PrivilegeFlow(%s) = %d, want %d", kind, got, want)
+		}
+	}
+}
+
+// newHopLimitGraph builds a dear one-hop route from "P" to "T", an assumed
+// role that requires MFA, and a cheap four-hop policy chain via X1..X3
+func newHopLimitGraph(t *testing.T) *Graph {
+	t.Helper()
+
+	g := New()
+	g.AddNode(ingest.Node{ID: "P", Kind: ingest.KindPrincipal})
+	for _, id := range []string{"X1", "X2", "X3"} {
+		g.AddNode(ingest.Node{ID: id, Kind: ingest.KindPolicy})
+	}
+	g.AddNode(ingest.Node{ID: "T", Kind: ingest.KindResource})
+
+	for _, e := range []ingest.Edge{
+		{Src: "P", Dst: "T", Kind: ingest.EdgeAssumesRole, Props: map[string]string{"mfa": "true"}},
+		{Src: "P", Dst: "X1", Kind: ingest.EdgeAttachedPolicy},
+		{Src: "X1", Dst: "X2", Kind: ingest.EdgeAttachedPolicy},
+		{Src: "X2", Dst: "X3", Kind: ingest.EdgeAttachedPolicy},
+		{Src: "X3", Dst: "T", Kind: ingest.EdgeAttachedPolicy},
+	} {
+		if err := g.AddEdge(e); err != nil {
+			t.Fatalf("Failed to add edge: %v", err)
+		}
+	}
+	return g
+}
+
+func TestFindAttackPathHopLimit(t *testing.T) {
+	g := newHopLimitGraph(t)
+
+	// The cheapest path is too long, so the dearer direct edge must win
+	result, err := g.FindAttackPath("P", "T", nil, 2, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("FindAttackPath failed: %v", err)
+	}
+	if !result.Found || len(result.Edges) != 1 {
+		t.Fatalf("Expected the one-hop path within 2 hops, got %+v", result)
+	}
+
+	result, err = g.FindAttackPath("P", "T", nil, 8, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("FindAttackPath failed: %v", err)
+	}
+	if !result.Found || len(result.Edges) != 4 {
+		t.Fatalf("Expected the cheaper four-hop path within 8 hops, got %+v", result)
+	}
+
+	if err := g.MarkSensitive("T"); err != nil {
+		t.Fatalf("MarkSensitive failed: %v", err)
+	}
+	result, err = g.FindAttackPath("P", "", []string{"sensitive"}, 2, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("FindAttackPath failed: %v", err)
+	}
+	if !result.Found || len(result.Edges) != 1 {
+		t.Errorf("Expected the nearest sensitive resource within 2 hops, got %+v", result)
+	}
+
+	pairs, err := g.PrivilegePaths([]string{"P"}, []string{"T"}, 3, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("PrivilegePaths failed: %v", err)
+	}
+	if len(pairs) != 1 || len(pairs[0].Edges) != 1 {
+		t.Errorf("Expected one pair over the direct edge, got %+v", pairs)
+	}
+}
@@ -0,0 +1,179 @@
+package graph
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+// Shape of the synthetic organisation: every principal holds
+// orgPoliciesPerPrincipal policies, every policy grants orgPermsPerPolicy
+// actions, and every permission applies to orgResourcesPerPerm resources,
+// for about a million edges in all
+const (
+	orgPrincipals           = 40000
+	orgPolicies             = 5000
+	orgPoliciesPerPrincipal = 5
+	orgPermsPerPolicy       = 40
+	orgResourcesPerPerm     = 3
+	orgResources            = 50000
+)
+
+var (
+	orgOnce  sync.Once
+	orgNodes []ingest.Node
+	orgEdges []ingest.Edge
+)
+
+// syntheticOrg returns the nodes and edges of an organisation-wide snapshot
+// shaped like ingested AWS data, with labels, props and provenance
+func syntheticOrg() ([]ingest.Node, []ingest.Edge) {
+	orgOnce.Do(func() {
+		prov := func(file string, i int) []ingest.Provenance {
+			return []ingest.Provenance{{Source: ingest.SourceAWS, File: file, Path: "/" + strconv.Itoa(i), Line: i + 1}}
+		}
+		principal := func(i int) string { return fmt.Sprintf("arn:aws:iam::111111111111:role/role-%d", i) }
+		policy := func(i int) string { return fmt.Sprintf("arn:aws:iam::111111111111:policy/policy-%d", i) }
+		resource := func(i int) string { return fmt.Sprintf("arn:aws:s3:::bucket-%d", i) }
+		actions := []string{"s3:GetObject", "s3:PutObject", "s3:ListBucket", "s3:*", "kms:Decrypt", "iam:PassRole", "ec2:RunInstances", "sts:AssumeRole"}
+
+		for i := 0; i < orgPrincipals; i++ {
+			orgNodes = append(orgNodes, ingest.Node{
+				ID: principal(i), Kind: ingest.KindPrincipal, Labels: []string{"aws-role"},
+				Props:      map[string]string{"name": fmt.Sprintf("role-%d", i), "account_id": "111111111111"},
+				Provenance: prov("roles.json", i),
+			})
+		}
+		for i := 0; i < orgPolicies; i++ {
+			orgNodes = append(orgNodes, ingest.Node{
+				ID: policy(i), Kind: ingest.KindPolicy, Labels: []string{"aws-policy"},
+				Props:      map[string]string{"name": fmt.Sprintf("policy-%d", i), "account_id": "111111111111"},
+				Provenance: prov("policies.json", i),
+			})
+		}
+		for i := 0; i < orgResources; i++ {
+			props := map[string]string{"account_id": "111111111111"}
+			if i%100 == 0 {
+				props["sensitive"] = "true"
+			}
+			orgNodes = append(orgNodes, ingest.Node{
+				ID: resource(i), Kind: ingest.KindResource, Labels: []string{"aws-resource"},
+				Props: props, Provenance: prov("policies.json", i),
+			})
+		}
+
+		for i := 0; i < orgPrincipals; i++ {
+			for j := 0; j < orgPoliciesPerPrincipal; j++ {
+				orgEdges = append(orgEdges, ingest.Edge{
+					Src: principal(i), Dst: policy((i*7 + j*131) % orgPolicies), Kind: ingest.EdgeAttachedPolicy,
+					Provenance: prov("attachments.json", i),
+				})
+			}
+		}
+		for i := 0; i < orgPolicies; i++ {
+			for j := 0; j < orgPermsPerPolicy; j++ {
+				action := actions[(i+j)%len(actions)]
+				perm := fmt.Sprintf("%s#stmt%d#%s", policy(i), j, action)
+				orgNodes = append(orgNodes, ingest.Node{
+					ID: perm, Kind: ingest.KindPerm,
+					Props:      map[string]string{"action": action, "wildcard": strconv.FormatBool(strings.HasSuffix(action, "*"))},
+					Provenance: prov("policies.json", i),
+				})
+				orgEdges = append(orgEdges, ingest.Edge{
+					Src: policy(i), Dst: perm, Kind: ingest.EdgeAllowsAction,
+					Props: map[string]string{"effect": "Allow"}, Provenance: prov("policies.json", i),
+				})
+				for k := 0; k < orgResourcesPerPerm; k++ {
+					orgEdges = append(orgEdges, ingest.Edge{
+						Src: perm, Dst: resource((i*orgPermsPerPolicy*orgResourcesPerPerm + j*orgResourcesPerPerm + k) % orgResources),
+						Kind: ingest.EdgeAppliesTo, Provenance: prov("policies.json", i),
+					})
+				}
+			}
+		}
+	})
+	return orgNodes, orgEdges
+}
+
+// loadOrg builds a frozen graph from the synthetic organisation
+func loadOrg(tb testing.TB, nodes []ingest.Node, edges []ingest.Edge) *Graph {
+	g := New()
+	for _, n := range nodes {
+		g.AddNode(n)
+	}
+	for _, e := range edges {
+		if err := g.AddEdge(e); err != nil {
+			tb.Fatalf("Failed to add edge: %v", err)
+		}
+	}
+	g.Freeze()
+	return g
+}
+
+// rssBytes returns the resident set size of the process, or 0 where
+// /proc/self/status is unavailable
+func rssBytes() uint64 {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) >= 2 && fields[0] == "VmRSS:" {
+			kb, _ := strconv.ParseUint(fields[1], 10, 64)
+			return kb * 1024
+		}
+	}
+	return 0
+}
+
+// BenchmarkLoad1MEdges loads a snapshot of about a million edges and reports
+// the heap the graph retains per edge and the process RSS afterwards (which
+// also holds the input nodes and edges)
+func BenchmarkLoad1MEdges(b *testing.B) {
+	nodes, edges := syntheticOrg()
+
+	var heap uint64
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		g := loadOrg(b, nodes, edges)
+
+		b.StopTimer()
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		heap = after.HeapAlloc - before.HeapAlloc
+		runtime.KeepAlive(g)
+		b.StartTimer()
+	}
+
+	b.ReportMetric(float64(len(edges)), "edges")
+	b.ReportMetric(float64(heap)/float64(len(edges)), "heap-B/edge")
+	b.ReportMetric(float64(rssBytes())/(1<<20), "rss-MB")
+}
+
+// BenchmarkWhoCanAccess1MEdges searches backwards from a sensitive resource
+// through a snapshot of about a million edges
+func BenchmarkWhoCanAccess1MEdges(b *testing.B) {
+	nodes, edges := syntheticOrg()
+	g := loadOrg(b, nodes, edges)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := g.WhoCanAccess("arn:aws:s3:::bucket-100", 4, EdgeFilter{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+func newBlastRadiusGraph(t *testing.T) *Graph {
+	t.Helper()
+
+	g := New()
+	for _, n := range []ingest.Node{
+		{ID: "arn:aws:iam::111111111111:role/Dev", Kind: ingest.KindPrincipal},
+		{ID: "arn:aws:iam::111111111111:role/Admin", Kind: ingest.KindPrincipal},
+		{ID: "arn:aws:iam::111111111111:policy/Read", Kind: ingest.KindPolicy},
+		{ID: "arn:aws:iam::111111111111:policy/Write", Kind: ingest.KindPolicy},
+		{ID: "read#s3:GetObject", Kind: ingest.KindPerm, Props: map[string]string{"action": "s3:GetObject"}},
+		{ID: "write#s3:PutObject", Kind: ingest.KindPerm, Props: map[string]string{"action": "s3:PutObject"}},
+		{ID: "write#kms:Decrypt", Kind: ingest.KindPerm, Props: map[string]string{"action": "kms:Decrypt"}},
+		{ID: "arn:aws:s3:::data", Kind: ingest.KindResource, Props: map[string]string{"sensitive": "true"}},
+		{ID: "arn:aws:s3:::logs", Kind: ingest.KindResource},
+		{ID: "arn:aws:kms:us-east-1:111111111111:key/k", Kind: ingest.KindResource},
+		{ID: "arn:aws:s3:::unreachable", Kind: ingest.KindResource},
+		{ID: "arn:aws:iam::111111111111:root", Kind: ingest.KindAccount},
+	} {
+		g.AddNode(n)
+	}
+
+	for _, e := range []ingest.Edge{
+		{Src: "arn:aws:iam::111111111111:role/Dev", Dst: "arn:aws:iam::111111111111:policy/Read", Kind: ingest.EdgeAttachedPolicy},
+		{Src: "arn:aws:iam::111111111111:policy/Read", Dst: "read#s3:GetObject", Kind: ingest.EdgeAllowsAction},
+		{Src: "read#s3:GetObject", Dst: "arn:aws:s3:::data", Kind: ingest.EdgeAppliesTo, Props: map[string]string{"action": "s3:GetObject"}},
+		{Src: "read#s3:GetObject", Dst: "arn:aws:s3:::logs", Kind: ingest.EdgeAppliesTo, Props: map[string]string{"action": "s3:GetObject"}},
+		{Src: "arn:aws:iam::111111111111:role/Dev", Dst: "arn:aws:iam::111111111111:role/Admin", Kind: ingest.EdgeAssumesRole},
+		{Src: "arn:aws:iam::111111111111:role/Admin", Dst: "arn:aws:iam::111111111111:policy/Write", Kind: ingest.EdgeAttachedPolicy},
+		{Src: "arn:aws:iam::111111111111:policy/Write", Dst: "write#s3:PutObject", Kind: ingest.EdgeAllowsAction},
+		{Src: "arn:aws:iam::111111111111:policy/Write", Dst: "write#kms:Decrypt", Kind: ingest.EdgeAllowsAction},
+		{Src: "write#s3:PutObject", Dst: "arn:aws:s3:::data", Kind: ingest.EdgeAppliesTo, Props: map[string]string{"action": "s3:PutObject"}},
+		{Src: "write#kms:Decrypt", Dst: "arn:aws:kms:us-east-1:111111111111:key/k", Kind: ingest.EdgeAppliesTo, Props: map[string]string{"action": "kms:Decrypt"}},
+		// Membership grants nothing, so the account must not lead anywhere
+		{Src: "arn:aws:iam::111111111111:role/Dev", Dst: "arn:aws:iam::111111111111:root", Kind: ingest.EdgeInAccount},
+		{Src: "arn:aws:s3:::unreachable", Dst: "arn:aws:iam::111111111111:root", Kind: ingest.EdgeInAccount},
+	} {
+		if err := g.AddEdge(e); err != nil {
+			t.Fatalf("Failed to add edge: %v", err)
+		}
+	}
+	return g
+}
+
+func TestBlastRadius(t *testing.T) {
+	g := newBlastRadiusGraph(t)
+
+	br, err := g.BlastRadius("arn:aws:iam::111111111111:role/Dev", 8, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("BlastRadius failed: %v", err)
+	}
+
+	want := []ReachableResource{
+		{Type: "s3", Hops: 3, Actions: []string{"s3:GetObject", "s3:PutObject"}, Sensitive: true},
+		{Type: "s3", Hops: 3, Actions: []string{"s3:GetObject"}},
+		{Type: "kms", Hops: 4, Actions: []string{"kms:Decrypt"}},
+	}
+	wantIDs := []string{"arn:aws:s3:::data", "arn:aws:s3:::logs", "arn:aws:kms:us-east-1:111111111111:key/k"}
+
+	if len(br.Resources) != len(want) {
+		t.Fatalf("Expected %d resources, got %d: %+v", len(want), len(br.Resources), br.Resources)
+	}
+	for i, w := range want {
+		got := br.Resources[i]
+		if got.Node.ID != wantIDs[i] || got.Type != w.Type || got.Hops != w.Hops ||
+			got.Sensitive != w.Sensitive || !reflect.DeepEqual(got.Actions, w.Actions) {
+			t.Errorf("Resource %d: expected %s %+v, got %s %+v", i, wantIDs[i], w, got.Node.ID, got)
+		}
+	}
+
+	wantByType := []ResourceTypeSummary{
+		{Type: "kms", Resources: 1},
+		{Type: "s3", Resources: 2, Sensitive: 1},
+	}
+	if !reflect.DeepEqual(br.ByType, wantByType) {
+		t.Errorf("Expected summary %+v, got %+v", wantByType, br.ByType)
+	}
+	if br.Sensitive != 1 {
+		t.Errorf("Expected 1 sensitive resource, got %d", br.Sensitive)
+	}
+}
+
+func TestBlastRadiusLimits(t *testing.T) {
+	g := newBlastRadiusGraph(t)
+
+	br, err := g.BlastRadius("arn:aws:iam::111111111111:role/Dev", 3, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("BlastRadius failed: %v", err)
+	}
+	if len(br.Resources) != 2 {
+		t.Errorf("Expected 2 resources within 3 hops, got %d", len(br.Resources))
+	}
+	// Only the read policy is within reach, so PutObject is not listed
+	if got := br.Resources[0].Actions; !reflect.DeepEqual(got, []string{"s3:GetObject"}) {
+		t.Errorf("Expected only s3:GetObject within 3 hops, got %v", got)
+	}
+
+	br, err = g.BlastRadius("arn:aws:iam::111111111111:role/Dev", 8, EdgeFilter{Deny: []string{ingest.EdgeAssumesRole}})
+	if err != nil {
+		t.Fatalf("BlastRadius failed: %v", err)
+	}
+	if len(br.Resources) != 2 {
+		t.Errorf("Expected 2 resources without role assumption, got %d", len(br.Resources))
+	}
+
+	if _, err := g.BlastRadius("missing", 8, EdgeFilter{}); err == nil {
+		t.Error("Expected error for unknown principal")
+	}
+}
+
+func TestResourceType(t *testing.T) {
+	tests := map[string]ingest.Node{
+		"s3":            {ID: "arn:aws:s3:::bucket"},
+		"kms":           {ID: "arn:aws:kms:us-east-1:111111111111:key/k"},
+		"*":             {ID: "*"},
+		"NetworkPolicy": {ID: "k8s:netpol:default:deny", Props: map[string]string{"type": "NetworkPolicy"}},
+		"other":         {ID: "k8s:secret:x"},
+	}
+	for want, node := range tests {
+		if got := resourceType(node); got != want {
+			t.Errorf("resourceType(%s) = %q, want %q", node.ID, got, want)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+// DefaultChokePoints is how many choke points callers show by default
+const DefaultChokePoints = 20
+
+// Choke point kinds
+const (
+	ChokePointNode = "node"
+	ChokePointEdge = "edge"
+)
+
+// ChokePointAnalysis ranks the nodes and edges whose removal would cut the
+// most attack paths from principals to sensitive resources
+type ChokePointAnalysis struct {
+	MaxHops int `json:"maxHops"`
+	// Pairs counts the principal → sensitive resource pairs with a path
+	Pairs int `json:"pairs"`
+	// Paths counts the attack paths enumerated across all pairs
+	Paths int `json:"paths"`
+	// Truncated is set when a principal hit the path limit or the analysis
+	// ran out of expansion budget, in which case the counts are lower bounds
+	Truncated bool `json:"truncated"`
+	// ChokePoints are sorted by PairsCut, then Paths, descending
+	ChokePoints []ChokePoint `json:"chokePoints"`
+}
+
+// ChokePoint is a node or edge that lies on attack paths. Exactly one of
+// Node and Edge is set, according to Kind.
+type ChokePoint struct {
+	Kind string       `json:"kind"`
+	Node *ingest.Node `json:"node,omitempty"`
+	Edge *ingest.Edge `json:"edge,omitempty"`
+	// Paths counts the attack paths through this element
+	Paths int `json:"paths"`
+	// PairsCut counts the pairs whose every path runs through this element,
+	// so that removing it alone disconnects them (a minimum cut of one).
+	// Only pairs whose paths were all enumerated are counted, since a path
+	// left out could bypass the element, and an edge is not counted where
+	// another allowed edge joins the same two nodes, since that one bypasses it.
+	PairsCut    int    `json:"pairsCut"`
+	Remediation string `json:"remediation"`
+}
+
+// ChokePoints enumerates the attack paths of at most maxHops from every
+// principal to every sensitive resource, following only edges allowed by
+// filter, and ranks the nodes and edges on them by how many principal →
+// resource pairs and paths removing them would cut. Path endpoints are not
+// counted as choke points of their own paths. At most pathLimit paths are
+// enumerated per principal, as in AllAttackPaths, and all principals share a
+// single budget of MaxPathExpansions edges, so the analysis stays bounded on
+// large graphs.
+func (g *Graph) ChokePoints(maxHops, pathLimit int, filter EdgeFilter) (*ChokePointAnalysis, error) {
+	if maxHops <= 0 {
+		maxHops = DefaultMaxHops
+	}
+	if pathLimit <= 0 {
+		pathLimit = DefaultPathLimit
+	}
+
+	analysis := &ChokePointAnalysis{
+		MaxHops:     maxHops,
+		ChokePoints: []ChokePoint{},
+	}
+
+	var principals []string
+	for i, id := range g.nodeIDs {
+		if g.nodeKind(int32(i)) == ingest.KindPrincipal {
+			principals = append(principals, id)
+		}
+	}
+	sort.Strings(principals)
+
+	points := make(map[string]*ChokePoint)
+	v := g.flowView(filter)
+	budget := MaxPathExpansions
+	for _, principal := range principals {
+		paths, complete, err := g.allAttackPaths(principal, "", []string{"sensitive"}, maxHops, pathLimit, filter, &budget)
+		if err != nil {
+			return nil, err
+		}
+		if !complete {
+			analysis.Truncated = true
+		}
+
+		byTarget := make(map[string][]*AttackPathResult)
+		for _, p := range paths {
+			target := p.Nodes[len(p.Nodes)-1].ID
+			byTarget[target] = append(byTarget[target], p)
+		}
+
+		for _, pairPaths := range byTarget {
+			analysis.Pairs++
+			analysis.Paths += len(pairPaths)
+
+			through := make(map[string]int)
+			bypassed := make(map[string]bool)
+			for _, p := range pairPaths {
+				for _, key := range chokePointsOnPath(p, points) {
+					through[key]++
+				}
+				g.markBypassed(p, v, bypassed)
+			}
+			for key, n := range through {
+				points[key].Paths += n
+				if complete && n == len(pairPaths) && !bypassed[key] {
+					points[key].PairsCut++
+				}
+			}
+		}
+	}
+
+	for _, point := range points {
+		point.Remediation = chokePointRemediation(*point)
+		analysis.ChokePoints = append(analysis.ChokePoints, *point)
+	}
+
+	sort.Slice(analysis.ChokePoints, func(i, j int) bool {
+		a, b := analysis.ChokePoints[i], analysis.ChokePoints[j]
+		if a.PairsCut != b.PairsCut {
+			return a.PairsCut > b.PairsCut
+		}
+		if a.Paths != b.Paths {
+			return a.Paths > b.Paths
+		}
+		return chokePointKey(a) < chokePointKey(b)
+	})
+
+	return analysis, nil
+}
+
+// chokePointsOnPath returns the keys of the intermediate nodes and the edges
+// of a path, registering any not yet in points
+func chokePointsOnPath(p *AttackPathResult, points map[string]*ChokePoint) []string {
+	var keys []string
+	seen := make(map[string]bool)
+
+	add := func(point ChokePoint) {
+		key := chokePointKey(point)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		if _, ok := points[key]; !ok {
+			points[key] = &point
+		}
+		keys = append(keys, key)
+	}
+
+	for i := 1; i < len(p.Nodes)-1; i++ {
+		node := p.Nodes[i]
+		add(ChokePoint{Kind: ChokePointNode, Node: &node})
+	}
+	for i := range p.Edges {
+		edge := p.Edges[i]
+		add(ChokePoint{Kind: ChokePointEdge, Edge: &edge})
+	}
+
+	return keys
+}
+
+// markBypassed records in bypassed the keys of the edges of p that another
+// edge v allows runs alongside. Paths are enumerated by node sequence, so
+// removing such an edge leaves the hop open and cuts none of them.
+func (g *Graph) markBypassed(p *AttackPathResult, v view, bypassed map[string]bool) {
+	for i := range p.Edges {
+		src, dst := g.nodeIndex[p.Nodes[i].ID], g.nodeIndex[p.Nodes[i+1].ID]
+		steps := 0
+		for range v.steps(src, dst) {
+			steps++
+		}
+		if steps > 1 {
+			bypassed[chokePointKey(ChokePoint{Kind: ChokePointEdge, Edge: &p.Edges[i]})] = true
+		}
+	}
+}
+
+// chokePointKey identifies a choke point
+func chokePointKey(point ChokePoint) string {
+	if point.Kind == ChokePointNode {
+		return "node:" + point.Node.ID
+	}
+	return "edge:" + point.Edge.Key()
+}
+
+// chokePointRemediation describes how to remove a choke point
+func chokePointRemediation(point ChokePoint) string {
+	if point.Kind == ChokePointNode {
+		node := point.Node
+		switch node.Kind {
+		case ingest.KindPolicy:
+			return fmt.Sprintf("Restrict or detach policy %s", node.ID)
+		case ingest.KindPrincipal:
+			return fmt.Sprintf("Restrict who can assume or act as %s", node.ID)
+		case ingest.KindRole:
+			return fmt.Sprintf("Restrict the rules or bindings of role %s", node.ID)
+		case ingest.KindPerm:
+			return fmt.Sprintf("Remove or scope down permission %s", node.ID)
+		default:
+			return fmt.Sprintf("Review %s", node.ID)
+		}
+	}
+
+	edge := point.Edge
+	switch edge.Kind {
+	case ingest.EdgeAttachedPolicy:
+		return fmt.Sprintf("Detach %s from %s", edge.Dst, edge.Src)
+	case ingest.EdgeAssumesRole:
+		return fmt.Sprintf("Remove %s from the trust policy of %s", edge.Src, edge.Dst)
+	case ingest.EdgeBindsTo:
+		return fmt.Sprintf("Remove %s from the bindings of %s", edge.Dst, edge.Src)
+	case ingest.EdgeAllowsAction:
+		return fmt.Sprintf("Remove permission %s from %s", edge.Dst, edge.Src)
+	case ingest.EdgeAppliesTo:
+		return fmt.Sprintf("Exclude %s from the resources of %s", edge.Dst, edge.Src)
+	default:
+		return fmt.Sprintf("Remove the %s edge from %s to %s", edge.Kind, edge.Src, edge.Dst)
+	}
+}
@@ -0,0 +1,152 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+func TestChokePoints(t *testing.T) {
+	g := newBlastRadiusGraph(t)
+
+	analysis, err := g.ChokePoints(8, 0, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("ChokePoints failed: %v", err)
+	}
+
+	// Dev reaches the data bucket via its own policy and via Admin; Admin
+	// only via the write policy
+	if analysis.Pairs != 2 || analysis.Paths != 3 || analysis.Truncated {
+		t.Errorf("Expected 2 pairs and 3 paths, got %+v", analysis)
+	}
+
+	// The write policy route cuts Admin off entirely and one of Dev's paths
+	top := analysis.ChokePoints[0]
+	if top.PairsCut != 1 || top.Paths != 2 {
+		t.Errorf("Expected top choke point to cut 1 pair and 2 paths, got %+v", top)
+	}
+
+	found := false
+	for _, point := range analysis.ChokePoints {
+		if point.Kind == ChokePointNode && point.Node.ID == "arn:aws:iam::111111111111:policy/Write" {
+			found = true
+			if point.PairsCut != 1 || point.Paths != 2 {
+				t.Errorf("Unexpected counts for write policy: %+v", point)
+			}
+			if point.Remediation != "Restrict or detach policy arn:aws:iam::111111111111:policy/Write" {
+				t.Errorf("Unexpected remediation %q", point.Remediation)
+			}
+		}
+		if point.Kind == ChokePointNode && point.Node.ID == "arn:aws:iam::111111111111:role/Dev" {
+			t.Error("Path sources must not be choke points of their own paths")
+		}
+	}
+	if !found {
+		t.Error("Expected the write policy to be a choke point")
+	}
+
+	for i := 1; i < len(analysis.ChokePoints); i++ {
+		a, b := analysis.ChokePoints[i-1], analysis.ChokePoints[i]
+		if a.PairsCut < b.PairsCut || (a.PairsCut == b.PairsCut && a.Paths < b.Paths) {
+			t.Fatalf("Choke points not ranked at %d: %+v before %+v", i, a, b)
+		}
+	}
+}
+
+func TestChokePointsLimits(t *testing.T) {
+	g := newBlastRadiusGraph(t)
+
+	analysis, err := g.ChokePoints(8, 0, EdgeFilter{Deny: []string{ingest.EdgeAssumesRole}})
+	if err != nil {
+		t.Fatalf("ChokePoints failed: %v", err)
+	}
+	// Without role assumption every path is the only one for its pair, so
+	// every element on it cuts that pair
+	if analysis.Pairs != 2 || analysis.Paths != 2 {
+		t.Errorf("Expected 2 pairs and 2 paths, got %+v", analysis)
+	}
+	for _, point := range analysis.ChokePoints {
+		if point.PairsCut != 1 {
+			t.Errorf("Expected every choke point to cut one pair, got %+v", point)
+		}
+	}
+
+	analysis, err = g.ChokePoints(8, 1, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("ChokePoints failed: %v", err)
+	}
+	if !analysis.Truncated {
+		t.Error("Expected truncation with a path limit of 1")
+	}
+	// Dev's one enumerated path runs via Admin, but its other path does not,
+	// so the role assumption must not be credited with cutting the pair
+	for _, point := range analysis.ChokePoints {
+		if point.Kind == ChokePointEdge && point.Edge.Kind == ingest.EdgeAssumesRole && point.PairsCut != 0 {
+			t.Errorf("Expected no pairs cut from a truncated enumeration, got %+v", point)
+		}
+	}
+}
+
+func TestChokePointsParallelEdges(t *testing.T) {
+	g := New()
+	for _, n := range []ingest.Node{
+		{ID: "u", Kind: ingest.KindPrincipal},
+		{ID: "r", Kind: ingest.KindPrincipal},
+		{ID: "policy", Kind: ingest.KindPolicy},
+		{ID: "perm", Kind: ingest.KindPerm},
+		{ID: "bucket", Kind: ingest.KindResource, Props: map[string]string{"sensitive": "true"}},
+	} {
+		g.AddNode(n)
+	}
+	for _, e := range []ingest.Edge{
+		{Src: "u", Dst: "r", Kind: ingest.EdgeAssumesRole},
+		{Src: "u", Dst: "r", Kind: ingest.EdgeCanEscalateTo},
+		{Src: "r", Dst: "policy", Kind: ingest.EdgeAttachedPolicy},
+		{Src: "policy", Dst: "perm", Kind: ingest.EdgeAllowsAction},
+		{Src: "perm", Dst: "bucket", Kind: ingest.EdgeAppliesTo},
+	} {
+		if err := g.AddEdge(e); err != nil {
+			t.Fatalf("Failed to add edge: %v", err)
+		}
+	}
+
+	analysis, err := g.ChokePoints(8, 0, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("ChokePoints failed: %v", err)
+	}
+
+	// Removing either edge from u to r leaves the other, so neither cuts u
+	// off, while the single edge from r to its policy does
+	for _, point := range analysis.ChokePoints {
+		if point.Kind != ChokePointEdge || point.Edge.Src != "u" {
+			continue
+		}
+		if point.PairsCut != 0 {
+			t.Errorf("Expected a bypassed edge to cut no pairs, got %+v", point)
+		}
+	}
+	for _, point := range analysis.ChokePoints {
+		if point.Kind == ChokePointEdge && point.Edge.Kind == ingest.EdgeAttachedPolicy && point.PairsCut != 2 {
+			t.Errorf("Expected the policy attachment to cut both pairs, got %+v", point)
+		}
+	}
+}
+
+func TestChokePointRemediation(t *testing.T) {
+	tests := []struct {
+		edge ingest.Edge
+		want string
+	}{
+		{ingest.Edge{Src: "role", Dst: "policy", Kind: ingest.EdgeAttachedPolicy}, "Detach policy from role"},
+		{ingest.Edge{Src: "user", Dst: "role", Kind: ingest.EdgeAssumesRole}, "Remove user from the trust policy of role"},
+		{ingest.Edge{Src: "cr", Dst: "sa", Kind: ingest.EdgeBindsTo}, "Remove sa from the bindings of cr"},
+		{ingest.Edge{Src: "perm", Dst: "bucket", Kind: ingest.EdgeAppliesTo}, "Exclude bucket from the resources of perm"},
+	}
+
+	for _, tt := range tests {
+		edge := tt.edge
+		if got := chokePointRemediation(ChokePoint{Kind: ChokePointEdge, Edge: &edge}); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", edge.Kind, tt.want, got)
+		}
+	}
+}
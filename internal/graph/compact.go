@@ -0,0 +1,292 @@
+package graph
+
+import (
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+// symbols interns strings, so that each distinct kind, label, property key or
+// value and provenance field is stored once and referred to by a uint32.
+// Symbol 0 stands for "absent" and is never handed out.
+type symbols struct {
+	ids  map[string]uint32
+	strs []string
+}
+
+func newSymbols() *symbols {
+	return &symbols{ids: make(map[string]uint32), strs: []string{""}}
+}
+
+// intern returns the symbol of s, adding it if new
+func (s *symbols) intern(str string) uint32 {
+	if sym, ok := s.ids[str]; ok {
+		return sym
+	}
+	sym := uint32(len(s.strs))
+	s.ids[str] = sym
+	s.strs = append(s.strs, str)
+	return sym
+}
+
+// lookup returns the symbol of s if it has been interned
+func (s *symbols) lookup(str string) (uint32, bool) {
+	sym, ok := s.ids[str]
+	return sym, ok
+}
+
+// str returns the string a symbol stands for
+func (s *symbols) str(sym uint32) string {
+	return s.strs[sym]
+}
+
+func (s *symbols) clone() *symbols {
+	c := &symbols{ids: make(map[string]uint32, len(s.ids)), strs: append([]string(nil), s.strs...)}
+	for str, sym := range s.ids {
+		c.ids[str] = sym
+	}
+	return c
+}
+
+// columns stores string properties column-wise: one column per key holding
+// the value symbol of each row, 0 where the row lacks the key. A column only
+// extends to the last row that sets it, so rare keys stay cheap.
+type columns struct {
+	// keys lists the key symbols in the order they were first set
+	keys []uint32
+	cols map[uint32][]uint32
+}
+
+func newColumns() columns {
+	return columns{cols: make(map[uint32][]uint32)}
+}
+
+// set stores value (a symbol, or 0 to clear) under key for row
+func (c *columns) set(row int, key, value uint32) {
+	col, ok := c.cols[key]
+	if !ok {
+		if value == 0 {
+			return
+		}
+		c.keys = append(c.keys, key)
+	}
+	if row >= len(col) {
+		if value == 0 {
+			return
+		}
+		col = append(col, make([]uint32, row+1-len(col))...)
+	}
+	col[row] = value
+	c.cols[key] = col
+}
+
+// get returns the value symbol under key for row, 0 if absent
+func (c *columns) get(row int, key uint32) uint32 {
+	col := c.cols[key]
+	if row >= len(col) {
+		return 0
+	}
+	return col[row]
+}
+
+// setRow replaces the properties of row with props
+func (c *columns) setRow(row int, props map[string]string, syms *symbols) {
+	for _, key := range c.keys {
+		c.set(row, key, 0)
+	}
+	for k, v := range props {
+		c.set(row, syms.intern(k), syms.intern(v))
+	}
+}
+
+// row returns the properties of row, nil if it has none
+func (c *columns) row(row int, syms *symbols) map[string]string {
+	var props map[string]string
+	for _, key := range c.keys {
+		if v := c.get(row, key); v != 0 {
+			if props == nil {
+				props = make(map[string]string)
+			}
+			props[syms.str(key)] = syms.str(v)
+		}
+	}
+	return props
+}
+
+func (c columns) clone() columns {
+	cc := columns{keys: append([]uint32(nil), c.keys...), cols: make(map[uint32][]uint32, len(c.cols))}
+	for k, col := range c.cols {
+		cc.cols[k] = append([]uint32(nil), col...)
+	}
+	return cc
+}
+
+// provRef is an ingest.Provenance with its strings interned
+type provRef struct {
+	source, file, path uint32
+	line               int32
+}
+
+// provenances stores the provenance of each row. Almost every node and edge
+// has exactly one source, which is kept inline; the rare extra sources of
+// merged entities are kept aside.
+type provenances struct {
+	first []provRef
+	rest  map[int32][]provRef
+}
+
+// setRow replaces the provenance of row with prov
+func (p *provenances) setRow(row int, prov []ingest.Provenance, syms *symbols) {
+	for row >= len(p.first) {
+		p.first = append(p.first, provRef{})
+	}
+
+	ref := func(pr ingest.Provenance) provRef {
+		return provRef{source: syms.intern(pr.Source), file: syms.intern(pr.File), path: syms.intern(pr.Path), line: int32(pr.Line)}
+	}
+
+	delete(p.rest, int32(row))
+	if len(prov) == 0 {
+		p.first[row] = provRef{}
+		return
+	}
+	p.first[row] = ref(prov[0])
+	if len(prov) > 1 {
+		if p.rest == nil {
+			p.rest = make(map[int32][]provRef)
+		}
+		extra := make([]provRef, len(prov)-1)
+		for i, pr := range prov[1:] {
+			extra[i] = ref(pr)
+		}
+		p.rest[int32(row)] = extra
+	}
+}
+
+// row returns the provenance of row, nil if it has none
+func (p *provenances) row(row int, syms *symbols) []ingest.Provenance {
+	if row >= len(p.first) || p.first[row].source == 0 {
+		return nil
+	}
+	prov := func(r provRef) ingest.Provenance {
+		return ingest.Provenance{Source: syms.str(r.source), File: syms.str(r.file), Path: syms.str(r.path), Line: int(r.line)}
+	}
+
+	extra := p.rest[int32(row)]
+	out := make([]ingest.Provenance, 1, 1+len(extra))
+	out[0] = prov(p.first[row])
+	for _, r := range extra {
+		out = append(out, prov(r))
+	}
+	return out
+}
+
+func (p provenances) clone() provenances {
+	c := provenances{first: append([]provRef(nil), p.first...)}
+	if len(p.rest) > 0 {
+		c.rest = make(map[int32][]provRef, len(p.rest))
+		for row, extra := range p.rest {
+			c.rest[row] = append([]provRef(nil), extra...)
+		}
+	}
+	return c
+}
+
+// adjacency indexes edges by endpoint in compressed sparse row form: the
+// edges leaving node n are out[outOff[n]:outOff[n+1]] and those entering it
+// in[inOff[n]:inOff[n+1]], each in insertion order. Edges added since the
+// last rebuild are kept in short per-node pending lists, and the arrays are
+// rebuilt once the pending edges outgrow a fraction of the built ones, so
+// that loading E edges costs O(E) overall.
+type adjacency struct {
+	// built counts the edges the arrays cover
+	built         int
+	outOff, inOff []int32
+	out, in       []int32
+	pending       int
+	pendingOut    map[int32][]int32
+	pendingIn     map[int32][]int32
+}
+
+// minRebuild is how many edges may be pending before a rebuild is considered
+const minRebuild = 4096
+
+// add records edge idx from src to dst, rebuilding over all edges src and
+// dst (indexed by edge) when enough are pending
+func (a *adjacency) add(idx int, src, dst []int32, nodes int) {
+	if a.pendingOut == nil {
+		a.pendingOut = make(map[int32][]int32)
+		a.pendingIn = make(map[int32][]int32)
+	}
+	a.pendingOut[src[idx]] = append(a.pendingOut[src[idx]], int32(idx))
+	a.pendingIn[dst[idx]] = append(a.pendingIn[dst[idx]], int32(idx))
+	a.pending++
+
+	if a.pending > minRebuild && a.pending > a.built/4 {
+		a.rebuild(src, dst, nodes)
+	}
+}
+
+// rebuild indexes every edge in the arrays and clears the pending lists,
+// with a counting sort by endpoint that keeps insertion order
+func (a *adjacency) rebuild(src, dst []int32, nodes int) {
+	a.outOff, a.out = csr(src, nodes)
+	a.inOff, a.in = csr(dst, nodes)
+	a.built = len(src)
+	a.pending = 0
+	a.pendingOut = nil
+	a.pendingIn = nil
+}
+
+// csr groups edge positions by endpoint
+func csr(ends []int32, nodes int) ([]int32, []int32) {
+	off := make([]int32, nodes+1)
+	for _, n := range ends {
+		off[n+1]++
+	}
+	for n := 0; n < nodes; n++ {
+		off[n+1] += off[n]
+	}
+
+	next := append([]int32(nil), off[:nodes]...)
+	idxs := make([]int32, len(ends))
+	for idx, n := range ends {
+		idxs[next[n]] = int32(idx)
+		next[n]++
+	}
+	return off, idxs
+}
+
+// lines returns the positions of the edges leaving (out) or entering node n,
+// in insertion order. The result may share memory with a and must not be
+// modified.
+func (a *adjacency) lines(n int32, out bool) []int32 {
+	off, idxs, pending := a.inOff, a.in, a.pendingIn[n]
+	if out {
+		off, idxs, pending = a.outOff, a.out, a.pendingOut[n]
+	}
+
+	var built []int32
+	if int(n)+1 < len(off) {
+		built = idxs[off[n]:off[n+1]]
+	}
+	switch {
+	case len(pending) == 0:
+		return built
+	case len(built) == 0:
+		return pending
+	}
+	return append(append(make([]int32, 0, len(built)+len(pending)), built...), pending...)
+}
+
+// degree counts the edges leaving (out) or entering node n
+func (a *adjacency) degree(n int32, out bool) int {
+	off, pending := a.inOff, a.pendingIn[n]
+	if out {
+		off, pending = a.outOff, a.pendingOut[n]
+	}
+
+	d := len(pending)
+	if int(n)+1 < len(off) {
+		d += int(off[n+1] - off[n])
+	}
+	return d
+}
@@ -0,0 +1,135 @@
+package graph
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+func TestCompactRoundTrip(t *testing.T) {
+	g := New()
+
+	first := ingest.Node{
+		ID:         "arn:aws:iam::123456789012:user/alice",
+		Kind:       ingest.KindPrincipal,
+		Labels:     []string{"aws-user"},
+		Props:      map[string]string{"name": "alice"},
+		Provenance: []ingest.Provenance{{Source: ingest.SourceAWS, File: "users.json", Path: "/0", Line: 3}},
+	}
+	g.AddNode(first)
+	g.AddNode(ingest.Node{
+		ID:         first.ID,
+		Labels:     []string{"admin"},
+		Props:      map[string]string{"team": "platform"},
+		Provenance: []ingest.Provenance{{Source: ingest.SourceAWS, File: "groups.json", Path: "/1", Line: 7}},
+	})
+	g.AddNode(ingest.Node{ID: "bare", Kind: ingest.KindResource})
+
+	want := ingest.CloneNode(first)
+	ingest.MergeNode(&want, ingest.Node{
+		ID:         first.ID,
+		Labels:     []string{"admin"},
+		Props:      map[string]string{"team": "platform"},
+		Provenance: []ingest.Provenance{{Source: ingest.SourceAWS, File: "groups.json", Path: "/1", Line: 7}},
+	})
+	if got, _ := g.GetNode(first.ID); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected merged node %+v, got %+v", want, got)
+	}
+
+	// A node without labels, props or provenance comes back with nil fields
+	if got, _ := g.GetNode("bare"); !reflect.DeepEqual(got, ingest.Node{ID: "bare", Kind: ingest.KindResource}) {
+		t.Errorf("Expected bare node, got %+v", got)
+	}
+
+	edge := ingest.Edge{Src: first.ID, Dst: "bare", Kind: ingest.EdgeAppliesTo, Props: map[string]string{"action": "s3:GetObject"}}
+	if err := g.AddEdge(edge); err != nil {
+		t.Fatalf("Failed to add edge: %v", err)
+	}
+	if err := g.AddEdge(ingest.Edge{Src: first.ID, Dst: "bare", Kind: ingest.EdgeAppliesTo, Props: map[string]string{"effect": "Allow"}}); err != nil {
+		t.Fatalf("Failed to add edge: %v", err)
+	}
+
+	edges := g.GetEdges()
+	if len(edges) != 1 {
+		t.Fatalf("Expected duplicate edge to merge, got %d edges", len(edges))
+	}
+	if want := map[string]string{"action": "s3:GetObject", "effect": "Allow"}; !reflect.DeepEqual(edges[0].Props, want) {
+		t.Errorf("Expected merged props %v, got %v", want, edges[0].Props)
+	}
+}
+
+func TestCompactAdjacency(t *testing.T) {
+	g := New()
+	g.AddNode(ingest.Node{ID: "hub", Kind: ingest.KindPolicy})
+
+	// Enough edges to force several rebuilds, with some left pending
+	count := 3*minRebuild + 17
+	for i := 0; i < count; i++ {
+		id := fmt.Sprintf("perm-%d", i)
+		g.AddNode(ingest.Node{ID: id, Kind: ingest.KindPerm})
+		if err := g.AddEdge(ingest.Edge{Src: "hub", Dst: id, Kind: ingest.EdgeAllowsAction}); err != nil {
+			t.Fatalf("Failed to add edge: %v", err)
+		}
+	}
+
+	check := func(stage string) {
+		hub := g.nodeIndex["hub"]
+		lines := g.linesFrom(hub)
+		if len(lines) != count || g.adj.degree(hub, true) != count {
+			t.Fatalf("%s: expected %d edges from hub, got %d (degree %d)", stage, count, len(lines), g.adj.degree(hub, true))
+		}
+		for i, idx := range lines {
+			if int(idx) != i {
+				t.Fatalf("%s: expected edges in insertion order, got %d at %d", stage, idx, i)
+			}
+		}
+		if to := g.linesTo(g.nodeIndex["perm-5"]); len(to) != 1 || g.edgeSrc[to[0]] != hub {
+			t.Errorf("%s: expected one edge into perm-5 from hub, got %v", stage, to)
+		}
+	}
+
+	if g.adj.pending == 0 {
+		t.Fatal("Expected some edges to be pending before freeze")
+	}
+	check("pending")
+
+	g.Freeze()
+	if g.adj.pending != 0 {
+		t.Errorf("Expected freeze to index pending edges, %d left", g.adj.pending)
+	}
+	check("frozen")
+
+	c := g.Clone()
+	if err := c.AddEdge(ingest.Edge{Src: "perm-0", Dst: "perm-1", Kind: ingest.EdgeAllowsAction}); err != nil {
+		t.Fatalf("Failed to add edge to clone: %v", err)
+	}
+	if len(g.linesFrom(g.nodeIndex["perm-0"])) != 0 {
+		t.Error("Expected clone edges to leave the original untouched")
+	}
+}
+
+func TestColumnsSetRow(t *testing.T) {
+	syms := newSymbols()
+	c := newColumns()
+
+	c.setRow(0, map[string]string{"a": "1", "b": "2"}, syms)
+	c.setRow(2, map[string]string{"c": "3"}, syms)
+	c.setRow(0, map[string]string{"b": "4"}, syms)
+
+	if got := c.row(0, syms); !reflect.DeepEqual(got, map[string]string{"b": "4"}) {
+		t.Errorf("Expected row 0 to be replaced, got %v", got)
+	}
+	if got := c.row(1, syms); got != nil {
+		t.Errorf("Expected empty row 1, got %v", got)
+	}
+	if got := c.row(2, syms); !reflect.DeepEqual(got, map[string]string{"c": "3"}) {
+		t.Errorf("Expected row 2 props, got %v", got)
+	}
+
+	// Rare keys only extend as far as the last row that sets them
+	if n := len(c.cols[syms.intern("a")]); n != 1 {
+		t.Errorf("Expected column a to cover 1 row, covers %d", n)
+	}
+}
@@ -0,0 +1,314 @@
+package graph
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+// Escalation target kinds: what a technique gains control of
+const (
+	EscalateToRole   = "role"
+	EscalateToUser   = "user"
+	EscalateToPolicy = "policy"
+)
+
+// EscalationTechnique is a known IAM privilege-escalation pattern
+type EscalationTechnique struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Actions must all be allowed to the principal. The resources the first
+	// action is allowed on select the targets.
+	Actions []string `json:"actions"`
+	// Target is the kind of node gained, one of the EscalateTo constants
+	Target string `json:"target"`
+	// SelfOnly techniques only raise the principal's own permissions, so
+	// they escalate when the principal is its own target
+	SelfOnly bool `json:"selfOnly"`
+}
+
+// EscalationTechniques is the catalog of techniques the engine recognises
+var EscalationTechniques = []EscalationTechnique{
+	{
+		ID:      "passrole-lambda",
+		Name:    "Pass a role to a new Lambda function and invoke it",
+		Actions: []string{"iam:PassRole", "lambda:CreateFunction", "lambda:InvokeFunction"},
+		Target:  EscalateToRole,
+	},
+	{
+		ID:      "passrole-lambda-event-source",
+		Name:    "Pass a role to a new Lambda function triggered by an event source",
+		Actions: []string{"iam:PassRole", "lambda:CreateFunction", "lambda:CreateEventSourceMapping"},
+		Target:  EscalateToRole,
+	},
+	{
+		ID:      "passrole-ec2",
+		Name:    "Pass a role to a new EC2 instance profile",
+		Actions: []string{"iam:PassRole", "ec2:RunInstances"},
+		Target:  EscalateToRole,
+	},
+	{
+		ID:      "passrole-cloudformation",
+		Name:    "Pass a role to a new CloudFormation stack",
+		Actions: []string{"iam:PassRole", "cloudformation:CreateStack"},
+		Target:  EscalateToRole,
+	},
+	{
+		ID:      "passrole-glue",
+		Name:    "Pass a role to a new Glue development endpoint",
+		Actions: []string{"iam:PassRole", "glue:CreateDevEndpoint"},
+		Target:  EscalateToRole,
+	},
+	{
+		ID:      "passrole-datapipeline",
+		Name:    "Pass a role to a new Data Pipeline",
+		Actions: []string{"iam:PassRole", "datapipeline:CreatePipeline", "datapipeline:PutPipelineDefinition"},
+		Target:  EscalateToRole,
+	},
+	{
+		ID:      "update-assume-role-policy",
+		Name:    "Rewrite a role's trust policy to trust the principal",
+		Actions: []string{"iam:UpdateAssumeRolePolicy"},
+		Target:  EscalateToRole,
+	},
+	{
+		ID:      "create-access-key",
+		Name:    "Create an access key for another user",
+		Actions: []string{"iam:CreateAccessKey"},
+		Target:  EscalateToUser,
+	},
+	{
+		ID:      "create-login-profile",
+		Name:    "Create a console password for another user",
+		Actions: []string{"iam:CreateLoginProfile"},
+		Target:  EscalateToUser,
+	},
+	{
+		ID:      "update-login-profile",
+		Name:    "Reset another user's console password",
+		Actions: []string{"iam:UpdateLoginProfile"},
+		Target:  EscalateToUser,
+	},
+	{
+		ID:      "create-policy-version",
+		Name:    "Publish a new default version of a managed policy",
+		Actions: []string{"iam:CreatePolicyVersion"},
+		Target:  EscalateToPolicy,
+	},
+	{
+		ID:      "set-default-policy-version",
+		Name:    "Roll a managed policy back to a more permissive version",
+		Actions: []string{"iam:SetDefaultPolicyVersion"},
+		Target:  EscalateToPolicy,
+	},
+	{
+		ID:       "attach-user-policy",
+		Name:     "Attach a managed policy to the principal's own user",
+		Actions:  []string{"iam:AttachUserPolicy"},
+		Target:   EscalateToUser,
+		SelfOnly: true,
+	},
+	{
+		ID:       "put-user-policy",
+		Name:     "Write an inline policy on the principal's own user",
+		Actions:  []string{"iam:PutUserPolicy"},
+		Target:   EscalateToUser,
+		SelfOnly: true,
+	},
+	{
+		ID:       "attach-role-policy",
+		Name:     "Attach a managed policy to the principal's own role",
+		Actions:  []string{"iam:AttachRolePolicy"},
+		Target:   EscalateToRole,
+		SelfOnly: true,
+	},
+	{
+		ID:       "put-role-policy",
+		Name:     "Write an inline policy on the principal's own role",
+		Actions:  []string{"iam:PutRolePolicy"},
+		Target:   EscalateToRole,
+		SelfOnly: true,
+	},
+}
+
+// Escalation is one use of a technique by a principal against a target.
+// Target equals Principal when a principal can raise its own permissions.
+type Escalation struct {
+	Principal string              `json:"principal"`
+	Target    string              `json:"target"`
+	Technique EscalationTechnique `json:"technique"`
+	// Grant is the APPLIES_TO edge that allows the technique's first action
+	// on the target
+	Grant ingest.Edge `json:"grant"`
+}
+
+// FindEscalations matches every principal's attached policies against the
+// technique catalog. Results are sorted by principal, target, then
+// technique ID.
+func (g *Graph) FindEscalations() []Escalation {
+	var principals []string
+	targets := map[string][]string{}
+	for i, id := range g.nodeIDs {
+		kind := g.nodeKind(int32(i))
+		switch {
+		case kind == ingest.KindPolicy:
+			targets[EscalateToPolicy] = append(targets[EscalateToPolicy], id)
+		case kind != ingest.KindPrincipal:
+			continue
+		case isRoleARN(id):
+			targets[EscalateToRole] = append(targets[EscalateToRole], id)
+		case isUserARN(id):
+			targets[EscalateToUser] = append(targets[EscalateToUser], id)
+		}
+		if kind == ingest.KindPrincipal {
+			principals = append(principals, id)
+		}
+	}
+	sort.Strings(principals)
+	for _, ids := range targets {
+		sort.Strings(ids)
+	}
+
+	escalations := []Escalation{}
+	for _, principal := range principals {
+		grants := make(map[string][]ingest.Edge)
+		granted := func(action string) []ingest.Edge {
+			if _, ok := grants[action]; !ok {
+				grants[action] = g.actionGrants(principal, action)
+			}
+			return grants[action]
+		}
+
+		for _, technique := range EscalationTechniques {
+			allowed := true
+			for _, action := range technique.Actions[1:] {
+				if len(granted(action)) == 0 {
+					allowed = false
+					break
+				}
+			}
+			if !allowed {
+				continue
+			}
+
+			key := granted(technique.Actions[0])
+			for _, target := range targets[technique.Target] {
+				if technique.SelfOnly != (target == principal) {
+					continue
+				}
+				if grant, ok := matchGrant(key, target); ok {
+					escalations = append(escalations, Escalation{
+						Principal: principal,
+						Target:    target,
+						Technique: technique,
+						Grant:     grant,
+					})
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(escalations, func(i, j int) bool {
+		a, b := escalations[i], escalations[j]
+		if a.Principal != b.Principal {
+			return a.Principal < b.Principal
+		}
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		return a.Technique.ID < b.Technique.ID
+	})
+
+	return escalations
+}
+
+// ExpandEscalations adds a CAN_ESCALATE_TO edge from each principal to every
+// other principal or policy it can gain through FindEscalations, so that
+// attack paths follow these indirect routes. An edge's technique prop lists
+// the IDs of every technique that reaches its target, comma-separated, and
+// derived is true. Self escalations add no edge. It returns the number of
+// edges added.
+func (g *Graph) ExpandEscalations() int {
+	if g.Frozen() {
+		return 0
+	}
+
+	type pair struct{ src, dst string }
+	var order []pair
+	byPair := make(map[pair][]Escalation)
+	for _, esc := range g.FindEscalations() {
+		if esc.Principal == esc.Target {
+			continue
+		}
+		p := pair{esc.Principal, esc.Target}
+		if _, ok := byPair[p]; !ok {
+			order = append(order, p)
+		}
+		byPair[p] = append(byPair[p], esc)
+	}
+
+	added := 0
+	for _, p := range order {
+		if _, exists := g.findEdge(g.nodeIndex[p.src], g.nodeIndex[p.dst], ingest.EdgeCanEscalateTo); exists {
+			continue
+		}
+
+		var techniques []string
+		var prov []ingest.Provenance
+		for _, esc := range byPair[p] {
+			techniques = append(techniques, esc.Technique.ID)
+			prov = append(prov, esc.Grant.Provenance...)
+		}
+
+		if err := g.AddEdge(ingest.Edge{
+			Src:  p.src,
+			Dst:  p.dst,
+			Kind: ingest.EdgeCanEscalateTo,
+			Props: map[string]string{
+				"technique": strings.Join(techniques, ","),
+				"derived":   "true",
+			},
+			Provenance: prov,
+		}); err == nil {
+			added++
+		}
+	}
+
+	return added
+}
+
+// EdgeTechniques returns the catalog entries named by a CAN_ESCALATE_TO
+// edge's technique prop, in prop order. IDs not in the catalog keep the ID
+// as their name.
+func EdgeTechniques(edge ingest.Edge) []EscalationTechnique {
+	if edge.Kind != ingest.EdgeCanEscalateTo || edge.Props["technique"] == "" {
+		return nil
+	}
+
+	var techniques []EscalationTechnique
+	for _, id := range strings.Split(edge.Props["technique"], ",") {
+		technique, ok := LookupEscalationTechnique(id)
+		if !ok {
+			technique = EscalationTechnique{ID: id, Name: id}
+		}
+		techniques = append(techniques, technique)
+	}
+	return techniques
+}
+
+// LookupEscalationTechnique returns the catalog entry with the given ID
+func LookupEscalationTechnique(id string) (EscalationTechnique, bool) {
+	for _, technique := range EscalationTechniques {
+		if technique.ID == id {
+			return technique, true
+		}
+	}
+	return EscalationTechnique{}, false
+}
+
+// isUserARN reports whether id is an IAM user ARN
+func isUserARN(id string) bool {
+	parts := strings.SplitN(id, ":", 6)
+	return len(parts) == 6 && parts[0] == "arn" && parts[2] == "iam" && strings.HasPrefix(parts[5], "user/")
+}
@@ -0,0 +1,172 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+// newEscalationGraph builds an account in which dev can launch EC2 instances
+// with any role, ops can only pass roles, helpdesk can create access keys for
+// users, and Admin can rewrite its own inline policies. Admin reaches a
+// sensitive bucket.
+func newEscalationGraph(t *testing.T) *Graph {
+	t.Helper()
+
+	const (
+		dev      = "arn:aws:iam::111111111111:user/dev"
+		ops      = "arn:aws:iam::111111111111:user/ops"
+		helpdesk = "arn:aws:iam::111111111111:user/helpdesk"
+		admin    = "arn:aws:iam::111111111111:role/Admin"
+		bucket   = "arn:aws:s3:::secrets"
+	)
+
+	g := New()
+	for _, n := range []ingest.Node{
+		{ID: dev, Kind: ingest.KindPrincipal},
+		{ID: ops, Kind: ingest.KindPrincipal},
+		{ID: helpdesk, Kind: ingest.KindPrincipal},
+		{ID: admin, Kind: ingest.KindPrincipal},
+		{ID: "policy/Launch", Kind: ingest.KindPolicy},
+		{ID: "policy/Pass", Kind: ingest.KindPolicy},
+		{ID: "policy/Keys", Kind: ingest.KindPolicy},
+		{ID: "policy/Admin", Kind: ingest.KindPolicy},
+		{ID: "launch#iam:PassRole", Kind: ingest.KindPerm, Props: map[string]string{"action": "iam:PassRole"}},
+		{ID: "launch#ec2:RunInstances", Kind: ingest.KindPerm, Props: map[string]string{"action": "ec2:RunInstances"}},
+		{ID: "keys#iam:CreateAccessKey", Kind: ingest.KindPerm, Props: map[string]string{"action": "iam:CreateAccessKey"}},
+		{ID: "admin#iam:Put*", Kind: ingest.KindPerm, Props: map[string]string{"action": "iam:Put*"}},
+		{ID: "admin#s3:GetObject", Kind: ingest.KindPerm, Props: map[string]string{"action": "s3:GetObject"}},
+		{ID: "arn:aws:iam::111111111111:role/*", Kind: ingest.KindResource},
+		{ID: "arn:aws:iam::111111111111:user/*", Kind: ingest.KindResource},
+		{ID: "*", Kind: ingest.KindResource},
+		{ID: bucket, Kind: ingest.KindResource, Props: map[string]string{"sensitive": "true"}},
+	} {
+		g.AddNode(n)
+	}
+
+	for _, e := range []ingest.Edge{
+		{Src: dev, Dst: "policy/Launch", Kind: ingest.EdgeAttachedPolicy},
+		{Src: "policy/Launch", Dst: "launch#iam:PassRole", Kind: ingest.EdgeAllowsAction},
+		{Src: "policy/Launch", Dst: "launch#ec2:RunInstances", Kind: ingest.EdgeAllowsAction},
+		{Src: "launch#iam:PassRole", Dst: "arn:aws:iam::111111111111:role/*", Kind: ingest.EdgeAppliesTo},
+		{Src: "launch#ec2:RunInstances", Dst: "*", Kind: ingest.EdgeAppliesTo},
+		{Src: ops, Dst: "policy/Pass", Kind: ingest.EdgeAttachedPolicy},
+		{Src: "policy/Pass", Dst: "launch#iam:PassRole", Kind: ingest.EdgeAllowsAction},
+		{Src: helpdesk, Dst: "policy/Keys", Kind: ingest.EdgeAttachedPolicy},
+		{Src: "policy/Keys", Dst: "keys#iam:CreateAccessKey", Kind: ingest.EdgeAllowsAction},
+		{Src: "keys#iam:CreateAccessKey", Dst: "arn:aws:iam::111111111111:user/*", Kind: ingest.EdgeAppliesTo},
+		{Src: admin, Dst: "policy/Admin", Kind: ingest.EdgeAttachedPolicy},
+		{Src: "policy/Admin", Dst: "admin#iam:Put*", Kind: ingest.EdgeAllowsAction},
+		{Src: "policy/Admin", Dst: "admin#s3:GetObject", Kind: ingest.EdgeAllowsAction},
+		{Src: "admin#iam:Put*", Dst: "*", Kind: ingest.EdgeAppliesTo},
+		{Src: "admin#s3:GetObject", Dst: bucket, Kind: ingest.EdgeAppliesTo},
+	} {
+		if err := g.AddEdge(e); err != nil {
+			t.Fatalf("Failed to add edge: %v", err)
+		}
+	}
+	return g
+}
+
+func TestFindEscalations(t *testing.T) {
+	g := newEscalationGraph(t)
+
+	type esc struct{ principal, target, technique string }
+	var got []esc
+	for _, e := range g.FindEscalations() {
+		got = append(got, esc{e.Principal, e.Target, e.Technique.ID})
+	}
+
+	want := []esc{
+		// put-user-policy is self-only and Admin is a role
+		{"arn:aws:iam::111111111111:role/Admin", "arn:aws:iam::111111111111:role/Admin", "put-role-policy"},
+		{"arn:aws:iam::111111111111:user/dev", "arn:aws:iam::111111111111:role/Admin", "passrole-ec2"},
+		{"arn:aws:iam::111111111111:user/helpdesk", "arn:aws:iam::111111111111:user/dev", "create-access-key"},
+		{"arn:aws:iam::111111111111:user/helpdesk", "arn:aws:iam::111111111111:user/ops", "create-access-key"},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d escalations, got %d: %+v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Escalation %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestExpandEscalations(t *testing.T) {
+	g := newEscalationGraph(t)
+
+	// Admin's self escalation adds no edge
+	if added := g.ExpandEscalations(); added != 3 {
+		t.Errorf("Expected 3 escalation edges, got %d", added)
+	}
+
+	edge, ok := g.lookupEdge("arn:aws:iam::111111111111:user/dev", "arn:aws:iam::111111111111:role/Admin", EdgeFilter{})
+	if !ok {
+		t.Fatal("Expected dev to escalate to Admin")
+	}
+	if edge.Kind != ingest.EdgeCanEscalateTo || edge.Props["technique"] != "passrole-ec2" || edge.Props["derived"] != "true" {
+		t.Errorf("Unexpected escalation edge %+v", edge)
+	}
+
+	if _, ok := g.lookupEdge("arn:aws:iam::111111111111:user/ops", "arn:aws:iam::111111111111:role/Admin", EdgeFilter{}); ok {
+		t.Error("Expected no escalation for ops without ec2:RunInstances")
+	}
+
+	if added := g.ExpandEscalations(); added != 0 {
+		t.Errorf("Expected expansion to be idempotent, added %d", added)
+	}
+
+	// The escalation is now an attack path to Admin's bucket
+	result, err := g.FindAttackPath("arn:aws:iam::111111111111:user/dev", "", []string{"sensitive"}, 0, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("FindAttackPath failed: %v", err)
+	}
+	if !result.Found || result.Edges[0].Kind != ingest.EdgeCanEscalateTo {
+		t.Fatalf("Expected path through CAN_ESCALATE_TO, got %+v", result)
+	}
+
+	// helpdesk reaches it in two escalations: dev's keys, then dev's launch
+	result, err = g.FindAttackPath("arn:aws:iam::111111111111:user/helpdesk", "", []string{"sensitive"}, 0, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("FindAttackPath failed: %v", err)
+	}
+	if !result.Found || result.Edges[0].Props["technique"] != "create-access-key" {
+		t.Errorf("Expected helpdesk path to start with create-access-key, got %+v", result)
+	}
+
+	// Excluding the edge kind removes the route
+	result, err = g.FindAttackPath("arn:aws:iam::111111111111:user/dev", "", []string{"sensitive"}, 0,
+		EdgeFilter{Deny: []string{ingest.EdgeCanEscalateTo}})
+	if err != nil {
+		t.Fatalf("FindAttackPath failed: %v", err)
+	}
+	if result.Found {
+		t.Errorf("Expected no path without escalation edges, got %+v", result)
+	}
+}
+
+func TestEdgeTechniques(t *testing.T) {
+	edge := ingest.Edge{
+		Kind:  ingest.EdgeCanEscalateTo,
+		Props: map[string]string{"technique": "passrole-ec2,custom"},
+	}
+
+	techniques := EdgeTechniques(edge)
+	if len(techniques) != 2 {
+		t.Fatalf("Expected 2 techniques, got %+v", techniques)
+	}
+	if !strings.Contains(techniques[0].Name, "EC2") {
+		t.Errorf("Expected catalog name for passrole-ec2, got %q", techniques[0].Name)
+	}
+	if techniques[1].Name != "custom" {
+		t.Errorf("Expected unknown technique to keep its ID, got %q", techniques[1].Name)
+	}
+
+	if EdgeTechniques(ingest.Edge{Kind: ingest.EdgeAssumesRole}) != nil {
+		t.Error("Expected no techniques on other edge kinds")
+	}
+}
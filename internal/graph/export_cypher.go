@@ -30,27 +30,21 @@ func (g *Graph) ExportCypher() (string, error) {
 	// Export nodes (sorted for determinism)
 	buf.WriteString("// ========== NODES ==========\n\n")
 
-	nodeIDs := make([]string, 0, len(g.nodes))
-	for id := range g.nodes {
-		nodeIDs = append(nodeIDs, id)
-	}
-	sort.Strings(nodeIDs)
-
-	for _, id := range nodeIDs {
-		node := g.nodes[id]
+	for _, n := range g.sortedNodes() {
+		node := g.node(n)
 
 		// Build props map
 		props := make(map[string]interface{})
-		props["id"] = node.data.ID
-		props["kind"] = string(node.data.Kind)
+		props["id"] = node.ID
+		props["kind"] = string(node.Kind)
 
 		// Add labels as array
-		if len(node.data.Labels) > 0 {
-			props["labels"] = node.data.Labels
+		if len(node.Labels) > 0 {
+			props["labels"] = node.Labels
 		}
 
 		// Merge custom props
-		for k, v := range node.data.Props {
+		for k, v := range node.Props {
 			props[k] = v
 		}
 
@@ -60,10 +54,10 @@ func (g *Graph) ExportCypher() (string, error) {
 		}
 
 		// Generate MERGE statement with kind label
-		kindLabel := sanitizeLabel(string(node.data.Kind))
+		kindLabel := sanitizeLabel(string(node.Kind))
 		buf.WriteString(fmt.Sprintf("MERGE (n:Node:K_%s {id: %s})\n",
 			kindLabel,
-			quoteString(node.data.ID)))
+			quoteString(node.ID)))
 		buf.WriteString(fmt.Sprintf("SET n += %s;\n\n", string(propsJSON)))
 	}
 
@@ -71,9 +65,9 @@ func (g *Graph) ExportCypher() (string, error) {
 	buf.WriteString("// ========== EDGES ==========\n\n")
 
 	// Sort edges
-	edges := make([]edgeWithIndex, len(g.edges))
-	for i, e := range g.edges {
-		edges[i] = edgeWithIndex{edge: e, index: i}
+	edges := make([]edgeWithIndex, len(g.edgeKinds))
+	for i := range edges {
+		edges[i] = edgeWithIndex{edge: g.edge(i), index: i}
 	}
 	sort.Slice(edges, func(i, j int) bool {
 		if edges[i].edge.Src != edges[j].edge.Src {
@@ -3,6 +3,7 @@ package graph
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"text/template"
 	"time"
 
@@ -84,6 +85,12 @@ func ExportMarkdownAttackPath(fromID, toID string, nodes []ingest.Node, edges []
 		if val, ok := edge.Props["cross_account"]; ok && val == "true" {
 			notes += " [CROSS-ACCOUNT]"
 		}
+		for _, technique := range EdgeTechniques(edge) {
+			if notes != "" {
+				notes += " "
+			}
+			notes += fmt.Sprintf("Technique: %s (%s)", technique.Name, technique.ID)
+		}
 
 		data.Steps = append(data.Steps, Step{
 			Step:     i + 1,
@@ -112,6 +119,183 @@ func ExportMarkdownAttackPath(fromID, toID string, nodes []ingest.Node, edges []
 	return buf.String(), nil
 }
 
+// ExportMarkdownBlastRadius exports a blast radius as a formatted Markdown document
+func ExportMarkdownBlastRadius(br *BlastRadius) (string, error) {
+	if br == nil {
+		return "", fmt.Errorf("no blast radius")
+	}
+
+	tmpl := `# Blast Radius: {{.Principal}}
+
+## Summary
+
+**Principal:** ` + "`{{.Principal}}`" + `
+**Reachable resources:** {{.Total}}
+**Sensitive resources:** {{.Sensitive}}
+**Max hops:** {{.MaxHops}}
+**Date:** {{.Date}}
+
+| Resource Type | Resources | Sensitive |
+|---------------|-----------|-----------|
+{{range .ByType}}| {{.Type}} | {{.Resources}} | {{.Sensitive}} |
+{{end}}
+## Reachable Resources
+
+| Resource | Type | Hops | Actions | Sensitive |
+|----------|------|------|---------|-----------|
+{{range .Resources}}| {{.ID}} | {{.Type}} | {{.Hops}} | {{.Actions}} | {{if .Sensitive}}**yes**{{else}}no{{end}} |
+{{end}}
+## Recommendations
+
+1. Start with sensitive resources and the policies granting access to them
+2. Remove wildcard actions and resources reachable from this principal
+3. Review role assumptions that widen the blast radius
+
+---
+*Generated by AccessGraph v1.1.0*
+`
+
+	type Row struct {
+		ID        string
+		Type      string
+		Hops      int
+		Actions   string
+		Sensitive bool
+	}
+
+	data := struct {
+		Principal string
+		Total     int
+		Sensitive int
+		MaxHops   int
+		Date      string
+		ByType    []ResourceTypeSummary
+		Resources []Row
+	}{
+		Principal: br.Principal,
+		Total:     len(br.Resources),
+		Sensitive: br.Sensitive,
+		MaxHops:   br.MaxHops,
+		Date:      time.Now().Format("2006-01-02"),
+		ByType:    br.ByType,
+	}
+
+	for _, res := range br.Resources {
+		actions := strings.Join(res.Actions, ", ")
+		if actions == "" {
+			actions = "-"
+		}
+		data.Resources = append(data.Resources, Row{
+			ID:        truncateID(res.Node.ID),
+			Type:      res.Type,
+			Hops:      res.Hops,
+			Actions:   actions,
+			Sensitive: res.Sensitive,
+		})
+	}
+
+	t, err := template.New("markdown").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("parsing template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("executing template: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+// ExportMarkdownResourceAccess exports the principals that can reach a
+// resource as a formatted Markdown access review
+func ExportMarkdownResourceAccess(access *ResourceAccess) (string, error) {
+	if access == nil {
+		return "", fmt.Errorf("no resource access")
+	}
+
+	tmpl := `# Access Review: {{.Resource}}
+
+## Summary
+
+**Resource:** ` + "`{{.Resource}}`" + `
+**Sensitive:** {{if .Sensitive}}**yes**{{else}}no{{end}}
+**Principals with access:** {{.Total}}
+**Max hops:** {{.MaxHops}}
+**Date:** {{.Date}}
+
+## Principals
+
+| Principal | Hops | Actions | Likelihood | Path |
+|-----------|------|---------|------------|------|
+{{range .Principals}}| {{.ID}} | {{.Hops}} | {{.Actions}} | {{.Likelihood}} | {{.Path}} |
+{{end}}
+## Recommendations
+
+1. Confirm each principal still needs access to this resource
+2. Remove wildcard actions in favour of the specific actions required
+3. Review role assumptions and bindings that grant indirect access
+
+---
+*Generated by AccessGraph v1.1.0*
+`
+
+	type Row struct {
+		ID         string
+		Hops       int
+		Actions    string
+		Likelihood string
+		Path       string
+	}
+
+	data := struct {
+		Resource   string
+		Sensitive  bool
+		Total      int
+		MaxHops    int
+		Date       string
+		Principals []Row
+	}{
+		Resource:  access.Resource.ID,
+		Sensitive: access.Resource.Props["sensitive"] == "true",
+		Total:     len(access.Principals),
+		MaxHops:   access.MaxHops,
+		Date:      time.Now().Format("2006-01-02"),
+	}
+
+	for _, p := range access.Principals {
+		actions := strings.Join(p.Actions, ", ")
+		if actions == "" {
+			actions = "-"
+		}
+
+		var hops []string
+		for _, edge := range p.Path.Edges {
+			hops = append(hops, edge.Kind)
+		}
+
+		data.Principals = append(data.Principals, Row{
+			ID:         truncateID(p.Node.ID),
+			Hops:       p.Hops,
+			Actions:    actions,
+			Likelihood: fmt.Sprintf("%.2f", p.Path.Likelihood),
+			Path:       strings.Join(hops, " → "),
+		})
+	}
+
+	t, err := template.New("markdown").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("parsing template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("executing template: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
 // analyzePathRisks identifies risk factors in an attack path
 func analyzePathRisks(nodes []ingest.Node, edges []ingest.Edge) []string {
 	var risks []string
@@ -134,6 +318,14 @@ func analyzePathRisks(nodes []ingest.Node, edges []ingest.Edge) []string {
 		}
 	}
 
+	// Check for privilege escalation
+	for _, edge := range edges {
+		if edge.Kind == ingest.EdgeCanEscalateTo {
+			risks = append(risks, "**Privilege escalation** - principal gains another identity's permissions through IAM")
+			break
+		}
+	}
+
 	// Check for sensitive target
 	if len(nodes) > 0 {
 		lastNode := nodes[len(nodes)-1]
@@ -213,6 +213,53 @@ func TestExportMarkdownWithCrossAccount(t *testing.T) {
 	}
 }
 
+func TestExportMarkdownWithEscalation(t *testing.T) {
+	nodes := []ingest.Node{
+		{
+			ID:    "arn:aws:iam::111111111111:user/dev",
+			Kind:  ingest.KindPrincipal,
+			Props: map[string]string{},
+		},
+		{
+			ID:    "arn:aws:iam::111111111111:role/Admin",
+			Kind:  ingest.KindPrincipal,
+			Props: map[string]string{},
+		},
+	}
+
+	edges := []ingest.Edge{
+		{
+			Src:  "arn:aws:iam::111111111111:user/dev",
+			Dst:  "arn:aws:iam::111111111111:role/Admin",
+			Kind: ingest.EdgeCanEscalateTo,
+			Props: map[string]string{
+				"technique": "passrole-ec2",
+				"derived":   "true",
+			},
+		},
+	}
+
+	markdown, err := ExportMarkdownAttackPath(
+		"arn:aws:iam::111111111111:user/dev",
+		"arn:aws:iam::111111111111:role/Admin",
+		nodes,
+		edges,
+	)
+
+	if err != nil {
+		t.Fatalf("ExportMarkdownAttackPath failed: %v", err)
+	}
+
+	// Should name the technique in notes
+	if !strings.Contains(markdown, "Technique: Pass a role to a new EC2 instance profile (passrole-ec2)") {
+		t.Error("Expected technique in notes")
+	}
+
+	if !strings.Contains(markdown, "**Privilege escalation**") {
+		t.Error("Expected to detect privilege escalation")
+	}
+}
+
 func TestExportMarkdownEmpty(t *testing.T) {
 	_, err := ExportMarkdownAttackPath("from", "to", nil, nil)
 	if err == nil {
@@ -252,3 +299,54 @@ func TestTruncateID(t *testing.T) {
 		})
 	}
 }
+
+func TestExportMarkdownBlastRadius(t *testing.T) {
+	g := newBlastRadiusGraph(t)
+
+	br, err := g.BlastRadius("arn:aws:iam::111111111111:role/Dev", 8, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("BlastRadius failed: %v", err)
+	}
+
+	markdown, err := ExportMarkdownBlastRadius(br)
+	if err != nil {
+		t.Fatalf("ExportMarkdownBlastRadius failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"# Blast Radius: arn:aws:iam::111111111111:role/Dev",
+		"**Reachable resources:** 3",
+		"**Sensitive resources:** 1",
+		"| s3 | 2 | 1 |",
+		"| arn:aws:s3:::data | s3 | 3 | s3:GetObject, s3:PutObject | **yes** |",
+	} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("Expected Markdown to contain %q", want)
+		}
+	}
+}
+
+func TestExportMarkdownResourceAccess(t *testing.T) {
+	g := newBlastRadiusGraph(t)
+
+	access, err := g.WhoCanAccess("arn:aws:s3:::data", 8, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("WhoCanAccess failed: %v", err)
+	}
+
+	markdown, err := ExportMarkdownResourceAccess(access)
+	if err != nil {
+		t.Fatalf("ExportMarkdownResourceAccess failed: %v", err)
+	}
+
+	for _, want := range []string{
+		"# Access Review: arn:aws:s3:::data",
+		"**Sensitive:** **yes**",
+		"**Principals with access:** 2",
+		"| arn:aws:iam::111111111111:role/Dev | 3 | s3:GetObject, s3:PutObject | 0.78 | ATTACHED_POLICY → ALLOWS_ACTION → APPLIES_TO |",
+	} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("Expected Markdown to contain %q", want)
+		}
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"path/filepath"
+	"strings"
 
 	"github.com/jamesolaitan/accessgraph/internal/ingest"
 )
@@ -140,6 +142,9 @@ func ExportSARIFAttackPath(fromID, toID string, nodes []ingest.Node, edges []ing
 		if action, ok := edge.Props["action"]; ok {
 			message += fmt.Sprintf(" [Action: %s]", action)
 		}
+		for _, technique := range EdgeTechniques(edge) {
+			message += fmt.Sprintf(" [Technique: %s]", technique.Name)
+		}
 
 		results = append(results, SARIFResult{
 			RuleID:    fmt.Sprintf("attack-path/%s", edge.Kind),
@@ -148,18 +153,92 @@ func ExportSARIFAttackPath(fromID, toID string, nodes []ingest.Node, edges []ing
 			Message: SARIFMessage{
 				Text: message,
 			},
-			Locations: []SARIFLocation{
-				{
-					PhysicalLocation: SARIFPhysicalLocation{
-						ArtifactLocation: SARIFArtifactLocation{
-							URI: generateStableURI(fromNode.ID, toNode.ID),
-						},
-						Region: SARIFRegion{
-							StartLine: i + 1,
-						},
+			Locations: hopLocations(i, fromNode, toNode, edge),
+		})
+	}
+
+	sarif := SARIF{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs: []SARIFRun{
+			{
+				Tool: SARIFTool{
+					Driver: SARIFDriver{
+						Name:           "AccessGraph",
+						Version:        "1.1.0",
+						InformationURI: "https://github.com/jamesolaitan/accessgraph",
+						Rules:          rules,
 					},
 				},
+				Results: results,
+			},
+		},
+	}
+
+	output, err := json.MarshalIndent(sarif, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("marshaling SARIF: %w", err)
+	}
+
+	return string(output), nil
+}
+
+// ExportSARIFResourceAccess exports the principals that can reach a resource
+// as SARIF v2.1.0, one result per principal. Results are errors when the
+// resource is sensitive or the principal holds a wildcard action on it.
+func ExportSARIFResourceAccess(access *ResourceAccess) (string, error) {
+	if access == nil {
+		return "", fmt.Errorf("no resource access")
+	}
+
+	rules := []SARIFRule{
+		{
+			ID: "resource-access",
+			ShortDescription: SARIFDescription{
+				Text: "Principal can access resource",
+			},
+			FullDescription: SARIFDescription{
+				Text: "Privilege flows from this principal to the resource through the access graph",
+			},
+			Help: SARIFDescription{
+				Text: "Confirm the principal needs this access and restrict the policies along its path",
+			},
+		},
+	}
+
+	sensitive := access.Resource.Props["sensitive"] == "true"
+	results := []SARIFResult{}
+
+	for _, p := range access.Principals {
+		level := "warning"
+		if sensitive || hasWildcardAction(p.Actions) {
+			level = "error"
+		}
+
+		message := fmt.Sprintf("%s (%s) can reach %s in %d hops",
+			truncateID(p.Node.ID),
+			p.Node.Kind,
+			truncateID(access.Resource.ID),
+			p.Hops,
+		)
+		if len(p.Actions) > 0 {
+			message += fmt.Sprintf(" [Actions: %s]", strings.Join(p.Actions, ", "))
+		}
+
+		// Point at the grant that gives the principal its access
+		var locations []SARIFLocation
+		if n := len(p.Path.Edges); n > 0 {
+			locations = hopLocations(n-1, p.Path.Nodes[n-1], p.Path.Nodes[n], p.Path.Edges[n-1])
+		}
+
+		results = append(results, SARIFResult{
+			RuleID:    "resource-access",
+			RuleIndex: 0,
+			Level:     level,
+			Message: SARIFMessage{
+				Text: message,
 			},
+			Locations: locations,
 		})
 	}
 
@@ -189,6 +268,44 @@ func ExportSARIFAttackPath(fromID, toID string, nodes []ingest.Node, edges []ing
 	return string(output), nil
 }
 
+// hopLocations returns the input files that produced an edge. Edges without
+// file provenance fall back to a stable synthetic URI for the node pair.
+func hopLocations(step int, fromNode, toNode ingest.Node, edge ingest.Edge) []SARIFLocation {
+	var locations []SARIFLocation
+	for _, p := range edge.Provenance {
+		if p.File == "" {
+			continue
+		}
+		locations = append(locations, SARIFLocation{
+			PhysicalLocation: SARIFPhysicalLocation{
+				ArtifactLocation: SARIFArtifactLocation{
+					URI: filepath.ToSlash(p.File),
+				},
+				Region: SARIFRegion{
+					StartLine: p.Line,
+				},
+			},
+		})
+	}
+
+	if len(locations) > 0 {
+		return locations
+	}
+
+	return []SARIFLocation{
+		{
+			PhysicalLocation: SARIFPhysicalLocation{
+				ArtifactLocation: SARIFArtifactLocation{
+					URI: generateStableURI(fromNode.ID, toNode.ID),
+				},
+				Region: SARIFRegion{
+					StartLine: step + 1,
+				},
+			},
+		},
+	}
+}
+
 // isCriticalEdge determines if an edge represents a critical security issue
 func isCriticalEdge(edge ingest.Edge) bool {
 	// Cross-account access is critical
@@ -196,6 +313,11 @@ func isCriticalEdge(edge ingest.Edge) bool {
 		return true
 	}
 
+	// Privilege escalation is critical
+	if edge.Kind == ingest.EdgeCanEscalateTo {
+		return true
+	}
+
 	// Wildcard permissions are critical
 	if val, ok := edge.Props["action"]; ok {
 		if val == "*" || (len(val) > 2 && val[len(val)-2:] == ":*") {
@@ -206,6 +328,16 @@ func isCriticalEdge(edge ingest.Edge) bool {
 	return false
 }
 
+// hasWildcardAction reports whether any action is "*" or a service wildcard
+func hasWildcardAction(actions []string) bool {
+	for _, val := range actions {
+		if val == "*" || (len(val) > 2 && val[len(val)-2:] == ":*") {
+			return true
+		}
+	}
+	return false
+}
+
 // generateStableURI creates a deterministic URI for a node pair
 func generateStableURI(fromID, toID string) string {
 	// Use hash for stable, short URIs
@@ -294,6 +294,16 @@ func TestIsCriticalEdge(t *testing.T) {
 			},
 			expected: false,
 		},
+		{
+			name: "Privilege escalation is critical",
+			edge: ingest.Edge{
+				Kind: ingest.EdgeCanEscalateTo,
+				Props: map[string]string{
+					"technique": "passrole-ec2",
+				},
+			},
+			expected: true,
+		},
 		{
 			name: "No props not critical",
 			edge: ingest.Edge{
@@ -320,3 +330,77 @@ func TestExportSARIFEmpty(t *testing.T) {
 		t.Error("Expected error for empty nodes")
 	}
 }
+
+func TestExportSARIFUsesProvenance(t *testing.T) {
+	nodes := []ingest.Node{
+		{ID: "role", Kind: ingest.KindPrincipal},
+		{ID: "policy", Kind: ingest.KindPolicy},
+	}
+	edges := []ingest.Edge{
+		{
+			Src:  "role",
+			Dst:  "policy",
+			Kind: ingest.EdgeAttachedPolicy,
+			Provenance: []ingest.Provenance{
+				{Source: ingest.SourceAWS, File: "sample/aws/attachments.json", Path: "/0/AttachedPolicies/0", Line: 5},
+			},
+		},
+	}
+
+	output, err := ExportSARIFAttackPath("role", "policy", nodes, edges)
+	if err != nil {
+		t.Fatalf("ExportSARIFAttackPath failed: %v", err)
+	}
+
+	var sarif SARIF
+	if err := json.Unmarshal([]byte(output), &sarif); err != nil {
+		t.Fatalf("Failed to parse SARIF: %v", err)
+	}
+
+	loc := sarif.Runs[0].Results[0].Locations[0].PhysicalLocation
+	if loc.ArtifactLocation.URI != "sample/aws/attachments.json" {
+		t.Errorf("Expected provenance file URI, got %s", loc.ArtifactLocation.URI)
+	}
+	if loc.Region.StartLine != 5 {
+		t.Errorf("Expected StartLine 5, got %d", loc.Region.StartLine)
+	}
+}
+
+func TestExportSARIFResourceAccess(t *testing.T) {
+	g := newBlastRadiusGraph(t)
+
+	access, err := g.WhoCanAccess("arn:aws:kms:us-east-1:111111111111:key/k", 8, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("WhoCanAccess failed: %v", err)
+	}
+
+	sarifJSON, err := ExportSARIFResourceAccess(access)
+	if err != nil {
+		t.Fatalf("ExportSARIFResourceAccess failed: %v", err)
+	}
+
+	var sarif SARIF
+	if err := json.Unmarshal([]byte(sarifJSON), &sarif); err != nil {
+		t.Fatalf("Failed to parse SARIF JSON: %v", err)
+	}
+
+	results := sarif.Runs[0].Results
+	if len(results) != 2 {
+		t.Fatalf("Expected one result per principal, got %d", len(results))
+	}
+	for _, r := range results {
+		if r.RuleID != "resource-access" {
+			t.Errorf("Expected resource-access rule, got %s", r.RuleID)
+		}
+		// The key is not sensitive and kms:Decrypt is not a wildcard
+		if r.Level != "warning" {
+			t.Errorf("Expected warning level, got %s", r.Level)
+		}
+		if len(r.Locations) == 0 {
+			t.Error("Expected a location for the granting edge")
+		}
+		if !strings.Contains(r.Message.Text, "[Actions: kms:Decrypt]") {
+			t.Errorf("Expected actions in message, got %q", r.Message.Text)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package graph
+
+import (
+	"iter"
+
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+// Flow is the direction privilege travels along an edge, relative to the
+// direction the edge is stored in
+type Flow int
+
+const (
+	// FlowForward means holding Src grants what Dst grants
+	FlowForward Flow = iota
+	// FlowReverse means holding Dst grants what Src grants
+	FlowReverse
+	// FlowNone means the edge records a fact, such as membership, that grants
+	// nothing in either direction
+	FlowNone
+)
+
+// privilegeFlow orients the built-in edge kinds. Edges are stored the way
+// the source data describes them, which is not always the way access is
+// gained: a RoleBinding names the role first, but it is the subject that
+// gains the role's permissions.
+var privilegeFlow = map[string]Flow{
+	ingest.EdgeAssumesRole:        FlowForward, // principal → role it can assume
+	ingest.EdgeAttachedPolicy:     FlowForward, // role → policy it holds
+	ingest.EdgeAllowsAction:       FlowForward, // policy or role → permission
+	ingest.EdgeAppliesTo:          FlowForward, // permission → resource
+	ingest.EdgeBindsTo:            FlowReverse, // k8s role → subject it is bound to
+	ingest.EdgeCanEscalateTo:      FlowForward, // principal → principal or policy it can gain
+	ingest.EdgeTrustsCrossAccount: FlowNone,    // role → account it trusts
+	ingest.EdgeInNamespace:        FlowNone,
+	ingest.EdgeInAccount:          FlowNone,
+}
+
+// PrivilegeFlow returns the privilege flow orientation of an edge kind.
+// Kinds without a canonical orientation are followed as stored.
+func PrivilegeFlow(kind string) Flow {
+	if flow, ok := privilegeFlow[kind]; ok {
+		return flow
+	}
+	return FlowForward
+}
+
+// flowEdges yields the positions of the edges allowed by filter that let
+// privilege flow from src to dst: forward edges src→dst, then reverse edges
+// dst→src, each group in insertion order
+func (g *Graph) flowEdges(src, dst int32, filter EdgeFilter) iter.Seq[int] {
+	return func(yield func(int) bool) {
+		for idx := range g.edgesBetween(src, dst, filter) {
+			if PrivilegeFlow(g.edgeKind(idx)) == FlowForward && !yield(idx) {
+				return
+			}
+		}
+		for idx := range g.edgesBetween(dst, src, filter) {
+			if PrivilegeFlow(g.edgeKind(idx)) == FlowReverse && !yield(idx) {
+				return
+			}
+		}
+	}
+}
+
+// PrivilegePath finds the cheapest path under the graph's Weights along
+// which privilege flows from one node to another, following only edges
+// allowed by filter. Where parallel edges join two nodes, the cheapest is
+// taken. Edges are returned as stored, so edges[i] runs from nodes[i] to
+// nodes[i+1] for forward edges and the other way round for reverse edges.
+func (g *Graph) PrivilegePath(fromID, toID string, maxHops int, filter EdgeFilter) ([]ingest.Node, []ingest.Edge, error) {
+	return g.shortestPath(fromID, toID, maxHops, g.flowView(filter))
+}
+
+// PrivilegePaths finds the cheapest privilege flow path from every source to
+// every target with one traversal per source, as ShortestPaths does for
+// fewest-hop paths
+func (g *Graph) PrivilegePaths(fromIDs, toIDs []string, maxHops int, filter EdgeFilter) ([]PathPair, error) {
+	return g.shortestPaths(fromIDs, toIDs, maxHops, g.flowView(filter))
+}
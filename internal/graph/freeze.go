@@ -0,0 +1,78 @@
+package graph
+
+import "errors"
+
+// ErrFrozen is returned by mutations of a frozen graph
+var ErrFrozen = errors.New("graph is frozen")
+
+// Freeze makes the graph immutable. A Graph is not safe for concurrent use
+// while it can change, but once frozen every read method may be called from
+// any number of goroutines, since nothing writes to it again: AddEdge,
+// MarkSensitive and SetWeights return ErrFrozen, AddNode panics, and the
+// Expand methods add nothing. Use Clone or Update to derive a changed copy.
+// Freeze also folds pending edges into the adjacency index, so that reads
+// never rebuild it.
+func (g *Graph) Freeze() {
+	if g.Frozen() {
+		return
+	}
+	if g.adj.pending > 0 {
+		g.adj.rebuild(g.edgeSrc, g.edgeDst, len(g.nodeIDs))
+	}
+	g.frozen.Store(true)
+}
+
+// Frozen reports whether Freeze has been called
+func (g *Graph) Frozen() bool {
+	return g.frozen.Load()
+}
+
+// Clone returns an unfrozen deep copy of the graph. Nodes keep their
+// numbers and edges their order, so traversals of the copy visit neighbors
+// in the same order as the original.
+func (g *Graph) Clone() *Graph {
+	c := &Graph{
+		syms:       g.syms.clone(),
+		nodeIndex:  make(map[string]int32, len(g.nodeIndex)),
+		nodeIDs:    append([]string(nil), g.nodeIDs...),
+		nodeKinds:  append([]uint32(nil), g.nodeKinds...),
+		nodeLabels: make([][]uint32, len(g.nodeLabels)),
+		nodeProps:  g.nodeProps.clone(),
+		nodeProv:   g.nodeProv.clone(),
+		edgeSrc:    append([]int32(nil), g.edgeSrc...),
+		edgeDst:    append([]int32(nil), g.edgeDst...),
+		edgeKinds:  append([]uint32(nil), g.edgeKinds...),
+		edgeProps:  g.edgeProps.clone(),
+		edgeProv:   g.edgeProv.clone(),
+		weights:    g.weights.clone(),
+	}
+	for id, n := range g.nodeIndex {
+		c.nodeIndex[id] = n
+	}
+	for i, labels := range g.nodeLabels {
+		c.nodeLabels[i] = append([]uint32(nil), labels...)
+	}
+	c.adj.rebuild(c.edgeSrc, c.edgeDst, len(c.nodeIDs))
+
+	return c
+}
+
+// Update applies fn to the graph copy-on-write. A frozen graph is cloned,
+// fn changes the clone, and the clone is returned frozen, leaving the
+// original untouched for its concurrent readers. An unfrozen graph is
+// changed in place and returned.
+func (g *Graph) Update(fn func(*Graph) error) (*Graph, error) {
+	if !g.Frozen() {
+		if err := fn(g); err != nil {
+			return nil, err
+		}
+		return g, nil
+	}
+
+	c := g.Clone()
+	if err := fn(c); err != nil {
+		return nil, err
+	}
+	c.Freeze()
+	return c, nil
+}
@@ -0,0 +1,147 @@
+package graph
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+func TestFreezeRejectsMutation(t *testing.T) {
+	g := newEscalationGraph(t)
+	g.Freeze()
+
+	if !g.Frozen() {
+		t.Fatal("Expected graph to be frozen")
+	}
+
+	err := g.AddEdge(ingest.Edge{Src: "arn:aws:iam::111111111111:user/ops", Dst: "*", Kind: ingest.EdgeAttachedPolicy})
+	if !errors.Is(err, ErrFrozen) {
+		t.Errorf("Expected ErrFrozen from AddEdge, got %v", err)
+	}
+	if err := g.MarkSensitive("*"); !errors.Is(err, ErrFrozen) {
+		t.Errorf("Expected ErrFrozen from MarkSensitive, got %v", err)
+	}
+	if err := g.SetWeights(DefaultWeights()); !errors.Is(err, ErrFrozen) {
+		t.Errorf("Expected ErrFrozen from SetWeights, got %v", err)
+	}
+	if added := g.ExpandEscalations(); added != 0 {
+		t.Errorf("Expected no escalation edges on a frozen graph, got %d", added)
+	}
+	if node, _ := g.GetNode("*"); node.Props["sensitive"] == "true" {
+		t.Error("Expected frozen node to be unchanged")
+	}
+
+	defer func() {
+		if r := recover(); r != ErrFrozen {
+			t.Errorf("Expected AddNode to panic with ErrFrozen, got %v", r)
+		}
+	}()
+	g.AddNode(ingest.Node{ID: "new", Kind: ingest.KindResource})
+}
+
+func TestCloneIsIndependent(t *testing.T) {
+	g := newEscalationGraph(t)
+	g.Freeze()
+
+	c := g.Clone()
+	if c.Frozen() {
+		t.Fatal("Expected clone to be unfrozen")
+	}
+	if c.NodeCount() != g.NodeCount() || c.EdgeCount() != g.EdgeCount() {
+		t.Fatalf("Expected clone with %d nodes and %d edges, got %d and %d",
+			g.NodeCount(), g.EdgeCount(), c.NodeCount(), c.EdgeCount())
+	}
+
+	if err := c.MarkSensitive("*"); err != nil {
+		t.Fatalf("MarkSensitive failed: %v", err)
+	}
+	c.ExpandEscalations()
+
+	if node, _ := g.GetNode("*"); node.Props["sensitive"] == "true" {
+		t.Error("Expected original node props to be unshared")
+	}
+	if _, ok := g.lookupEdge("arn:aws:iam::111111111111:user/dev", "arn:aws:iam::111111111111:role/Admin", EdgeFilter{}); ok {
+		t.Error("Expected original to have no escalation edges")
+	}
+
+	// The clone finds the same paths as the original
+	want, err := g.FindAttackPath("arn:aws:iam::111111111111:role/Admin", "", []string{"sensitive"}, 0, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("FindAttackPath failed: %v", err)
+	}
+	got, err := c.FindAttackPath("arn:aws:iam::111111111111:role/Admin", "arn:aws:s3:::secrets", nil, 0, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("FindAttackPath failed: %v", err)
+	}
+	if !got.Found || got.Cost != want.Cost || len(got.Edges) != len(want.Edges) {
+		t.Errorf("Expected clone path %+v, got %+v", want, got)
+	}
+}
+
+func TestUpdateCopyOnWrite(t *testing.T) {
+	g := newEscalationGraph(t)
+
+	// Unfrozen graphs change in place
+	same, err := g.Update(func(g *Graph) error { return g.MarkSensitive("*") })
+	if err != nil || same != g {
+		t.Fatalf("Expected in-place update, got %p (%v)", same, err)
+	}
+
+	g.Freeze()
+	updated, err := g.Update(func(g *Graph) error {
+		g.ExpandEscalations()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if updated == g || !updated.Frozen() {
+		t.Fatal("Expected a frozen copy")
+	}
+	if updated.EdgeCount() != g.EdgeCount()+3 {
+		t.Errorf("Expected 3 new edges in the copy, got %d", updated.EdgeCount()-g.EdgeCount())
+	}
+
+	fail := errors.New("boom")
+	if _, err := g.Update(func(*Graph) error { return fail }); !errors.Is(err, fail) {
+		t.Errorf("Expected Update to return fn's error, got %v", err)
+	}
+}
+
+// TestFrozenGraphConcurrentReaders is meant for go test -race
+func TestFrozenGraphConcurrentReaders(t *testing.T) {
+	g := newEscalationGraph(t)
+	g.ExpandEscalations()
+	g.Freeze()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 32)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := g.FindAttackPath("arn:aws:iam::111111111111:user/helpdesk", "", []string{"sensitive"}, 0, EdgeFilter{}); err != nil {
+				errs <- err
+			}
+			if _, err := g.WhoCanAccess("arn:aws:s3:::secrets", 0, EdgeFilter{}); err != nil {
+				errs <- err
+			}
+			if _, err := g.BlastRadius("arn:aws:iam::111111111111:user/dev", 0, EdgeFilter{}); err != nil {
+				errs <- err
+			}
+			if _, err := g.ChokePoints(0, 0, EdgeFilter{}); err != nil {
+				errs <- err
+			}
+			g.FindEscalations()
+			g.GetNodes()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
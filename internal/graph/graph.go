@@ -2,10 +2,13 @@ package graph
 
 import (
 	"fmt"
+	"iter"
+	"sort"
+	"sync"
+	"sync/atomic"
 
 	"github.com/jamesolaitan/accessgraph/internal/ingest"
 	"gonum.org/v1/gonum/graph"
-	"gonum.org/v1/gonum/graph/path"
 	"gonum.org/v1/gonum/graph/simple"
 	"gonum.org/v1/gonum/graph/traverse"
 )
@@ -16,175 +19,380 @@ const (
 	DefaultBFSDepth = 3
 )
 
-// Graph wraps a directed multigraph with node/edge management
+// Graph is a directed multigraph of ingested nodes and edges. Every
+// ingest.Edge is kept separately, so parallel edges of different kinds
+// between the same two nodes stay apart and traversals report the exact
+// edge used at each hop.
+//
+// Storage is compact so that org-wide snapshots fit in memory: nodes and
+// edges are numbered in insertion order and kept column-wise, strings are
+// interned, properties are stored per key, and adjacency is a compressed
+// sparse row index over edge numbers. A node's number is also its ID in the
+// gonum views the algorithms run on. Nodes and edges are rebuilt as
+// ingest values on the way out.
 type Graph struct {
-	g         *simple.DirectedGraph
-	nodes     map[string]*graphNode
-	edges     []ingest.Edge
-	nodesByID map[int64]string
-	// edgeIndex provides O(1) edge lookup by source and destination node IDs,
-	// avoiding O(E) scans when resolving neighbors or shortest paths.
-	edgeIndex map[string]map[string][]ingest.Edge
-}
-
-type graphNode struct {
-	id   int64
-	data ingest.Node
-}
-
-func (n *graphNode) ID() int64 {
-	return n.id
+	syms *symbols
+
+	nodeIndex  map[string]int32
+	nodeIDs    []string
+	nodeKinds  []uint32
+	nodeLabels [][]uint32
+	nodeProps  columns
+	nodeProv   provenances
+
+	edgeSrc   []int32
+	edgeDst   []int32
+	edgeKinds []uint32
+	edgeProps columns
+	edgeProv  provenances
+	adj       adjacency
+
+	// weights prices edges for attack path search
+	weights Weights
+	// frozen rejects further mutation, see Freeze
+	frozen atomic.Bool
+	// centrality caches betweenness per edge filter once frozen
+	centrality sync.Map
 }
 
 // New creates a new graph
 func New() *Graph {
 	return &Graph{
-		g:         simple.NewDirectedGraph(),
-		nodes:     make(map[string]*graphNode),
-		edges:     []ingest.Edge{},
-		nodesByID: make(map[int64]string),
-		edgeIndex: make(map[string]map[string][]ingest.Edge),
+		syms:      newSymbols(),
+		nodeIndex: make(map[string]int32),
+		nodeProps: newColumns(),
+		edgeProps: newColumns(),
+		weights:   DefaultWeights(),
 	}
 }
 
-// AddNode adds a node to the graph
+// AddNode adds a node to the graph. Adding a node whose ID already exists
+// merges its labels, props and provenance into the existing node.
+//
+// AddNode panics with ErrFrozen if the graph is frozen, where the other
+// mutators return it: adding a node cannot otherwise fail, and every caller
+// builds a graph it owns. Derive a changed copy of a frozen graph with Clone
+// or Update instead.
 func (g *Graph) AddNode(node ingest.Node) {
-	if _, exists := g.nodes[node.ID]; exists {
+	if g.Frozen() {
+		panic(ErrFrozen)
+	}
+
+	if n, exists := g.nodeIndex[node.ID]; exists {
+		merged := g.node(n)
+		ingest.MergeNode(&merged, node)
+		g.setNode(n, merged)
 		return
 	}
 
-	id := int64(len(g.nodes) + 1)
-	gn := &graphNode{
-		id:   id,
-		data: node,
+	n := int32(len(g.nodeIDs))
+	g.nodeIndex[node.ID] = n
+	g.nodeIDs = append(g.nodeIDs, node.ID)
+	g.nodeKinds = append(g.nodeKinds, 0)
+	g.nodeLabels = append(g.nodeLabels, nil)
+	g.setNode(n, node)
+}
+
+// setNode stores everything but the ID of node as node n
+func (g *Graph) setNode(n int32, node ingest.Node) {
+	g.nodeKinds[n] = g.syms.intern(string(node.Kind))
+
+	var labels []uint32
+	if len(node.Labels) > 0 {
+		labels = make([]uint32, len(node.Labels))
+		for i, l := range node.Labels {
+			labels[i] = g.syms.intern(l)
+		}
 	}
+	g.nodeLabels[n] = labels
 
-	g.nodes[node.ID] = gn
-	g.nodesByID[id] = node.ID
-	g.g.AddNode(gn)
+	g.nodeProps.setRow(int(n), node.Props, g.syms)
+	g.nodeProv.setRow(int(n), node.Provenance, g.syms)
 }
 
-// AddEdge adds an edge to the graph
+// AddEdge adds an edge to the graph. Adding an edge whose Key already exists
+// merges its props and provenance into the existing edge; edges of other
+// kinds between the same nodes are kept as parallel edges.
 func (g *Graph) AddEdge(edge ingest.Edge) error {
-	src, ok := g.nodes[edge.Src]
+	if g.Frozen() {
+		return ErrFrozen
+	}
+
+	src, ok := g.nodeIndex[edge.Src]
 	if !ok {
 		return fmt.Errorf("source node not found: %s", edge.Src)
 	}
 
-	dst, ok := g.nodes[edge.Dst]
+	dst, ok := g.nodeIndex[edge.Dst]
 	if !ok {
 		return fmt.Errorf("destination node not found: %s", edge.Dst)
 	}
 
-	g.g.SetEdge(g.g.NewEdge(src, dst))
-	g.edges = append(g.edges, edge)
-
-	// Update edge index for O(1) lookups
-	if g.edgeIndex[edge.Src] == nil {
-		g.edgeIndex[edge.Src] = make(map[string][]ingest.Edge)
+	if idx, exists := g.findEdge(src, dst, edge.Kind); exists {
+		merged := g.edge(idx)
+		ingest.MergeEdge(&merged, edge)
+		g.edgeProps.setRow(idx, merged.Props, g.syms)
+		g.edgeProv.setRow(idx, merged.Provenance, g.syms)
+		return nil
 	}
-	g.edgeIndex[edge.Src][edge.Dst] = append(g.edgeIndex[edge.Src][edge.Dst], edge)
+
+	idx := len(g.edgeSrc)
+	g.edgeSrc = append(g.edgeSrc, src)
+	g.edgeDst = append(g.edgeDst, dst)
+	g.edgeKinds = append(g.edgeKinds, g.syms.intern(edge.Kind))
+	g.edgeProps.setRow(idx, edge.Props, g.syms)
+	g.edgeProv.setRow(idx, edge.Provenance, g.syms)
+	g.adj.add(idx, g.edgeSrc, g.edgeDst, len(g.nodeIDs))
 
 	return nil
 }
 
+// lookupNode returns the number of the node with the given ID
+func (g *Graph) lookupNode(id string) (int32, bool) {
+	n, ok := g.nodeIndex[id]
+	return n, ok
+}
+
+// node rebuilds node n
+func (g *Graph) node(n int32) ingest.Node {
+	node := ingest.Node{
+		ID:         g.nodeIDs[n],
+		Kind:       g.nodeKind(n),
+		Props:      g.nodeProps.row(int(n), g.syms),
+		Provenance: g.nodeProv.row(int(n), g.syms),
+	}
+	if labels := g.nodeLabels[n]; len(labels) > 0 {
+		node.Labels = make([]string, len(labels))
+		for i, l := range labels {
+			node.Labels[i] = g.syms.str(l)
+		}
+	}
+	return node
+}
+
+// nodeKind returns the kind of node n
+func (g *Graph) nodeKind(n int32) ingest.Kind {
+	return ingest.Kind(g.syms.str(g.nodeKinds[n]))
+}
+
+// propOf returns a property of node n without rebuilding the node
+func (g *Graph) propOf(n int32, key string) (string, bool) {
+	return lookupProp(&g.nodeProps, int(n), key, g.syms)
+}
+
+// edge rebuilds the edge at position idx
+func (g *Graph) edge(idx int) ingest.Edge {
+	return ingest.Edge{
+		Src:        g.nodeIDs[g.edgeSrc[idx]],
+		Dst:        g.nodeIDs[g.edgeDst[idx]],
+		Kind:       g.edgeKind(idx),
+		Props:      g.edgeProps.row(idx, g.syms),
+		Provenance: g.edgeProv.row(idx, g.syms),
+	}
+}
+
+// edgeKind returns the kind of the edge at position idx
+func (g *Graph) edgeKind(idx int) string {
+	return g.syms.str(g.edgeKinds[idx])
+}
+
+// edgePropOf returns a property of the edge at position idx without
+// rebuilding the edge
+func (g *Graph) edgePropOf(idx int, key string) (string, bool) {
+	return lookupProp(&g.edgeProps, idx, key, g.syms)
+}
+
+// lookupProp returns the property key of row from c
+func lookupProp(c *columns, row int, key string, syms *symbols) (string, bool) {
+	k, ok := syms.lookup(key)
+	if !ok {
+		return "", false
+	}
+	v := c.get(row, k)
+	if v == 0 {
+		return "", false
+	}
+	return syms.str(v), true
+}
+
+// other returns the endpoint of the edge at position idx that is not n
+// (n itself for a self loop)
+func (g *Graph) other(idx int, n int32) int32 {
+	if g.edgeSrc[idx] == n {
+		return g.edgeDst[idx]
+	}
+	return g.edgeSrc[idx]
+}
+
 // GetNode retrieves a node by ID
 func (g *Graph) GetNode(id string) (ingest.Node, bool) {
-	node, ok := g.nodes[id]
+	n, ok := g.nodeIndex[id]
 	if !ok {
 		return ingest.Node{}, false
 	}
-	return node.data, true
+	return g.node(n), true
 }
 
-// GetNodes returns all nodes
+// GetNodes returns all nodes, in insertion order
 func (g *Graph) GetNodes() []ingest.Node {
-	nodes := make([]ingest.Node, 0, len(g.nodes))
-	for _, node := range g.nodes {
-		nodes = append(nodes, node.data)
+	nodes := make([]ingest.Node, len(g.nodeIDs))
+	for n := range g.nodeIDs {
+		nodes[n] = g.node(int32(n))
 	}
 	return nodes
 }
 
-// GetEdges returns all edges
+// GetEdges returns all edges, in insertion order
 func (g *Graph) GetEdges() []ingest.Edge {
-	return g.edges
+	edges := make([]ingest.Edge, len(g.edgeSrc))
+	for idx := range g.edgeSrc {
+		edges[idx] = g.edge(idx)
+	}
+	return edges
 }
 
-// lookupEdgeKind returns the kind of the first edge between src and dst using
-// the edge index. Falls back to empty string if no edge is found.
-func (g *Graph) lookupEdgeKind(srcID, dstID string) string {
-	if dstMap, ok := g.edgeIndex[srcID]; ok {
-		if edges, ok := dstMap[dstID]; ok && len(edges) > 0 {
-			return edges[0].Kind
+// NodeCount returns the number of nodes
+func (g *Graph) NodeCount() int {
+	return len(g.nodeIDs)
+}
+
+// EdgeCount returns the number of edges
+func (g *Graph) EdgeCount() int {
+	return len(g.edgeSrc)
+}
+
+// edgesBetween yields the positions of the edges from src to dst that filter
+// allows, in insertion order. It scans whichever of src's outgoing and dst's
+// incoming edges is shorter.
+func (g *Graph) edgesBetween(src, dst int32, filter EdgeFilter) iter.Seq[int] {
+	return func(yield func(int) bool) {
+		lines, match, want := g.adj.lines(src, true), g.edgeDst, dst
+		if g.adj.degree(dst, false) < len(lines) {
+			lines, match, want = g.adj.lines(dst, false), g.edgeSrc, src
+		}
+		for _, idx := range lines {
+			if match[idx] == want && filter.Allows(g.edgeKind(int(idx))) && !yield(int(idx)) {
+				return
+			}
 		}
 	}
-	return ""
 }
 
-// lookupEdge returns the first edge between src and dst using the edge index.
-func (g *Graph) lookupEdge(srcID, dstID string) (ingest.Edge, bool) {
-	if dstMap, ok := g.edgeIndex[srcID]; ok {
-		if edges, ok := dstMap[dstID]; ok && len(edges) > 0 {
-			return edges[0], true
+// findEdge returns the position of the edge from src to dst of kind
+func (g *Graph) findEdge(src, dst int32, kind string) (int, bool) {
+	k, ok := g.syms.lookup(kind)
+	if !ok {
+		return 0, false
+	}
+	for idx := range g.edgesBetween(src, dst, EdgeFilter{}) {
+		if g.edgeKinds[idx] == k {
+			return idx, true
 		}
 	}
+	return 0, false
+}
+
+// lookupEdge returns the first edge from src to dst that filter allows,
+// in insertion order.
+func (g *Graph) lookupEdge(srcID, dstID string, filter EdgeFilter) (ingest.Edge, bool) {
+	src, ok := g.nodeIndex[srcID]
+	if !ok {
+		return ingest.Edge{}, false
+	}
+	dst, ok := g.nodeIndex[dstID]
+	if !ok {
+		return ingest.Edge{}, false
+	}
+	for idx := range g.edgesBetween(src, dst, filter) {
+		return g.edge(idx), true
+	}
 	return ingest.Edge{}, false
 }
 
-// GetNeighbors returns neighbors of a node filtered by kind
-func (g *Graph) GetNeighbors(id string, kinds []ingest.Kind) ([]ingest.Node, []string, error) {
-	node, ok := g.nodes[id]
+// Neighbor is a node adjacent to another, together with the edge that
+// connects them. A node joined by several parallel edges appears once per
+// edge.
+type Neighbor struct {
+	Node     ingest.Node
+	Edge     ingest.Edge
+	Outgoing bool // true if Edge leads away from the queried node
+}
+
+// GetNeighbors returns the neighbors of a node reached over edges allowed by
+// filter, restricted to the given node kinds (all kinds if empty). Outgoing
+// edges come first; each group is in insertion order.
+func (g *Graph) GetNeighbors(id string, kinds []ingest.Kind, filter EdgeFilter) ([]Neighbor, error) {
+	n, ok := g.nodeIndex[id]
 	if !ok {
-		return nil, nil, fmt.Errorf("node not found: %s", id)
+		return nil, fmt.Errorf("node not found: %s", id)
 	}
 
-	neighbors := []ingest.Node{}
-	edgeKinds := []string{}
 	kindsMap := make(map[ingest.Kind]bool)
 	for _, k := range kinds {
 		kindsMap[k] = true
 	}
 
-	// Get outgoing edges
-	to := g.g.From(node.ID())
-	for to.Next() {
-		neighborID := to.Node().ID()
-		neighborNodeID := g.nodesByID[neighborID]
-		neighborData := g.nodes[neighborNodeID].data
+	neighbors := []Neighbor{}
+	collect := func(lines []int32, outgoing bool) {
+		for _, idx := range lines {
+			if !filter.Allows(g.edgeKind(int(idx))) {
+				continue
+			}
 
-		if len(kinds) == 0 || kindsMap[neighborData.Kind] {
-			edgeKind := g.lookupEdgeKind(id, neighborNodeID)
-			neighbors = append(neighbors, neighborData)
-			edgeKinds = append(edgeKinds, edgeKind)
+			other := g.edgeDst[idx]
+			if !outgoing {
+				other = g.edgeSrc[idx]
+			}
+			if len(kinds) == 0 || kindsMap[g.nodeKind(other)] {
+				neighbors = append(neighbors, Neighbor{Node: g.node(other), Edge: g.edge(int(idx)), Outgoing: outgoing})
+			}
 		}
 	}
 
-	// Get incoming edges
-	from := g.g.To(node.ID())
-	for from.Next() {
-		neighborID := from.Node().ID()
-		neighborNodeID := g.nodesByID[neighborID]
-		neighborData := g.nodes[neighborNodeID].data
+	collect(g.linesFrom(n), true)
+	collect(g.linesTo(n), false)
 
-		if len(kinds) == 0 || kindsMap[neighborData.Kind] {
-			edgeKind := g.lookupEdgeKind(neighborNodeID, id)
-			neighbors = append(neighbors, neighborData)
-			edgeKinds = append(edgeKinds, edgeKind)
-		}
+	return neighbors, nil
+}
+
+// linesFrom returns the positions of all edges leaving n, in insertion
+// order. The result must not be modified.
+func (g *Graph) linesFrom(n int32) []int32 {
+	return g.adj.lines(n, true)
+}
+
+// linesTo returns the positions of all edges entering n, in insertion
+// order. The result must not be modified.
+func (g *Graph) linesTo(n int32) []int32 {
+	return g.adj.lines(n, false)
+}
+
+// sortedNodes returns every node number in node ID order
+func (g *Graph) sortedNodes() []int32 {
+	nodes := make([]int32, len(g.nodeIDs))
+	for i := range nodes {
+		nodes[i] = int32(i)
 	}
+	sort.Slice(nodes, func(i, j int) bool { return g.nodeIDs[nodes[i]] < g.nodeIDs[nodes[j]] })
+	return nodes
+}
 
-	return neighbors, edgeKinds, nil
+// ShortestPath finds the path with the fewest hops between two nodes that
+// only follows edges allowed by filter. edges[i] is the exact edge taken
+// from nodes[i] to nodes[i+1].
+func (g *Graph) ShortestPath(fromID, toID string, maxHops int, filter EdgeFilter) ([]ingest.Node, []ingest.Edge, error) {
+	return g.shortestPath(fromID, toID, maxHops, g.view(filter))
 }
 
-// ShortestPath finds the shortest path between two nodes using BFS
-func (g *Graph) ShortestPath(fromID, toID string, maxHops int) ([]ingest.Node, []ingest.Edge, error) {
-	srcNode, ok := g.nodes[fromID]
+// shortestPath finds the lowest-weight path of at most maxHops between two
+// nodes in v
+func (g *Graph) shortestPath(fromID, toID string, maxHops int, v view) ([]ingest.Node, []ingest.Edge, error) {
+	src, ok := g.nodeIndex[fromID]
 	if !ok {
 		return nil, nil, fmt.Errorf("source node not found: %s", fromID)
 	}
 
-	dstNode, ok := g.nodes[toID]
+	dst, ok := g.nodeIndex[toID]
 	if !ok {
 		return nil, nil, fmt.Errorf("destination node not found: %s", toID)
 	}
@@ -193,40 +401,100 @@ func (g *Graph) ShortestPath(fromID, toID string, maxHops int) ([]ingest.Node, [
 		maxHops = DefaultMaxHops
 	}
 
-	// Use BFS to find shortest path
-	shortest := path.DijkstraFrom(srcNode, g.g)
-	nodePath, _ := shortest.To(dstNode.ID())
-
+	// A plain view weighs every hop 1, so the search yields the fewest-hop
+	// path; a flow view weighs hops by edge cost, and the hop limit is
+	// applied during the search so that a dearer path within it still wins
+	// over a cheaper one beyond it
+	nodePath := hopBoundedFrom(v, int64(src), maxHops).To(int64(dst))
 	if len(nodePath) == 0 {
-		return nil, nil, fmt.Errorf("no path found")
+		return nil, nil, fmt.Errorf("no path found within %d hops", maxHops)
+	}
+
+	return g.resolvePath(nodePath, v)
+}
+
+// PathPair is a path found from one of several sources to one of several
+// targets
+type PathPair struct {
+	From  string
+	To    string
+	Nodes []ingest.Node
+	Edges []ingest.Edge
+}
+
+// ShortestPaths finds the fewest-hop path from every source to every target,
+// as ShortestPath does for one pair, but runs a single traversal per source
+// rather than one per pair. Pairs with no path within maxHops, including
+// targets not in the graph, are omitted. Pairs are ordered by source, then by
+// target, in the order given.
+func (g *Graph) ShortestPaths(fromIDs, toIDs []string, maxHops int, filter EdgeFilter) ([]PathPair, error) {
+	return g.shortestPaths(fromIDs, toIDs, maxHops, g.view(filter))
+}
+
+// shortestPaths finds the lowest-weight path of at most maxHops in v from
+// every source to every target, with one hop-bounded search per source
+func (g *Graph) shortestPaths(fromIDs, toIDs []string, maxHops int, v view) ([]PathPair, error) {
+	if maxHops <= 0 {
+		maxHops = DefaultMaxHops
 	}
 
-	if len(nodePath) > maxHops+1 {
-		return nil, nil, fmt.Errorf("path exceeds max hops")
+	var pairs []PathPair
+	for _, fromID := range fromIDs {
+		src, ok := g.nodeIndex[fromID]
+		if !ok {
+			return nil, fmt.Errorf("source node not found: %s", fromID)
+		}
+
+		shortest := hopBoundedFrom(v, int64(src), maxHops)
+		for _, toID := range toIDs {
+			dst, ok := g.nodeIndex[toID]
+			if !ok || dst == src {
+				continue
+			}
+
+			nodePath := shortest.To(int64(dst))
+			if len(nodePath) == 0 {
+				continue
+			}
+
+			nodes, edges, err := g.resolvePath(nodePath, v)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, PathPair{From: fromID, To: toID, Nodes: nodes, Edges: edges})
+		}
 	}
 
-	// Convert to node/edge lists
-	nodes := []ingest.Node{}
-	edges := []ingest.Edge{}
+	return pairs, nil
+}
+
+// resolvePath converts a gonum node path through v into nodes and the exact
+// edge used at each hop
+func (g *Graph) resolvePath(nodePath []graph.Node, v view) ([]ingest.Node, []ingest.Edge, error) {
+	nodes := make([]ingest.Node, 0, len(nodePath))
+	edges := make([]ingest.Edge, 0, len(nodePath)-1)
 
 	for i, gn := range nodePath {
-		nodeID := g.nodesByID[gn.ID()]
-		nodes = append(nodes, g.nodes[nodeID].data)
+		n := int32(gn.ID())
+		nodes = append(nodes, g.node(n))
 
 		if i < len(nodePath)-1 {
-			nextID := g.nodesByID[nodePath[i+1].ID()]
-			if edge, found := g.lookupEdge(nodeID, nextID); found {
-				edges = append(edges, edge)
+			next := int32(nodePath[i+1].ID())
+			idx, found := v.lookup(n, next)
+			if !found {
+				return nil, nil, fmt.Errorf("no allowed edge from %s to %s", g.nodeIDs[n], g.nodeIDs[next])
 			}
+			edges = append(edges, g.edge(idx))
 		}
 	}
 
 	return nodes, edges, nil
 }
 
-// BFS performs a breadth-first search starting from a node
-func (g *Graph) BFS(startID string, maxDepth int) ([]ingest.Node, error) {
-	startNode, ok := g.nodes[startID]
+// BFS performs a breadth-first search starting from a node, following only
+// outgoing edges allowed by filter
+func (g *Graph) BFS(startID string, maxDepth int, filter EdgeFilter) ([]ingest.Node, error) {
+	start, ok := g.nodeIndex[startID]
 	if !ok {
 		return nil, fmt.Errorf("start node not found: %s", startID)
 	}
@@ -247,14 +515,13 @@ func (g *Graph) BFS(startID string, maxDepth int) ([]ingest.Node, error) {
 		},
 	}
 
-	bfs.Walk(g.g, startNode, func(n graph.Node, depth int) bool {
+	bfs.Walk(g.view(filter), simple.Node(start), func(n graph.Node, depth int) bool {
 		if depth > maxDepth {
 			return true // stop exploring beyond maxDepth
 		}
 		if !visited[n.ID()] {
 			visited[n.ID()] = true
-			nodeID := g.nodesByID[n.ID()]
-			result = append(result, g.nodes[nodeID].data)
+			result = append(result, g.node(int32(n.ID())))
 		}
 		return false
 	})
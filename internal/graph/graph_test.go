@@ -1,6 +1,7 @@
 package graph
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/jamesolaitan/accessgraph/internal/ingest"
@@ -80,19 +81,21 @@ func TestGraphOperations(t *testing.T) {
 	}
 
 	// Test GetNeighbors
-	neighbors, edgeKinds, err := g.GetNeighbors("node1", nil)
+	neighbors, err := g.GetNeighbors("node1", nil, EdgeFilter{})
 	if err != nil {
 		t.Errorf("GetNeighbors failed: %v", err)
 	}
 	if len(neighbors) == 0 {
 		t.Error("Expected neighbors")
 	}
-	if len(edgeKinds) == 0 {
-		t.Error("Expected edge kinds")
+	for _, n := range neighbors {
+		if n.Edge.Kind == "" {
+			t.Error("Expected edge kinds")
+		}
 	}
 
 	// Test ShortestPath
-	pathNodes, pathEdges, err := g.ShortestPath("node1", "node3", 10)
+	pathNodes, pathEdges, err := g.ShortestPath("node1", "node3", 10, EdgeFilter{})
 	if err != nil {
 		t.Errorf("ShortestPath failed: %v", err)
 	}
@@ -132,8 +135,239 @@ func TestGraphMissingNode(t *testing.T) {
 	node2 := ingest.Node{ID: "node2", Kind: ingest.KindResource, Labels: []string{}, Props: map[string]string{}}
 	g.AddNode(node2)
 
-	_, _, err = g.ShortestPath("node1", "node2", 8)
+	_, _, err = g.ShortestPath("node1", "node2", 8, EdgeFilter{})
 	if err == nil {
 		t.Error("Expected error for path with no connection")
 	}
 }
+
+func TestAddNodeMergesDuplicates(t *testing.T) {
+	g := New()
+	g.AddNode(ingest.Node{
+		ID:    "bucket",
+		Kind:  ingest.KindResource,
+		Props: map[string]string{"arn": "bucket"},
+	})
+	g.AddNode(ingest.Node{
+		ID:    "bucket",
+		Kind:  ingest.KindResource,
+		Props: map[string]string{"sensitive": "true"},
+	})
+
+	node, ok := g.GetNode("bucket")
+	if !ok {
+		t.Fatal("Expected to find bucket")
+	}
+	if node.Props["arn"] != "bucket" || node.Props["sensitive"] != "true" {
+		t.Errorf("Expected props from both copies, got %v", node.Props)
+	}
+	if len(g.GetNodes()) != 1 {
+		t.Errorf("Expected 1 node, got %d", len(g.GetNodes()))
+	}
+}
+
+func TestParallelEdgesAndFilters(t *testing.T) {
+	g := New()
+	for _, id := range []string{"a", "b", "c"} {
+		g.AddNode(ingest.Node{ID: id, Kind: ingest.KindPrincipal})
+	}
+
+	// a has two parallel edges to b; only the second kind continues to c
+	for _, e := range []ingest.Edge{
+		{Src: "a", Dst: "b", Kind: "TRUSTS"},
+		{Src: "a", Dst: "b", Kind: "ASSUMES_ROLE"},
+		{Src: "b", Dst: "c", Kind: "ASSUMES_ROLE"},
+		{Src: "a", Dst: "c", Kind: "TRUSTS"},
+	} {
+		if err := g.AddEdge(e); err != nil {
+			t.Fatalf("Failed to add edge: %v", err)
+		}
+	}
+
+	if len(g.GetEdges()) != 4 {
+		t.Fatalf("Expected parallel edges to be kept, got %d edges", len(g.GetEdges()))
+	}
+
+	neighbors, err := g.GetNeighbors("b", nil, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("GetNeighbors failed: %v", err)
+	}
+	var kinds []string
+	for _, n := range neighbors {
+		kinds = append(kinds, n.Edge.Kind)
+	}
+	if want := []string{"ASSUMES_ROLE", "TRUSTS", "ASSUMES_ROLE"}; fmt.Sprint(kinds) != fmt.Sprint(want) {
+		t.Errorf("Expected neighbor edge kinds %v, got %v", want, kinds)
+	}
+
+	// Unfiltered, the direct TRUSTS edge is shortest
+	_, edges, err := g.ShortestPath("a", "c", 8, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("ShortestPath failed: %v", err)
+	}
+	if len(edges) != 1 || edges[0].Kind != "TRUSTS" {
+		t.Errorf("Expected direct TRUSTS edge, got %v", edges)
+	}
+
+	// Denying TRUSTS forces the two-hop route over the ASSUMES_ROLE edges
+	nodes, edges, err := g.ShortestPath("a", "c", 8, EdgeFilter{Deny: []string{"TRUSTS"}})
+	if err != nil {
+		t.Fatalf("ShortestPath failed: %v", err)
+	}
+	if len(nodes) != 3 || len(edges) != 2 {
+		t.Fatalf("Expected 2-hop path, got %d nodes and %d edges", len(nodes), len(edges))
+	}
+	for i, e := range edges {
+		if e.Kind != "ASSUMES_ROLE" || e.Src != nodes[i].ID || e.Dst != nodes[i+1].ID {
+			t.Errorf("Hop %d: expected ASSUMES_ROLE %s->%s, got %+v", i, nodes[i].ID, nodes[i+1].ID, e)
+		}
+	}
+
+	// Allowing only TRUSTS cannot go through b
+	if _, _, err := g.ShortestPath("b", "c", 8, EdgeFilter{Allow: []string{"TRUSTS"}}); err == nil {
+		t.Error("Expected no path when only TRUSTS edges are allowed from b")
+	}
+
+	reached, err := g.BFS("a", 3, EdgeFilter{Allow: []string{"TRUSTS"}})
+	if err != nil {
+		t.Fatalf("BFS failed: %v", err)
+	}
+	if len(reached) != 3 {
+		t.Errorf("Expected BFS over TRUSTS to reach 3 nodes, got %d", len(reached))
+	}
+}
+
+func TestAddEdgeMergesDuplicates(t *testing.T) {
+	g := New()
+	g.AddNode(ingest.Node{ID: "a"})
+	g.AddNode(ingest.Node{ID: "b"})
+
+	_ = g.AddEdge(ingest.Edge{Src: "a", Dst: "b", Kind: "K", Props: map[string]string{"x": "1"}})
+	_ = g.AddEdge(ingest.Edge{Src: "a", Dst: "b", Kind: "K", Props: map[string]string{"y": "2"}})
+
+	edges := g.GetEdges()
+	if len(edges) != 1 {
+		t.Fatalf("Expected duplicate edge to merge, got %d edges", len(edges))
+	}
+	if edges[0].Props["x"] != "1" || edges[0].Props["y"] != "2" {
+		t.Errorf("Expected merged props, got %v", edges[0].Props)
+	}
+}
+
+func TestEdgeFilterAllows(t *testing.T) {
+	tests := []struct {
+		filter EdgeFilter
+		kind   string
+		want   bool
+	}{
+		{EdgeFilter{}, "ANY", true},
+		{EdgeFilter{Allow: []string{"A"}}, "A", true},
+		{EdgeFilter{Allow: []string{"A"}}, "B", false},
+		{EdgeFilter{Deny: []string{"A"}}, "A", false},
+		{EdgeFilter{Allow: []string{"A"}, Deny: []string{"A"}}, "A", false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.filter.Allows(tt.kind); got != tt.want {
+			t.Errorf("%+v.Allows(%q) = %t, want %t", tt.filter, tt.kind, got, tt.want)
+		}
+	}
+}
+
+func TestShortestPaths(t *testing.T) {
+	g := newDiamondGraph(t)
+
+	pairs, err := g.ShortestPaths([]string{"user", "b"}, []string{"bucket", "c", "missing"}, 8, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("ShortestPaths failed: %v", err)
+	}
+
+	want := []string{"user>a>bucket", "user>b>c", "b>bucket", "b>c"}
+	if len(pairs) != len(want) {
+		t.Fatalf("Expected %d pairs, got %d", len(want), len(pairs))
+	}
+	for i, pair := range pairs {
+		got := pathIDs(&AttackPathResult{Nodes: pair.Nodes})
+		if got != want[i] {
+			t.Errorf("Pair %d: expected %s, got %s", i, want[i], got)
+		}
+		if pair.From != pair.Nodes[0].ID || pair.To != pair.Nodes[len(pair.Nodes)-1].ID {
+			t.Errorf("Pair %d: endpoints %s→%s do not match path %s", i, pair.From, pair.To, got)
+		}
+		// Each pair must agree with the single-pair search
+		nodes, _, err := g.ShortestPath(pair.From, pair.To, 8, EdgeFilter{})
+		if err != nil || len(nodes) != len(pair.Nodes) {
+			t.Errorf("Pair %d: ShortestPath disagrees: %v %v", i, nodes, err)
+		}
+	}
+
+	pairs, err = g.ShortestPaths([]string{"user"}, []string{"c"}, 1, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("ShortestPaths failed: %v", err)
+	}
+	if len(pairs) != 0 {
+		t.Errorf("Expected no pairs within 1 hop, got %d", len(pairs))
+	}
+
+	if _, err := g.ShortestPaths([]string{"missing"}, []string{"bucket"}, 8, EdgeFilter{}); err == nil {
+		t.Error("Expected error for unknown source")
+	}
+}
+
+func TestPrivilegePathsMatchesPrivilegePath(t *testing.T) {
+	g := newDiamondGraph(t)
+
+	pairs, err := g.PrivilegePaths([]string{"user"}, []string{"bucket"}, 8, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("PrivilegePaths failed: %v", err)
+	}
+	nodes, _, err := g.PrivilegePath("user", "bucket", 8, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("PrivilegePath failed: %v", err)
+	}
+	if len(pairs) != 1 || pathIDs(&AttackPathResult{Nodes: pairs[0].Nodes}) != pathIDs(&AttackPathResult{Nodes: nodes}) {
+		t.Errorf("Expected PrivilegePaths to match PrivilegePath, got %+v", pairs)
+	}
+}
+
+// BenchmarkFindAttackPathSensitive searches a graph of 20,000 nodes for the
+// nearest of 500 sensitive resources
+func BenchmarkFindAttackPathSensitive(b *testing.B) {
+	const n = 5000
+
+	g := New()
+	for i := 0; i < n; i++ {
+		role := fmt.Sprintf("role-%d", i)
+		pol := fmt.Sprintf("policy-%d", i)
+		perm := fmt.Sprintf("perm-%d", i)
+		res := fmt.Sprintf("res-%d", i)
+
+		g.AddNode(ingest.Node{ID: role, Kind: ingest.KindPrincipal})
+		g.AddNode(ingest.Node{ID: pol, Kind: ingest.KindPolicy})
+		g.AddNode(ingest.Node{ID: perm, Kind: ingest.KindPerm})
+		props := map[string]string{}
+		if i%10 == 0 {
+			props["sensitive"] = "true"
+		}
+		g.AddNode(ingest.Node{ID: res, Kind: ingest.KindResource, Props: props})
+	}
+	for i := 0; i < n; i++ {
+		for _, e := range []ingest.Edge{
+			{Src: fmt.Sprintf("role-%d", i), Dst: fmt.Sprintf("policy-%d", i), Kind: ingest.EdgeAttachedPolicy},
+			{Src: fmt.Sprintf("role-%d", i), Dst: fmt.Sprintf("role-%d", (i+1)%n), Kind: ingest.EdgeAssumesRole},
+			{Src: fmt.Sprintf("policy-%d", i), Dst: fmt.Sprintf("perm-%d", i), Kind: ingest.EdgeAllowsAction},
+			{Src: fmt.Sprintf("perm-%d", i), Dst: fmt.Sprintf("res-%d", (i*7)%n), Kind: ingest.EdgeAppliesTo},
+		} {
+			if err := g.AddEdge(e); err != nil {
+				b.Fatalf("Failed to add edge: %v", err)
+			}
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := g.FindAttackPath("role-1", "", []string{"sensitive"}, 8, EdgeFilter{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
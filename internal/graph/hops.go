@@ -0,0 +1,125 @@
+package graph
+
+import (
+	"container/heap"
+	"slices"
+
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+// weightedFrom is the part of a view a hop-bounded search walks: the nodes a
+// node leads to and the weight of each step
+type weightedFrom interface {
+	From(id int64) graph.Nodes
+	Weight(xid, yid int64) (float64, bool)
+}
+
+// hopLabel is one state of a hop-bounded search: node reached in hops steps
+// at cost, by extending the label at parent (-1 for the source)
+type hopLabel struct {
+	node   int64
+	hops   int
+	cost   float64
+	parent int
+}
+
+// hopTree holds the cheapest path within a hop limit from one source to
+// every node it reaches
+type hopTree struct {
+	labels []hopLabel
+	// best is the label of the cheapest path to each node reached
+	best map[int64]int
+}
+
+// hopBoundedFrom runs Dijkstra over (node, hops) states from src, so that
+// the cheapest path of at most maxHops steps is found even when a cheaper
+// but longer path exists. A state is skipped once its node has been reached
+// at no greater cost in no more hops, so each node is settled at most
+// maxHops+1 times and every path found is simple. Equal costs are broken by
+// fewer hops, then by the order states were reached in; v yields neighbors
+// in node order, which keeps the result deterministic.
+func hopBoundedFrom(v weightedFrom, src int64, maxHops int) hopTree {
+	tree := hopTree{
+		labels: []hopLabel{{node: src, parent: -1}},
+		best:   make(map[int64]int),
+	}
+	fewest := make(map[int64]int)
+
+	queue := &hopQueue{labels: &tree.labels, items: []int{0}}
+	for queue.Len() > 0 {
+		i := heap.Pop(queue).(int)
+		l := tree.labels[i]
+		if h, settled := fewest[l.node]; settled && h <= l.hops {
+			continue
+		}
+		if _, reached := fewest[l.node]; !reached {
+			tree.best[l.node] = i
+		}
+		fewest[l.node] = l.hops
+
+		if l.hops == maxHops {
+			continue
+		}
+		next := v.From(l.node)
+		for next.Next() {
+			w := next.Node().ID()
+			if h, settled := fewest[w]; settled && h <= l.hops+1 {
+				continue
+			}
+			weight, ok := v.Weight(l.node, w)
+			if !ok {
+				continue
+			}
+			tree.labels = append(tree.labels, hopLabel{node: w, hops: l.hops + 1, cost: l.cost + weight, parent: i})
+			heap.Push(queue, len(tree.labels)-1)
+		}
+	}
+
+	return tree
+}
+
+// To returns the cheapest path from the source to n, source first, or nil if
+// n is not reached within the hop limit
+func (t hopTree) To(n int64) []graph.Node {
+	i, ok := t.best[n]
+	if !ok {
+		return nil
+	}
+
+	var nodePath []graph.Node
+	for ; i >= 0; i = t.labels[i].parent {
+		nodePath = append(nodePath, simple.Node(t.labels[i].node))
+	}
+	slices.Reverse(nodePath)
+	return nodePath
+}
+
+// hopQueue orders label indexes by cost, then hops, then index
+type hopQueue struct {
+	labels *[]hopLabel
+	items  []int
+}
+
+func (q *hopQueue) Len() int { return len(q.items) }
+
+func (q *hopQueue) Less(i, j int) bool {
+	a, b := (*q.labels)[q.items[i]], (*q.labels)[q.items[j]]
+	if a.cost != b.cost {
+		return a.cost < b.cost
+	}
+	if a.hops != b.hops {
+		return a.hops < b.hops
+	}
+	return q.items[i] < q.items[j]
+}
+
+func (q *hopQueue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+
+func (q *hopQueue) Push(x any) { q.items = append(q.items, x.(int)) }
+
+func (q *hopQueue) Pop() any {
+	last := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return last
+}
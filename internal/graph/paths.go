@@ -0,0 +1,284 @@
+package graph
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/iterator"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+// Defaults for attack path enumeration
+const (
+	DefaultK         = 3
+	DefaultPathLimit = 100
+)
+
+// MaxPathExpansions bounds the edges one enumeration of all attack paths may
+// try, which would otherwise grow exponentially with maxHops when few paths
+// reach a target
+const MaxPathExpansions = 1_000_000
+
+// FindAttackPaths finds up to k alternative attack paths of at most maxHops
+// from a principal, cheapest first, using Yen's k-shortest loopless paths
+// over the same weighted privilege flow as FindAttackPath. Paths are distinct
+// node sequences, and the hop limit is applied during the search, so fewer
+// than k are returned only if fewer than k fit. If toID is empty and tags
+// includes "sensitive", the k cheapest paths to any sensitive resource are
+// returned.
+func (g *Graph) FindAttackPaths(fromID, toID string, tags []string, k, maxHops int, filter EdgeFilter) ([]*AttackPathResult, error) {
+	if k <= 0 {
+		k = DefaultK
+	}
+	if maxHops <= 0 {
+		maxHops = DefaultMaxHops
+	}
+
+	targets, err := g.attackTargets(fromID, toID, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	v := g.flowView(filter)
+	src := int64(g.nodeIndex[fromID])
+
+	var results []*AttackPathResult
+	for _, targetID := range targets {
+		for _, nodePath := range yenPaths(v, src, int64(g.nodeIndex[targetID]), k, maxHops) {
+			nodes, edges, err := g.resolvePath(nodePath, v)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, g.attackPathResult(nodes, edges))
+		}
+	}
+
+	sortAttackPaths(results)
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+// yenPaths finds up to k loopless paths of at most maxHops from src to dst
+// in v, cheapest first, by Yen's algorithm. Each spur search is bounded by
+// the hops left after its root path, so a path is never found only to be
+// dropped for being too long. Equal costs are broken by fewer hops, then by
+// the order candidates were found in.
+func yenPaths(v weightedFrom, src, dst int64, k, maxHops int) [][]graph.Node {
+	if src == dst {
+		return nil
+	}
+	first := hopBoundedFrom(v, src, maxHops).To(dst)
+	if first == nil {
+		return nil
+	}
+
+	type candidate struct {
+		path []graph.Node
+		cost float64
+	}
+	found := [][]graph.Node{first}
+	var candidates []candidate
+
+	for len(found) < k {
+		prev := found[len(found)-1]
+		for i := 0; i < len(prev)-1; i++ {
+			root := prev[:i+1]
+
+			// Block the next hop of every path found that shares this root,
+			// and the root itself, so the spur is a new loopless detour
+			masked := maskedView{weightedFrom: v, nodes: make(map[int64]bool), edges: make(map[[2]int64]bool)}
+			for _, p := range found {
+				if len(p) > i+1 && samePath(p[:i+1], root) {
+					masked.edges[[2]int64{p[i].ID(), p[i+1].ID()}] = true
+				}
+			}
+			for _, n := range root[:i] {
+				masked.nodes[n.ID()] = true
+			}
+
+			spur := hopBoundedFrom(masked, root[i].ID(), maxHops-i).To(dst)
+			if spur == nil {
+				continue
+			}
+			p := append(append([]graph.Node(nil), root[:i]...), spur...)
+
+			duplicate := slices.ContainsFunc(candidates, func(c candidate) bool { return samePath(c.path, p) })
+			if !duplicate {
+				candidates = append(candidates, candidate{path: p, cost: pathWeight(v, p)})
+			}
+		}
+
+		if len(candidates) == 0 {
+			break
+		}
+		best := 0
+		for j, c := range candidates {
+			b := candidates[best]
+			if c.cost < b.cost || (c.cost == b.cost && len(c.path) < len(b.path)) {
+				best = j
+			}
+		}
+		found = append(found, candidates[best].path)
+		candidates = slices.Delete(candidates, best, best+1)
+	}
+
+	return found
+}
+
+// maskedView hides some nodes and steps of a view from a search
+type maskedView struct {
+	weightedFrom
+	nodes map[int64]bool
+	edges map[[2]int64]bool
+}
+
+func (m maskedView) From(id int64) graph.Nodes {
+	var nodes []graph.Node
+	next := m.weightedFrom.From(id)
+	for next.Next() {
+		n := next.Node()
+		if !m.nodes[n.ID()] && !m.edges[[2]int64{id, n.ID()}] {
+			nodes = append(nodes, n)
+		}
+	}
+	if len(nodes) == 0 {
+		return graph.Empty
+	}
+	return iterator.NewOrderedNodes(nodes)
+}
+
+// samePath reports whether two node paths visit the same nodes in order
+func samePath(a, b []graph.Node) bool {
+	return slices.EqualFunc(a, b, func(x, y graph.Node) bool { return x.ID() == y.ID() })
+}
+
+// pathWeight sums the weights of the steps of a node path in v
+func pathWeight(v weightedFrom, p []graph.Node) float64 {
+	total := 0.0
+	for i := 1; i < len(p); i++ {
+		w, _ := v.Weight(p[i-1].ID(), p[i].ID())
+		total += w
+	}
+	return total
+}
+
+// AllAttackPaths enumerates the simple paths of at most maxHops along which
+// privilege flows from a principal to the target (or, if toID is empty and
+// tags includes "sensitive", to any sensitive resource). Enumeration is
+// depth-first and stops once limit paths are found or MaxPathExpansions
+// edges have been tried, so on large graphs it may return fewer paths than
+// exist; the paths found are returned cheapest first.
+func (g *Graph) AllAttackPaths(fromID, toID string, tags []string, maxHops, limit int, filter EdgeFilter) ([]*AttackPathResult, error) {
+	budget := MaxPathExpansions
+	results, _, err := g.allAttackPaths(fromID, toID, tags, maxHops, limit, filter, &budget)
+	return results, err
+}
+
+// allAttackPaths enumerates paths as AllAttackPaths does, drawing on budget
+// for every edge tried. It also reports whether enumeration was complete,
+// that is, stopped neither at limit nor for want of budget.
+func (g *Graph) allAttackPaths(fromID, toID string, tags []string, maxHops, limit int, filter EdgeFilter, budget *int) ([]*AttackPathResult, bool, error) {
+	if maxHops <= 0 {
+		maxHops = DefaultMaxHops
+	}
+	if limit <= 0 {
+		limit = DefaultPathLimit
+	}
+
+	targets, err := g.attackTargets(fromID, toID, tags)
+	if err != nil {
+		return nil, false, err
+	}
+	isTarget := make(map[int64]bool, len(targets))
+	for _, id := range targets {
+		isTarget[int64(g.nodeIndex[id])] = true
+	}
+
+	v := g.flowView(filter)
+	var results []*AttackPathResult
+	onPath := make(map[int64]bool)
+	current := []graph.Node{simple.Node(g.nodeIndex[fromID])}
+	complete := true
+
+	var walk func() error
+	walk = func() error {
+		last := current[len(current)-1]
+		if len(current) > 1 && isTarget[last.ID()] {
+			nodes, edges, err := g.resolvePath(current, v)
+			if err != nil {
+				return err
+			}
+			results = append(results, g.attackPathResult(nodes, edges))
+		}
+		if len(current) > maxHops {
+			return nil
+		}
+
+		onPath[last.ID()] = true
+		defer delete(onPath, last.ID())
+
+		next := v.From(last.ID())
+		for next.Next() {
+			if len(results) >= limit || *budget <= 0 {
+				complete = false
+				return nil
+			}
+			*budget--
+
+			n := next.Node()
+			if onPath[n.ID()] {
+				continue
+			}
+			current = append(current, n)
+			err := walk()
+			current = current[:len(current)-1]
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(); err != nil {
+		return nil, false, err
+	}
+
+	sortAttackPaths(results)
+	return results, complete, nil
+}
+
+// attackTargets validates the source and returns the target IDs of an
+// attack path query: toID if set, otherwise every sensitive resource
+func (g *Graph) attackTargets(fromID, toID string, tags []string) ([]string, error) {
+	if _, ok := g.nodeIndex[fromID]; !ok {
+		return nil, fmt.Errorf("source node not found: %s", fromID)
+	}
+
+	if toID != "" {
+		if _, ok := g.nodeIndex[toID]; !ok {
+			return nil, fmt.Errorf("destination node not found: %s", toID)
+		}
+		return []string{toID}, nil
+	}
+
+	if slices.Contains(tags, "sensitive") {
+		return g.findSensitiveResources(), nil
+	}
+
+	return nil, fmt.Errorf("target ID or 'sensitive' tag required")
+}
+
+// sortAttackPaths orders paths cheapest first, then by fewer hops. The sort
+// is stable, so paths that tie keep the order they were found in.
+func sortAttackPaths(results []*AttackPathResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Cost != results[j].Cost {
+			return results[i].Cost < results[j].Cost
+		}
+		return len(results[i].Nodes) < len(results[j].Nodes)
+	})
+}
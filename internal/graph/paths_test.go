@@ -0,0 +1,202 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+// newDiamondGraph builds three routes from "user" to "bucket": a cheap
+// two-hop route via "a", a dearer two-hop route via "b" and a three-hop
+// route via "b" and "c"
+func newDiamondGraph(t *testing.T) *Graph {
+	t.Helper()
+
+	g := New()
+	for _, id := range []string{"user", "a", "b", "c", "bucket"} {
+		g.AddNode(ingest.Node{ID: id, Kind: ingest.KindPrincipal})
+	}
+	for _, e := range []ingest.Edge{
+		{Src: "user", Dst: "a", Kind: ingest.EdgeAssumesRole},
+		{Src: "a", Dst: "bucket", Kind: ingest.EdgeAppliesTo},
+		{Src: "user", Dst: "b", Kind: ingest.EdgeAssumesRole, Props: map[string]string{"condition_keys": "sts:ExternalId"}},
+		{Src: "b", Dst: "bucket", Kind: ingest.EdgeAppliesTo},
+		{Src: "b", Dst: "c", Kind: ingest.EdgeAttachedPolicy},
+		{Src: "c", Dst: "bucket", Kind: ingest.EdgeAppliesTo},
+	} {
+		if err := g.AddEdge(e); err != nil {
+			t.Fatalf("Failed to add edge: %v", err)
+		}
+	}
+	return g
+}
+
+func pathIDs(result *AttackPathResult) string {
+	ids := make([]string, len(result.Nodes))
+	for i, n := range result.Nodes {
+		ids[i] = n.ID
+	}
+	return strings.Join(ids, ">")
+}
+
+func TestFindAttackPaths(t *testing.T) {
+	g := newDiamondGraph(t)
+
+	t.Run("k alternatives cheapest first", func(t *testing.T) {
+		results, err := g.FindAttackPaths("user", "bucket", nil, 3, 8, EdgeFilter{})
+		if err != nil {
+			t.Fatalf("FindAttackPaths failed: %v", err)
+		}
+
+		want := []string{"user>a>bucket", "user>b>bucket", "user>b>c>bucket"}
+		if len(results) != len(want) {
+			t.Fatalf("Expected %d paths, got %d", len(want), len(results))
+		}
+		for i, w := range want {
+			if got := pathIDs(results[i]); got != w {
+				t.Errorf("Path %d: expected %s, got %s", i, w, got)
+			}
+			if i > 0 && results[i].Cost < results[i-1].Cost {
+				t.Errorf("Paths not sorted by cost: %v then %v", results[i-1].Cost, results[i].Cost)
+			}
+		}
+	})
+
+	t.Run("first path matches FindAttackPath", func(t *testing.T) {
+		results, err := g.FindAttackPaths("user", "bucket", nil, 1, 8, EdgeFilter{})
+		if err != nil {
+			t.Fatalf("FindAttackPaths failed: %v", err)
+		}
+		single, err := g.FindAttackPath("user", "bucket", nil, 8, EdgeFilter{})
+		if err != nil {
+			t.Fatalf("FindAttackPath failed: %v", err)
+		}
+		if len(results) != 1 || pathIDs(results[0]) != pathIDs(single) {
+			t.Errorf("Expected %s, got %v", pathIDs(single), results)
+		}
+	})
+
+	t.Run("max hops drops longer paths", func(t *testing.T) {
+		results, err := g.FindAttackPaths("user", "bucket", nil, 3, 2, EdgeFilter{})
+		if err != nil {
+			t.Fatalf("FindAttackPaths failed: %v", err)
+		}
+		if len(results) != 2 {
+			t.Errorf("Expected 2 paths within 2 hops, got %d", len(results))
+		}
+	})
+
+	t.Run("sensitive targets", func(t *testing.T) {
+		if err := g.MarkSensitive("bucket"); err != nil {
+			t.Fatalf("MarkSensitive failed: %v", err)
+		}
+		if err := g.MarkSensitive("c"); err != nil {
+			t.Fatalf("MarkSensitive failed: %v", err)
+		}
+
+		results, err := g.FindAttackPaths("user", "", []string{"sensitive"}, 2, 8, EdgeFilter{})
+		if err != nil {
+			t.Fatalf("FindAttackPaths failed: %v", err)
+		}
+		if len(results) != 2 || pathIDs(results[0]) != "user>a>bucket" {
+			t.Errorf("Expected two paths starting with user>a>bucket, got %d", len(results))
+		}
+	})
+
+	t.Run("missing target", func(t *testing.T) {
+		if _, err := g.FindAttackPaths("user", "nope", nil, 3, 8, EdgeFilter{}); err == nil {
+			t.Error("Expected error for unknown target")
+		}
+	})
+}
+
+func TestAllAttackPaths(t *testing.T) {
+	g := newDiamondGraph(t)
+
+	results, err := g.AllAttackPaths("user", "bucket", nil, 8, 0, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("AllAttackPaths failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 simple paths, got %d", len(results))
+	}
+	if got := pathIDs(results[0]); got != "user>a>bucket" {
+		t.Errorf("Expected cheapest path first, got %s", got)
+	}
+
+	results, err = g.AllAttackPaths("user", "bucket", nil, 2, 0, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("AllAttackPaths failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Expected 2 paths within 2 hops, got %d", len(results))
+	}
+
+	results, err = g.AllAttackPaths("user", "bucket", nil, 8, 1, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("AllAttackPaths failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("Expected limit of 1 path, got %d", len(results))
+	}
+
+	results, err = g.AllAttackPaths("user", "bucket", nil, 8, 0, EdgeFilter{Deny: []string{ingest.EdgeAttachedPolicy}})
+	if err != nil {
+		t.Fatalf("AllAttackPaths failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Errorf("Expected 2 paths without ATTACHED_POLICY, got %d", len(results))
+	}
+}
+
+func TestFindAttackPathsHopLimit(t *testing.T) {
+	g := newHopLimitGraph(t)
+
+	// The cheapest path is four hops; the direct edge is the only one
+	// within two
+	results, err := g.FindAttackPaths("P", "T", nil, 1, 2, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("FindAttackPaths failed: %v", err)
+	}
+	if len(results) != 1 || pathIDs(results[0]) != "P>T" {
+		t.Fatalf("Expected P>T within 2 hops, got %d paths", len(results))
+	}
+
+	results, err = g.FindAttackPaths("P", "T", nil, 3, 8, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("FindAttackPaths failed: %v", err)
+	}
+	if len(results) != 2 || pathIDs(results[0]) != "P>X1>X2>X3>T" || pathIDs(results[1]) != "P>T" {
+		t.Errorf("Expected both paths cheapest first, got %d paths", len(results))
+	}
+}
+
+func TestAllAttackPathsBudget(t *testing.T) {
+	g := newDenseQueryGraph(t)
+	g.AddNode(ingest.Node{ID: "island", Kind: ingest.KindResource})
+
+	// No path reaches the island, so without a budget every simple path of
+	// up to 16 hops would be walked
+	budget := 1000
+	results, complete, err := g.allAttackPaths("n00", "island", nil, 16, 0, EdgeFilter{}, &budget)
+	if err != nil {
+		t.Fatalf("allAttackPaths failed: %v", err)
+	}
+	if len(results) != 0 || complete || budget != 0 {
+		t.Errorf("Expected an incomplete search that used the budget, got %d paths, complete %v, budget %d", len(results), complete, budget)
+	}
+
+	results, err = g.AllAttackPaths("n00", "island", nil, 16, 0, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("AllAttackPaths failed: %v", err)
+	}
+	if len(results) != 0 {
+		t.Errorf("Expected no paths, got %d", len(results))
+	}
+
+	budget = MaxPathExpansions
+	if _, complete, _ := newDiamondGraph(t).allAttackPaths("user", "bucket", nil, 8, 0, EdgeFilter{}, &budget); !complete {
+		t.Error("Expected a complete search of the diamond graph")
+	}
+}
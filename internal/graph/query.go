@@ -0,0 +1,495 @@
+package graph
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+// DefaultQueryLimit is how many rows a query returns without a LIMIT clause
+const DefaultQueryLimit = 100
+
+// MaxQueryHops bounds variable-length relationships in queries
+const MaxQueryHops = 16
+
+// MaxQueryExpansions bounds the edges a query may try while matching, so
+// that a pattern with many variable-length paths cannot run unbounded
+const MaxQueryExpansions = 1_000_000
+
+// Query value kinds
+const (
+	QueryValueNode  = "node"
+	QueryValueEdge  = "edge"
+	QueryValuePath  = "path"
+	QueryValueValue = "value"
+)
+
+// QueryResult is the table a query returns
+type QueryResult struct {
+	Columns []string       `json:"columns"`
+	Rows    [][]QueryValue `json:"rows"`
+	// Truncated is set when more rows matched than the limit, or when
+	// matching stopped after MaxQueryExpansions edges, in which case further
+	// rows may exist
+	Truncated bool `json:"truncated"`
+}
+
+// QueryValue is one cell of a query result. Node is set for node variables,
+// Edges for relationship variables (one edge, or the hops of a
+// variable-length relationship) and Value for properties, nil when the
+// property is absent.
+type QueryValue struct {
+	Kind  string        `json:"kind"`
+	Node  *ingest.Node  `json:"node,omitempty"`
+	Edges []ingest.Edge `json:"edges,omitempty"`
+	Value *string       `json:"value,omitempty"`
+}
+
+// Query runs a pattern query in a subset of Cypher:
+//
+//	MATCH (p:PRINCIPAL)-[:ATTACHED_POLICY]->(:POLICY)-[:ALLOWS_ACTION]->(x {wildcard: "true"})
+//	WHERE p.id CONTAINS "Dev" AND NOT x.action = "s3:GetObject"
+//	RETURN DISTINCT p, x.action AS action
+//	LIMIT 10
+//
+// A pattern is a single chain of nodes, each with an optional variable,
+// kinds (:PRINCIPAL|ROLE) and property map, joined by relationships written
+// -[]->, <-[]- or -[]- (or -->, <--, --) with optional variable, edge kinds,
+// property map and hop range (*, *2, *1..3, *..4). Node properties include id
+// and kind; edge properties include kind, src and dst. Property values always
+// compare as strings. WHERE combines =, <>, CONTAINS, STARTS WITH, ENDS WITH,
+// IS NULL and IS NOT NULL with AND, OR, NOT and parentheses; conditions
+// AND-ed at the top level that only read node variables are checked as soon
+// as those are bound. A node variable that appears twice must bind the same
+// node, and no match uses an edge twice. Rows come in match order, starting
+// from nodes in ID order, and stop at LIMIT or DefaultQueryLimit, or once
+// MaxQueryExpansions edges have been tried. Matching stops with ctx's error
+// if ctx is done first.
+func (g *Graph) Query(ctx context.Context, src string) (*QueryResult, error) {
+	q, err := parseQuery(src)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	limit := q.limit
+	if limit <= 0 {
+		limit = DefaultQueryLimit
+	}
+
+	result := &QueryResult{Rows: [][]QueryValue{}}
+	for _, item := range q.returns {
+		result.Columns = append(result.Columns, item.column())
+	}
+
+	m := &queryMatch{
+		g:     g,
+		q:     q,
+		ctx:   ctx,
+		nodes: make(map[string]int32),
+		rels:  make(map[string][]int),
+		used:  make(map[int]bool),
+	}
+	m.planWhere()
+	seen := make(map[string]bool)
+	m.emit = func() bool {
+		for _, cond := range m.late {
+			if !cond.eval(m) {
+				return true
+			}
+		}
+
+		row := m.row()
+		if q.distinct {
+			key := rowKey(row)
+			if seen[key] {
+				return true
+			}
+			seen[key] = true
+		}
+
+		if len(result.Rows) == limit {
+			result.Truncated = true
+			return false
+		}
+		result.Rows = append(result.Rows, row)
+		return true
+	}
+
+	for _, start := range g.queryStarts(q.nodes[0]) {
+		if !m.spend() {
+			break
+		}
+		if !m.bindNode(0, start) {
+			continue
+		}
+		more := m.extend(0, start)
+		m.unbindNode(0)
+		if !more {
+			break
+		}
+	}
+
+	if m.err != nil {
+		return nil, m.err
+	}
+	if m.exhausted {
+		result.Truncated = true
+	}
+	return result, nil
+}
+
+// queryStarts returns the candidates for a pattern's first node in ID order
+func (g *Graph) queryStarts(first nodePattern) []int32 {
+	if id, ok := first.props["id"]; ok {
+		if n, found := g.nodeIndex[id]; found {
+			return []int32{n}
+		}
+		return nil
+	}
+
+	return g.sortedNodes()
+}
+
+// queryMatch is the state of a backtracking match of one query
+type queryMatch struct {
+	g *Graph
+	q *query
+	// nodes and rels bind variables; rels hold edge positions in g.edges
+	nodes map[string]int32
+	rels  map[string][]int
+	// used marks the edges of the current match, which may not repeat
+	used map[int]bool
+	// nodeChecks[i] are the WHERE conditions checked when pattern node i is
+	// bound; late are those checked on a complete match
+	nodeChecks [][]queryExpr
+	late       []queryExpr
+	// emit records a complete match and reports whether to keep going
+	emit func() bool
+
+	// ctx, expansions, exhausted and err stop a match that runs too long
+	ctx        context.Context
+	expansions int
+	exhausted  bool
+	err        error
+}
+
+// planWhere splits the WHERE clause into its AND-ed conditions. A condition
+// that only reads node variables is checked by the pattern node that binds
+// the last of them, so that partial matches which cannot satisfy it are cut
+// early; the rest wait for a complete match.
+func (m *queryMatch) planWhere() {
+	m.nodeChecks = make([][]queryExpr, len(m.q.nodes))
+	if m.q.where == nil {
+		return
+	}
+
+	first := make(map[string]int)
+	for i, n := range m.q.nodes {
+		if _, ok := first[n.variable]; n.variable != "" && !ok {
+			first[n.variable] = i
+		}
+	}
+
+	for _, cond := range conjuncts(m.q.where) {
+		at, early := -1, true
+		for _, variable := range exprVariables(cond) {
+			i, ok := first[variable]
+			if !ok {
+				early = false
+				break
+			}
+			at = max(at, i)
+		}
+		if early && at >= 0 {
+			m.nodeChecks[at] = append(m.nodeChecks[at], cond)
+		} else {
+			m.late = append(m.late, cond)
+		}
+	}
+}
+
+// spend counts one expansion of the match and reports whether it may go on:
+// false once MaxQueryExpansions is used up or ctx is done
+func (m *queryMatch) spend() bool {
+	m.expansions++
+	if m.expansions > MaxQueryExpansions {
+		m.exhausted = true
+		return false
+	}
+	if m.expansions%1024 == 0 {
+		if err := m.ctx.Err(); err != nil {
+			m.err = err
+			return false
+		}
+	}
+	return true
+}
+
+// bindNode binds pattern node i to n if n matches it, reporting success
+func (m *queryMatch) bindNode(i int, n int32) bool {
+	pattern := m.q.nodes[i]
+	if !m.g.matchNode(pattern, n) {
+		return false
+	}
+	if pattern.variable == "" {
+		return true
+	}
+	if bound, ok := m.nodes[pattern.variable]; ok {
+		// A repeated variable must bind the node it already holds
+		return bound == n
+	}
+	m.nodes[pattern.variable] = n
+	for _, cond := range m.nodeChecks[i] {
+		if !cond.eval(m) {
+			delete(m.nodes, pattern.variable)
+			return false
+		}
+	}
+	return true
+}
+
+// unbindNode releases the binding bindNode(i, ...) made, unless the variable
+// was bound by an earlier occurrence
+func (m *queryMatch) unbindNode(i int) {
+	variable := m.q.nodes[i].variable
+	if variable == "" {
+		return
+	}
+	for j := 0; j < i; j++ {
+		if m.q.nodes[j].variable == variable {
+			return
+		}
+	}
+	delete(m.nodes, variable)
+}
+
+// extend matches relationship i onwards from n, the node bound to pattern
+// node i. It reports whether to keep matching.
+func (m *queryMatch) extend(i int, n int32) bool {
+	if i == len(m.q.rels) {
+		return m.emit()
+	}
+
+	rel := m.q.rels[i]
+	var hops []int
+
+	var walk func(at int32) bool
+	walk = func(at int32) bool {
+		if len(hops) >= rel.min && m.bindNode(i+1, at) {
+			if rel.variable != "" {
+				m.rels[rel.variable] = append([]int(nil), hops...)
+			}
+			more := m.extend(i+1, at)
+			delete(m.rels, rel.variable)
+			m.unbindNode(i + 1)
+			if !more {
+				return false
+			}
+		}
+		if len(hops) == rel.max {
+			return true
+		}
+
+		for _, idx := range m.g.queryLines(at, rel.dir) {
+			if !m.spend() {
+				return false
+			}
+			if m.used[idx] || !m.g.matchEdge(rel, idx) {
+				continue
+			}
+
+			next := m.g.other(idx, at)
+
+			m.used[idx] = true
+			hops = append(hops, idx)
+			more := walk(next)
+			hops = hops[:len(hops)-1]
+			delete(m.used, idx)
+			if !more {
+				return false
+			}
+		}
+		return true
+	}
+
+	return walk(n)
+}
+
+// queryLines returns the positions of the edges leaving n in direction dir,
+// in insertion order
+func (g *Graph) queryLines(n int32, dir int) []int {
+	var lines []int
+	if dir != dirIn {
+		for _, idx := range g.linesFrom(n) {
+			lines = append(lines, int(idx))
+		}
+	}
+	if dir != dirOut {
+		for _, idx := range g.linesTo(n) {
+			lines = append(lines, int(idx))
+		}
+	}
+	if dir != dirBoth {
+		return lines
+	}
+	sort.Ints(lines)
+	// A self loop appears in both lists
+	lines = compactInts(lines)
+	return lines
+}
+
+// compactInts removes adjacent duplicates from a sorted slice
+func compactInts(s []int) []int {
+	if len(s) == 0 {
+		return s
+	}
+	out := s[:1]
+	for _, v := range s[1:] {
+		if v != out[len(out)-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// matchNode reports whether node n satisfies a node pattern
+func (g *Graph) matchNode(pattern nodePattern, n int32) bool {
+	if len(pattern.kinds) > 0 && !containsFold(pattern.kinds, string(g.nodeKind(n))) {
+		return false
+	}
+	for k, v := range pattern.props {
+		if got, ok := g.nodeProp(n, k); !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// matchEdge reports whether the edge at position idx satisfies a
+// relationship pattern
+func (g *Graph) matchEdge(pattern relPattern, idx int) bool {
+	if len(pattern.kinds) > 0 && !containsFold(pattern.kinds, g.edgeKind(idx)) {
+		return false
+	}
+	for k, v := range pattern.props {
+		if got, ok := g.edgeProp(idx, k); !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// containsFold reports whether kinds holds kind in any case
+func containsFold(kinds []string, kind string) bool {
+	for _, k := range kinds {
+		if strings.EqualFold(k, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeProp returns a property of node n, with id and kind taken from the
+// node
+func (g *Graph) nodeProp(n int32, key string) (string, bool) {
+	switch key {
+	case "id":
+		return g.nodeIDs[n], true
+	case "kind":
+		return string(g.nodeKind(n)), true
+	}
+	return g.propOf(n, key)
+}
+
+// edgeProp returns a property of the edge at position idx, with kind, src
+// and dst taken from the edge
+func (g *Graph) edgeProp(idx int, key string) (string, bool) {
+	switch key {
+	case "kind":
+		return g.edgeKind(idx), true
+	case "src":
+		return g.nodeIDs[g.edgeSrc[idx]], true
+	case "dst":
+		return g.nodeIDs[g.edgeDst[idx]], true
+	}
+	return g.edgePropOf(idx, key)
+}
+
+// prop returns a property of a bound variable
+func (m *queryMatch) prop(variable, key string) (string, bool) {
+	if n, ok := m.nodes[variable]; ok {
+		return m.g.nodeProp(n, key)
+	}
+	if idxs, ok := m.rels[variable]; ok && len(idxs) == 1 {
+		return m.g.edgeProp(idxs[0], key)
+	}
+	return "", false
+}
+
+// row builds the result row for the current match
+func (m *queryMatch) row() []QueryValue {
+	row := make([]QueryValue, len(m.q.returns))
+	for i, item := range m.q.returns {
+		if item.prop != "" {
+			row[i] = QueryValue{Kind: QueryValueValue}
+			if v, ok := m.prop(item.variable, item.prop); ok {
+				row[i].Value = &v
+			}
+			continue
+		}
+
+		if n, ok := m.nodes[item.variable]; ok {
+			node := m.g.node(n)
+			row[i] = QueryValue{Kind: QueryValueNode, Node: &node}
+			continue
+		}
+
+		idxs := m.rels[item.variable]
+		edges := make([]ingest.Edge, len(idxs))
+		for j, idx := range idxs {
+			edges[j] = m.g.edge(idx)
+		}
+		row[i] = QueryValue{Kind: QueryValueEdge, Edges: edges}
+		if m.isPath(item.variable) {
+			row[i].Kind = QueryValuePath
+		}
+	}
+	return row
+}
+
+// isPath reports whether variable names a variable-length relationship
+func (m *queryMatch) isPath(variable string) bool {
+	for _, rel := range m.q.rels {
+		if rel.variable == variable {
+			return rel.varLength
+		}
+	}
+	return false
+}
+
+// rowKey identifies a row for RETURN DISTINCT
+func rowKey(row []QueryValue) string {
+	var sb strings.Builder
+	for _, v := range row {
+		sb.WriteString(v.Kind)
+		sb.WriteByte(0)
+		switch {
+		case v.Node != nil:
+			sb.WriteString(v.Node.ID)
+		case v.Value != nil:
+			sb.WriteString("=" + *v.Value)
+		default:
+			for _, e := range v.Edges {
+				sb.WriteString(e.Key())
+				sb.WriteByte(1)
+			}
+		}
+		sb.WriteByte(0)
+	}
+	return sb.String()
+}
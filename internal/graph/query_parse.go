@@ -0,0 +1,725 @@
+package graph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Relationship directions in a pattern
+const (
+	dirOut  = iota // (a)-[]->(b)
+	dirIn          // (a)<-[]-(b)
+	dirBoth        // (a)-[]-(b)
+)
+
+// query is a parsed MATCH ... [WHERE ...] RETURN ... [LIMIT n] statement
+type query struct {
+	// nodes and rels alternate along the pattern: nodes[i] -rels[i]- nodes[i+1]
+	nodes    []nodePattern
+	rels     []relPattern
+	where    queryExpr
+	distinct bool
+	returns  []returnItem
+	limit    int
+}
+
+// nodePattern is (var:KIND|KIND {key: "value"})
+type nodePattern struct {
+	variable string
+	kinds    []string
+	props    map[string]string
+}
+
+// relPattern is -[var:KIND|KIND*min..max {key: "value"}]->
+type relPattern struct {
+	variable  string
+	kinds     []string
+	props     map[string]string
+	dir       int
+	varLength bool
+	min, max  int
+}
+
+// returnItem is var, var.prop, optionally AS alias
+type returnItem struct {
+	variable string
+	prop     string
+	alias    string
+}
+
+// column names a return item
+func (r returnItem) column() string {
+	switch {
+	case r.alias != "":
+		return r.alias
+	case r.prop != "":
+		return r.variable + "." + r.prop
+	default:
+		return r.variable
+	}
+}
+
+// queryExpr is a WHERE condition over a match's bindings
+type queryExpr interface {
+	eval(m *queryMatch) bool
+}
+
+type andExpr struct{ left, right queryExpr }
+type orExpr struct{ left, right queryExpr }
+type notExpr struct{ expr queryExpr }
+
+// compareExpr tests var.prop against a value. op is one of =, <>, CONTAINS,
+// STARTS WITH, ENDS WITH, IS NULL and IS NOT NULL.
+type compareExpr struct {
+	variable, prop string
+	op             string
+	value          string
+}
+
+func (e andExpr) eval(m *queryMatch) bool { return e.left.eval(m) && e.right.eval(m) }
+func (e orExpr) eval(m *queryMatch) bool  { return e.left.eval(m) || e.right.eval(m) }
+func (e notExpr) eval(m *queryMatch) bool { return !e.expr.eval(m) }
+
+func (e compareExpr) eval(m *queryMatch) bool {
+	value, ok := m.prop(e.variable, e.prop)
+	switch e.op {
+	case "IS NULL":
+		return !ok
+	case "IS NOT NULL":
+		return ok
+	}
+	if !ok {
+		return false
+	}
+	switch e.op {
+	case "=":
+		return value == e.value
+	case "<>":
+		return value != e.value
+	case "CONTAINS":
+		return strings.Contains(value, e.value)
+	case "STARTS WITH":
+		return strings.HasPrefix(value, e.value)
+	case "ENDS WITH":
+		return strings.HasSuffix(value, e.value)
+	}
+	return false
+}
+
+// conjuncts splits e into the conditions AND-ed at its top level
+func conjuncts(e queryExpr) []queryExpr {
+	if and, ok := e.(andExpr); ok {
+		return append(conjuncts(and.left), conjuncts(and.right)...)
+	}
+	return []queryExpr{e}
+}
+
+// exprVariables returns the variables e reads
+func exprVariables(e queryExpr) []string {
+	switch e := e.(type) {
+	case andExpr:
+		return append(exprVariables(e.left), exprVariables(e.right)...)
+	case orExpr:
+		return append(exprVariables(e.left), exprVariables(e.right)...)
+	case notExpr:
+		return exprVariables(e.expr)
+	case compareExpr:
+		return []string{e.variable}
+	}
+	return nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// lexQuery splits a query into identifiers, quoted strings, integers and
+// single punctuation characters
+func lexQuery(src string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isIdentByte(c) && !isDigit(c):
+			start := i
+			for i < len(src) && isIdentByte(src[i]) {
+				i++
+			}
+			toks = append(toks, token{tokIdent, src[start:i], start})
+		case isDigit(c):
+			start := i
+			for i < len(src) && isDigit(src[i]) {
+				i++
+			}
+			toks = append(toks, token{tokNumber, src[start:i], start})
+		case c == '"' || c == '\'':
+			start := i
+			var sb strings.Builder
+			for i++; ; i++ {
+				if i >= len(src) {
+					return nil, fmt.Errorf("query: position %d: unterminated string", start)
+				}
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+					sb.WriteByte(src[i])
+					continue
+				}
+				if src[i] == c {
+					i++
+					break
+				}
+				sb.WriteByte(src[i])
+			}
+			toks = append(toks, token{tokString, sb.String(), start})
+		case strings.IndexByte("()[]{}:,.|*-<>=", c) >= 0:
+			toks = append(toks, token{tokPunct, string(c), i})
+			i++
+		default:
+			return nil, fmt.Errorf("query: position %d: unexpected character %q", i, c)
+		}
+	}
+	return append(toks, token{tokEOF, "", len(src)}), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isIdentByte reports whether c may appear in an identifier
+func isIdentByte(c byte) bool {
+	return c == '_' || isDigit(c) || (c|0x20 >= 'a' && c|0x20 <= 'z')
+}
+
+// queryParser is a recursive-descent parser over lexed tokens
+type queryParser struct {
+	toks []token
+	pos  int
+}
+
+// parseQuery parses a query in the supported Cypher subset
+func parseQuery(src string) (*query, error) {
+	toks, err := lexQuery(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{toks: toks}
+
+	q, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+	if err := q.check(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (p *queryParser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *queryParser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// isPunct reports whether the next token is punctuation c
+func (p *queryParser) isPunct(c string) bool {
+	t := p.peek()
+	return t.kind == tokPunct && t.text == c
+}
+
+// isKeyword reports whether the next token is keyword kw, in any case
+func (p *queryParser) isKeyword(kw string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && strings.EqualFold(t.text, kw)
+}
+
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	found := t.text
+	if t.kind == tokEOF {
+		found = "end of query"
+	}
+	return fmt.Errorf("query: position %d: %s, found %q", t.pos, fmt.Sprintf(format, args...), found)
+}
+
+func (p *queryParser) expectPunct(c string) error {
+	if !p.isPunct(c) {
+		return p.errorf("expected %q", c)
+	}
+	p.next()
+	return nil
+}
+
+func (p *queryParser) expectKeyword(kw string) error {
+	if !p.isKeyword(kw) {
+		return p.errorf("expected %s", kw)
+	}
+	p.next()
+	return nil
+}
+
+func (p *queryParser) ident() (string, error) {
+	if p.peek().kind != tokIdent {
+		return "", p.errorf("expected identifier")
+	}
+	return p.next().text, nil
+}
+
+func (p *queryParser) number() (int, error) {
+	if p.peek().kind != tokNumber {
+		return 0, p.errorf("expected number")
+	}
+	return strconv.Atoi(p.next().text)
+}
+
+func (p *queryParser) query() (*query, error) {
+	q := &query{}
+	if err := p.expectKeyword("MATCH"); err != nil {
+		return nil, err
+	}
+
+	node, err := p.nodePattern()
+	if err != nil {
+		return nil, err
+	}
+	q.nodes = append(q.nodes, node)
+	for p.isPunct("-") || p.isPunct("<") {
+		rel, err := p.relPattern()
+		if err != nil {
+			return nil, err
+		}
+		node, err := p.nodePattern()
+		if err != nil {
+			return nil, err
+		}
+		q.rels = append(q.rels, rel)
+		q.nodes = append(q.nodes, node)
+	}
+
+	if p.isKeyword("WHERE") {
+		p.next()
+		if q.where, err = p.orExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.expectKeyword("RETURN"); err != nil {
+		return nil, err
+	}
+	if p.isKeyword("DISTINCT") {
+		p.next()
+		q.distinct = true
+	}
+	for {
+		item, err := p.returnItem()
+		if err != nil {
+			return nil, err
+		}
+		q.returns = append(q.returns, item)
+		if !p.isPunct(",") {
+			break
+		}
+		p.next()
+	}
+
+	if p.isKeyword("LIMIT") {
+		p.next()
+		if q.limit, err = p.number(); err != nil {
+			return nil, err
+		}
+		if q.limit <= 0 {
+			return nil, fmt.Errorf("query: LIMIT must be positive")
+		}
+	}
+
+	if p.peek().kind != tokEOF {
+		return nil, p.errorf("expected end of query")
+	}
+	return q, nil
+}
+
+// nodePattern parses (var:KIND|KIND {props})
+func (p *queryParser) nodePattern() (nodePattern, error) {
+	var n nodePattern
+	if err := p.expectPunct("("); err != nil {
+		return n, err
+	}
+
+	var err error
+	if p.peek().kind == tokIdent {
+		n.variable = p.next().text
+	}
+	if p.isPunct(":") {
+		if n.kinds, err = p.kinds(); err != nil {
+			return n, err
+		}
+	}
+	if p.isPunct("{") {
+		if n.props, err = p.props(); err != nil {
+			return n, err
+		}
+	}
+
+	return n, p.expectPunct(")")
+}
+
+// relPattern parses -[...]->, <-[...]-, -[...]- and the bare forms -->,
+// <-- and --
+func (p *queryParser) relPattern() (relPattern, error) {
+	r := relPattern{dir: dirBoth, min: 1, max: 1}
+
+	if p.isPunct("<") {
+		p.next()
+		r.dir = dirIn
+	}
+	if err := p.expectPunct("-"); err != nil {
+		return r, err
+	}
+
+	if p.isPunct("[") {
+		p.next()
+		var err error
+		if p.peek().kind == tokIdent {
+			r.variable = p.next().text
+		}
+		if p.isPunct(":") {
+			if r.kinds, err = p.kinds(); err != nil {
+				return r, err
+			}
+		}
+		if p.isPunct("*") {
+			if err := p.hops(&r); err != nil {
+				return r, err
+			}
+		}
+		if p.isPunct("{") {
+			if r.props, err = p.props(); err != nil {
+				return r, err
+			}
+		}
+		if err := p.expectPunct("]"); err != nil {
+			return r, err
+		}
+	}
+
+	if err := p.expectPunct("-"); err != nil {
+		return r, err
+	}
+	if p.isPunct(">") {
+		if r.dir == dirIn {
+			return r, p.errorf("relationship cannot point both ways")
+		}
+		p.next()
+		r.dir = dirOut
+	}
+
+	return r, nil
+}
+
+// hops parses *, *n, *min.., *..max and *min..max
+func (p *queryParser) hops(r *relPattern) error {
+	p.next()
+	r.varLength = true
+	r.min, r.max = 1, DefaultMaxHops
+
+	var err error
+	if p.peek().kind == tokNumber {
+		if r.min, err = p.number(); err != nil {
+			return err
+		}
+		r.max = r.min
+	}
+	if p.isPunct(".") {
+		p.next()
+		if err := p.expectPunct("."); err != nil {
+			return err
+		}
+		r.max = DefaultMaxHops
+		if p.peek().kind == tokNumber {
+			if r.max, err = p.number(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if r.max < r.min {
+		return fmt.Errorf("query: hop range *%d..%d is empty", r.min, r.max)
+	}
+	if r.max > MaxQueryHops {
+		return fmt.Errorf("query: at most %d hops are allowed, got %d", MaxQueryHops, r.max)
+	}
+	return nil
+}
+
+// kinds parses :KIND|KIND
+func (p *queryParser) kinds() ([]string, error) {
+	p.next()
+	var kinds []string
+	for {
+		kind, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		kinds = append(kinds, kind)
+		if !p.isPunct("|") {
+			return kinds, nil
+		}
+		p.next()
+		// Cypher also writes alternatives as :A|:B
+		if p.isPunct(":") {
+			p.next()
+		}
+	}
+}
+
+// props parses {key: value, ...}; values are strings, numbers or bare words
+// such as true, all compared as strings
+func (p *queryParser) props() (map[string]string, error) {
+	p.next()
+	props := make(map[string]string)
+	for !p.isPunct("}") {
+		key, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		props[key] = value
+
+		if !p.isPunct(",") {
+			break
+		}
+		p.next()
+	}
+	return props, p.expectPunct("}")
+}
+
+// literal parses a string, number or bare word value
+func (p *queryParser) literal() (string, error) {
+	switch p.peek().kind {
+	case tokString, tokNumber, tokIdent:
+		return p.next().text, nil
+	}
+	return "", p.errorf("expected value")
+}
+
+func (p *queryParser) returnItem() (returnItem, error) {
+	var item returnItem
+	var err error
+	if item.variable, err = p.ident(); err != nil {
+		return item, err
+	}
+	if p.isPunct(".") {
+		p.next()
+		if item.prop, err = p.ident(); err != nil {
+			return item, err
+		}
+	}
+	if p.isKeyword("AS") {
+		p.next()
+		if item.alias, err = p.ident(); err != nil {
+			return item, err
+		}
+	}
+	return item, nil
+}
+
+func (p *queryParser) orExpr() (queryExpr, error) {
+	left, err := p.andExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("OR") {
+		p.next()
+		right, err := p.andExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) andExpr() (queryExpr, error) {
+	left, err := p.notExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("AND") {
+		p.next()
+		right, err := p.notExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) notExpr() (queryExpr, error) {
+	if p.isKeyword("NOT") {
+		p.next()
+		expr, err := p.notExpr()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr}, nil
+	}
+	if p.isPunct("(") {
+		p.next()
+		expr, err := p.orExpr()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expectPunct(")")
+	}
+	return p.compareExpr()
+}
+
+// compareExpr parses var.prop followed by an operator and, except for the
+// null tests, a value
+func (p *queryParser) compareExpr() (queryExpr, error) {
+	var e compareExpr
+	var err error
+	if e.variable, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if err := p.expectPunct("."); err != nil {
+		return nil, err
+	}
+	if e.prop, err = p.ident(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.isPunct("="):
+		p.next()
+		e.op = "="
+	case p.isPunct("<"):
+		p.next()
+		if err := p.expectPunct(">"); err != nil {
+			return nil, err
+		}
+		e.op = "<>"
+	case p.isKeyword("CONTAINS"):
+		p.next()
+		e.op = "CONTAINS"
+	case p.isKeyword("STARTS"), p.isKeyword("ENDS"):
+		e.op = strings.ToUpper(p.next().text) + " WITH"
+		if err := p.expectKeyword("WITH"); err != nil {
+			return nil, err
+		}
+	case p.isKeyword("IS"):
+		p.next()
+		e.op = "IS NULL"
+		if p.isKeyword("NOT") {
+			p.next()
+			e.op = "IS NOT NULL"
+		}
+		return e, p.expectKeyword("NULL")
+	default:
+		return nil, p.errorf("expected comparison operator")
+	}
+
+	if e.value, err = p.literal(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// check validates variable use: relationship variables are unique and not
+// shared with nodes, and WHERE and RETURN only name pattern variables, with
+// no property access on variable-length relationships
+func (q *query) check() error {
+	kinds := make(map[string]string)
+	for _, n := range q.nodes {
+		if n.variable == "" {
+			continue
+		}
+		if kinds[n.variable] == "rel" {
+			return fmt.Errorf("query: %s is both a node and a relationship", n.variable)
+		}
+		kinds[n.variable] = "node"
+	}
+	for _, r := range q.rels {
+		if r.variable == "" {
+			continue
+		}
+		if _, dup := kinds[r.variable]; dup {
+			return fmt.Errorf("query: variable %s is already defined", r.variable)
+		}
+		kinds[r.variable] = "rel"
+		if r.varLength {
+			kinds[r.variable] = "path"
+		}
+	}
+
+	checkRef := func(variable, prop string) error {
+		kind, ok := kinds[variable]
+		if !ok {
+			return fmt.Errorf("query: variable %s is not defined", variable)
+		}
+		if kind == "path" && prop != "" {
+			return fmt.Errorf("query: %s is a variable-length relationship and has no properties", variable)
+		}
+		return nil
+	}
+
+	var walk func(e queryExpr) error
+	walk = func(e queryExpr) error {
+		switch e := e.(type) {
+		case andExpr:
+			if err := walk(e.left); err != nil {
+				return err
+			}
+			return walk(e.right)
+		case orExpr:
+			if err := walk(e.left); err != nil {
+				return err
+			}
+			return walk(e.right)
+		case notExpr:
+			return walk(e.expr)
+		case compareExpr:
+			return checkRef(e.variable, e.prop)
+		}
+		return nil
+	}
+	if q.where != nil {
+		if err := walk(q.where); err != nil {
+			return err
+		}
+	}
+
+	for _, item := range q.returns {
+		if err := checkRef(item.variable, item.prop); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+// queryColumn returns column c of every row, rendering nodes by ID, values
+// as text ("<null>" when absent) and relationships as their edge kinds
+func queryColumn(result *QueryResult, c int) []string {
+	var out []string
+	for _, row := range result.Rows {
+		v := row[c]
+		switch v.Kind {
+		case QueryValueNode:
+			out = append(out, v.Node.ID)
+		case QueryValueValue:
+			if v.Value == nil {
+				out = append(out, "<null>")
+			} else {
+				out = append(out, *v.Value)
+			}
+		default:
+			var kinds []string
+			for _, e := range v.Edges {
+				kinds = append(kinds, e.Kind)
+			}
+			out = append(out, strings.Join(kinds, ","))
+		}
+	}
+	return out
+}
+
+func TestQuery(t *testing.T) {
+	g := newEscalationGraph(t)
+	g.ExpandEscalations()
+
+	tests := []struct {
+		name      string
+		query     string
+		columns   []string
+		want      []string
+		truncated bool
+	}{
+		{
+			name:    "chain with property filter",
+			query:   `MATCH (p:PRINCIPAL)-[:ATTACHED_POLICY]->(:POLICY)-[:ALLOWS_ACTION]->(x {action: "iam:PassRole"}) RETURN p`,
+			columns: []string{"p"},
+			want:    []string{"arn:aws:iam::111111111111:user/dev", "arn:aws:iam::111111111111:user/ops"},
+		},
+		{
+			name:    "where, alias and keywords in any case",
+			query:   `match (p:principal)-[:attached_policy]->(pol) where p.id ENDS WITH "dev" or p.id contains 'Admin' return pol.id as policy`,
+			columns: []string{"policy"},
+			want:    []string{"policy/Admin", "policy/Launch"},
+		},
+		{
+			name:    "incoming relationship with distinct",
+			query:   `MATCH (perm)<-[:ALLOWS_ACTION]-(pol:POLICY {id: "policy/Launch"}) RETURN DISTINCT pol`,
+			columns: []string{"pol"},
+			want:    []string{"policy/Launch"},
+		},
+		{
+			name:    "variable-length path through an escalation",
+			query:   `MATCH (p {id: "arn:aws:iam::111111111111:user/dev"})-[r*..4]->(b {sensitive: "true"}) RETURN r, b`,
+			columns: []string{"r", "b"},
+			want:    []string{"CAN_ESCALATE_TO,ATTACHED_POLICY,ALLOWS_ACTION,APPLIES_TO"},
+		},
+		{
+			name:    "variable-length path too short",
+			query:   `MATCH (p {id: "arn:aws:iam::111111111111:user/dev"})-[*..3]->(b {sensitive: "true"}) RETURN b`,
+			columns: []string{"b"},
+			want:    nil,
+		},
+		{
+			name:    "relationship properties",
+			query:   `MATCH (a)-[e:CAN_ESCALATE_TO {technique: "passrole-ec2"}]->(b) RETURN e, e.derived`,
+			columns: []string{"e", "e.derived"},
+			want:    []string{"CAN_ESCALATE_TO"},
+		},
+		{
+			name:    "null test",
+			query:   `MATCH (n:RESOURCE) WHERE n.sensitive IS NULL AND NOT n.id STARTS WITH "arn:aws:iam" RETURN n.id, n.sensitive`,
+			columns: []string{"n.id", "n.sensitive"},
+			want:    []string{"*"},
+		},
+		{
+			name:    "undirected bare relationship",
+			query:   `MATCH (a {id: "policy/Keys"})--(b) RETURN b`,
+			columns: []string{"b"},
+			want:    []string{"arn:aws:iam::111111111111:user/helpdesk", "keys#iam:CreateAccessKey"},
+		},
+		{
+			name:      "limit",
+			query:     `MATCH (n:PRINCIPAL) RETURN n LIMIT 2`,
+			columns:   []string{"n"},
+			want:      []string{"arn:aws:iam::111111111111:role/Admin", "arn:aws:iam::111111111111:user/dev"},
+			truncated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := g.Query(context.Background(), tt.query)
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if strings.Join(result.Columns, ",") != strings.Join(tt.columns, ",") {
+				t.Errorf("Expected columns %v, got %v", tt.columns, result.Columns)
+			}
+			got := queryColumn(result, 0)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Expected rows %v, got %v", tt.want, got)
+			}
+			if result.Truncated != tt.truncated {
+				t.Errorf("Expected truncated=%t, got %t", tt.truncated, result.Truncated)
+			}
+		})
+	}
+}
+
+func TestQueryValues(t *testing.T) {
+	g := newEscalationGraph(t)
+
+	result, err := g.Query(context.Background(), `MATCH (n:RESOURCE) RETURN n.id, n.sensitive, n`)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	sensitive := queryColumn(result, 1)
+	for i, id := range queryColumn(result, 0) {
+		want := "<null>"
+		if id == "arn:aws:s3:::secrets" {
+			want = "true"
+		}
+		if sensitive[i] != want {
+			t.Errorf("%s: expected sensitive %s, got %s", id, want, sensitive[i])
+		}
+		if row := result.Rows[i][2]; row.Kind != QueryValueNode || row.Node.Kind != ingest.KindResource {
+			t.Errorf("Expected a resource node, got %+v", row)
+		}
+	}
+}
+
+func TestQueryRepeatedVariable(t *testing.T) {
+	g := New()
+	for _, id := range []string{"a", "b", "c"} {
+		g.AddNode(ingest.Node{ID: id, Kind: ingest.KindPrincipal})
+	}
+	for _, e := range [][2]string{{"a", "b"}, {"b", "a"}, {"b", "c"}} {
+		if err := g.AddEdge(ingest.Edge{Src: e[0], Dst: e[1], Kind: ingest.EdgeAssumesRole}); err != nil {
+			t.Fatalf("Failed to add edge: %v", err)
+		}
+	}
+
+	// Only a and b lie on a cycle
+	result, err := g.Query(context.Background(), `MATCH (x)-->(y)-->(x) RETURN x`)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if got := strings.Join(queryColumn(result, 0), ","); got != "a,b" {
+		t.Errorf("Expected a,b, got %s", got)
+	}
+
+	// An undirected walk may not go back over the edge it came by
+	result, err = g.Query(context.Background(), `MATCH (x {id: "c"})-[*2]-(y) RETURN y`)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if got := strings.Join(queryColumn(result, 0), ","); got != "a,a" {
+		t.Errorf("Expected a twice, over each parallel route, got %s", got)
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	g := New()
+
+	for _, q := range []string{
+		``,
+		`RETURN n`,
+		`MATCH (n) RETURN m`,
+		`MATCH (n) WHERE m.id = "x" RETURN n`,
+		`MATCH (n)-[r*]->(m) RETURN r.kind`,
+		`MATCH (n)-[r]->(r) RETURN r`,
+		`MATCH (n)-[r]->(m)-[r]->(o) RETURN r`,
+		`MATCH (n) RETURN n LIMIT 0`,
+		`MATCH (n)<-[]->(m) RETURN n`,
+		`MATCH (n)-[*3..1]->(m) RETURN n`,
+		`MATCH (n)-[*..100]->(m) RETURN n`,
+		`MATCH (n {id: 'x) RETURN n`,
+		`MATCH (n) WHERE n.id > "x" RETURN n`,
+		`MATCH (n) RETURN n extra`,
+		`MATCH (n) RETURN n;`,
+	} {
+		if _, err := g.Query(context.Background(), q); err == nil {
+			t.Errorf("Expected error for %q", q)
+		}
+	}
+}
+
+// newDenseQueryGraph builds 30 nodes, each with edges to the next three
+func newDenseQueryGraph(t *testing.T) *Graph {
+	t.Helper()
+
+	g := New()
+	for i := 0; i < 30; i++ {
+		g.AddNode(ingest.Node{ID: fmt.Sprintf("n%02d", i), Kind: ingest.KindPolicy})
+	}
+	for i := 0; i < 30; i++ {
+		for d := 1; d <= 3; d++ {
+			e := ingest.Edge{Src: fmt.Sprintf("n%02d", i), Dst: fmt.Sprintf("n%02d", (i+d)%30), Kind: ingest.EdgeAttachedPolicy}
+			if err := g.AddEdge(e); err != nil {
+				t.Fatalf("Failed to add edge: %v", err)
+			}
+		}
+	}
+	return g
+}
+
+func TestQueryBudget(t *testing.T) {
+	g := newDenseQueryGraph(t)
+
+	result, err := g.Query(context.Background(), `MATCH (a)-[*..8]-(b) WHERE b.id = "nope" RETURN a`)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(result.Rows) != 0 || !result.Truncated {
+		t.Errorf("Expected no rows and truncation at the expansion budget, got %d rows, truncated %v", len(result.Rows), result.Truncated)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := g.Query(ctx, `MATCH (a)-[*..8]-(b) RETURN a`); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestQueryEarlyWhere(t *testing.T) {
+	g := newDenseQueryGraph(t)
+
+	// The condition on a prunes every start but one; the condition on the
+	// relationship is left for complete matches
+	result, err := g.Query(context.Background(), `MATCH (a)-[r]->(b)-[*2]->(c) WHERE a.id = "n00" AND r.dst <> "n01" AND c.id = "n05" RETURN DISTINCT b`)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if got := queryColumn(result, 0); strings.Join(got, ",") != "n02,n03" || result.Truncated {
+		t.Errorf("Expected n02,n03, got %v (truncated %v)", got, result.Truncated)
+	}
+}
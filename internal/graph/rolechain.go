@@ -0,0 +1,295 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+// ChainedSessionSeconds is the longest session AWS issues when a role is
+// assumed with another role's session credentials
+const ChainedSessionSeconds = 3600
+
+// defaultSessionSeconds is a role's MaxSessionDuration when none is recorded
+const defaultSessionSeconds = 3600
+
+// RoleChain is a sequence of role assumptions starting from a principal
+type RoleChain struct {
+	Principal string `json:"principal"`
+	// Depth is the number of assumptions, len(Steps)
+	Depth int             `json:"depth"`
+	Steps []RoleChainStep `json:"steps"`
+}
+
+// RoleChainStep is one role assumption in a chain
+type RoleChainStep struct {
+	Role string      `json:"role"`
+	Edge ingest.Edge `json:"edge"`
+	// Chained is set when the caller holds role session credentials, which
+	// is every step after the first, and the first when the chain starts
+	// from a role. AWS caps such sessions at one hour.
+	Chained bool `json:"chained"`
+	// MaxSessionSeconds is the longest session the step can obtain
+	MaxSessionSeconds int `json:"maxSessionSeconds"`
+}
+
+// RoleChains enumerates the chains of ASSUMES_ROLE edges of at most maxDepth
+// assumptions from a principal, or from every principal if fromID is empty.
+// Every prefix of a chain is itself listed, and no chain revisits a role.
+// Enumeration is depth-first from each principal in ID order and stops once
+// limit chains are found.
+func (g *Graph) RoleChains(fromID string, maxDepth, limit int) ([]RoleChain, error) {
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxHops
+	}
+	if limit <= 0 {
+		limit = DefaultPathLimit
+	}
+
+	var starts []string
+	if fromID != "" {
+		if _, ok := g.nodeIndex[fromID]; !ok {
+			return nil, fmt.Errorf("principal not found: %s", fromID)
+		}
+		starts = []string{fromID}
+	} else {
+		for i, id := range g.nodeIDs {
+			if g.nodeKind(int32(i)) == ingest.KindPrincipal {
+				starts = append(starts, id)
+			}
+		}
+		sort.Strings(starts)
+	}
+
+	chains := []RoleChain{}
+	for _, start := range starts {
+		fromRole := isRoleARN(start)
+		onChain := map[string]bool{start: true}
+		var steps []RoleChainStep
+
+		var walk func(id string)
+		walk = func(id string) {
+			if len(steps) == maxDepth {
+				return
+			}
+			for _, idx := range g.linesFrom(g.nodeIndex[id]) {
+				if g.edgeKind(int(idx)) != ingest.EdgeAssumesRole || onChain[g.nodeIDs[g.edgeDst[idx]]] || len(chains) >= limit {
+					continue
+				}
+				edge := g.edge(int(idx))
+
+				chained := fromRole || len(steps) > 0
+				session := ChainedSessionSeconds
+				if !chained {
+					session = g.maxSessionSeconds(edge.Dst)
+				}
+
+				steps = append(steps, RoleChainStep{
+					Role:              edge.Dst,
+					Edge:              edge,
+					Chained:           chained,
+					MaxSessionSeconds: session,
+				})
+				onChain[edge.Dst] = true
+
+				chains = append(chains, RoleChain{
+					Principal: start,
+					Depth:     len(steps),
+					Steps:     append([]RoleChainStep(nil), steps...),
+				})
+				walk(edge.Dst)
+
+				delete(onChain, edge.Dst)
+				steps = steps[:len(steps)-1]
+			}
+		}
+		walk(start)
+	}
+
+	return chains, nil
+}
+
+// maxSessionSeconds returns a role's MaxSessionDuration
+func (g *Graph) maxSessionSeconds(roleID string) int {
+	if n, ok := g.nodeIndex[roleID]; ok {
+		duration, _ := g.propOf(n, "max_session_duration")
+		if secs, err := strconv.Atoi(duration); err == nil && secs > 0 {
+			return secs
+		}
+	}
+	return defaultSessionSeconds
+}
+
+// ExpandAccountTrust resolves trust policies that trust a whole account. IAM
+// lets a principal assume a role whose trust policy names its account root
+// only if the principal's own policies also allow sts:AssumeRole on the
+// role, so for each ASSUMES_ROLE edge from an ACCOUNT node an ASSUMES_ROLE
+// edge is added from every principal in that account that holds the
+// permission. Added edges carry trust=account, derived=true and via (the
+// account root), plus the trust edge's conditions. It returns the number of
+// edges added.
+func (g *Graph) ExpandAccountTrust() int {
+	if g.Frozen() {
+		return 0
+	}
+
+	var trusts []ingest.Edge
+	for idx := range g.edgeKinds {
+		if g.edgeKind(idx) == ingest.EdgeAssumesRole && g.nodeKind(g.edgeSrc[idx]) == ingest.KindAccount {
+			trusts = append(trusts, g.edge(idx))
+		}
+	}
+	if len(trusts) == 0 {
+		return 0
+	}
+
+	byAccount := make(map[string][]string)
+	for i, id := range g.nodeIDs {
+		if g.nodeKind(int32(i)) == ingest.KindPrincipal {
+			if account := arnAccount(id); account != "" {
+				byAccount[account] = append(byAccount[account], id)
+			}
+		}
+	}
+	for _, principals := range byAccount {
+		sort.Strings(principals)
+	}
+
+	grants := make(map[string][]ingest.Edge)
+	added := 0
+	for _, trust := range trusts {
+		for _, principal := range byAccount[arnAccount(trust.Src)] {
+			if principal == trust.Dst {
+				continue
+			}
+			if _, exists := g.findEdge(g.nodeIndex[principal], g.nodeIndex[trust.Dst], ingest.EdgeAssumesRole); exists {
+				continue
+			}
+
+			if _, ok := grants[principal]; !ok {
+				grants[principal] = g.actionGrants(principal, "sts:AssumeRole")
+			}
+			grant, ok := matchGrant(grants[principal], trust.Dst)
+			if !ok {
+				continue
+			}
+
+			props := map[string]string{
+				"action":  "sts:AssumeRole",
+				"trust":   "account",
+				"via":     trust.Src,
+				"derived": "true",
+			}
+			for _, k := range []string{"condition_keys", "mfa"} {
+				if v, ok := trust.Props[k]; ok {
+					props[k] = v
+				}
+			}
+
+			var prov []ingest.Provenance
+			prov = append(prov, trust.Provenance...)
+			prov = append(prov, grant.Provenance...)
+
+			if err := g.AddEdge(ingest.Edge{
+				Src:        principal,
+				Dst:        trust.Dst,
+				Kind:       ingest.EdgeAssumesRole,
+				Props:      props,
+				Provenance: prov,
+			}); err == nil {
+				added++
+			}
+		}
+	}
+
+	return added
+}
+
+// actionGrants returns the APPLIES_TO edges through which a principal's
+// attached policies allow action
+func (g *Graph) actionGrants(principalID, action string) []ingest.Edge {
+	var grants []ingest.Edge
+	for _, p := range g.linesFrom(g.nodeIndex[principalID]) {
+		if g.edgeKind(int(p)) != ingest.EdgeAttachedPolicy {
+			continue
+		}
+		for _, a := range g.linesFrom(g.edgeDst[p]) {
+			if g.edgeKind(int(a)) != ingest.EdgeAllowsAction {
+				continue
+			}
+			perm := g.edgeDst[a]
+			if allowed, _ := g.propOf(perm, "action"); !iamMatch(allowed, action, true) {
+				continue
+			}
+			for _, r := range g.linesFrom(perm) {
+				if g.edgeKind(int(r)) == ingest.EdgeAppliesTo {
+					grants = append(grants, g.edge(int(r)))
+				}
+			}
+		}
+	}
+	return grants
+}
+
+// matchGrant returns the first grant whose resource matches id
+func matchGrant(grants []ingest.Edge, id string) (ingest.Edge, bool) {
+	for _, grant := range grants {
+		if iamMatch(grant.Dst, id, false) {
+			return grant, true
+		}
+	}
+	return ingest.Edge{}, false
+}
+
+// iamMatch reports whether value matches an IAM pattern, in which * matches
+// any run of characters and ? any single character. Actions compare
+// case-insensitively (fold), resources exactly.
+func iamMatch(pattern, value string, fold bool) bool {
+	if fold {
+		pattern, value = strings.ToLower(pattern), strings.ToLower(value)
+	}
+
+	// Greedy match with backtracking to the most recent *
+	p, v := 0, 0
+	star, mark := -1, 0
+	for v < len(value) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, v
+			p++
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == value[v]):
+			p++
+			v++
+		case star >= 0:
+			p = star + 1
+			mark++
+			v = mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// arnAccount returns the account ID field of an ARN, or "" if id is not an
+// ARN with one
+func arnAccount(id string) string {
+	parts := strings.SplitN(id, ":", 6)
+	if len(parts) < 6 || parts[0] != "arn" {
+		return ""
+	}
+	return parts[4]
+}
+
+// isRoleARN reports whether id is an IAM role ARN, whose sessions make any
+// further assumption role chaining
+func isRoleARN(id string) bool {
+	parts := strings.SplitN(id, ":", 6)
+	return len(parts) == 6 && parts[0] == "arn" && parts[2] == "iam" && strings.HasPrefix(parts[5], "role/")
+}
@@ -0,0 +1,180 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+// newRoleChainGraph builds an account whose Admin role trusts the account
+// root, an Ops role that trusts alice directly, and three callers: alice may
+// assume any role, Ops may call sts:*, and bob has no sts permission
+func newRoleChainGraph(t *testing.T) *Graph {
+	t.Helper()
+
+	const (
+		root  = "arn:aws:iam::111111111111:root"
+		alice = "arn:aws:iam::111111111111:user/alice"
+		bob   = "arn:aws:iam::111111111111:user/bob"
+		ops   = "arn:aws:iam::111111111111:role/Ops"
+		admin = "arn:aws:iam::111111111111:role/Admin"
+		ext   = "arn:aws:iam::222222222222:role/Ext"
+	)
+
+	g := New()
+	for _, n := range []ingest.Node{
+		{ID: root, Kind: ingest.KindAccount},
+		{ID: alice, Kind: ingest.KindPrincipal},
+		{ID: bob, Kind: ingest.KindPrincipal},
+		{ID: ops, Kind: ingest.KindPrincipal, Props: map[string]string{"max_session_duration": "43200"}},
+		{ID: admin, Kind: ingest.KindPrincipal},
+		{ID: ext, Kind: ingest.KindPrincipal},
+		{ID: "policy/AssumeAny", Kind: ingest.KindPolicy},
+		{ID: "policy/StsAll", Kind: ingest.KindPolicy},
+		{ID: "policy/Read", Kind: ingest.KindPolicy},
+		{ID: "assume#sts:AssumeRole", Kind: ingest.KindPerm, Props: map[string]string{"action": "sts:AssumeRole"}},
+		{ID: "sts#sts:*", Kind: ingest.KindPerm, Props: map[string]string{"action": "sts:*"}},
+		{ID: "read#s3:GetObject", Kind: ingest.KindPerm, Props: map[string]string{"action": "s3:GetObject"}},
+		{ID: "arn:aws:iam::111111111111:role/*", Kind: ingest.KindResource},
+		{ID: "*", Kind: ingest.KindResource},
+	} {
+		g.AddNode(n)
+	}
+
+	for _, e := range []ingest.Edge{
+		{Src: alice, Dst: ops, Kind: ingest.EdgeAssumesRole, Props: map[string]string{"trust": "principal"}},
+		{Src: root, Dst: admin, Kind: ingest.EdgeAssumesRole, Props: map[string]string{"trust": "account", "mfa": "true"}},
+		{Src: alice, Dst: "policy/AssumeAny", Kind: ingest.EdgeAttachedPolicy},
+		{Src: "policy/AssumeAny", Dst: "assume#sts:AssumeRole", Kind: ingest.EdgeAllowsAction},
+		{Src: "assume#sts:AssumeRole", Dst: "arn:aws:iam::111111111111:role/*", Kind: ingest.EdgeAppliesTo},
+		{Src: ops, Dst: "policy/StsAll", Kind: ingest.EdgeAttachedPolicy},
+		{Src: ext, Dst: "policy/StsAll", Kind: ingest.EdgeAttachedPolicy},
+		{Src: "policy/StsAll", Dst: "sts#sts:*", Kind: ingest.EdgeAllowsAction},
+		{Src: "sts#sts:*", Dst: "*", Kind: ingest.EdgeAppliesTo},
+		{Src: bob, Dst: "policy/Read", Kind: ingest.EdgeAttachedPolicy},
+		{Src: "policy/Read", Dst: "read#s3:GetObject", Kind: ingest.EdgeAllowsAction},
+		{Src: "read#s3:GetObject", Dst: "*", Kind: ingest.EdgeAppliesTo},
+	} {
+		if err := g.AddEdge(e); err != nil {
+			t.Fatalf("Failed to add edge: %v", err)
+		}
+	}
+	return g
+}
+
+func TestExpandAccountTrust(t *testing.T) {
+	g := newRoleChainGraph(t)
+
+	if added := g.ExpandAccountTrust(); added != 2 {
+		t.Errorf("Expected 2 derived edges, got %d", added)
+	}
+
+	for _, src := range []string{"arn:aws:iam::111111111111:user/alice", "arn:aws:iam::111111111111:role/Ops"} {
+		edge, ok := g.lookupEdge(src, "arn:aws:iam::111111111111:role/Admin", EdgeFilter{})
+		if !ok {
+			t.Errorf("Expected %s to assume Admin through the account root", src)
+			continue
+		}
+		if edge.Props["derived"] != "true" || edge.Props["via"] != "arn:aws:iam::111111111111:root" || edge.Props["mfa"] != "true" {
+			t.Errorf("Unexpected derived edge props %v", edge.Props)
+		}
+	}
+
+	// bob lacks sts:AssumeRole and Ext is in another account
+	for _, src := range []string{"arn:aws:iam::111111111111:user/bob", "arn:aws:iam::222222222222:role/Ext"} {
+		if _, ok := g.lookupEdge(src, "arn:aws:iam::111111111111:role/Admin", EdgeFilter{}); ok {
+			t.Errorf("Expected no derived edge from %s", src)
+		}
+	}
+
+	if added := g.ExpandAccountTrust(); added != 0 {
+		t.Errorf("Expected expansion to be idempotent, added %d", added)
+	}
+}
+
+func TestRoleChains(t *testing.T) {
+	g := newRoleChainGraph(t)
+	g.ExpandAccountTrust()
+
+	chains, err := g.RoleChains("arn:aws:iam::111111111111:user/alice", 0, 0)
+	if err != nil {
+		t.Fatalf("RoleChains failed: %v", err)
+	}
+
+	type step struct {
+		role    string
+		chained bool
+		session int
+	}
+	want := [][]step{
+		{{"arn:aws:iam::111111111111:role/Ops", false, 43200}},
+		{{"arn:aws:iam::111111111111:role/Ops", false, 43200}, {"arn:aws:iam::111111111111:role/Admin", true, ChainedSessionSeconds}},
+		{{"arn:aws:iam::111111111111:role/Admin", false, 3600}},
+	}
+
+	if len(chains) != len(want) {
+		t.Fatalf("Expected %d chains, got %d: %+v", len(want), len(chains), chains)
+	}
+	for i, w := range want {
+		got := chains[i]
+		if got.Depth != len(w) || len(got.Steps) != len(w) {
+			t.Errorf("Chain %d: expected depth %d, got %d", i, len(w), got.Depth)
+			continue
+		}
+		for j, s := range w {
+			gs := got.Steps[j]
+			if gs.Role != s.role || gs.Chained != s.chained || gs.MaxSessionSeconds != s.session {
+				t.Errorf("Chain %d step %d: expected %+v, got %+v", i, j, s, gs)
+			}
+		}
+	}
+
+	// A chain starting from a role is chained from its first assumption
+	chains, err = g.RoleChains("arn:aws:iam::111111111111:role/Ops", 0, 0)
+	if err != nil {
+		t.Fatalf("RoleChains failed: %v", err)
+	}
+	if len(chains) != 1 || !chains[0].Steps[0].Chained {
+		t.Errorf("Expected one chained assumption from Ops, got %+v", chains)
+	}
+
+	chains, err = g.RoleChains("", 1, 0)
+	if err != nil {
+		t.Fatalf("RoleChains failed: %v", err)
+	}
+	for _, c := range chains {
+		if c.Depth != 1 {
+			t.Errorf("Expected depth 1 only, got %d", c.Depth)
+		}
+	}
+	if len(chains) != 3 {
+		t.Errorf("Expected 3 single assumptions, got %d", len(chains))
+	}
+
+	if _, err := g.RoleChains("missing", 0, 0); err == nil {
+		t.Error("Expected error for unknown principal")
+	}
+}
+
+func TestIAMMatch(t *testing.T) {
+	tests := []struct {
+		pattern, value string
+		fold, want     bool
+	}{
+		{"*", "arn:aws:iam::1:role/a", false, true},
+		{"arn:aws:iam::1:role/*", "arn:aws:iam::1:role/path/a", false, true},
+		{"arn:aws:iam::1:role/a?", "arn:aws:iam::1:role/ab", false, true},
+		{"arn:aws:iam::1:role/a", "arn:aws:iam::1:role/ab", false, false},
+		{"arn:aws:iam::2:role/*", "arn:aws:iam::1:role/a", false, false},
+		{"sts:Assume*", "sts:AssumeRole", true, true},
+		{"STS:ASSUMEROLE", "sts:AssumeRole", true, true},
+		{"STS:ASSUMEROLE", "sts:AssumeRole", false, false},
+		{"s3:*", "sts:AssumeRole", true, false},
+	}
+
+	for _, tt := range tests {
+		if got := iamMatch(tt.pattern, tt.value, tt.fold); got != tt.want {
+			t.Errorf("iamMatch(%q, %q, %t) = %t, want %t", tt.pattern, tt.value, tt.fold, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+// DefaultSubgraphLimit is how many nodes a subgraph holds by default
+const DefaultSubgraphLimit = 500
+
+// Subgraph is a self-contained neighbourhood of a graph: every edge joins two
+// of its nodes
+type Subgraph struct {
+	Roots []string `json:"roots"`
+	Depth int      `json:"depth"`
+	// Nodes are in breadth-first order from the roots
+	Nodes []SubgraphNode `json:"nodes"`
+	// Edges are the allowed edges between Nodes, in insertion order
+	Edges []ingest.Edge `json:"edges"`
+	// Truncated is set when the node limit cut the search short, so that
+	// some nodes within Depth are missing
+	Truncated bool `json:"truncated"`
+}
+
+// SubgraphNode is a node of a subgraph and its distance from the roots
+type SubgraphNode struct {
+	Node ingest.Node `json:"node"`
+	// Depth counts the hops from the nearest root
+	Depth int `json:"depth"`
+	// Truncated is set when the node has neighbours the subgraph's filters
+	// admit but the subgraph leaves out, either beyond Depth or past the
+	// node limit; expanding from it would find more
+	Truncated bool `json:"truncated"`
+}
+
+// Subgraph collects the nodes within depth hops of any root, walking edges
+// allowed by filter in either direction and keeping only nodes of the given
+// kinds (all kinds if empty); the roots are always kept. Nodes are added in
+// breadth-first order until there are limit of them (DefaultSubgraphLimit if
+// limit <= 0). depth <= 0 means DefaultBFSDepth.
+func (g *Graph) Subgraph(rootIDs []string, depth int, kinds []ingest.Kind, filter EdgeFilter, limit int) (*Subgraph, error) {
+	if depth <= 0 {
+		depth = DefaultBFSDepth
+	}
+	if limit <= 0 {
+		limit = DefaultSubgraphLimit
+	}
+
+	kindsMap := make(map[ingest.Kind]bool)
+	for _, k := range kinds {
+		kindsMap[k] = true
+	}
+
+	sub := &Subgraph{
+		Roots: rootIDs,
+		Depth: depth,
+		Nodes: []SubgraphNode{},
+		Edges: []ingest.Edge{},
+	}
+
+	// index maps node numbers to their position in sub.Nodes
+	index := make(map[int32]int)
+	add := func(n int32, d int) bool {
+		if len(sub.Nodes) == limit {
+			sub.Truncated = true
+			return false
+		}
+		index[n] = len(sub.Nodes)
+		sub.Nodes = append(sub.Nodes, SubgraphNode{Node: g.node(n), Depth: d})
+		return true
+	}
+
+	var queue []int32
+	for _, id := range rootIDs {
+		n, ok := g.nodeIndex[id]
+		if !ok {
+			return nil, fmt.Errorf("node not found: %s", id)
+		}
+		if _, seen := index[n]; !seen && add(n, 0) {
+			queue = append(queue, n)
+		}
+	}
+
+	// admits reports whether the walk may step from n over the edge at
+	// position idx, returning the node it reaches
+	admits := func(n int32, idx int) (int32, bool) {
+		if !filter.Allows(g.edgeKind(idx)) {
+			return 0, false
+		}
+		other := g.other(idx, n)
+		if len(kinds) > 0 && !kindsMap[g.nodeKind(other)] {
+			return 0, false
+		}
+		return other, true
+	}
+
+	for len(queue) > 0 && !sub.Truncated {
+		n := queue[0]
+		queue = queue[1:]
+
+		d := sub.Nodes[index[n]].Depth
+		if d == depth {
+			continue
+		}
+		for _, idx := range g.queryLines(n, dirBoth) {
+			other, ok := admits(n, idx)
+			if !ok {
+				continue
+			}
+			if _, seen := index[other]; seen {
+				continue
+			}
+			if !add(other, d+1) {
+				break
+			}
+			queue = append(queue, other)
+		}
+	}
+
+	// Mark the nodes with admissible neighbours left out, and keep every
+	// allowed edge between kept nodes
+	var lines []int
+	for i := range sub.Nodes {
+		n := g.nodeIndex[sub.Nodes[i].Node.ID]
+		for _, idx := range g.queryLines(n, dirBoth) {
+			if other, ok := admits(n, idx); ok {
+				if _, kept := index[other]; !kept {
+					sub.Nodes[i].Truncated = true
+				}
+			}
+		}
+		for _, idx := range g.linesFrom(n) {
+			if _, kept := index[g.edgeDst[idx]]; kept && filter.Allows(g.edgeKind(int(idx))) {
+				lines = append(lines, int(idx))
+			}
+		}
+	}
+
+	sort.Ints(lines)
+	for _, idx := range lines {
+		sub.Edges = append(sub.Edges, g.edge(idx))
+	}
+
+	return sub, nil
+}
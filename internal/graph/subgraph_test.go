@@ -0,0 +1,121 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+// subgraphNodes renders the nodes of sub as id@depth, with a trailing + for
+// truncated nodes
+func subgraphNodes(sub *Subgraph) string {
+	var out []string
+	for _, n := range sub.Nodes {
+		s := fmt.Sprintf("%s@%d", strings.TrimPrefix(n.Node.ID, "arn:aws:iam::111111111111:"), n.Depth)
+		if n.Truncated {
+			s += "+"
+		}
+		out = append(out, s)
+	}
+	return strings.Join(out, ",")
+}
+
+// subgraphEdges renders the edges of sub as src>dst
+func subgraphEdges(sub *Subgraph) string {
+	var out []string
+	for _, e := range sub.Edges {
+		out = append(out, strings.TrimPrefix(e.Src, "arn:aws:iam::111111111111:")+">"+strings.TrimPrefix(e.Dst, "arn:aws:iam::111111111111:"))
+	}
+	return strings.Join(out, ",")
+}
+
+func TestSubgraph(t *testing.T) {
+	g := newAnalysisGraph(t)
+	const alice = "arn:aws:iam::111111111111:user/alice"
+
+	tests := []struct {
+		name      string
+		roots     []string
+		depth     int
+		kinds     []ingest.Kind
+		filter    EdgeFilter
+		limit     int
+		nodes     string
+		edges     string
+		truncated bool
+	}{
+		{
+			name:  "one hop",
+			roots: []string{alice},
+			depth: 1,
+			nodes: "user/alice@0,policy/Shared@1+,role/Admin@1+",
+			edges: "user/alice>policy/Shared,user/alice>role/Admin",
+		},
+		{
+			name:  "two hops in either direction",
+			roots: []string{alice},
+			depth: 2,
+			nodes: "user/alice@0,policy/Shared@1,role/Admin@1,user/bob@2,shared#s3:GetObject@2+,policy/Admin@2+",
+			edges: "user/alice>policy/Shared,user/bob>policy/Shared,policy/Shared>shared#s3:GetObject,user/alice>role/Admin,role/Admin>policy/Admin",
+		},
+		{
+			name:  "node kinds",
+			roots: []string{alice},
+			depth: 2,
+			kinds: []ingest.Kind{ingest.KindPrincipal},
+			nodes: "user/alice@0,role/Admin@1",
+			edges: "user/alice>role/Admin",
+		},
+		{
+			name:   "edge kinds",
+			roots:  []string{alice},
+			depth:  3,
+			filter: EdgeFilter{Allow: []string{ingest.EdgeAttachedPolicy}},
+			nodes:  "user/alice@0,policy/Shared@1,user/bob@2",
+			edges:  "user/alice>policy/Shared,user/bob>policy/Shared",
+		},
+		{
+			name:      "limit",
+			roots:     []string{alice},
+			depth:     2,
+			limit:     2,
+			nodes:     "user/alice@0+,policy/Shared@1+",
+			edges:     "user/alice>policy/Shared",
+			truncated: true,
+		},
+		{
+			name:  "several roots",
+			roots: []string{"arn:aws:iam::111111111111:user/bob", "k8s:role:empty", "arn:aws:iam::111111111111:user/bob"},
+			depth: 1,
+			nodes: "user/bob@0,k8s:role:empty@0,policy/Shared@1+,k8s:sa:default:idle@1",
+			edges: "user/bob>policy/Shared,k8s:role:empty>k8s:sa:default:idle",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, err := g.Subgraph(tt.roots, tt.depth, tt.kinds, tt.filter, tt.limit)
+			if err != nil {
+				t.Fatalf("Subgraph failed: %v", err)
+			}
+			if got := subgraphNodes(sub); got != tt.nodes {
+				t.Errorf("Expected nodes %s, got %s", tt.nodes, got)
+			}
+			if got := subgraphEdges(sub); got != tt.edges {
+				t.Errorf("Expected edges %s, got %s", tt.edges, got)
+			}
+			if sub.Truncated != tt.truncated {
+				t.Errorf("Expected truncated=%t, got %t", tt.truncated, sub.Truncated)
+			}
+		})
+	}
+}
+
+func TestSubgraphUnknownRoot(t *testing.T) {
+	g := newAnalysisGraph(t)
+	if _, err := g.Subgraph([]string{"missing"}, 1, nil, EdgeFilter{}, 0); err == nil {
+		t.Error("Expected error for unknown root")
+	}
+}
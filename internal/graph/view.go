@@ -0,0 +1,204 @@
+package graph
+
+import (
+	"iter"
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/iterator"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+// EdgeFilter selects the edge kinds a traversal may follow. An empty Allow
+// list allows every kind; Deny always wins over Allow. The zero value allows
+// everything.
+type EdgeFilter struct {
+	Allow []string
+	Deny  []string
+}
+
+// Allows reports whether an edge of kind may be followed
+func (f EdgeFilter) Allows(kind string) bool {
+	for _, k := range f.Deny {
+		if k == kind {
+			return false
+		}
+	}
+	if len(f.Allow) == 0 {
+		return true
+	}
+	for _, k := range f.Allow {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// view presents g to gonum algorithms as a simple directed graph containing
+// only the edges filter allows: u→v exists if at least one allowed parallel
+// edge joins them. A flow view instead orients every edge along PrivilegeFlow,
+// so u→v exists if privilege can flow from u to v, and weighs u→v by the
+// cheapest such edge under the graph's Weights; a plain view weighs every
+// hop 1. Node IDs are node numbers, and neighbors are returned in insertion
+// order so that ties between equal-cost paths are broken deterministically.
+type view struct {
+	g      *Graph
+	filter EdgeFilter
+	flow   bool
+}
+
+func (g *Graph) view(filter EdgeFilter) view {
+	return view{g: g, filter: filter}
+}
+
+func (g *Graph) flowView(filter EdgeFilter) view {
+	return view{g: g, filter: filter, flow: true}
+}
+
+// steps yields the positions of the edges that let a traversal of v step
+// from src to dst
+func (v view) steps(src, dst int32) iter.Seq[int] {
+	if v.flow {
+		return v.g.flowEdges(src, dst, v.filter)
+	}
+	return v.g.edgesBetween(src, dst, v.filter)
+}
+
+// lookup returns the position of the edge a traversal of v takes from src to
+// dst: the first in a plain view, the cheapest (first among equals) in a
+// flow view
+func (v view) lookup(src, dst int32) (int, bool) {
+	best, bestCost, found := 0, 0.0, false
+	for idx := range v.steps(src, dst) {
+		if !v.flow {
+			return idx, true
+		}
+		if cost := v.g.edgeCost(idx); !found || cost < bestCost {
+			best, bestCost, found = idx, cost, true
+		}
+	}
+	return best, found
+}
+
+func (v view) Node(id int64) graph.Node {
+	if id < 0 || id >= int64(len(v.g.nodeIDs)) {
+		return nil
+	}
+	return simple.Node(id)
+}
+
+func (v view) Nodes() graph.Nodes {
+	return &nodeRange{n: int64(len(v.g.nodeIDs)), cur: -1}
+}
+
+func (v view) From(id int64) graph.Nodes {
+	return v.adjacent(int32(id), true)
+}
+
+func (v view) To(id int64) graph.Nodes {
+	return v.adjacent(int32(id), false)
+}
+
+// adjacent returns the nodes n leads to (out) or that lead to n in the view,
+// in node order. Stored edges leaving n lead forward; in a flow view, stored
+// edges entering n also lead out of it if privilege flows against them.
+func (v view) adjacent(n int32, out bool) graph.Nodes {
+	var ids []int64
+	seen := make(map[int32]bool)
+	collect := func(lines []int32, flow Flow) {
+		for _, idx := range lines {
+			kind := v.g.edgeKind(int(idx))
+			if !v.filter.Allows(kind) || (v.flow && PrivilegeFlow(kind) != flow) {
+				continue
+			}
+			other := v.g.other(int(idx), n)
+			if !seen[other] {
+				seen[other] = true
+				ids = append(ids, int64(other))
+			}
+		}
+	}
+
+	forward, reverse := v.g.linesFrom(n), v.g.linesTo(n)
+	if !out {
+		forward, reverse = reverse, forward
+	}
+	collect(forward, FlowForward)
+	if v.flow {
+		collect(reverse, FlowReverse)
+	}
+
+	if len(ids) == 0 {
+		return graph.Empty
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	nodes := make([]graph.Node, len(ids))
+	for i, id := range ids {
+		nodes[i] = simple.Node(id)
+	}
+	return iterator.NewOrderedNodes(nodes)
+}
+
+func (v view) HasEdgeBetween(xid, yid int64) bool {
+	return v.HasEdgeFromTo(xid, yid) || v.HasEdgeFromTo(yid, xid)
+}
+
+func (v view) HasEdgeFromTo(uid, vid int64) bool {
+	_, ok := v.lookup(int32(uid), int32(vid))
+	return ok
+}
+
+// Weight implements path.Weighted so that Dijkstra prices each hop by the
+// edge lookup would take
+func (v view) Weight(xid, yid int64) (float64, bool) {
+	if xid == yid {
+		return 0, true
+	}
+	idx, ok := v.lookup(int32(xid), int32(yid))
+	if !ok {
+		return math.Inf(1), false
+	}
+	if !v.flow {
+		return 1, true
+	}
+	return v.g.edgeCost(idx), true
+}
+
+func (v view) Edge(uid, vid int64) graph.Edge {
+	if !v.HasEdgeFromTo(uid, vid) {
+		return nil
+	}
+	return simple.Edge{F: simple.Node(uid), T: simple.Node(vid)}
+}
+
+// nodeRange iterates over the node numbers 0..n-1
+type nodeRange struct {
+	n, cur int64
+}
+
+func (r *nodeRange) Next() bool {
+	if r.cur < r.n {
+		r.cur++
+	}
+	return r.cur < r.n
+}
+
+func (r *nodeRange) Len() int {
+	if r.cur >= r.n {
+		return 0
+	}
+	return int(r.n - r.cur - 1)
+}
+
+func (r *nodeRange) Reset() {
+	r.cur = -1
+}
+
+func (r *nodeRange) Node() graph.Node {
+	if r.cur < 0 || r.cur >= r.n {
+		return nil
+	}
+	return simple.Node(r.cur)
+}
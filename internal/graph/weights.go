@@ -0,0 +1,169 @@
+package graph
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+	"gopkg.in/yaml.v3"
+)
+
+// Weights prices each edge for attack path search. An edge costs the base
+// cost of its kind, multiplied by the factor of every condition it meets.
+// Lower costs are easier for an attacker to exploit.
+type Weights struct {
+	// Kinds is the base cost per edge kind
+	Kinds map[string]float64 `yaml:"kinds"`
+	// Default is the base cost of kinds missing from Kinds
+	Default float64 `yaml:"default"`
+	// MFA multiplies edges whose condition requires MFA
+	MFA float64 `yaml:"mfa"`
+	// Conditional multiplies edges with any other condition
+	Conditional float64 `yaml:"conditional"`
+	// Wildcard multiplies edges to or from a wildcard permission
+	Wildcard float64 `yaml:"wildcard"`
+}
+
+// DefaultWeights returns the weights used unless others are configured
+func DefaultWeights() Weights {
+	return Weights{
+		Kinds: map[string]float64{
+			ingest.EdgeAssumesRole:    0.2,
+			ingest.EdgeAttachedPolicy: 0.05,
+			ingest.EdgeAllowsAction:   0.1,
+			ingest.EdgeAppliesTo:      0.1,
+			ingest.EdgeBindsTo:        0.05,
+			ingest.EdgeCanEscalateTo:  0.5,
+		},
+		Default:     1,
+		MFA:         10,
+		Conditional: 3,
+		Wildcard:    0.5,
+	}
+}
+
+// LoadWeights reads weights from a YAML file. Settings missing from the file
+// keep their DefaultWeights value; kinds listed in it are added to, or
+// override, the default kinds.
+func LoadWeights(path string) (Weights, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Weights{}, err
+	}
+
+	// Decoding onto the defaults keeps every setting, and every kind, the
+	// file does not mention
+	w := DefaultWeights()
+	if err := yaml.Unmarshal(data, &w); err != nil {
+		return Weights{}, fmt.Errorf("parsing weights %s: %w", path, err)
+	}
+
+	if err := w.Validate(); err != nil {
+		return Weights{}, fmt.Errorf("weights %s: %w", path, err)
+	}
+	return w, nil
+}
+
+// Validate checks that every cost and factor is finite and non-negative, as
+// shortest path search requires
+func (w Weights) Validate() error {
+	check := func(name string, v float64) error {
+		if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("%s must be a non-negative number, got %v", name, v)
+		}
+		return nil
+	}
+
+	for kind, cost := range w.Kinds {
+		if err := check("cost of "+kind, cost); err != nil {
+			return err
+		}
+	}
+	for name, v := range map[string]float64{
+		"default": w.Default, "mfa": w.MFA, "conditional": w.Conditional, "wildcard": w.Wildcard,
+	} {
+		if err := check(name, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetWeights replaces the weights used to price attack paths
+func (g *Graph) SetWeights(w Weights) error {
+	if g.Frozen() {
+		return ErrFrozen
+	}
+	if err := w.Validate(); err != nil {
+		return err
+	}
+	g.weights = w.clone()
+	return nil
+}
+
+// clone copies w so that later changes to its Kinds map are not shared
+func (w Weights) clone() Weights {
+	kinds := make(map[string]float64, len(w.Kinds))
+	for k, v := range w.Kinds {
+		kinds[k] = v
+	}
+	w.Kinds = kinds
+	return w
+}
+
+// EdgeCost returns the cost of following edge under the graph's weights
+func (g *Graph) EdgeCost(edge ingest.Edge) float64 {
+	ends := make([]int32, 0, 2)
+	for _, id := range []string{edge.Src, edge.Dst} {
+		if n, ok := g.nodeIndex[id]; ok {
+			ends = append(ends, n)
+		}
+	}
+	return g.cost(edge.Kind, edge.Props["mfa"], edge.Props["condition_keys"], ends)
+}
+
+// edgeCost returns the cost of following the edge at position idx
+func (g *Graph) edgeCost(idx int) float64 {
+	mfa, _ := g.edgePropOf(idx, "mfa")
+	conditions, _ := g.edgePropOf(idx, "condition_keys")
+	return g.cost(g.edgeKind(idx), mfa, conditions, []int32{g.edgeSrc[idx], g.edgeDst[idx]})
+}
+
+// cost prices an edge of kind with the given mfa and condition_keys props
+// between the nodes ends
+func (g *Graph) cost(kind, mfa, conditions string, ends []int32) float64 {
+	w := g.weights
+
+	cost, ok := w.Kinds[kind]
+	if !ok {
+		cost = w.Default
+	}
+
+	if mfa == "true" {
+		cost *= w.MFA
+	} else if conditions != "" {
+		cost *= w.Conditional
+	}
+
+	for _, n := range ends {
+		if g.nodeKind(n) == ingest.KindPerm {
+			if wildcard, _ := g.propOf(n, "wildcard"); wildcard == "true" {
+				cost *= w.Wildcard
+				break
+			}
+		}
+	}
+
+	return cost
+}
+
+// PathCost returns the total cost of a path's edges and the likelihood of
+// an attacker completing it, exp(-cost): a free path is certain, and every
+// added unit of cost makes it less likely
+func (g *Graph) PathCost(edges []ingest.Edge) (cost, likelihood float64) {
+	for _, edge := range edges {
+		cost += g.EdgeCost(edge)
+	}
+	return cost, math.Exp(-cost)
+}
@@ -0,0 +1,112 @@
+package graph
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+func TestFindAttackPathPrefersCheapestRoute(t *testing.T) {
+	g := New()
+
+	for _, id := range []string{"user", "admin", "jump", "bucket"} {
+		g.AddNode(ingest.Node{ID: id, Kind: ingest.KindPrincipal})
+	}
+
+	// One MFA-gated hop versus two unconditional hops
+	for _, e := range []ingest.Edge{
+		{Src: "user", Dst: "admin", Kind: ingest.EdgeAssumesRole, Props: map[string]string{"mfa": "true", "condition_keys": "aws:MultiFactorAuthPresent"}},
+		{Src: "admin", Dst: "bucket", Kind: ingest.EdgeAppliesTo},
+		{Src: "user", Dst: "jump", Kind: ingest.EdgeAssumesRole},
+		{Src: "jump", Dst: "admin", Kind: ingest.EdgeAssumesRole},
+	} {
+		if err := g.AddEdge(e); err != nil {
+			t.Fatalf("Failed to add edge: %v", err)
+		}
+	}
+
+	result, err := g.FindAttackPath("user", "bucket", nil, 8, EdgeFilter{})
+	if err != nil {
+		t.Fatalf("FindAttackPath failed: %v", err)
+	}
+	if !result.Found || len(result.Nodes) != 4 || result.Nodes[1].ID != "jump" {
+		t.Fatalf("Expected path through jump, got %v", result.Nodes)
+	}
+
+	// 0.2 + 0.2 + 0.1
+	if math.Abs(result.Cost-0.5) > 1e-9 {
+		t.Errorf("Expected cost 0.5, got %v", result.Cost)
+	}
+	if math.Abs(result.Likelihood-math.Exp(-0.5)) > 1e-9 {
+		t.Errorf("Expected likelihood exp(-0.5), got %v", result.Likelihood)
+	}
+
+	// ShortestPath still counts hops
+	nodes, _, err := g.ShortestPath("user", "bucket", 8, EdgeFilter{})
+	if err != nil || len(nodes) != 3 {
+		t.Errorf("Expected 3-node shortest path, got %v (%v)", nodes, err)
+	}
+}
+
+func TestEdgeCost(t *testing.T) {
+	g := New()
+	g.AddNode(ingest.Node{ID: "policy", Kind: ingest.KindPolicy})
+	g.AddNode(ingest.Node{ID: "perm", Kind: ingest.KindPerm, Props: map[string]string{"wildcard": "true"}})
+
+	tests := []struct {
+		name string
+		edge ingest.Edge
+		want float64
+	}{
+		{"base kind", ingest.Edge{Kind: ingest.EdgeAssumesRole}, 0.2},
+		{"unknown kind", ingest.Edge{Kind: "CUSTOM"}, 1},
+		{"mfa", ingest.Edge{Kind: ingest.EdgeAssumesRole, Props: map[string]string{"mfa": "true", "condition_keys": "aws:MultiFactorAuthAge"}}, 2},
+		{"conditional", ingest.Edge{Kind: ingest.EdgeAssumesRole, Props: map[string]string{"condition_keys": "sts:ExternalId"}}, 0.6},
+		{"wildcard", ingest.Edge{Src: "policy", Dst: "perm", Kind: ingest.EdgeAllowsAction}, 0.05},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := g.EdgeCost(tt.edge); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("EdgeCost = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadWeights(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "weights.yaml")
+	content := "kinds:\n  ASSUMES_ROLE: 0.5\n  CUSTOM: 0.3\nmfa: 20\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write weights: %v", err)
+	}
+
+	w, err := LoadWeights(path)
+	if err != nil {
+		t.Fatalf("LoadWeights failed: %v", err)
+	}
+
+	defaults := DefaultWeights()
+	if w.Kinds[ingest.EdgeAssumesRole] != 0.5 || w.Kinds["CUSTOM"] != 0.3 {
+		t.Errorf("Expected file kinds to apply, got %v", w.Kinds)
+	}
+	if w.Kinds[ingest.EdgeAppliesTo] != defaults.Kinds[ingest.EdgeAppliesTo] {
+		t.Errorf("Expected unlisted kinds to keep defaults, got %v", w.Kinds)
+	}
+	if w.MFA != 20 || w.Conditional != defaults.Conditional {
+		t.Errorf("Expected mfa 20 and default conditional, got %+v", w)
+	}
+}
+
+func TestLoadWeightsRejectsNegative(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "weights.yaml")
+	if err := os.WriteFile(path, []byte("wildcard: -1\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write weights: %v", err)
+	}
+
+	if _, err := LoadWeights(path); err == nil {
+		t.Error("Expected error for negative factor")
+	}
+}
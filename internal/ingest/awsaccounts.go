@@ -0,0 +1,168 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sync"
+)
+
+// accountDirPattern finds the account ID in an account folder name such as
+// "123456789012" or "prod-123456789012"
+var accountDirPattern = regexp.MustCompile(`\d{12}`)
+
+// AWSAccountDir is one account folder in a multi-account export
+type AWSAccountDir struct {
+	AccountID string
+	Path      string
+}
+
+// ListAWSAccounts returns the account folders directly under rootDir, sorted
+// by folder name. Every subdirectory must contain a 12-digit account ID in
+// its name, and each account may appear only once.
+func ListAWSAccounts(rootDir string) ([]AWSAccountDir, error) {
+	entries, err := os.ReadDir(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []AWSAccountDir
+	seen := make(map[string]string)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		accountID := accountDirPattern.FindString(entry.Name())
+		if accountID == "" {
+			return nil, fmt.Errorf("account folder %q has no 12-digit account ID in its name", entry.Name())
+		}
+		if prev, ok := seen[accountID]; ok {
+			return nil, fmt.Errorf("account %s exported twice: %q and %q", accountID, prev, entry.Name())
+		}
+		seen[accountID] = entry.Name()
+
+		accounts = append(accounts, AWSAccountDir{
+			AccountID: accountID,
+			Path:      filepath.Join(rootDir, entry.Name()),
+		})
+	}
+
+	return accounts, nil
+}
+
+// ParseAWSAccounts parses a directory of AWS account folders
+func ParseAWSAccounts(rootDir string, workers int) (ParseResult, error) {
+	result := ParseResult{
+		Nodes: []Node{},
+		Edges: []Edge{},
+	}
+	err := StreamAWSAccounts(rootDir, workers, &result)
+	return result, err
+}
+
+// StreamAWSAccounts parses every account folder under rootDir with a pool of
+// workers goroutines (runtime.NumCPU() if workers <= 0), sending everything
+// to sink. Calls to sink are serialised, so it need not be safe for
+// concurrent use, and arrive in account folder order whatever the number of
+// workers, so that first-seen merge rules give the same snapshot every time.
+//
+// Each account gets an ACCOUNT node, and every node parsed from its folder is
+// stamped with account_id: the account in the node's ARN if it has one,
+// otherwise the account it was ingested from. Principals and policies whose
+// ARN names the account are linked to its ACCOUNT node with IN_ACCOUNT edges.
+func StreamAWSAccounts(rootDir string, workers int, sink Sink) error {
+	accounts, err := ListAWSAccounts(rootDir)
+	if err != nil {
+		return err
+	}
+
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(accounts) {
+		workers = len(accounts)
+	}
+
+	// Each account streams into its own channel, and the channels are drained
+	// in order, so a worker runs at most DefaultBuffer items ahead of the
+	// account being forwarded
+	outputs := make([]chan Item, len(accounts))
+	for i := range outputs {
+		outputs[i] = make(chan Item, DefaultBuffer)
+	}
+	errs := make([]error, len(accounts))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				account := accounts[i]
+				if err := streamAWSAccount(account, channelSink(outputs[i])); err != nil {
+					errs[i] = fmt.Errorf("account %s: %w", account.AccountID, err)
+				}
+				close(outputs[i])
+			}
+		}()
+	}
+
+	go func() {
+		for i := range accounts {
+			jobs <- i
+		}
+		close(jobs)
+	}()
+
+	for _, output := range outputs {
+		for item := range output {
+			item.sendTo(sink)
+		}
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func streamAWSAccount(account AWSAccountDir, sink Sink) error {
+	// The account comes from the folder name, not from any file in it
+	sink.AddNode(accountNode(account.AccountID, Provenance{Source: SourceAWS}))
+	return StreamAWS(account.Path, accountSink{Sink: sink, accountID: account.AccountID})
+}
+
+// accountSink stamps nodes with the account they were ingested from
+type accountSink struct {
+	Sink
+	accountID string
+}
+
+func (s accountSink) AddNode(node Node) {
+	owner, owned := s.accountID, false
+	if m := accountIDPattern.FindStringSubmatch(node.ID); len(m) > 1 {
+		owner, owned = m[1], m[1] == s.accountID
+	}
+
+	if _, ok := node.Props["account_id"]; !ok {
+		node.Props = cloneProps(node.Props)
+		if node.Props == nil {
+			node.Props = make(map[string]string, 1)
+		}
+		node.Props["account_id"] = owner
+	}
+	s.Sink.AddNode(node)
+
+	if owned && (node.Kind == KindPrincipal || node.Kind == KindPolicy) {
+		s.Sink.AddEdge(Edge{
+			Src:        node.ID,
+			Dst:        accountARN(s.accountID),
+			Kind:       EdgeInAccount,
+			Props:      map[string]string{},
+			Provenance: node.Provenance,
+		})
+	}
+}
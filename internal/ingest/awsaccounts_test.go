@@ -0,0 +1,170 @@
+package ingest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// writeAWSAccount writes a minimal export for one account: a role trusting
+// trustedArn (if set) and a policy granting s3:GetObject on "*".
+func writeAWSAccount(t *testing.T, dir, accountID, trustedArn string) {
+	t.Helper()
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("Failed to create %s: %v", dir, err)
+	}
+
+	statements := "[]"
+	if trustedArn != "" {
+		statements = fmt.Sprintf(`[{"Effect": "Allow", "Principal": {"AWS": %q}, "Action": "sts:AssumeRole"}]`, trustedArn)
+	}
+
+	files := map[string]string{
+		"roles.json": fmt.Sprintf(`[{
+  "RoleName": "App",
+  "Arn": "arn:aws:iam::%[1]s:role/App",
+  "AssumeRolePolicyDocument": {"Statement": %[2]s}
+}]`, accountID, statements),
+		"policies.json": fmt.Sprintf(`[{
+  "PolicyName": "Read",
+  "Arn": "arn:aws:iam::%[1]s:policy/Read",
+  "PolicyVersion": {"Document": {"Statement": [{"Effect": "Allow", "Action": "s3:GetObject", "Resource": "*"}]}}
+}]`, accountID),
+		"attachments.json": `[{"RoleName": "App", "AttachedPolicies": [{"PolicyName": "Read", "PolicyArn": "arn:aws:iam::` + accountID + `:policy/Read"}]}]`,
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestParseAWSAccounts(t *testing.T) {
+	root := t.TempDir()
+	writeAWSAccount(t, filepath.Join(root, "111111111111"), "111111111111", "")
+	writeAWSAccount(t, filepath.Join(root, "prod-222222222222"), "222222222222", "arn:aws:iam::111111111111:role/App")
+	writeAWSAccount(t, filepath.Join(root, "333333333333"), "333333333333", "")
+
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			result, err := ParseAWSAccounts(root, workers)
+			if err != nil {
+				t.Fatalf("ParseAWSAccounts failed: %v", err)
+			}
+
+			nodes := make(map[string]Node)
+			for _, n := range result.Nodes {
+				nodes[n.ID] = n
+				if n.Props["account_id"] == "" {
+					t.Errorf("Expected account_id on %s", n.ID)
+				}
+			}
+
+			for _, id := range []string{"111111111111", "222222222222", "333333333333"} {
+				account, ok := nodes[accountARN(id)]
+				if !ok || account.Kind != KindAccount {
+					t.Errorf("Expected ACCOUNT node for %s", id)
+				}
+				for _, prov := range account.Provenance {
+					if info, err := os.Stat(prov.File); err == nil && info.IsDir() {
+						t.Errorf("Expected account %s provenance to name a file, got directory %s", id, prov.File)
+					}
+				}
+			}
+
+			if got := nodes["arn:aws:iam::222222222222:role/App"].Props["account_id"]; got != "222222222222" {
+				t.Errorf("Expected role account_id 222222222222, got %q", got)
+			}
+			if got := nodes["*"].Props["account_id"]; got != "111111111111,222222222222,333333333333" {
+				t.Errorf("Expected shared resource to list every account, got %q", got)
+			}
+			if len(result.Conflicts) != 0 {
+				t.Errorf("Expected no conflicts, got %v", result.Conflicts)
+			}
+
+			inAccount := 0
+			for _, e := range result.Edges {
+				if e.Kind == EdgeInAccount {
+					inAccount++
+				}
+			}
+			// One role and one policy per account
+			if inAccount != 6 {
+				t.Errorf("Expected 6 IN_ACCOUNT edges, got %d", inAccount)
+			}
+
+			report := result.Validate()
+			if !report.Empty() {
+				t.Errorf("Expected no validation issues, got %v", report.Issues)
+			}
+		})
+	}
+}
+
+func TestParseAWSAccountsDeterministic(t *testing.T) {
+	root := t.TempDir()
+	for i := 1; i <= 8; i++ {
+		accountID := strings.Repeat(strconv.Itoa(i), 12)
+		writeAWSAccount(t, filepath.Join(root, accountID), accountID, "arn:aws:iam::111111111111:role/App")
+	}
+
+	// The first account is slow to parse, so with several workers the others
+	// finish first
+	var policies []string
+	for i := 0; i < 500; i++ {
+		policies = append(policies, fmt.Sprintf(`{
+  "PolicyName": "P%[1]d",
+  "Arn": "arn:aws:iam::111111111111:policy/P%[1]d",
+  "PolicyVersion": {"Document": {"Statement": [{"Effect": "Allow", "Action": "s3:GetObject", "Resource": "*"}]}}
+}`, i))
+	}
+	if err := os.WriteFile(filepath.Join(root, "111111111111", "policies.json"), []byte("["+strings.Join(policies, ",")+"]"), 0o644); err != nil {
+		t.Fatalf("Failed to write policies: %v", err)
+	}
+
+	// Every account shares the "*" resource and the trusted role, whose
+	// provenance lists the accounts in the order they were merged
+	want, err := ParseAWSAccounts(root, 1)
+	if err != nil {
+		t.Fatalf("ParseAWSAccounts failed: %v", err)
+	}
+	for run := 0; run < 3; run++ {
+		got, err := ParseAWSAccounts(root, 8)
+		if err != nil {
+			t.Fatalf("ParseAWSAccounts failed: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("Expected the same result with 8 workers as with 1, run %d differs", run)
+		}
+	}
+}
+
+func TestListAWSAccountsRejectsUnnamedFolder(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "staging"), 0o755); err != nil {
+		t.Fatalf("Failed to create folder: %v", err)
+	}
+
+	if _, err := ListAWSAccounts(root); err == nil {
+		t.Error("Expected error for folder without an account ID")
+	}
+}
+
+func TestListAWSAccountsRejectsDuplicate(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"111111111111", "old-111111111111"} {
+		if err := os.Mkdir(filepath.Join(root, name), 0o755); err != nil {
+			t.Fatalf("Failed to create folder: %v", err)
+		}
+	}
+
+	if _, err := ListAWSAccounts(root); err == nil {
+		t.Error("Expected error for an account exported twice")
+	}
+}
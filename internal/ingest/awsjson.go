@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -14,6 +15,7 @@ type AWSRole struct {
 	RoleName                 string          `json:"RoleName"`
 	Arn                      string          `json:"Arn"`
 	AssumeRolePolicyDocument json.RawMessage `json:"AssumeRolePolicyDocument"`
+	MaxSessionDuration       int             `json:"MaxSessionDuration,omitempty"`
 }
 
 // AWSPolicy represents an AWS IAM policy
@@ -37,6 +39,7 @@ type Statement struct {
 	Action    json.RawMessage `json:"Action"`
 	Resource  json.RawMessage `json:"Resource"`
 	Principal json.RawMessage `json:"Principal,omitempty"`
+	Condition json.RawMessage `json:"Condition,omitempty"`
 }
 
 // AWSAttachment represents role-to-policy attachments
@@ -48,7 +51,27 @@ type AWSAttachment struct {
 	} `json:"AttachedPolicies"`
 }
 
-var accountIDPattern = regexp.MustCompile(`:(\d{12}):`)
+var (
+	accountIDPattern = regexp.MustCompile(`:(\d{12}):`)
+	// bareAccountPattern matches a trust principal given as just an account
+	// ID, which IAM treats as that account's root
+	bareAccountPattern = regexp.MustCompile(`^\d{12}$`)
+)
+
+// Fields emitted by the AWS IAM CLI that the parser reads or deliberately
+// ignores. Anything else is reported as an unknown field.
+var (
+	awsRoleFields = fieldSet("Path", "RoleName", "RoleId", "Arn", "CreateDate",
+		"AssumeRolePolicyDocument", "Description", "MaxSessionDuration",
+		"PermissionsBoundary", "Tags", "RoleLastUsed")
+	awsPolicyFields = fieldSet("PolicyName", "PolicyId", "Arn", "Path",
+		"DefaultVersionId", "AttachmentCount", "PermissionsBoundaryUsageCount",
+		"IsAttachable", "Description", "CreateDate", "UpdateDate", "Tags",
+		"PolicyVersion")
+	awsAttachmentFields = fieldSet("RoleName", "AttachedPolicies")
+	awsStatementFields  = fieldSet("Sid", "Effect", "Action", "NotAction",
+		"Resource", "NotResource", "Principal", "NotPrincipal", "Condition")
+)
 
 // ParseAWS parses AWS IAM JSON files from a directory
 func ParseAWS(dirPath string) (ParseResult, error) {
@@ -56,95 +79,123 @@ func ParseAWS(dirPath string) (ParseResult, error) {
 		Nodes: []Node{},
 		Edges: []Edge{},
 	}
+	err := StreamAWS(dirPath, &result)
+	return result, err
+}
 
-	// Parse roles
+// StreamAWS parses AWS IAM JSON files from a directory, sending nodes, edges
+// and issues to sink as each array element is decoded
+func StreamAWS(dirPath string, sink Sink) error {
+	// Parse roles. The role name to ARN lookup it returns lets attachments be
+	// resolved without hardcoding an AWS account ID.
 	rolesPath := filepath.Join(dirPath, "roles.json")
-	roles, err := parseRoles(rolesPath)
+	roleNameToARN, err := parseRoles(rolesPath, sink)
 	if err != nil {
-		return result, fmt.Errorf("parsing roles: %w", err)
+		return fmt.Errorf("parsing roles: %w", err)
 	}
-	result.Merge(roles)
-
-	// Build a lookup from role name to ARN using the already-parsed role nodes.
-	// This avoids hardcoding an AWS account ID when resolving attachments.
-	roleNameToARN := buildRoleNameToARNMap(roles.Nodes)
 
 	// Parse policies
 	policiesPath := filepath.Join(dirPath, "policies.json")
-	policies, err := parsePolicies(policiesPath)
-	if err != nil {
-		return result, fmt.Errorf("parsing policies: %w", err)
+	if err := parsePolicies(policiesPath, sink); err != nil {
+		return fmt.Errorf("parsing policies: %w", err)
 	}
-	result.Merge(policies)
 
 	// Parse attachments
 	attachmentsPath := filepath.Join(dirPath, "attachments.json")
-	attachments, err := parseAttachments(attachmentsPath, roleNameToARN)
-	if err != nil {
-		return result, fmt.Errorf("parsing attachments: %w", err)
+	if err := parseAttachments(attachmentsPath, roleNameToARN, sink); err != nil {
+		return fmt.Errorf("parsing attachments: %w", err)
 	}
-	result.Merge(attachments)
 
-	return result, nil
+	return nil
 }
 
-// buildRoleNameToARNMap creates a mapping from role name to full ARN
-// by inspecting role nodes that were already parsed from roles.json.
-func buildRoleNameToARNMap(nodes []Node) map[string]string {
-	roleNameToARN := make(map[string]string, len(nodes))
-	for _, node := range nodes {
-		if node.Kind == KindPrincipal {
-			if name, ok := node.Props["name"]; ok {
-				roleNameToARN[name] = node.ID
-			}
-		}
+// parseRoles streams roles.json into sink and returns a lookup from role name
+// to ARN
+func parseRoles(path string, sink Sink) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
 	}
-	return roleNameToARN
-}
+	defer f.Close()
 
-func parseRoles(path string) (ParseResult, error) {
-	result := ParseResult{}
+	file := newJSONFile(SourceAWS, path, f)
+	roleNameToARN := make(map[string]string)
+	accountNodes := make(map[string]bool)
 
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return result, err
-	}
+	err = file.eachArrayElement(func(i int, raw json.RawMessage, offset int) error {
+		var role AWSRole
+		if err := json.Unmarshal(raw, &role); err != nil {
+			return err
+		}
 
-	var roles []AWSRole
-	if err := json.Unmarshal(data, &roles); err != nil {
-		return result, err
-	}
+		rolePtr := jsonPointer(i)
+		roleProv := file.provenance(raw, offset, rolePtr, "")
 
-	accountNodes := make(map[string]bool)
+		for _, f := range unknownFields(raw, awsRoleFields) {
+			addIssue(sink, IssueUnknownField, role.Arn, roleProv, "unknown field %q", f)
+		}
+		if role.Arn == "" {
+			addIssue(sink, IssueDroppedEntity, role.RoleName, roleProv, "role has no Arn")
+			return nil
+		}
+		roleNameToARN[role.RoleName] = role.Arn
 
-	for _, role := range roles {
 		// Create role node
-		result.Nodes = append(result.Nodes, Node{
-			ID:     role.Arn,
-			Kind:   KindPrincipal,
-			Labels: []string{role.RoleName, "aws-role"},
-			Props: map[string]string{
-				"name": role.RoleName,
-				"arn":  role.Arn,
-			},
-		})
+		roleProps := map[string]string{
+			"name": role.RoleName,
+			"arn":  role.Arn,
+		}
+		if role.MaxSessionDuration > 0 {
+			roleProps["max_session_duration"] = fmt.Sprintf("%d", role.MaxSessionDuration)
+		}
 
 		// Parse trust policy
 		var trustDoc PolicyDocument
-		if err := json.Unmarshal(role.AssumeRolePolicyDocument, &trustDoc); err != nil {
-			continue
+		trustErr := json.Unmarshal(role.AssumeRolePolicyDocument, &trustDoc)
+
+		// AWS services are not nodes, but a role a service can assume is in
+		// use, so the services are kept on the role
+		if services := trustedServices(trustDoc); len(services) > 0 {
+			roleProps["trusted_services"] = strings.Join(services, ",")
 		}
 
-		for _, stmt := range trustDoc.Statement {
+		sink.AddNode(Node{
+			ID:         role.Arn,
+			Kind:       KindPrincipal,
+			Labels:     []string{role.RoleName, "aws-role"},
+			Props:      roleProps,
+			Provenance: []Provenance{roleProv},
+		})
+
+		if err := trustErr; err != nil {
+			addIssue(sink, IssueDroppedEntity, role.Arn,
+				file.provenance(raw, offset, rolePtr, "/AssumeRolePolicyDocument"),
+				"trust policy could not be parsed: %v", err)
+			return nil
+		}
+		checkStatementFields(sink, file, raw, offset, rolePtr, "/AssumeRolePolicyDocument", role.AssumeRolePolicyDocument, role.Arn)
+
+		for j, stmt := range trustDoc.Statement {
 			if stmt.Effect != "Allow" {
 				continue
 			}
 
+			stmtProv := file.provenance(raw, offset, rolePtr, jsonPointer("AssumeRolePolicyDocument", "Statement", j))
+
 			var principal map[string]interface{}
 			if err := json.Unmarshal(stmt.Principal, &principal); err != nil {
+				addIssue(sink, IssueDroppedEntity, role.Arn, stmtProv,
+					"trust statement principal %s could not be parsed", string(stmt.Principal))
 				continue
 			}
 
+			for _, principalType := range sortedKeys(principal) {
+				if principalType != "AWS" && principalType != "Service" {
+					addIssue(sink, IssueDroppedEntity, role.Arn, stmtProv,
+						"trust principal type %q is not modelled", principalType)
+				}
+			}
+
 			if awsPrincipal, ok := principal["AWS"]; ok {
 				principals := []string{}
 				switch v := awsPrincipal.(type) {
@@ -159,73 +210,143 @@ func parseRoles(path string) (ParseResult, error) {
 				}
 
 				for _, p := range principals {
+					if bareAccountPattern.MatchString(p) {
+						p = accountARN(p)
+					}
+
 					// Extract account ID from principal
 					matches := accountIDPattern.FindStringSubmatch(p)
+					if len(matches) <= 1 {
+						addIssue(sink, IssueDroppedEntity, role.Arn, stmtProv,
+							"trust principal %q has no account ID", p)
+					}
 					if len(matches) > 1 {
 						accountID := matches[1]
 
+						// Trusting an account root delegates to every principal
+						// in the account that is also allowed sts:AssumeRole,
+						// which graph.ExpandAccountTrust resolves
+						accountArn := accountARN(accountID)
+						trust := "principal"
+						if p == accountArn {
+							trust = "account"
+						}
+
 						// Check if it's cross-account
 						roleAccountMatches := accountIDPattern.FindStringSubmatch(role.Arn)
-						if len(roleAccountMatches) > 1 && roleAccountMatches[1] != accountID {
-							// Create account node if not exists
-							accountArn := fmt.Sprintf("arn:aws:iam::%s:root", accountID)
-							if !accountNodes[accountArn] {
-								result.Nodes = append(result.Nodes, Node{
-									ID:     accountArn,
-									Kind:   KindAccount,
-									Labels: []string{accountID, "aws-account"},
-									Props: map[string]string{
-										"account_id": accountID,
-									},
-								})
-								accountNodes[accountArn] = true
-							}
+						crossAccount := len(roleAccountMatches) > 1 && roleAccountMatches[1] != accountID
 
+						// Create account node if not exists
+						if (crossAccount || trust == "account") && !accountNodes[accountArn] {
+							sink.AddNode(accountNode(accountID, stmtProv))
+							accountNodes[accountArn] = true
+						}
+
+						if crossAccount {
 							// Create TRUSTS_CROSS_ACCOUNT edge
-							result.Edges = append(result.Edges, Edge{
+							sink.AddEdge(Edge{
 								Src:  role.Arn,
 								Dst:  accountArn,
 								Kind: EdgeTrustsCrossAccount,
 								Props: map[string]string{
 									"principal": p,
 								},
+								Provenance: []Provenance{stmtProv},
 							})
 						}
 
 						// Create ASSUMES_ROLE edge
-						result.Edges = append(result.Edges, Edge{
-							Src:  p,
-							Dst:  role.Arn,
-							Kind: EdgeAssumesRole,
-							Props: map[string]string{
-								"action": "sts:AssumeRole",
-							},
+						props := map[string]string{
+							"action": "sts:AssumeRole",
+							"trust":  trust,
+						}
+						addConditionProps(sink, props, stmt.Condition, role.Arn, stmtProv)
+						sink.AddEdge(Edge{
+							Src:        p,
+							Dst:        role.Arn,
+							Kind:       EdgeAssumesRole,
+							Props:      props,
+							Provenance: []Provenance{stmtProv},
 						})
 					}
 				}
 			}
 		}
-	}
 
-	return result, nil
+		return nil
+	})
+
+	return roleNameToARN, err
 }
 
-func parsePolicies(path string) (ParseResult, error) {
-	result := ParseResult{}
+// trustedServices returns the AWS services the Allow statements of a trust
+// policy let assume the role, sorted
+func trustedServices(doc PolicyDocument) []string {
+	seen := make(map[string]bool)
+	for _, stmt := range doc.Statement {
+		if stmt.Effect != "Allow" {
+			continue
+		}
+		var principal struct {
+			Service json.RawMessage
+		}
+		if err := json.Unmarshal(stmt.Principal, &principal); err != nil || principal.Service == nil {
+			continue
+		}
+
+		var one string
+		var many []string
+		if err := json.Unmarshal(principal.Service, &one); err == nil {
+			many = []string{one}
+		} else if err := json.Unmarshal(principal.Service, &many); err != nil {
+			continue
+		}
+		for _, service := range many {
+			if service != "" {
+				seen[service] = true
+			}
+		}
+	}
+	return sortedKeys(seen)
+}
 
-	data, err := os.ReadFile(path)
+func parsePolicies(path string, sink Sink) error {
+	f, err := os.Open(path)
 	if err != nil {
-		return result, err
+		return err
 	}
+	defer f.Close()
 
-	var policies []AWSPolicy
-	if err := json.Unmarshal(data, &policies); err != nil {
-		return result, err
-	}
+	file := newJSONFile(SourceAWS, path, f)
+
+	return file.eachArrayElement(func(i int, raw json.RawMessage, offset int) error {
+		var policy AWSPolicy
+		if err := json.Unmarshal(raw, &policy); err != nil {
+			return err
+		}
+
+		policyPtr := jsonPointer(i)
+		policyProv := file.provenance(raw, offset, policyPtr, "")
+
+		for _, f := range unknownFields(raw, awsPolicyFields) {
+			addIssue(sink, IssueUnknownField, policy.Arn, policyProv, "unknown field %q", f)
+		}
+		if policy.Arn == "" {
+			addIssue(sink, IssueDroppedEntity, policy.PolicyName, policyProv, "policy has no Arn")
+			return nil
+		}
+
+		var versionRaw struct {
+			PolicyVersion struct {
+				Document json.RawMessage `json:"Document"`
+			} `json:"PolicyVersion"`
+		}
+		if err := json.Unmarshal(raw, &versionRaw); err == nil {
+			checkStatementFields(sink, file, raw, offset, policyPtr, "/PolicyVersion/Document", versionRaw.PolicyVersion.Document, policy.Arn)
+		}
 
-	for _, policy := range policies {
 		// Create policy node
-		result.Nodes = append(result.Nodes, Node{
+		sink.AddNode(Node{
 			ID:     policy.Arn,
 			Kind:   KindPolicy,
 			Labels: []string{policy.PolicyName, "aws-policy"},
@@ -233,22 +354,33 @@ func parsePolicies(path string) (ParseResult, error) {
 				"name": policy.PolicyName,
 				"arn":  policy.Arn,
 			},
+			Provenance: []Provenance{policyProv},
 		})
 
 		// Process statements
-		for i, stmt := range policy.PolicyVersion.Document.Statement {
+		for j, stmt := range policy.PolicyVersion.Document.Statement {
 			if stmt.Effect != "Allow" {
 				continue
 			}
 
+			stmtPtr := jsonPointer("PolicyVersion", "Document", "Statement", j)
+			actionProv := file.provenance(raw, offset, policyPtr, stmtPtr+"/Action")
+			resourceProv := file.provenance(raw, offset, policyPtr, stmtPtr+"/Resource")
+
 			// Parse actions
 			actions := parseStringOrArray(stmt.Action)
 			resources := parseStringOrArray(stmt.Resource)
 
+			if len(actions) == 0 {
+				addIssue(sink, IssueDroppedEntity, policy.Arn,
+					file.provenance(raw, offset, policyPtr, stmtPtr),
+					"statement %d has no Action (NotAction is not modelled)", j)
+			}
+
 			for _, action := range actions {
 				// Create permission node
-				permID := fmt.Sprintf("%s#stmt%d#%s", policy.Arn, i, action)
-				result.Nodes = append(result.Nodes, Node{
+				permID := fmt.Sprintf("%s#stmt%d#%s", policy.Arn, j, action)
+				sink.AddNode(Node{
 					ID:     permID,
 					Kind:   KindPerm,
 					Labels: []string{action},
@@ -256,81 +388,117 @@ func parsePolicies(path string) (ParseResult, error) {
 						"action":   action,
 						"wildcard": fmt.Sprintf("%t", strings.Contains(action, "*")),
 					},
+					Provenance: []Provenance{actionProv},
 				})
 
 				// Create ALLOWS_ACTION edge
-				result.Edges = append(result.Edges, Edge{
-					Src:  policy.Arn,
-					Dst:  permID,
-					Kind: EdgeAllowsAction,
-					Props: map[string]string{
-						"statement_index": fmt.Sprintf("%d", i),
-					},
+				props := map[string]string{
+					"statement_index": fmt.Sprintf("%d", j),
+				}
+				addConditionProps(sink, props, stmt.Condition, policy.Arn,
+					file.provenance(raw, offset, policyPtr, stmtPtr+"/Condition"))
+				sink.AddEdge(Edge{
+					Src:        policy.Arn,
+					Dst:        permID,
+					Kind:       EdgeAllowsAction,
+					Props:      props,
+					Provenance: []Provenance{actionProv},
 				})
 
 				// Create resource nodes and APPLIES_TO edges
 				for _, resource := range resources {
 					resourceID := resource
-					result.Nodes = append(result.Nodes, Node{
+					sink.AddNode(Node{
 						ID:     resourceID,
 						Kind:   KindResource,
 						Labels: []string{resource},
 						Props: map[string]string{
 							"arn": resource,
 						},
+						Provenance: []Provenance{resourceProv},
 					})
 
-					result.Edges = append(result.Edges, Edge{
+					sink.AddEdge(Edge{
 						Src:  permID,
 						Dst:  resourceID,
 						Kind: EdgeAppliesTo,
 						Props: map[string]string{
 							"action": action,
 						},
+						Provenance: []Provenance{resourceProv},
 					})
 				}
 			}
 		}
-	}
 
-	return result, nil
+		return nil
+	})
 }
 
-func parseAttachments(path string, roleNameToARN map[string]string) (ParseResult, error) {
-	result := ParseResult{}
-
-	data, err := os.ReadFile(path)
+func parseAttachments(path string, roleNameToARN map[string]string, sink Sink) error {
+	f, err := os.Open(path)
 	if err != nil {
-		return result, err
+		return err
 	}
+	defer f.Close()
 
-	var attachments []AWSAttachment
-	if err := json.Unmarshal(data, &attachments); err != nil {
-		return result, err
-	}
+	file := newJSONFile(SourceAWS, path, f)
+
+	return file.eachArrayElement(func(i int, raw json.RawMessage, offset int) error {
+		var attachment AWSAttachment
+		if err := json.Unmarshal(raw, &attachment); err != nil {
+			return err
+		}
+
+		if unknown := unknownFields(raw, awsAttachmentFields); len(unknown) > 0 {
+			prov := file.provenance(raw, offset, jsonPointer(i), "")
+			for _, f := range unknown {
+				addIssue(sink, IssueUnknownField, attachment.RoleName, prov, "unknown field %q", f)
+			}
+		}
 
-	for _, attachment := range attachments {
 		// Derive the role ARN from already-parsed roles instead of hardcoding
 		// an account ID. This ensures correctness across different AWS accounts.
 		roleArn, ok := roleNameToARN[attachment.RoleName]
 		if !ok {
 			// Skip attachments for roles we don't have data for
-			continue
+			addIssue(sink, IssueDroppedEntity, attachment.RoleName,
+				file.provenance(raw, offset, jsonPointer(i), ""),
+				"attachments reference unknown role %q", attachment.RoleName)
+			return nil
 		}
 
-		for _, policy := range attachment.AttachedPolicies {
-			result.Edges = append(result.Edges, Edge{
+		for j, policy := range attachment.AttachedPolicies {
+			sink.AddEdge(Edge{
 				Src:  roleArn,
 				Dst:  policy.PolicyArn,
 				Kind: EdgeAttachedPolicy,
 				Props: map[string]string{
 					"policy_name": policy.PolicyName,
 				},
+				Provenance: []Provenance{file.provenance(raw, offset, jsonPointer(i), jsonPointer("AttachedPolicies", j))},
 			})
 		}
-	}
 
-	return result, nil
+		return nil
+	})
+}
+
+// accountARN returns the ID of the ACCOUNT node for accountID
+func accountARN(accountID string) string {
+	return fmt.Sprintf("arn:aws:iam::%s:root", accountID)
+}
+
+func accountNode(accountID string, prov Provenance) Node {
+	return Node{
+		ID:     accountARN(accountID),
+		Kind:   KindAccount,
+		Labels: []string{accountID, "aws-account"},
+		Props: map[string]string{
+			"account_id": accountID,
+		},
+		Provenance: []Provenance{prov},
+	}
 }
 
 func parseStringOrArray(raw json.RawMessage) []string {
@@ -350,3 +518,112 @@ func parseStringOrArray(raw json.RawMessage) []string {
 
 	return result
 }
+
+// checkStatementFields records unknown fields in every statement of the
+// policy document doc, found at docPtr within the element at basePtr.
+func checkStatementFields(sink Sink, file *jsonFile, raw json.RawMessage, offset int, basePtr, docPtr string, doc json.RawMessage, entityID string) {
+	var statements struct {
+		Statement []json.RawMessage `json:"Statement"`
+	}
+	if err := json.Unmarshal(doc, &statements); err != nil {
+		return
+	}
+
+	for j, stmt := range statements.Statement {
+		unknown := unknownFields(stmt, awsStatementFields)
+		if len(unknown) == 0 {
+			continue
+		}
+		prov := file.provenance(raw, offset, basePtr, docPtr+jsonPointer("Statement", j))
+		for _, f := range unknown {
+			addIssue(sink, IssueUnknownField, entityID, prov, "unknown statement field %q", f)
+		}
+	}
+}
+
+// addConditionProps describes a statement's Condition block on the edge it
+// produced: condition_keys lists the keys it tests, sorted and comma-joined,
+// and mfa is "true" when one of the tests admits only callers signed in with
+// MFA. Statements without a condition add nothing.
+func addConditionProps(sink Sink, props map[string]string, condition json.RawMessage, entityID string, prov Provenance) {
+	if len(condition) == 0 || string(condition) == "null" {
+		return
+	}
+
+	var operators map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(condition, &operators); err != nil {
+		addIssue(sink, IssueDroppedEntity, entityID, prov, "condition could not be parsed: %v", err)
+		return
+	}
+
+	seen := make(map[string]bool)
+	var keys []string
+	for operator, tests := range operators {
+		for key, value := range tests {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+			if requiresMFA(operator, key, value) {
+				props["mfa"] = "true"
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	sort.Strings(keys)
+	props["condition_keys"] = strings.Join(keys, ",")
+}
+
+// requiresMFA reports whether a condition test admits only callers signed in
+// with MFA: Bool true on aws:MultiFactorAuthPresent, or a maximum or a
+// non-null aws:MultiFactorAuthAge, which is absent without MFA. Negated
+// tests, and IfExists variants that admit callers without the key, do not.
+// IAM compares operators and keys case-insensitively.
+func requiresMFA(operator, key string, value json.RawMessage) bool {
+	operator = strings.ToLower(operator)
+	switch strings.ToLower(key) {
+	case "aws:multifactorauthpresent":
+		return operator == "bool" && allConditionValues(value, "true")
+	case "aws:multifactorauthage":
+		switch operator {
+		case "numericlessthan", "numericlessthanequals":
+			return true
+		case "null":
+			return allConditionValues(value, "false")
+		}
+	}
+	return false
+}
+
+// allConditionValues reports whether a condition value, a single string,
+// number or boolean or an array of them, is want and nothing else. Values
+// in an array are alternatives, so one other value admits other callers.
+func allConditionValues(raw json.RawMessage, want string) bool {
+	var values []any
+	if err := json.Unmarshal(raw, &values); err != nil {
+		var single any
+		if err := json.Unmarshal(raw, &single); err != nil {
+			return false
+		}
+		values = []any{single}
+	}
+
+	for _, v := range values {
+		if !strings.EqualFold(fmt.Sprint(v), want) {
+			return false
+		}
+	}
+	return len(values) > 0
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
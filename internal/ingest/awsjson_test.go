@@ -1,6 +1,7 @@
 package ingest
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"testing"
@@ -108,3 +109,190 @@ func TestParseStringOrArray(t *testing.T) {
 		})
 	}
 }
+
+func TestParseAWSConditions(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	rolesJSON := `[{
+  "RoleName": "Admin",
+  "Arn": "arn:aws:iam::111111111111:role/Admin",
+  "AssumeRolePolicyDocument": {"Statement": [{
+    "Effect": "Allow",
+    "Principal": {"AWS": "arn:aws:iam::111111111111:user/alice"},
+    "Action": "sts:AssumeRole",
+    "Condition": {"Bool": {"aws:MultiFactorAuthPresent": "true"}, "StringEquals": {"sts:ExternalId": "x"}}
+  }]}
+}]`
+	policiesJSON := `[{
+  "PolicyName": "Read",
+  "Arn": "arn:aws:iam::111111111111:policy/Read",
+  "PolicyVersion": {"Document": {"Statement": [{
+    "Effect": "Allow", "Action": "s3:GetObject", "Resource": "*",
+    "Condition": {"IpAddress": {"aws:SourceIp": "10.0.0.0/8"}}
+  }]}}
+}]`
+
+	for name, content := range map[string]string{
+		"roles.json":       rolesJSON,
+		"policies.json":    policiesJSON,
+		"attachments.json": `[]`,
+	} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	result, err := ParseAWS(tmpDir)
+	if err != nil {
+		t.Fatalf("ParseAWS failed: %v", err)
+	}
+
+	for _, e := range result.Edges {
+		switch e.Kind {
+		case EdgeAssumesRole:
+			if e.Props["mfa"] != "true" {
+				t.Errorf("Expected mfa on ASSUMES_ROLE, got %v", e.Props)
+			}
+			if got := e.Props["condition_keys"]; got != "aws:MultiFactorAuthPresent,sts:ExternalId" {
+				t.Errorf("Unexpected condition_keys %q", got)
+			}
+		case EdgeAllowsAction:
+			if _, ok := e.Props["mfa"]; ok {
+				t.Errorf("Expected no mfa on ALLOWS_ACTION, got %v", e.Props)
+			}
+			if got := e.Props["condition_keys"]; got != "aws:SourceIp" {
+				t.Errorf("Unexpected condition_keys %q", got)
+			}
+		}
+	}
+}
+
+func TestConditionMFA(t *testing.T) {
+	tests := []struct {
+		condition string
+		mfa       bool
+	}{
+		{`{"Bool": {"aws:MultiFactorAuthPresent": "true"}}`, true},
+		{`{"bool": {"aws:multifactorauthpresent": true}}`, true},
+		{`{"NumericLessThan": {"aws:MultiFactorAuthAge": "3600"}}`, true},
+		{`{"Null": {"aws:MultiFactorAuthAge": "false"}}`, true},
+		// Negated, or admitting callers without MFA
+		{`{"Bool": {"aws:MultiFactorAuthPresent": "false"}}`, false},
+		{`{"Bool": {"aws:MultiFactorAuthPresent": ["true", "false"]}}`, false},
+		{`{"BoolIfExists": {"aws:MultiFactorAuthPresent": "true"}}`, false},
+		{`{"Null": {"aws:MultiFactorAuthAge": "true"}}`, false},
+		{`{"NumericGreaterThan": {"aws:MultiFactorAuthAge": "3600"}}`, false},
+		{`{"NumericLessThanIfExists": {"aws:MultiFactorAuthAge": "3600"}}`, false},
+	}
+
+	for _, tt := range tests {
+		props := make(map[string]string)
+		addConditionProps(&ParseResult{}, props, json.RawMessage(tt.condition), "role", Provenance{})
+		if got := props["mfa"] == "true"; got != tt.mfa {
+			t.Errorf("Condition %s: expected mfa %t, got %v", tt.condition, tt.mfa, props)
+		}
+		if props["condition_keys"] == "" {
+			t.Errorf("Condition %s: expected condition_keys, got %v", tt.condition, props)
+		}
+	}
+}
+
+func TestParseAWSAccountTrust(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	rolesJSON := `[{
+  "RoleName": "Admin",
+  "Arn": "arn:aws:iam::111111111111:role/Admin",
+  "MaxSessionDuration": 43200,
+  "AssumeRolePolicyDocument": {"Statement": [{
+    "Effect": "Allow",
+    "Principal": {"AWS": ["arn:aws:iam::111111111111:root", "222222222222", "arn:aws:iam::111111111111:user/alice"]},
+    "Action": "sts:AssumeRole"
+  }]}
+}]`
+
+	for name, content := range map[string]string{
+		"roles.json":       rolesJSON,
+		"policies.json":    `[]`,
+		"attachments.json": `[]`,
+	} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	result, err := ParseAWS(tmpDir)
+	if err != nil {
+		t.Fatalf("ParseAWS failed: %v", err)
+	}
+
+	trust := make(map[string]string)
+	for _, e := range result.Edges {
+		if e.Kind == EdgeAssumesRole {
+			trust[e.Src] = e.Props["trust"]
+		}
+	}
+	want := map[string]string{
+		"arn:aws:iam::111111111111:root":       "account",
+		"arn:aws:iam::222222222222:root":       "account",
+		"arn:aws:iam::111111111111:user/alice": "principal",
+	}
+	for src, kind := range want {
+		if trust[src] != kind {
+			t.Errorf("Expected %s trust from %s, got %q", kind, src, trust[src])
+		}
+	}
+
+	// Both roots need ACCOUNT nodes so their trust edges are not dangling
+	accounts := 0
+	for _, n := range result.Nodes {
+		switch {
+		case n.Kind == KindAccount:
+			accounts++
+		case n.ID == "arn:aws:iam::111111111111:role/Admin" && n.Props["max_session_duration"] != "43200":
+			t.Errorf("Expected max_session_duration on role, got %v", n.Props)
+		}
+	}
+	if accounts != 2 {
+		t.Errorf("Expected 2 account nodes, got %d", accounts)
+	}
+}
+
+func TestParseAWSServiceTrust(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	rolesJSON := `[{
+  "RoleName": "LambdaExec",
+  "Arn": "arn:aws:iam::111111111111:role/LambdaExec",
+  "AssumeRolePolicyDocument": {"Statement": [
+    {"Effect": "Allow", "Principal": {"Service": "lambda.amazonaws.com"}, "Action": "sts:AssumeRole"},
+    {"Effect": "Allow", "Principal": {"Service": ["ecs-tasks.amazonaws.com", "lambda.amazonaws.com"]}, "Action": "sts:AssumeRole"},
+    {"Effect": "Deny", "Principal": {"Service": "ec2.amazonaws.com"}, "Action": "sts:AssumeRole"}
+  ]}
+}]`
+
+	for name, content := range map[string]string{
+		"roles.json":       rolesJSON,
+		"policies.json":    `[]`,
+		"attachments.json": `[]`,
+	} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	result, err := ParseAWS(tmpDir)
+	if err != nil {
+		t.Fatalf("ParseAWS failed: %v", err)
+	}
+
+	if len(result.Nodes) != 1 {
+		t.Fatalf("Expected only the role node, got %v", result.Nodes)
+	}
+	if got := result.Nodes[0].Props["trusted_services"]; got != "ecs-tasks.amazonaws.com,lambda.amazonaws.com" {
+		t.Errorf("Expected the allowed services on the role, got %q", got)
+	}
+	if counts := result.Validate().Counts(); counts[IssueDroppedEntity] != 0 {
+		t.Errorf("Expected service principals not to be reported as dropped, got %v", counts)
+	}
+}
@@ -1,7 +1,9 @@
 package ingest
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -39,13 +41,25 @@ type K8sResource struct {
 	} `yaml:"spec"`
 }
 
+// k8sResourceFields are the top-level fields of the supported kinds that the
+// parser reads or deliberately ignores
+var k8sResourceFields = fieldSet("apiVersion", "kind", "metadata", "subjects",
+	"roleRef", "rules", "aggregationRule", "spec", "secrets",
+	"imagePullSecrets", "automountServiceAccountToken")
+
 // ParseK8s parses Kubernetes RBAC YAML files from a directory
 func ParseK8s(dirPath string) (ParseResult, error) {
 	result := ParseResult{
 		Nodes: []Node{},
 		Edges: []Edge{},
 	}
+	err := StreamK8s(dirPath, &result)
+	return result, err
+}
 
+// StreamK8s parses Kubernetes RBAC YAML files from a directory, decoding one
+// document at a time and sending its nodes, edges and issues to sink
+func StreamK8s(dirPath string, sink Sink) error {
 	files := []string{
 		"serviceaccounts.yaml",
 		"clusterroles.yaml",
@@ -59,33 +73,56 @@ func ParseK8s(dirPath string) (ParseResult, error) {
 			continue
 		}
 
-		data, err := os.ReadFile(path)
-		if err != nil {
-			return result, fmt.Errorf("reading %s: %w", file, err)
+		if err := streamK8sFile(path, sink); err != nil {
+			return fmt.Errorf("reading %s: %w", file, err)
 		}
+	}
+
+	return nil
+}
 
-		// Parse YAML documents
-		decoder := yaml.NewDecoder(strings.NewReader(string(data)))
-		for {
-			var resource K8sResource
-			if err := decoder.Decode(&resource); err != nil {
-				break
+// streamK8sFile decodes the YAML documents in path one at a time
+func streamK8sFile(path string, sink Sink) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	for {
+		var root yaml.Node
+		if err := decoder.Decode(&root); err != nil {
+			if !errors.Is(err, io.EOF) {
+				addIssue(sink, IssueDroppedEntity, "", Provenance{Source: SourceK8s, File: path},
+					"remaining YAML documents could not be parsed: %v", err)
 			}
+			return nil
+		}
 
-			parsed := parseK8sResource(resource)
-			result.Merge(parsed)
+		doc := yamlDoc{source: SourceK8s, path: path, root: &root}
+		if len(root.Content) == 0 {
+			continue
 		}
-	}
 
-	return result, nil
-}
+		var resource K8sResource
+		if err := root.Decode(&resource); err != nil {
+			addIssue(sink, IssueDroppedEntity, "", doc.provenance(), "document could not be decoded: %v", err)
+			continue
+		}
 
-func parseK8sResource(resource K8sResource) ParseResult {
-	result := ParseResult{}
+		for _, field := range doc.unknownFields(k8sResourceFields) {
+			addIssue(sink, IssueUnknownField, resource.Metadata.Name, doc.provenance(field), "unknown field %q", field)
+		}
 
+		parseK8sResource(resource, doc, sink)
+	}
+}
+
+func parseK8sResource(resource K8sResource, doc yamlDoc, sink Sink) {
 	switch resource.Kind {
 	case "ServiceAccount":
-		result.Nodes = append(result.Nodes, Node{
+		sink.AddNode(Node{
 			ID:     fmt.Sprintf("k8s:sa:%s:%s", resource.Metadata.Namespace, resource.Metadata.Name),
 			Kind:   KindPrincipal,
 			Labels: []string{resource.Metadata.Name, "k8s-serviceaccount"},
@@ -93,24 +130,28 @@ func parseK8sResource(resource K8sResource) ParseResult {
 				"name":      resource.Metadata.Name,
 				"namespace": resource.Metadata.Namespace,
 			},
+			Provenance: []Provenance{doc.provenance()},
 		})
 
 		// Create namespace node
 		if resource.Metadata.Namespace != "" {
-			result.Nodes = append(result.Nodes, Node{
+			nsProv := doc.provenance("metadata", "namespace")
+			sink.AddNode(Node{
 				ID:     fmt.Sprintf("k8s:ns:%s", resource.Metadata.Namespace),
 				Kind:   KindNS,
 				Labels: []string{resource.Metadata.Namespace},
 				Props: map[string]string{
 					"name": resource.Metadata.Namespace,
 				},
+				Provenance: []Provenance{nsProv},
 			})
 
-			result.Edges = append(result.Edges, Edge{
-				Src:   fmt.Sprintf("k8s:sa:%s:%s", resource.Metadata.Namespace, resource.Metadata.Name),
-				Dst:   fmt.Sprintf("k8s:ns:%s", resource.Metadata.Namespace),
-				Kind:  EdgeInNamespace,
-				Props: map[string]string{},
+			sink.AddEdge(Edge{
+				Src:        fmt.Sprintf("k8s:sa:%s:%s", resource.Metadata.Namespace, resource.Metadata.Name),
+				Dst:        fmt.Sprintf("k8s:ns:%s", resource.Metadata.Namespace),
+				Kind:       EdgeInNamespace,
+				Props:      map[string]string{},
+				Provenance: []Provenance{nsProv},
 			})
 		}
 
@@ -122,7 +163,7 @@ func parseK8sResource(resource K8sResource) ParseResult {
 
 		isClusterAdmin := resource.Metadata.Name == "cluster-admin"
 
-		result.Nodes = append(result.Nodes, Node{
+		sink.AddNode(Node{
 			ID:     roleID,
 			Kind:   KindRole,
 			Labels: []string{resource.Metadata.Name, fmt.Sprintf("k8s-%s", strings.ToLower(resource.Kind))},
@@ -130,17 +171,19 @@ func parseK8sResource(resource K8sResource) ParseResult {
 				"name":          resource.Metadata.Name,
 				"cluster_admin": fmt.Sprintf("%t", isClusterAdmin),
 			},
+			Provenance: []Provenance{doc.provenance()},
 		})
 
 		// Process rules
 		for i, rule := range resource.Rules {
+			ruleProv := doc.provenance("rules", i)
 			for _, verb := range rule.Verbs {
 				for _, res := range rule.Resources {
 					permID := fmt.Sprintf("%s#rule%d#%s#%s", roleID, i, verb, res)
 
 					isWildcard := verb == "*" || res == "*"
 
-					result.Nodes = append(result.Nodes, Node{
+					sink.AddNode(Node{
 						ID:     permID,
 						Kind:   KindPerm,
 						Labels: []string{fmt.Sprintf("%s:%s", verb, res)},
@@ -149,15 +192,17 @@ func parseK8sResource(resource K8sResource) ParseResult {
 							"resource": res,
 							"wildcard": fmt.Sprintf("%t", isWildcard),
 						},
+						Provenance: []Provenance{ruleProv},
 					})
 
-					result.Edges = append(result.Edges, Edge{
+					sink.AddEdge(Edge{
 						Src:  roleID,
 						Dst:  permID,
 						Kind: EdgeAllowsAction,
 						Props: map[string]string{
 							"rule_index": fmt.Sprintf("%d", i),
 						},
+						Provenance: []Provenance{ruleProv},
 					})
 				}
 			}
@@ -167,7 +212,7 @@ func parseK8sResource(resource K8sResource) ParseResult {
 		bindingID := fmt.Sprintf("k8s:binding:%s", resource.Metadata.Name)
 		roleID := fmt.Sprintf("k8s:role:%s", resource.RoleRef.Name)
 
-		for _, subject := range resource.Subjects {
+		for j, subject := range resource.Subjects {
 			var subjectID string
 			if subject.Kind == "ServiceAccount" {
 				ns := subject.Namespace
@@ -179,13 +224,14 @@ func parseK8sResource(resource K8sResource) ParseResult {
 				subjectID = fmt.Sprintf("k8s:%s:%s", strings.ToLower(subject.Kind), subject.Name)
 			}
 
-			result.Edges = append(result.Edges, Edge{
+			sink.AddEdge(Edge{
 				Src:  roleID,
 				Dst:  subjectID,
 				Kind: EdgeBindsTo,
 				Props: map[string]string{
 					"binding": bindingID,
 				},
+				Provenance: []Provenance{doc.provenance("subjects", j)},
 			})
 		}
 
@@ -197,7 +243,7 @@ func parseK8sResource(resource K8sResource) ParseResult {
 			labels = append(labels, fmt.Sprintf("%s=%s", k, v))
 		}
 
-		result.Nodes = append(result.Nodes, Node{
+		sink.AddNode(Node{
 			ID:     npID,
 			Kind:   KindResource,
 			Labels: labels,
@@ -206,8 +252,11 @@ func parseK8sResource(resource K8sResource) ParseResult {
 				"namespace": resource.Metadata.Namespace,
 				"type":      "NetworkPolicy",
 			},
+			Provenance: []Provenance{doc.provenance()},
 		})
-	}
 
-	return result
+	default:
+		addIssue(sink, IssueDroppedEntity, resource.Metadata.Name, doc.provenance("kind"),
+			"unsupported kind %q", resource.Kind)
+	}
 }
@@ -0,0 +1,251 @@
+package ingest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Conflict records a property disagreement found while merging two copies of
+// the same node or edge. The first-seen value is kept; the other is dropped.
+type Conflict struct {
+	EntityID    string       `json:"entityId"` // node ID or edge key
+	Key         string       `json:"key"`
+	Kept        string       `json:"kept"`
+	Dropped     string       `json:"dropped"`
+	DroppedFrom []Provenance `json:"droppedFrom,omitempty"`
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s: %s kept %q, dropped %q", c.EntityID, c.Key, c.Kept, c.Dropped)
+}
+
+// riskFlagProps are boolean props where "true" always wins over "false".
+// Losing one of these during a merge would hide a finding, so they are
+// merged conservatively instead of first-seen-wins.
+var riskFlagProps = map[string]bool{
+	"sensitive":     true,
+	"wildcard":      true,
+	"cluster_admin": true,
+	"cross_account": true,
+}
+
+// setProps hold a comma-separated set of values. Nodes shared between
+// accounts ingested in parallel, such as a "*" resource, list every account
+// they were seen from, so the merged value does not depend on which worker
+// finished first.
+var setProps = map[string]bool{
+	"account_id":       true,
+	"trusted_services": true,
+}
+
+// MergeNode folds src into dst, which must share the same ID.
+//
+// Merge rules, applied per field:
+//   - Kind: first-seen wins; a different kind is reported as a conflict.
+//   - Labels: union, preserving first-seen order.
+//   - Props: missing keys are copied; risk flags resolve to "true" if either
+//     side is "true"; set-valued props are unioned; any other differing
+//     value keeps the first-seen value and is reported as a conflict.
+//   - Provenance: union, preserving first-seen order.
+func MergeNode(dst *Node, src Node) []Conflict {
+	var conflicts []Conflict
+
+	if src.Kind != "" && dst.Kind != src.Kind {
+		if dst.Kind == "" {
+			dst.Kind = src.Kind
+		} else {
+			conflicts = append(conflicts, Conflict{
+				EntityID:    dst.ID,
+				Key:         "kind",
+				Kept:        string(dst.Kind),
+				Dropped:     string(src.Kind),
+				DroppedFrom: src.Provenance,
+			})
+		}
+	}
+
+	dst.Labels = unionStrings(dst.Labels, src.Labels)
+	dst.Props, conflicts = mergeProps(dst.ID, dst.Props, src.Props, src.Provenance, conflicts)
+	dst.Provenance = unionProvenance(dst.Provenance, src.Provenance)
+
+	return conflicts
+}
+
+// MergeEdge folds src into dst, which must share the same Key. Props and
+// provenance follow the same rules as MergeNode.
+func MergeEdge(dst *Edge, src Edge) []Conflict {
+	var conflicts []Conflict
+	dst.Props, conflicts = mergeProps(dst.Key(), dst.Props, src.Props, src.Provenance, conflicts)
+	dst.Provenance = unionProvenance(dst.Provenance, src.Provenance)
+	return conflicts
+}
+
+func mergeProps(entityID string, dst, src map[string]string, from []Provenance, conflicts []Conflict) (map[string]string, []Conflict) {
+	if len(src) == 0 {
+		return dst, conflicts
+	}
+	if dst == nil {
+		dst = make(map[string]string, len(src))
+	}
+
+	for _, k := range sortedKeys(src) {
+		v := src[k]
+		existing, ok := dst[k]
+		switch {
+		case !ok:
+			dst[k] = v
+		case existing == v:
+		case riskFlagProps[k]:
+			if v == "true" {
+				dst[k] = v
+			}
+		case setProps[k]:
+			dst[k] = unionSet(existing, v)
+		default:
+			conflicts = append(conflicts, Conflict{
+				EntityID:    entityID,
+				Key:         k,
+				Kept:        existing,
+				Dropped:     v,
+				DroppedFrom: from,
+			})
+		}
+	}
+
+	return dst, conflicts
+}
+
+func unionStrings(dst, src []string) []string {
+	for _, s := range src {
+		found := false
+		for _, d := range dst {
+			if d == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			dst = append(dst, s)
+		}
+	}
+	return dst
+}
+
+// unionSet merges two comma-separated sets into one sorted set
+func unionSet(a, b string) string {
+	seen := make(map[string]bool)
+	var values []string
+	for _, v := range append(strings.Split(a, ","), strings.Split(b, ",")...) {
+		if v != "" && !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	sort.Strings(values)
+	return strings.Join(values, ",")
+}
+
+func unionProvenance(dst, src []Provenance) []Provenance {
+	for _, p := range src {
+		found := false
+		for _, d := range dst {
+			if d == p {
+				found = true
+				break
+			}
+		}
+		if !found {
+			dst = append(dst, p)
+		}
+	}
+	return dst
+}
+
+// AddNode adds a node, merging it into any existing node with the same ID
+func (pr *ParseResult) AddNode(node Node) {
+	pr.ensureIndex()
+
+	if i, ok := pr.nodeIndex[node.ID]; ok {
+		pr.Conflicts = append(pr.Conflicts, MergeNode(&pr.Nodes[i], node)...)
+		return
+	}
+
+	pr.nodeIndex[node.ID] = len(pr.Nodes)
+	pr.Nodes = append(pr.Nodes, CloneNode(node))
+}
+
+// AddEdge adds an edge, merging it into any existing edge with the same Key
+func (pr *ParseResult) AddEdge(edge Edge) {
+	pr.ensureIndex()
+
+	key := edge.Key()
+	if i, ok := pr.edgeIndex[key]; ok {
+		pr.Conflicts = append(pr.Conflicts, MergeEdge(&pr.Edges[i], edge)...)
+		return
+	}
+
+	pr.edgeIndex[key] = len(pr.Edges)
+	pr.Edges = append(pr.Edges, CloneEdge(edge))
+}
+
+// ensureIndex (re)builds the dedup indexes. Parsers may append to Nodes and
+// Edges directly, so the indexes are considered stale whenever their size no
+// longer matches the slices, and the slices are canonicalised again.
+func (pr *ParseResult) ensureIndex() {
+	if pr.nodeIndex == nil || len(pr.nodeIndex) != len(pr.Nodes) {
+		nodes := pr.Nodes
+		pr.Nodes = make([]Node, 0, len(nodes))
+		pr.nodeIndex = make(map[string]int, len(nodes))
+		for _, n := range nodes {
+			if i, ok := pr.nodeIndex[n.ID]; ok {
+				pr.Conflicts = append(pr.Conflicts, MergeNode(&pr.Nodes[i], n)...)
+				continue
+			}
+			pr.nodeIndex[n.ID] = len(pr.Nodes)
+			pr.Nodes = append(pr.Nodes, CloneNode(n))
+		}
+	}
+
+	if pr.edgeIndex == nil || len(pr.edgeIndex) != len(pr.Edges) {
+		edges := pr.Edges
+		pr.Edges = make([]Edge, 0, len(edges))
+		pr.edgeIndex = make(map[string]int, len(edges))
+		for _, e := range edges {
+			key := e.Key()
+			if i, ok := pr.edgeIndex[key]; ok {
+				pr.Conflicts = append(pr.Conflicts, MergeEdge(&pr.Edges[i], e)...)
+				continue
+			}
+			pr.edgeIndex[key] = len(pr.Edges)
+			pr.Edges = append(pr.Edges, CloneEdge(e))
+		}
+	}
+}
+
+// CloneNode copies the mutable parts of a node so merges never write through
+// to a slice or map still owned by another ParseResult.
+func CloneNode(n Node) Node {
+	n.Labels = append([]string(nil), n.Labels...)
+	n.Props = cloneProps(n.Props)
+	n.Provenance = append([]Provenance(nil), n.Provenance...)
+	return n
+}
+
+// CloneEdge copies the mutable parts of an edge, as CloneNode does
+func CloneEdge(e Edge) Edge {
+	e.Props = cloneProps(e.Props)
+	e.Provenance = append([]Provenance(nil), e.Provenance...)
+	return e
+}
+
+func cloneProps(props map[string]string) map[string]string {
+	if props == nil {
+		return nil
+	}
+	out := make(map[string]string, len(props))
+	for k, v := range props {
+		out[k] = v
+	}
+	return out
+}
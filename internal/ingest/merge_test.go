@@ -0,0 +1,123 @@
+package ingest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMergeDeduplicatesNodesAndEdges(t *testing.T) {
+	awsProv := []Provenance{{Source: SourceAWS, File: "policies.json"}}
+	aws := ParseResult{
+		Nodes: []Node{
+			{ID: "bucket", Kind: KindResource, Labels: []string{"bucket"}, Props: map[string]string{"arn": "bucket"}, Provenance: awsProv},
+			{ID: "bucket", Kind: KindResource, Labels: []string{"bucket"}, Props: map[string]string{"arn": "bucket"}, Provenance: awsProv},
+			{ID: "perm", Kind: KindPerm, Props: map[string]string{"action": "s3:GetObject"}, Provenance: awsProv},
+		},
+		Edges: []Edge{
+			{Src: "perm", Dst: "bucket", Kind: EdgeAppliesTo, Props: map[string]string{"action": "s3:GetObject"}, Provenance: awsProv},
+			{Src: "perm", Dst: "bucket", Kind: EdgeAppliesTo, Props: map[string]string{"action": "s3:GetObject"}, Provenance: awsProv},
+		},
+	}
+
+	tf := ParseResult{
+		Nodes: []Node{
+			{ID: "bucket", Kind: KindResource, Labels: []string{"prod"}, Props: map[string]string{"sensitive": "true"}, Provenance: []Provenance{{Source: SourceTerraform, File: "plan.json"}}},
+		},
+	}
+
+	var result ParseResult
+	result.Merge(aws)
+	result.Merge(tf)
+
+	if len(result.Nodes) != 2 {
+		t.Fatalf("Expected 2 nodes, got %d", len(result.Nodes))
+	}
+	if len(result.Edges) != 1 {
+		t.Fatalf("Expected 1 edge, got %d", len(result.Edges))
+	}
+	if len(result.Conflicts) != 0 {
+		t.Errorf("Expected no conflicts, got %v", result.Conflicts)
+	}
+
+	bucket := result.Nodes[0]
+	if bucket.ID != "bucket" {
+		t.Fatalf("Expected first-seen order to be preserved, got %s", bucket.ID)
+	}
+	if bucket.Props["sensitive"] != "true" || bucket.Props["arn"] != "bucket" {
+		t.Errorf("Expected props from both sources, got %v", bucket.Props)
+	}
+	if len(bucket.Labels) != 2 {
+		t.Errorf("Expected label union [bucket prod], got %v", bucket.Labels)
+	}
+	if len(bucket.Provenance) != 2 {
+		t.Errorf("Expected provenance from both sources, got %v", bucket.Provenance)
+	}
+}
+
+func TestMergeConflicts(t *testing.T) {
+	var result ParseResult
+	result.AddNode(Node{
+		ID:         "role",
+		Kind:       KindPrincipal,
+		Props:      map[string]string{"name": "first", "wildcard": "false"},
+		Provenance: []Provenance{{Source: SourceAWS}},
+	})
+	result.AddNode(Node{
+		ID:         "role",
+		Kind:       KindRole,
+		Props:      map[string]string{"name": "second", "wildcard": "true"},
+		Provenance: []Provenance{{Source: SourceK8s}},
+	})
+
+	node := result.Nodes[0]
+	if node.Kind != KindPrincipal {
+		t.Errorf("Expected first-seen kind to win, got %s", node.Kind)
+	}
+	if node.Props["name"] != "first" {
+		t.Errorf("Expected first-seen name to win, got %s", node.Props["name"])
+	}
+	if node.Props["wildcard"] != "true" {
+		t.Errorf("Expected risk flag to resolve to true, got %s", node.Props["wildcard"])
+	}
+
+	if len(result.Conflicts) != 2 {
+		t.Fatalf("Expected 2 conflicts (kind, name), got %d: %v", len(result.Conflicts), result.Conflicts)
+	}
+	for _, c := range result.Conflicts {
+		if c.EntityID != "role" {
+			t.Errorf("Expected conflict on role, got %s", c.EntityID)
+		}
+		if len(c.DroppedFrom) != 1 || c.DroppedFrom[0].Source != SourceK8s {
+			t.Errorf("Expected dropped value attributed to k8s, got %v", c.DroppedFrom)
+		}
+	}
+}
+
+func TestMergeConflictOrder(t *testing.T) {
+	// Map iteration order is random, so a few merges would show any leak of it
+	for run := 0; run < 20; run++ {
+		dst := Node{ID: "role", Props: map[string]string{"path": "/a/", "name": "first", "arn": "x"}}
+		conflicts := MergeNode(&dst, Node{ID: "role", Props: map[string]string{"path": "/b/", "name": "second", "arn": "y"}})
+
+		var keys []string
+		for _, c := range conflicts {
+			keys = append(keys, c.Key)
+		}
+		if got := strings.Join(keys, ","); got != "arn,name,path" {
+			t.Fatalf("Expected conflicts in key order, got %s", got)
+		}
+	}
+}
+
+func TestMergeDoesNotAliasInput(t *testing.T) {
+	props := map[string]string{"name": "a"}
+	other := ParseResult{Nodes: []Node{{ID: "n", Props: props}}}
+
+	var result ParseResult
+	result.Merge(other)
+	result.AddNode(Node{ID: "n", Props: map[string]string{"extra": "b"}})
+
+	if _, ok := props["extra"]; ok {
+		t.Error("Merge must not write through to the input props map")
+	}
+}
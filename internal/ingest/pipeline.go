@@ -0,0 +1,103 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+)
+
+// Sink receives parser output as it is produced. ParseResult is a Sink that
+// keeps everything in memory; Run forwards items to a consumer instead.
+type Sink interface {
+	AddNode(Node)
+	AddEdge(Edge)
+	AddIssue(Issue)
+}
+
+// Item is one unit of parser output flowing through a pipeline. Exactly one
+// field is set.
+type Item struct {
+	Node  *Node
+	Edge  *Edge
+	Issue *Issue
+}
+
+// DefaultBuffer is the pipeline capacity used by the ingester
+const DefaultBuffer = 1024
+
+// Run streams everything produce emits to consume, in order. produce runs in
+// its own goroutine and blocks once buffer items are waiting, so the parsers
+// never run further ahead of the consumer than that. If consume fails, the
+// rest of the producer's output is discarded and the error is returned.
+func Run(ctx context.Context, buffer int, produce func(Sink) error, consume func(Item) error) error {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	p := &pipeline{ctx: ctx, items: make(chan Item, buffer)}
+	produceErr := make(chan error, 1)
+
+	go func() {
+		defer close(p.items)
+		produceErr <- produce(p)
+	}()
+
+	var consumeErr error
+	for item := range p.items {
+		if consumeErr != nil {
+			continue // drain so the producer can finish
+		}
+		if err := consume(item); err != nil {
+			consumeErr = err
+			cancel()
+		}
+	}
+
+	if err := <-produceErr; err != nil && consumeErr == nil {
+		return err
+	}
+	if consumeErr == nil && ctx.Err() != nil {
+		return fmt.Errorf("pipeline cancelled: %w", ctx.Err())
+	}
+	return consumeErr
+}
+
+// pipeline is the Sink handed to producers by Run
+type pipeline struct {
+	ctx   context.Context
+	items chan Item
+}
+
+func (p *pipeline) AddNode(node Node)    { p.send(Item{Node: &node}) }
+func (p *pipeline) AddEdge(edge Edge)    { p.send(Item{Edge: &edge}) }
+func (p *pipeline) AddIssue(issue Issue) { p.send(Item{Issue: &issue}) }
+
+// send blocks until the consumer has room, dropping the item once the
+// pipeline is cancelled
+func (p *pipeline) send(item Item) {
+	select {
+	case p.items <- item:
+	case <-p.ctx.Done():
+	}
+}
+
+// sendTo calls the method of sink that adds the item
+func (item Item) sendTo(sink Sink) {
+	switch {
+	case item.Node != nil:
+		sink.AddNode(*item.Node)
+	case item.Edge != nil:
+		sink.AddEdge(*item.Edge)
+	case item.Issue != nil:
+		sink.AddIssue(*item.Issue)
+	}
+}
+
+// channelSink sends everything added to it down a channel
+type channelSink chan<- Item
+
+func (c channelSink) AddNode(node Node)    { c <- Item{Node: &node} }
+func (c channelSink) AddEdge(edge Edge)    { c <- Item{Edge: &edge} }
+func (c channelSink) AddIssue(issue Issue) { c <- Item{Issue: &issue} }
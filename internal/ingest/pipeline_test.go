@@ -0,0 +1,111 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRunPreservesOrder(t *testing.T) {
+	produce := func(sink Sink) error {
+		for i := 0; i < 100; i++ {
+			sink.AddNode(Node{ID: fmt.Sprintf("n%d", i)})
+		}
+		sink.AddEdge(Edge{Src: "n0", Dst: "n1", Kind: EdgeAppliesTo})
+		sink.AddIssue(Issue{Kind: IssueUnknownField})
+		return nil
+	}
+
+	var nodes, edges, issues int
+	consume := func(item Item) error {
+		switch {
+		case item.Node != nil:
+			if item.Node.ID != fmt.Sprintf("n%d", nodes) {
+				t.Errorf("Expected n%d, got %s", nodes, item.Node.ID)
+			}
+			nodes++
+		case item.Edge != nil:
+			edges++
+		case item.Issue != nil:
+			issues++
+		}
+		return nil
+	}
+
+	if err := Run(context.Background(), 4, produce, consume); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if nodes != 100 || edges != 1 || issues != 1 {
+		t.Errorf("Expected 100 nodes, 1 edge, 1 issue; got %d, %d, %d", nodes, edges, issues)
+	}
+}
+
+func TestRunIsBounded(t *testing.T) {
+	const buffer = 8
+
+	var produced atomic.Int64
+	produce := func(sink Sink) error {
+		for i := 0; i < 1000; i++ {
+			sink.AddNode(Node{ID: fmt.Sprintf("n%d", i)})
+			produced.Add(1)
+		}
+		return nil
+	}
+
+	var consumed int64
+	consume := func(item Item) error {
+		consumed++
+		// The producer can be at most one buffer plus the item being sent ahead
+		if ahead := produced.Load() - consumed; ahead > buffer+1 {
+			t.Fatalf("Producer ran %d items ahead of the consumer", ahead)
+		}
+		return nil
+	}
+
+	if err := Run(context.Background(), buffer, produce, consume); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+}
+
+func TestRunStopsOnConsumerError(t *testing.T) {
+	errStop := errors.New("stop")
+
+	produce := func(sink Sink) error {
+		for i := 0; i < 1000; i++ {
+			sink.AddNode(Node{ID: fmt.Sprintf("n%d", i)})
+		}
+		return nil
+	}
+
+	consumed := 0
+	consume := func(item Item) error {
+		consumed++
+		if consumed == 3 {
+			return errStop
+		}
+		return nil
+	}
+
+	err := Run(context.Background(), 4, produce, consume)
+	if !errors.Is(err, errStop) {
+		t.Fatalf("Expected consumer error, got %v", err)
+	}
+	if consumed != 3 {
+		t.Errorf("Expected consume to stop after the error, got %d calls", consumed)
+	}
+}
+
+func TestRunReturnsProducerError(t *testing.T) {
+	errParse := errors.New("parse")
+
+	err := Run(context.Background(), 4, func(sink Sink) error {
+		sink.AddNode(Node{ID: "a"})
+		return errParse
+	}, func(Item) error { return nil })
+
+	if !errors.Is(err, errParse) {
+		t.Fatalf("Expected producer error, got %v", err)
+	}
+}
@@ -0,0 +1,407 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Source identifiers recorded in provenance
+const (
+	SourceAWS       = "aws"
+	SourceK8s       = "k8s"
+	SourceTerraform = "terraform"
+)
+
+// Provenance records where in the input a node or edge came from.
+// Path is a JSON pointer (RFC 6901) for JSON inputs and a YAML path such as
+// "$.rules[0]" for YAML inputs. Line is 1-based; 0 means unknown.
+type Provenance struct {
+	Source string `json:"source"`
+	File   string `json:"file,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Line   int    `json:"line,omitempty"`
+}
+
+// String returns a compact "source:file:line" form for logs and reports
+func (p Provenance) String() string {
+	s := p.Source
+	if p.File != "" {
+		s += ":" + p.File
+		if p.Line > 0 {
+			s += ":" + strconv.Itoa(p.Line)
+		}
+	}
+	return s
+}
+
+// lineTracker counts lines in the bytes read through it. Only newline offsets
+// at or after the last forget mark are kept, so memory is bounded by the
+// element being processed rather than by the size of the file.
+type lineTracker struct {
+	r        io.Reader
+	offset   int   // bytes read so far
+	newlines []int // offsets of remembered newlines
+	before   int   // newlines dropped by forget
+}
+
+func newLineTracker(r io.Reader) *lineTracker {
+	return &lineTracker{r: r}
+}
+
+func (t *lineTracker) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	for i, b := range p[:n] {
+		if b == '\n' {
+			t.newlines = append(t.newlines, t.offset+i)
+		}
+	}
+	t.offset += n
+	return n, err
+}
+
+// line returns the 1-based line containing offset, which must not be before
+// the last forget mark
+func (t *lineTracker) line(offset int) int {
+	return t.before + sort.SearchInts(t.newlines, offset) + 1
+}
+
+// forget drops newline offsets before offset
+func (t *lineTracker) forget(offset int) {
+	n := sort.SearchInts(t.newlines, offset)
+	t.before += n
+	t.newlines = t.newlines[n:]
+}
+
+// jsonFile streams a JSON document and ties each decoded element to its
+// provenance so parsers can stamp nodes and edges with a pointer and line
+// number.
+type jsonFile struct {
+	source string
+	path   string
+	lines  *lineTracker
+	dec    *json.Decoder
+}
+
+func newJSONFile(source, path string, r io.Reader) *jsonFile {
+	lines := newLineTracker(r)
+	return &jsonFile{
+		source: source,
+		path:   path,
+		lines:  lines,
+		dec:    json.NewDecoder(lines),
+	}
+}
+
+// provenance returns the provenance of the value at pointer. base is the byte
+// offset of raw within the file and basePointer is raw's own JSON pointer; rel
+// is a pointer relative to raw.
+func (f *jsonFile) provenance(raw []byte, base int, basePointer, rel string) Provenance {
+	p := Provenance{Source: f.source, File: f.path, Path: basePointer + rel}
+	if off, ok := jsonPointerOffset(raw, rel); ok {
+		p.Line = f.lines.line(base + off)
+	}
+	return p
+}
+
+// elementFunc receives one array element with its index and byte offset
+// within the file
+type elementFunc func(i int, raw json.RawMessage, offset int) error
+
+// eachArrayElement streams a top-level JSON array
+func (f *jsonFile) eachArrayElement(fn elementFunc) error {
+	return f.eachElement(map[string]elementFunc{"": fn})
+}
+
+// eachElement streams the elements of every array whose JSON pointer is a
+// key of arrays, calling its function once per element. Everything else is
+// skipped token by token, so only one element is held in memory at a time.
+func (f *jsonFile) eachElement(arrays map[string]elementFunc) error {
+	return f.walk("", arrays)
+}
+
+func (f *jsonFile) walk(pointer string, arrays map[string]elementFunc) error {
+	if fn, ok := arrays[pointer]; ok {
+		return f.streamArray(pointer, fn)
+	}
+	if !containsPointerBelow(arrays, pointer) {
+		return skipJSONValue(f.dec)
+	}
+
+	tok, err := f.dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok {
+	case json.Delim('{'):
+	case json.Delim('['):
+		return skipJSONRest(f.dec, 1)
+	default:
+		return nil
+	}
+
+	for f.dec.More() {
+		key, err := f.dec.Token()
+		if err != nil {
+			return err
+		}
+		if err := f.walk(pointer+jsonPointer(key), arrays); err != nil {
+			return err
+		}
+	}
+
+	_, err = f.dec.Token()
+	return err
+}
+
+func (f *jsonFile) streamArray(pointer string, fn elementFunc) error {
+	tok, err := f.dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil // null array
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		if pointer == "" {
+			return fmt.Errorf("expected JSON array, got %v", tok)
+		}
+		return fmt.Errorf("expected JSON array at %s, got %v", pointer, tok)
+	}
+
+	for i := 0; f.dec.More(); i++ {
+		var raw json.RawMessage
+		if err := f.dec.Decode(&raw); err != nil {
+			return err
+		}
+
+		// RawMessage holds the exact input bytes, so the element starts
+		// len(raw) bytes before the decoder's position
+		offset := int(f.dec.InputOffset()) - len(raw)
+		f.lines.forget(offset)
+
+		if err := fn(i, raw, offset); err != nil {
+			return err
+		}
+	}
+
+	_, err = f.dec.Token()
+	return err
+}
+
+// containsPointerBelow reports whether any key of arrays addresses a value
+// nested inside pointer
+func containsPointerBelow(arrays map[string]elementFunc, pointer string) bool {
+	for p := range arrays {
+		if strings.HasPrefix(p, pointer+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	pointerEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+// jsonPointerOffset returns the byte offset within raw of the value addressed
+// by the RFC 6901 pointer. The empty pointer addresses raw itself.
+func jsonPointerOffset(raw []byte, pointer string) (int, bool) {
+	if pointer == "" {
+		return skipJSONSpace(raw, 0), true
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return 0, false
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	for _, seg := range strings.Split(pointer[1:], "/") {
+		seg = pointerUnescaper.Replace(seg)
+
+		tok, err := dec.Token()
+		if err != nil {
+			return 0, false
+		}
+
+		found := false
+		switch tok {
+		case json.Delim('{'):
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return 0, false
+				}
+				if key == seg {
+					found = true
+					break
+				}
+				if err := skipJSONValue(dec); err != nil {
+					return 0, false
+				}
+			}
+		case json.Delim('['):
+			idx, err := strconv.Atoi(seg)
+			if err != nil {
+				return 0, false
+			}
+			for i := 0; dec.More(); i++ {
+				if i == idx {
+					found = true
+					break
+				}
+				if err := skipJSONValue(dec); err != nil {
+					return 0, false
+				}
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+
+	return skipJSONSpace(raw, int(dec.InputOffset())), true
+}
+
+// skipJSONValue consumes one complete value from dec
+func skipJSONValue(dec *json.Decoder) error {
+	return skipJSONRest(dec, 0)
+}
+
+// skipJSONRest consumes tokens from dec until depth open containers have been
+// closed. A depth of 0 consumes one complete value.
+func skipJSONRest(dec *json.Decoder, depth int) error {
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// skipJSONSpace advances offset past whitespace and the separators the
+// decoder leaves behind between tokens.
+func skipJSONSpace(data []byte, offset int) int {
+	for offset < len(data) {
+		switch data[offset] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			offset++
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+// jsonPointer joins segments into an RFC 6901 pointer
+func jsonPointer(segments ...interface{}) string {
+	var b strings.Builder
+	for _, s := range segments {
+		b.WriteByte('/')
+		b.WriteString(pointerEscaper.Replace(fmt.Sprint(s)))
+	}
+	return b.String()
+}
+
+// yamlDoc ties one YAML document to its provenance so parsers can stamp
+// nodes and edges with a YAML path and line number.
+type yamlDoc struct {
+	source string
+	path   string
+	root   *yaml.Node
+}
+
+// provenance returns the provenance of the value addressed by segments, where
+// string segments are mapping keys and int segments are sequence indexes.
+func (d yamlDoc) provenance(segments ...interface{}) Provenance {
+	p := Provenance{Source: d.source, File: d.path, Path: yamlPath(segments...)}
+	if n := yamlLookup(d.root, segments...); n != nil {
+		p.Line = n.Line
+	}
+	return p
+}
+
+// unknownFields returns the sorted top-level mapping keys of the document that
+// are not in known
+func (d yamlDoc) unknownFields(known map[string]bool) []string {
+	n := yamlLookup(d.root)
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	var keys []string
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if !known[n.Content[i].Value] {
+			keys = append(keys, n.Content[i].Value)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// yamlPath renders segments as a YAML path such as "$.rules[0].verbs"
+func yamlPath(segments ...interface{}) string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, s := range segments {
+		switch v := s.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", v)
+		default:
+			fmt.Fprintf(&b, ".%v", v)
+		}
+	}
+	return b.String()
+}
+
+// yamlLookup walks from n along segments, returning nil if any step is missing
+func yamlLookup(n *yaml.Node, segments ...interface{}) *yaml.Node {
+	if n != nil && n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+
+	for _, s := range segments {
+		if n == nil {
+			return nil
+		}
+
+		switch v := s.(type) {
+		case int:
+			if n.Kind != yaml.SequenceNode || v < 0 || v >= len(n.Content) {
+				return nil
+			}
+			n = n.Content[v]
+		case string:
+			if n.Kind != yaml.MappingNode {
+				return nil
+			}
+			var next *yaml.Node
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Value == v {
+					next = n.Content[i+1]
+					break
+				}
+			}
+			n = next
+		default:
+			return nil
+		}
+	}
+
+	return n
+}
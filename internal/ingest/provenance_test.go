@@ -0,0 +1,220 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSONPointerOffset(t *testing.T) {
+	raw := []byte(`{
+  "a": [
+    {"b": 1},
+    {"b": 2}
+  ],
+  "c~/d": true
+}`)
+	lines := newLineTracker(bytes.NewReader(raw))
+	if _, err := io.ReadAll(lines); err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+
+	tests := []struct {
+		pointer string
+		line    int
+		ok      bool
+	}{
+		{"", 1, true},
+		{"/a", 2, true},
+		{"/a/1", 4, true},
+		{"/a/1/b", 4, true},
+		{"/c~0~1d", 6, true},
+		{"/a/5", 0, false},
+		{"/missing", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pointer, func(t *testing.T) {
+			off, ok := jsonPointerOffset(raw, tt.pointer)
+			if ok != tt.ok {
+				t.Fatalf("Expected ok=%t, got %t", tt.ok, ok)
+			}
+			if ok && lines.line(off) != tt.line {
+				t.Errorf("Expected line %d, got %d", tt.line, lines.line(off))
+			}
+		})
+	}
+}
+
+func TestLineTrackerForget(t *testing.T) {
+	lines := newLineTracker(bytes.NewReader([]byte("a\nb\nc\nd\n")))
+	if _, err := io.ReadAll(lines); err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+
+	lines.forget(4)
+	if len(lines.newlines) != 2 {
+		t.Errorf("Expected 2 remembered newlines, got %d", len(lines.newlines))
+	}
+	if got := lines.line(4); got != 3 {
+		t.Errorf("Expected line 3 after forget, got %d", got)
+	}
+	if got := lines.line(7); got != 4 {
+		t.Errorf("Expected line 4, got %d", got)
+	}
+}
+
+func TestJSONFileEachElement(t *testing.T) {
+	raw := `{
+  "skip": {"a": [1, 2, {"b": 3}]},
+  "outer": {
+    "items": [
+      {"n": 1},
+      {"n": 2}
+    ],
+    "other": [9]
+  },
+  "top": null
+}`
+
+	file := newJSONFile(SourceTerraform, "plan.json", bytes.NewReader([]byte(raw)))
+
+	var got []string
+	err := file.eachElement(map[string]elementFunc{
+		"/outer/items": func(i int, elem json.RawMessage, offset int) error {
+			prov := file.provenance(elem, offset, jsonPointer("outer", "items", i), "/n")
+			got = append(got, fmt.Sprintf("%s@%d", prov.Path, prov.Line))
+			return nil
+		},
+		"/top": func(i int, elem json.RawMessage, offset int) error {
+			t.Error("Expected null array to produce no elements")
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("eachElement failed: %v", err)
+	}
+
+	want := []string{"/outer/items/0/n@5", "/outer/items/1/n@6"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestParseAWSProvenance(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	rolesJSON := `[
+  {
+    "RoleName": "A",
+    "Arn": "arn:aws:iam::111111111111:role/A",
+    "AssumeRolePolicyDocument": {"Statement": []}
+  },
+  {
+    "RoleName": "B",
+    "Arn": "arn:aws:iam::111111111111:role/B",
+    "AssumeRolePolicyDocument": {
+      "Statement": [
+        {
+          "Effect": "Allow",
+          "Principal": {"AWS": "arn:aws:iam::111111111111:role/A"},
+          "Action": "sts:AssumeRole"
+        }
+      ]
+    }
+  }
+]`
+
+	for name, content := range map[string]string{
+		"roles.json":       rolesJSON,
+		"policies.json":    `[]`,
+		"attachments.json": `[]`,
+	} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	result, err := ParseAWS(tmpDir)
+	if err != nil {
+		t.Fatalf("ParseAWS failed: %v", err)
+	}
+
+	rolesPath := filepath.Join(tmpDir, "roles.json")
+
+	for _, node := range result.Nodes {
+		if node.ID != "arn:aws:iam::111111111111:role/B" {
+			continue
+		}
+		want := Provenance{Source: SourceAWS, File: rolesPath, Path: "/1", Line: 7}
+		if len(node.Provenance) != 1 || node.Provenance[0] != want {
+			t.Errorf("Expected role provenance %+v, got %+v", want, node.Provenance)
+		}
+	}
+
+	found := false
+	for _, edge := range result.Edges {
+		if edge.Kind != EdgeAssumesRole {
+			continue
+		}
+		found = true
+		want := Provenance{
+			Source: SourceAWS,
+			File:   rolesPath,
+			Path:   "/1/AssumeRolePolicyDocument/Statement/0",
+			Line:   12,
+		}
+		if len(edge.Provenance) != 1 || edge.Provenance[0] != want {
+			t.Errorf("Expected edge provenance %+v, got %+v", want, edge.Provenance)
+		}
+	}
+	if !found {
+		t.Fatal("Expected an ASSUMES_ROLE edge")
+	}
+}
+
+func TestParseK8sProvenance(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	roleYAML := `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: other
+  namespace: default
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: reader
+rules:
+- resources: ["pods"]
+  verbs: ["get"]
+- resources: ["secrets"]
+  verbs: ["list"]
+`
+	path := filepath.Join(tmpDir, "clusterroles.yaml")
+	if err := os.WriteFile(path, []byte(roleYAML), 0644); err != nil {
+		t.Fatalf("Failed to write clusterroles.yaml: %v", err)
+	}
+
+	result, err := ParseK8s(tmpDir)
+	if err != nil {
+		t.Fatalf("ParseK8s failed: %v", err)
+	}
+
+	for _, node := range result.Nodes {
+		if node.ID != "k8s:role:reader#rule1#list#secrets" {
+			continue
+		}
+		want := Provenance{Source: SourceK8s, File: path, Path: "$.rules[1]", Line: 14}
+		if len(node.Provenance) != 1 || node.Provenance[0] != want {
+			t.Errorf("Expected provenance %+v, got %+v", want, node.Provenance)
+		}
+		return
+	}
+	t.Fatal("Expected secrets permission node")
+}
@@ -38,67 +38,101 @@ type TFResourceChange struct {
 	} `json:"change"`
 }
 
+// Arrays of the plan that the parser streams; the rest of the plan is skipped
+var (
+	tfPlannedResourcesPointer = jsonPointer("planned_values", "root_module", "resources")
+	tfResourceChangesPointer  = jsonPointer("resource_changes")
+)
+
 // ParseTerraform parses a Terraform plan JSON file
 func ParseTerraform(path string) (ParseResult, bool, error) {
 	result := ParseResult{}
+	isTF, err := StreamTerraform(path, &result)
+	return result, isTF, err
+}
 
-	data, err := os.ReadFile(path)
+// StreamTerraform parses a Terraform plan JSON file, decoding one resource at
+// a time and sending its nodes, edges and issues to sink. It reports false
+// if the plan file does not exist.
+func StreamTerraform(path string, sink Sink) (bool, error) {
+	f, err := os.Open(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return result, false, nil // Optional file
+			return false, nil // Optional file
 		}
-		return result, false, err
+		return false, err
 	}
+	defer f.Close()
 
-	var plan TerraformPlan
-	if err := json.Unmarshal(data, &plan); err != nil {
-		return result, false, err
-	}
+	file := newJSONFile(SourceTerraform, path, f)
 
-	// Process planned resources (focused on IAM policies)
-	for _, resource := range plan.PlannedValues.RootModule.Resources {
-		if resource.Type == "aws_iam_policy" {
+	err = file.eachElement(map[string]elementFunc{
+		// Process planned resources (focused on IAM policies)
+		tfPlannedResourcesPointer: func(i int, raw json.RawMessage, offset int) error {
+			var resource TFResource
+			if err := json.Unmarshal(raw, &resource); err != nil {
+				return err
+			}
+			if resource.Type != "aws_iam_policy" {
+				return nil
+			}
+
+			prov := file.provenance(raw, offset, tfPlannedResourcesPointer+jsonPointer(i), "/values/policy")
 			if policyStr, ok := resource.Values["policy"].(string); ok {
-				parsed := parseTFPolicy(resource.Address, policyStr)
-				result.Merge(parsed)
+				parseTFPolicy(resource.Address, policyStr, prov, sink)
+			} else {
+				addIssue(sink, IssueDroppedEntity, resource.Address, prov, "policy value is not known at plan time")
+			}
+			return nil
+		},
+
+		// Process resource changes to detect permission expansions
+		tfResourceChangesPointer: func(i int, raw json.RawMessage, offset int) error {
+			var change TFResourceChange
+			if err := json.Unmarshal(raw, &change); err != nil {
+				return err
+			}
+			if change.Type != "aws_iam_policy" || !slices.Contains(change.Change.Actions, "update") {
+				return nil
 			}
-		}
-	}
 
-	// Process resource changes to detect permission expansions
-	for _, change := range plan.ResourceChanges {
-		if change.Type == "aws_iam_policy" && slices.Contains(change.Change.Actions, "update") {
 			beforePolicy, _ := change.Change.Before["policy"].(string)
 			afterPolicy, _ := change.Change.After["policy"].(string)
+			if beforePolicy == "" || afterPolicy == "" {
+				return nil
+			}
 
-			if beforePolicy != "" && afterPolicy != "" {
-				// Simple detection: check if wildcard was added
-				hadWildcard := strings.Contains(beforePolicy, ":*")
-				hasWildcard := strings.Contains(afterPolicy, ":*")
+			// Simple detection: check if wildcard was added
+			hadWildcard := strings.Contains(beforePolicy, ":*")
+			hasWildcard := strings.Contains(afterPolicy, ":*")
 
-				if !hadWildcard && hasWildcard {
-					// Permission expansion detected
-					parsed := parseTFPolicy(change.Address+"#expanded", afterPolicy)
-					result.Merge(parsed)
-				}
+			if !hadWildcard && hasWildcard {
+				// Permission expansion detected
+				prov := file.provenance(raw, offset, tfResourceChangesPointer+jsonPointer(i), "/change/after/policy")
+				parseTFPolicy(change.Address+"#expanded", afterPolicy, prov, sink)
 			}
-		}
+			return nil
+		},
+	})
+	if err != nil {
+		return false, err
 	}
 
-	return result, true, nil
+	return true, nil
 }
 
-func parseTFPolicy(address, policyJSON string) ParseResult {
-	result := ParseResult{}
-
+// parseTFPolicy parses an IAM policy embedded as a JSON string in the plan.
+// Everything it produces shares prov, the location of that string.
+func parseTFPolicy(address, policyJSON string, prov Provenance, sink Sink) {
 	var doc PolicyDocument
 	if err := json.Unmarshal([]byte(policyJSON), &doc); err != nil {
-		return result
+		addIssue(sink, IssueDroppedEntity, address, prov, "policy document could not be parsed: %v", err)
+		return
 	}
 
 	// Create policy node
 	policyID := fmt.Sprintf("tf:%s", address)
-	result.Nodes = append(result.Nodes, Node{
+	sink.AddNode(Node{
 		ID:     policyID,
 		Kind:   KindPolicy,
 		Labels: []string{address, "terraform"},
@@ -106,6 +140,7 @@ func parseTFPolicy(address, policyJSON string) ParseResult {
 			"address": address,
 			"source":  "terraform",
 		},
+		Provenance: []Provenance{prov},
 	})
 
 	// Process statements
@@ -119,7 +154,7 @@ func parseTFPolicy(address, policyJSON string) ParseResult {
 
 		for _, action := range actions {
 			permID := fmt.Sprintf("%s#stmt%d#%s", policyID, i, action)
-			result.Nodes = append(result.Nodes, Node{
+			sink.AddNode(Node{
 				ID:     permID,
 				Kind:   KindPerm,
 				Labels: []string{action},
@@ -127,38 +162,40 @@ func parseTFPolicy(address, policyJSON string) ParseResult {
 					"action":   action,
 					"wildcard": fmt.Sprintf("%t", strings.Contains(action, "*")),
 				},
+				Provenance: []Provenance{prov},
 			})
 
-			result.Edges = append(result.Edges, Edge{
+			sink.AddEdge(Edge{
 				Src:  policyID,
 				Dst:  permID,
 				Kind: EdgeAllowsAction,
 				Props: map[string]string{
 					"statement_index": fmt.Sprintf("%d", i),
 				},
+				Provenance: []Provenance{prov},
 			})
 
 			for _, resource := range resources {
-				result.Nodes = append(result.Nodes, Node{
+				sink.AddNode(Node{
 					ID:     resource,
 					Kind:   KindResource,
 					Labels: []string{resource},
 					Props: map[string]string{
 						"arn": resource,
 					},
+					Provenance: []Provenance{prov},
 				})
 
-				result.Edges = append(result.Edges, Edge{
+				sink.AddEdge(Edge{
 					Src:  permID,
 					Dst:  resource,
 					Kind: EdgeAppliesTo,
 					Props: map[string]string{
 						"action": action,
 					},
+					Provenance: []Provenance{prov},
 				})
 			}
 		}
 	}
-
-	return result
 }
@@ -15,18 +15,20 @@ const (
 
 // Node represents a graph node
 type Node struct {
-	ID     string            `json:"id"`
-	Kind   Kind              `json:"kind"`
-	Labels []string          `json:"labels"`
-	Props  map[string]string `json:"props"`
+	ID         string            `json:"id"`
+	Kind       Kind              `json:"kind"`
+	Labels     []string          `json:"labels"`
+	Props      map[string]string `json:"props"`
+	Provenance []Provenance      `json:"provenance,omitempty"`
 }
 
 // Edge represents a graph edge
 type Edge struct {
-	Src   string            `json:"src"`
-	Dst   string            `json:"dst"`
-	Kind  string            `json:"kind"`
-	Props map[string]string `json:"props"`
+	Src        string            `json:"src"`
+	Dst        string            `json:"dst"`
+	Kind       string            `json:"kind"`
+	Props      map[string]string `json:"props"`
+	Provenance []Provenance      `json:"provenance,omitempty"`
 }
 
 // EdgeKind constants
@@ -38,18 +40,36 @@ const (
 	EdgeAppliesTo          = "APPLIES_TO"
 	EdgeBindsTo            = "BINDS_TO"
 	EdgeInNamespace        = "IN_NAMESPACE"
+	EdgeInAccount          = "IN_ACCOUNT"
+	EdgeCanEscalateTo      = "CAN_ESCALATE_TO"
 )
 
-// ParseResult holds parsed nodes and edges
+// ParseResult holds parsed nodes and edges. Nodes are unique by ID and edges
+// by Key once they have gone through AddNode, AddEdge or Merge.
 type ParseResult struct {
-	Nodes []Node
-	Edges []Edge
+	Nodes     []Node
+	Edges     []Edge
+	Conflicts []Conflict
+	Issues    []Issue
+
+	nodeIndex map[string]int
+	edgeIndex map[string]int
 }
 
-// Merge combines two parse results
+// Merge folds another parse result into this one, deduplicating nodes by ID
+// and edges by Key. Duplicate properties are combined with MergeNode and
+// MergeEdge; any disagreements are appended to Conflicts. Parser issues are
+// carried over unchanged.
 func (pr *ParseResult) Merge(other ParseResult) {
-	pr.Nodes = append(pr.Nodes, other.Nodes...)
-	pr.Edges = append(pr.Edges, other.Edges...)
+	pr.ensureIndex()
+	for _, node := range other.Nodes {
+		pr.AddNode(node)
+	}
+	for _, edge := range other.Edges {
+		pr.AddEdge(edge)
+	}
+	pr.Conflicts = append(pr.Conflicts, other.Conflicts...)
+	pr.Issues = append(pr.Issues, other.Issues...)
 }
 
 // Key returns a unique string key for edge comparison in diffs.
@@ -0,0 +1,182 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// IssueKind classifies a validation issue
+type IssueKind string
+
+const (
+	// IssueDroppedEntity means input data could not be turned into nodes or edges
+	IssueDroppedEntity IssueKind = "DROPPED_ENTITY"
+	// IssueDanglingEdge means an edge references a node that was never produced
+	IssueDanglingEdge IssueKind = "DANGLING_EDGE"
+	// IssueUnknownField means the input contains a field the parser does not recognise
+	IssueUnknownField IssueKind = "UNKNOWN_FIELD"
+	// IssueMergeConflict means two sources disagreed on a property value
+	IssueMergeConflict IssueKind = "MERGE_CONFLICT"
+)
+
+// Issue is a single validation finding produced during ingestion
+type Issue struct {
+	Kind       IssueKind  `json:"kind"`
+	EntityID   string     `json:"entityId,omitempty"`
+	Message    string     `json:"message"`
+	Provenance Provenance `json:"provenance"`
+}
+
+func (i Issue) String() string {
+	s := string(i.Kind)
+	if i.EntityID != "" {
+		s += " " + i.EntityID
+	}
+	s += ": " + i.Message
+	if i.Provenance.Source != "" {
+		s += " (" + i.Provenance.String() + ")"
+	}
+	return s
+}
+
+// Report lists every issue found while ingesting one snapshot
+type Report struct {
+	Issues []Issue `json:"issues"`
+}
+
+// Empty reports whether no issues were found
+func (r Report) Empty() bool {
+	return len(r.Issues) == 0
+}
+
+// Counts returns the number of issues per kind
+func (r Report) Counts() map[IssueKind]int {
+	counts := make(map[IssueKind]int)
+	for _, issue := range r.Issues {
+		counts[issue.Kind]++
+	}
+	return counts
+}
+
+// Summary returns a one-line, deterministic summary such as
+// "3 issues (DANGLING_EDGE=2, DROPPED_ENTITY=1)"
+func (r Report) Summary() string {
+	if r.Empty() {
+		return "no issues"
+	}
+
+	counts := r.Counts()
+	kinds := make([]string, 0, len(counts))
+	for k := range counts {
+		kinds = append(kinds, string(k))
+	}
+	sort.Strings(kinds)
+
+	s := fmt.Sprintf("%d issues (", len(r.Issues))
+	for i, k := range kinds {
+		if i > 0 {
+			s += ", "
+		}
+		s += fmt.Sprintf("%s=%d", k, counts[IssueKind(k)])
+	}
+	return s + ")"
+}
+
+// Validate builds the validation report for pr: issues recorded by the
+// parsers, merge conflicts, and edges whose endpoints are not in pr.Nodes.
+func (pr *ParseResult) Validate() Report {
+	pr.ensureIndex()
+
+	return NewReport(pr.Issues, pr.Conflicts, pr.Edges, func(id string) bool {
+		_, ok := pr.nodeIndex[id]
+		return ok
+	})
+}
+
+// NewReport builds a validation report from parser issues and merge
+// conflicts. Every edge with an endpoint for which hasNode returns false is
+// reported as dangling.
+func NewReport(issues []Issue, conflicts []Conflict, edges []Edge, hasNode func(id string) bool) Report {
+	report := Report{Issues: append([]Issue(nil), issues...)}
+
+	for _, c := range conflicts {
+		issue := Issue{
+			Kind:     IssueMergeConflict,
+			EntityID: c.EntityID,
+			Message:  fmt.Sprintf("%s: kept %q, dropped %q", c.Key, c.Kept, c.Dropped),
+		}
+		if len(c.DroppedFrom) > 0 {
+			issue.Provenance = c.DroppedFrom[0]
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	for _, e := range edges {
+		var missing []string
+		if !hasNode(e.Src) {
+			missing = append(missing, "source "+e.Src)
+		}
+		if !hasNode(e.Dst) {
+			missing = append(missing, "destination "+e.Dst)
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		issue := Issue{
+			Kind:     IssueDanglingEdge,
+			EntityID: e.Key(),
+			Message:  fmt.Sprintf("%s edge references unknown %s", e.Kind, strings.Join(missing, " and ")),
+		}
+		if len(e.Provenance) > 0 {
+			issue.Provenance = e.Provenance[0]
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	return report
+}
+
+// AddIssue records a parser issue on pr
+func (pr *ParseResult) AddIssue(issue Issue) {
+	pr.Issues = append(pr.Issues, issue)
+}
+
+// addIssue formats a parser issue and sends it to sink
+func addIssue(sink Sink, kind IssueKind, entityID string, prov Provenance, format string, args ...interface{}) {
+	sink.AddIssue(Issue{
+		Kind:       kind,
+		EntityID:   entityID,
+		Message:    fmt.Sprintf(format, args...),
+		Provenance: prov,
+	})
+}
+
+// unknownFields returns the sorted top-level keys of the JSON object raw that
+// are not in known.
+func unknownFields(raw json.RawMessage, known map[string]bool) []string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil
+	}
+
+	var keys []string
+	for k := range fields {
+		if !known[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fieldSet builds a lookup set of field names
+func fieldSet(names ...string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, n := range names {
+		set[n] = true
+	}
+	return set
+}
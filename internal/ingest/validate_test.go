@@ -0,0 +1,124 @@
+package ingest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateReportsDroppedAndDangling(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	rolesJSON := `[
+  {
+    "RoleName": "Broken",
+    "Arn": "arn:aws:iam::111111111111:role/Broken",
+    "AssumeRolePolicyDocument": "not-a-document"
+  },
+  {
+    "RoleName": "Trusting",
+    "Arn": "arn:aws:iam::111111111111:role/Trusting",
+    "Surprise": true,
+    "AssumeRolePolicyDocument": {
+      "Statement": [{
+        "Effect": "Allow",
+        "Principal": {"AWS": "arn:aws:iam::111111111111:role/Missing", "Federated": "cognito-identity.amazonaws.com"},
+        "Action": "sts:AssumeRole"
+      }]
+    }
+  }
+]`
+	attachmentsJSON := `[{"RoleName": "Ghost", "AttachedPolicies": []}]`
+
+	for name, content := range map[string]string{
+		"roles.json":       rolesJSON,
+		"policies.json":    `[]`,
+		"attachments.json": attachmentsJSON,
+	} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	result, err := ParseAWS(tmpDir)
+	if err != nil {
+		t.Fatalf("ParseAWS failed: %v", err)
+	}
+
+	report := result.Validate()
+	counts := report.Counts()
+
+	// Broken trust doc, Federated principal, unknown attachment role
+	if counts[IssueDroppedEntity] != 3 {
+		t.Errorf("Expected 3 dropped entities, got %d: %v", counts[IssueDroppedEntity], report.Issues)
+	}
+	// ASSUMES_ROLE from a role that was never ingested
+	if counts[IssueDanglingEdge] != 1 {
+		t.Errorf("Expected 1 dangling edge, got %d: %v", counts[IssueDanglingEdge], report.Issues)
+	}
+	// "Surprise"
+	if counts[IssueUnknownField] != 1 {
+		t.Errorf("Expected 1 unknown field, got %d: %v", counts[IssueUnknownField], report.Issues)
+	}
+
+	for _, issue := range report.Issues {
+		if issue.Provenance.File == "" || issue.Provenance.Line == 0 {
+			t.Errorf("Expected issue to carry file and line, got %+v", issue)
+		}
+	}
+}
+
+func TestValidateK8sUnsupportedKind(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	yamlDocs := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: read
+  namespace: default
+roleRef:
+  kind: Role
+  name: reader
+subjects:
+- kind: User
+  name: alice
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "rolebindings.yaml"), []byte(yamlDocs), 0644); err != nil {
+		t.Fatalf("Failed to write rolebindings.yaml: %v", err)
+	}
+
+	result, err := ParseK8s(tmpDir)
+	if err != nil {
+		t.Fatalf("ParseK8s failed: %v", err)
+	}
+
+	counts := result.Validate().Counts()
+	if counts[IssueDroppedEntity] != 1 {
+		t.Errorf("Expected Deployment to be reported as dropped, got %v", counts)
+	}
+	if counts[IssueDanglingEdge] != 1 {
+		t.Errorf("Expected binding to missing role and user to be dangling, got %v", counts)
+	}
+}
+
+func TestReportSummary(t *testing.T) {
+	report := Report{Issues: []Issue{
+		{Kind: IssueDanglingEdge},
+		{Kind: IssueDroppedEntity},
+		{Kind: IssueDanglingEdge},
+	}}
+
+	want := "3 issues (DANGLING_EDGE=2, DROPPED_ENTITY=1)"
+	if got := report.Summary(); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	if (Report{}).Summary() != "no issues" {
+		t.Error("Expected empty report summary to be 'no issues'")
+	}
+}
@@ -16,6 +16,7 @@ func BuildInput(g *graph.Graph) map[string]interface{} {
 		"k8s": map[string]interface{}{
 			"bindings": map[string]interface{}{},
 		},
+		"escalations": map[string]interface{}{},
 	}
 
 	nodes := g.GetNodes()
@@ -116,5 +117,19 @@ func BuildInput(g *graph.Graph) map[string]interface{} {
 		}
 	}
 
+	// Build escalations map, keyed by principal|target|technique
+	escalations := input["escalations"].(map[string]interface{})
+	for _, esc := range g.FindEscalations() {
+		key := strings.Join([]string{esc.Principal, esc.Target, esc.Technique.ID}, "|")
+		escalations[key] = map[string]interface{}{
+			"principal":      esc.Principal,
+			"target":         esc.Target,
+			"technique":      esc.Technique.ID,
+			"technique_name": esc.Technique.Name,
+			"actions":        esc.Technique.Actions,
+			"self":           esc.Principal == esc.Target,
+		}
+	}
+
 	return input
 }
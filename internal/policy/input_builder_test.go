@@ -158,3 +158,51 @@ func TestBuildInput(t *testing.T) {
 		t.Error("Expected cluster_admin to be true")
 	}
 }
+
+func TestBuildInputEscalations(t *testing.T) {
+	g := graph.New()
+
+	const (
+		dev   = "arn:aws:iam::111111111111:user/dev"
+		admin = "arn:aws:iam::111111111111:role/Admin"
+	)
+
+	for _, n := range []ingest.Node{
+		{ID: dev, Kind: ingest.KindPrincipal},
+		{ID: admin, Kind: ingest.KindPrincipal},
+		{ID: "policy/Launch", Kind: ingest.KindPolicy},
+		{ID: "launch#iam:PassRole", Kind: ingest.KindPerm, Props: map[string]string{"action": "iam:PassRole"}},
+		{ID: "launch#ec2:RunInstances", Kind: ingest.KindPerm, Props: map[string]string{"action": "ec2:RunInstances"}},
+		{ID: "arn:aws:iam::111111111111:role/*", Kind: ingest.KindResource},
+		{ID: "*", Kind: ingest.KindResource},
+	} {
+		g.AddNode(n)
+	}
+
+	for _, e := range []ingest.Edge{
+		{Src: dev, Dst: "policy/Launch", Kind: ingest.EdgeAttachedPolicy},
+		{Src: "policy/Launch", Dst: "launch#iam:PassRole", Kind: ingest.EdgeAllowsAction},
+		{Src: "policy/Launch", Dst: "launch#ec2:RunInstances", Kind: ingest.EdgeAllowsAction},
+		{Src: "launch#iam:PassRole", Dst: "arn:aws:iam::111111111111:role/*", Kind: ingest.EdgeAppliesTo},
+		{Src: "launch#ec2:RunInstances", Dst: "*", Kind: ingest.EdgeAppliesTo},
+	} {
+		if err := g.AddEdge(e); err != nil {
+			t.Fatalf("Failed to add edge: %v", err)
+		}
+	}
+
+	input := BuildInput(g)
+
+	escalations, ok := input["escalations"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected escalations in input")
+	}
+
+	esc, ok := escalations[dev+"|"+admin+"|passrole-ec2"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected passrole-ec2 escalation, got %v", escalations)
+	}
+	if esc["principal"] != dev || esc["target"] != admin || esc["self"] != false {
+		t.Errorf("Unexpected escalation %v", esc)
+	}
+}
@@ -75,38 +75,35 @@ func (r *Recommender) Recommend(policyID string, targetID string, tags []string,
 		targets = r.findAllResources()
 	}
 
-	// Analyze paths from each principal to targets
-	for _, principalID := range principals {
-		for _, targetResID := range targets {
-			// Find path
-			nodes, edges, err := r.g.ShortestPath(principalID, targetResID, 8)
-			if err != nil {
-				continue
-			}
+	// Analyze paths from each principal to targets, one traversal per principal
+	pairs, err := r.g.ShortestPaths(principals, targets, 8, graph.EdgeFilter{})
+	if err != nil {
+		return nil, fmt.Errorf("finding paths: %w", err)
+	}
 
-			// Check if path includes the policy
-			includesPolicy := false
-			for _, node := range nodes {
-				if node.ID == policyID {
-					includesPolicy = true
-					break
-				}
+	for _, pair := range pairs {
+		// Check if path includes the policy
+		includesPolicy := false
+		for _, node := range pair.Nodes {
+			if node.ID == policyID {
+				includesPolicy = true
+				break
 			}
+		}
 
-			if !includesPolicy {
-				continue
-			}
+		if !includesPolicy {
+			continue
+		}
 
-			// Extract actions and resources from path
-			for _, edge := range edges {
-				if action, ok := edge.Props["action"]; ok {
-					actions[action] = true
-				}
+		// Extract actions and resources from path
+		for _, edge := range pair.Edges {
+			if action, ok := edge.Props["action"]; ok {
+				actions[action] = true
 			}
-
-			// Add the target resource
-			resources[targetResID] = true
 		}
+
+		// Add the target resource
+		resources[pair.To] = true
 	}
 
 	// Convert to sorted slices
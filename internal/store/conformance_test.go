@@ -0,0 +1,436 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jamesolaitan/accessgraph/internal/graph"
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+// postgresURLEnv names a PostgreSQL server to run the conformance tests
+// against as well as SQLite, such as the container make test-postgres starts
+const postgresURLEnv = "ACCESSGRAPH_TEST_POSTGRES_URL"
+
+var schemaCounter atomic.Int64
+
+// forEachBackend runs fn on a fresh store for every backend: SQLite, and
+// PostgreSQL if postgresURLEnv is set, in a schema of its own that is dropped
+// afterwards
+func forEachBackend(t *testing.T, fn func(t *testing.T, s *Store)) {
+	t.Run("sqlite", func(t *testing.T) {
+		s, err := New(t.TempDir() + "/test.db")
+		if err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+		defer s.Close()
+		fn(t, s)
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		base := os.Getenv(postgresURLEnv)
+		if base == "" {
+			t.Skipf("%s not set", postgresURLEnv)
+		}
+
+		admin, err := sql.Open("pgx", base)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer admin.Close()
+
+		schema := fmt.Sprintf("conformance_%d_%d", os.Getpid(), schemaCounter.Add(1))
+		if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+			t.Fatalf("Failed to create schema: %v", err)
+		}
+		defer func() { _, _ = admin.Exec("DROP SCHEMA " + schema + " CASCADE") }()
+
+		u, err := url.Parse(base)
+		if err != nil {
+			t.Fatalf("Invalid %s: %v", postgresURLEnv, err)
+		}
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+
+		s, err := New(u.String())
+		if err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+		defer s.Close()
+		fn(t, s)
+	})
+}
+
+// conformanceGraph returns a small graph with every field set
+func conformanceGraph(t *testing.T) *graph.Graph {
+	g := graph.New()
+	prov := []ingest.Provenance{{Source: ingest.SourceAWS, File: "users.json", Path: "/0", Line: 3}}
+	g.AddNode(ingest.Node{ID: "arn:aws:iam::1:user/Alice", Kind: ingest.KindPrincipal, Labels: []string{"aws-user"}, Props: map[string]string{"name": "Alice"}, Provenance: prov})
+	g.AddNode(ingest.Node{ID: "arn:aws:iam::1:role/admin", Kind: ingest.KindPrincipal, Labels: []string{"aws-role"}})
+	g.AddNode(ingest.Node{ID: "arn:aws:iam::1:policy/p", Kind: ingest.KindPolicy})
+	g.AddNode(ingest.Node{ID: "arn:aws:s3:::bucket", Kind: ingest.KindResource, Props: map[string]string{"sensitive": "true"}})
+	for _, e := range []ingest.Edge{
+		{Src: "arn:aws:iam::1:user/Alice", Dst: "arn:aws:iam::1:role/admin", Kind: ingest.EdgeAssumesRole, Provenance: prov},
+		{Src: "arn:aws:iam::1:role/admin", Dst: "arn:aws:iam::1:policy/p", Kind: ingest.EdgeAttachedPolicy},
+		{Src: "arn:aws:iam::1:policy/p", Dst: "arn:aws:s3:::bucket", Kind: ingest.EdgeAppliesTo, Props: map[string]string{"action": "s3:GetObject"}},
+	} {
+		if err := g.AddEdge(e); err != nil {
+			t.Fatalf("Failed to add edge: %v", err)
+		}
+	}
+	return g
+}
+
+func TestConformanceRoundTrip(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		g := conformanceGraph(t)
+
+		if err := s.SaveSnapshot(ctx, "snap", "label", g); err != nil {
+			t.Fatalf("Failed to save: %v", err)
+		}
+
+		snap, err := s.GetSnapshot(ctx, "snap")
+		if err != nil || snap.Label != "label" || time.Since(snap.CreatedAt) > time.Hour {
+			t.Errorf("Expected snapshot metadata, got %+v, %v", snap, err)
+		}
+		if _, err := s.GetSnapshot(ctx, "missing"); err == nil {
+			t.Error("Expected an error for a missing snapshot")
+		}
+
+		loaded, err := s.LoadSnapshot(ctx, "snap")
+		if err != nil {
+			t.Fatalf("Failed to load: %v", err)
+		}
+		for _, want := range g.GetNodes() {
+			got, ok := loaded.GetNode(want.ID)
+			if !ok || !reflect.DeepEqual(got, want) {
+				t.Errorf("Expected node %+v, got %+v", want, got)
+			}
+		}
+
+		// Edges come back sorted byte-wise by key, so upper case sorts first
+		edges, err := s.GetEdges(ctx, "snap")
+		if err != nil {
+			t.Fatalf("Failed to get edges: %v", err)
+		}
+		var srcs []string
+		for _, e := range edges {
+			srcs = append(srcs, e.Src)
+		}
+		if want := []string{"arn:aws:iam::1:policy/p", "arn:aws:iam::1:role/admin", "arn:aws:iam::1:user/Alice"}; !reflect.DeepEqual(srcs, want) {
+			t.Errorf("Expected edges from %v, got %v", want, srcs)
+		}
+		if edges[0].Props["action"] != "s3:GetObject" {
+			t.Errorf("Expected edge props to round-trip, got %v", edges[0].Props)
+		}
+
+		if n, err := s.CountNodes(ctx, "snap"); err != nil || n != 4 {
+			t.Errorf("Expected 4 nodes, got %d, %v", n, err)
+		}
+		if n, err := s.CountEdges(ctx, "snap"); err != nil || n != 3 {
+			t.Errorf("Expected 3 edges, got %d, %v", n, err)
+		}
+
+		// Search is case-insensitive and only returns principals
+		found, err := s.SearchPrincipals(ctx, "snap", "alice", 10)
+		if err != nil || len(found) != 1 || found[0].ID != "arn:aws:iam::1:user/Alice" {
+			t.Errorf("Expected to find Alice, got %v, %v", found, err)
+		}
+		if found, _ := s.SearchPrincipals(ctx, "snap", "bucket", 10); len(found) != 0 {
+			t.Errorf("Expected no principals named bucket, got %v", found)
+		}
+
+		if _, err := s.GetNode(ctx, "snap", "missing"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("Expected sql.ErrNoRows for a missing node, got %v", err)
+		}
+	})
+}
+
+func TestConformanceSnapshotWriter(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+
+		w, err := s.BeginSnapshot(ctx, "snap", "snap")
+		if err != nil {
+			t.Fatalf("Failed to begin snapshot: %v", err)
+		}
+		defer func() { _ = w.Rollback() }()
+
+		// Edges before their nodes, duplicates on both sides of a batch, and
+		// edges whose endpoints never arrive
+		add := func(e ingest.Edge) {
+			if err := w.AddEdge(e); err != nil {
+				t.Fatalf("Failed to add edge: %v", err)
+			}
+		}
+		add(ingest.Edge{Src: "n0", Dst: "n1", Kind: ingest.EdgeAssumesRole})
+		add(ingest.Edge{Src: "ghost", Dst: "n1", Kind: ingest.EdgeAssumesRole})
+		for i := 0; i < writeBatch+5; i++ {
+			if err := w.AddNode(ingest.Node{ID: fmt.Sprintf("n%d", i), Kind: ingest.KindPrincipal}); err != nil {
+				t.Fatalf("Failed to add node: %v", err)
+			}
+		}
+		for _, id := range []string{"n0", fmt.Sprintf("n%d", writeBatch+4)} {
+			if err := w.AddNode(ingest.Node{ID: id, Kind: ingest.KindRole, Labels: []string{"dup"}}); err != nil {
+				t.Fatalf("Failed to add node: %v", err)
+			}
+		}
+		add(ingest.Edge{Src: "n1", Dst: "nowhere", Kind: ingest.EdgeAssumesRole})
+
+		if len(w.Conflicts()) != 2 {
+			t.Errorf("Expected kind conflicts for both duplicates, got %v", w.Conflicts())
+		}
+
+		dangling, err := w.DropDanglingEdges()
+		if err != nil {
+			t.Fatalf("Failed to drop dangling edges: %v", err)
+		}
+		if len(dangling) != 2 || dangling[0].Src != "ghost" || dangling[1].Dst != "nowhere" {
+			t.Errorf("Expected the two dangling edges in the order added, got %v", dangling)
+		}
+		if err := w.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+
+		for _, id := range []string{"n0", fmt.Sprintf("n%d", writeBatch+4)} {
+			node, err := s.GetNode(ctx, "snap", id)
+			if err != nil || len(node.Labels) != 1 || node.Labels[0] != "dup" {
+				t.Errorf("Expected %s to be merged, got %+v, %v", id, node, err)
+			}
+		}
+		if n, _ := s.CountEdges(ctx, "snap"); n != 1 {
+			t.Errorf("Expected 1 edge, got %d", n)
+		}
+	})
+}
+
+func TestConformanceForeignKeys(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+
+		w, err := s.BeginSnapshot(ctx, "snap", "snap")
+		if err != nil {
+			t.Fatalf("Failed to begin snapshot: %v", err)
+		}
+		if err := w.AddEdge(ingest.Edge{Src: "a", Dst: "b", Kind: ingest.EdgeAssumesRole}); err != nil {
+			t.Fatalf("Failed to add edge: %v", err)
+		}
+		if err := w.Commit(); err == nil {
+			t.Error("Expected a commit with dangling edges to fail")
+		}
+		_ = w.Rollback()
+
+		if _, err := s.GetSnapshot(ctx, "snap"); err == nil {
+			t.Error("Expected the failed snapshot to be rolled back")
+		}
+		if err := s.SaveReport(ctx, "missing", ingest.Report{Issues: []ingest.Issue{{Kind: ingest.IssueDanglingEdge}}}); err == nil {
+			t.Error("Expected a report for a missing snapshot to fail")
+		}
+	})
+}
+
+func TestConformanceReports(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+
+		if err := s.SaveSnapshot(ctx, "snap", "snap", conformanceGraph(t)); err != nil {
+			t.Fatalf("Failed to save: %v", err)
+		}
+
+		var issues []ingest.Issue
+		for _, id := range []string{"z", "a", "m"} {
+			issues = append(issues, ingest.Issue{Kind: ingest.IssueDanglingEdge, EntityID: id, Message: "m", Provenance: ingest.Provenance{Source: ingest.SourceK8s, File: "f.yaml"}})
+		}
+		for _, report := range []ingest.Report{{Issues: issues[:1]}, {Issues: issues}} {
+			if err := s.SaveReport(ctx, "snap", report); err != nil {
+				t.Fatalf("Failed to save report: %v", err)
+			}
+		}
+
+		got, err := s.GetReport(ctx, "snap")
+		if err != nil {
+			t.Fatalf("Failed to get report: %v", err)
+		}
+		if !reflect.DeepEqual(got.Issues, issues) {
+			t.Errorf("Expected the last report in the order saved, got %+v", got.Issues)
+		}
+	})
+}
+
+func TestConformanceWriterReport(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+
+		// replace rewrites snap with one node and a report of one issue about
+		// entity, committing or rolling back both together
+		replace := func(entity string, commit bool) {
+			w, err := s.ReplaceSnapshot(ctx, "snap", entity)
+			if err != nil {
+				t.Fatalf("Failed to replace: %v", err)
+			}
+			defer func() { _ = w.Rollback() }()
+			if err := w.AddNode(ingest.Node{ID: "alice", Kind: ingest.KindPrincipal}); err != nil {
+				t.Fatalf("Failed to add node: %v", err)
+			}
+			report := ingest.Report{Issues: []ingest.Issue{{Kind: ingest.IssueDanglingEdge, EntityID: entity, Message: "m"}}}
+			if err := w.SaveReport(report); err != nil {
+				t.Fatalf("Failed to save report: %v", err)
+			}
+			if commit {
+				if err := w.Commit(); err != nil {
+					t.Fatalf("Failed to commit: %v", err)
+				}
+			}
+		}
+		entities := func() string {
+			report, err := s.GetReport(ctx, "snap")
+			if err != nil {
+				t.Fatalf("Failed to get report: %v", err)
+			}
+			var ids []string
+			for _, issue := range report.Issues {
+				ids = append(ids, issue.EntityID)
+			}
+			return strings.Join(ids, ",")
+		}
+
+		replace("first", true)
+		if got := entities(); got != "first" {
+			t.Errorf("Expected the committed report, got %q", got)
+		}
+		replace("second", false)
+		if got := entities(); got != "first" {
+			t.Errorf("Expected a rolled back replacement to keep the report, got %q", got)
+		}
+		replace("third", true)
+		if got := entities(); got != "third" {
+			t.Errorf("Expected the report to be replaced with the snapshot, got %q", got)
+		}
+	})
+}
+
+func TestConformanceLifecycle(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+
+		for _, id := range []string{"day1", "day2", "day3"} {
+			if err := s.SaveSnapshot(ctx, id, id, lifecycleGraph(t, "bucket-"+id)); err != nil {
+				t.Fatalf("Failed to save %s: %v", id, err)
+			}
+		}
+		if err := s.SaveSnapshot(ctx, "day1", "again", lifecycleGraph(t, "x")); !errors.Is(err, ErrSnapshotExists) {
+			t.Errorf("Expected ErrSnapshotExists, got %v", err)
+		}
+
+		before, err := s.GetSnapshot(ctx, "day1")
+		if err != nil {
+			t.Fatalf("Failed to get snapshot: %v", err)
+		}
+		w, err := s.ReplaceSnapshot(ctx, "day1", "replaced")
+		if err != nil {
+			t.Fatalf("Failed to replace: %v", err)
+		}
+		if err := w.AddNode(ingest.Node{ID: "alice", Kind: ingest.KindPrincipal}); err != nil {
+			t.Fatalf("Failed to add node: %v", err)
+		}
+		if err := w.Commit(); err != nil {
+			t.Fatalf("Failed to commit replacement: %v", err)
+		}
+		if n, _ := s.CountNodes(ctx, "day1"); n != 1 {
+			t.Errorf("Expected the replacement to hold 1 node, got %d", n)
+		}
+		// Readers that cache a snapshot tell a replacement by its time, even
+		// within the second the original was saved in
+		if after, err := s.GetSnapshot(ctx, "day1"); err != nil || !after.CreatedAt.After(before.CreatedAt) {
+			t.Errorf("Expected the replacement to be created after %v, got %v, %v", before.CreatedAt, after, err)
+		}
+
+		if err := s.UpdateLabel(ctx, "day2", "kept"); err != nil {
+			t.Fatalf("Failed to update label: %v", err)
+		}
+		if err := s.UpdateLabel(ctx, "missing", "x"); !errors.Is(err, ErrSnapshotNotFound) {
+			t.Errorf("Expected ErrSnapshotNotFound, got %v", err)
+		}
+
+		if err := s.DeleteSnapshot(ctx, "day3"); err != nil {
+			t.Fatalf("Failed to delete: %v", err)
+		}
+		if err := s.DeleteSnapshot(ctx, "day3"); !errors.Is(err, ErrSnapshotNotFound) {
+			t.Errorf("Expected ErrSnapshotNotFound, got %v", err)
+		}
+
+		// day1's replacement keeps alice; day2 keeps its graph
+		if n := countRows(t, s, "node_data"); n != 3 {
+			t.Errorf("Expected 3 node contents, got %d", n)
+		}
+		if n := countRows(t, s, "edge_data"); n != 2 {
+			t.Errorf("Expected 2 edge contents, got %d", n)
+		}
+
+		expired, err := s.PruneSnapshots(ctx, RetentionPolicy{KeepLast: 1}, false)
+		if err != nil || len(expired) != 1 {
+			t.Fatalf("Expected 1 snapshot pruned, got %v, %v", expired, err)
+		}
+		if err := s.Vacuum(ctx); err != nil {
+			t.Fatalf("Failed to vacuum: %v", err)
+		}
+		snaps, err := s.ListSnapshots(ctx)
+		if err != nil || len(snaps) != 1 {
+			t.Errorf("Expected 1 snapshot left, got %v, %v", snaps, err)
+		}
+	})
+}
+
+func TestConformanceSchema(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+
+		status, err := s.SchemaStatus(ctx)
+		if err != nil {
+			t.Fatalf("Failed to get schema status: %v", err)
+		}
+		if status.Version != s.LatestVersion() || status.Version == 0 || len(status.Pending) != 0 {
+			t.Errorf("Expected a fully migrated schema, got %+v", status)
+		}
+		if applied, err := s.Migrate(ctx); err != nil || len(applied) != 0 {
+			t.Errorf("Expected migrating again to do nothing, got %v, %v", applied, err)
+		}
+	})
+}
+
+func TestRebind(t *testing.T) {
+	query := "SELECT a FROM t WHERE b = ? AND c IN (?, ?)"
+	if got := sqliteDialect.rebind(query); got != query {
+		t.Errorf("Expected SQLite queries unchanged, got %s", got)
+	}
+	if got, want := postgresDialect.rebind(query), "SELECT a FROM t WHERE b = $1 AND c IN ($2, $3)"; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	if got := postgresDialect.insert("t (a)", "(?)", true); !strings.HasSuffix(got, "ON CONFLICT DO NOTHING") {
+		t.Errorf("Expected an upsert that ignores conflicts, got %s", got)
+	}
+	if got := sqliteDialect.insert("t (a)", "(?)", true); !strings.HasPrefix(got, "INSERT OR IGNORE") {
+		t.Errorf("Expected INSERT OR IGNORE, got %s", got)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	if got := Describe("/data/graph.db"); got != "/data/graph.db" {
+		t.Errorf("Expected a SQLite path unchanged, got %s", got)
+	}
+	if got := Describe("postgres://ag:secret@db:5432/ag"); strings.Contains(got, "secret") {
+		t.Errorf("Expected the password to be redacted, got %s", got)
+	}
+}
@@ -0,0 +1,155 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// dialect holds what differs between the databases the store runs on.
+// Queries are written for SQLite with ? placeholders, and rebound for
+// databases that number them.
+type dialect struct {
+	// name is also the directory of the dialect's migrations
+	name string
+	open func(dsn string) (*sql.DB, error)
+	// numbered databases take $1, $2, ... placeholders
+	numbered bool
+	// seq is the column that orders snapshot_edges and validation_issues rows
+	// by insertion
+	seq string
+	// like matches case-insensitively, as SQLite's LIKE does for ASCII
+	like string
+	// tableCount counts the tables named ?
+	tableCount string
+	// adoptUnversioned is set for databases that predate schema_version
+	adoptUnversioned bool
+	// hooks holds the Go parts of migrations by version
+	hooks map[int]func(ctx context.Context, tx *dbTx) error
+	// vacuum lists the statements that reclaim the space of deleted rows
+	vacuum []string
+	// migrationLock, if set, is run at the start of each migration to keep
+	// processes that share the database from applying it twice
+	migrationLock string
+}
+
+var sqliteDialect = &dialect{
+	name:             "sqlite",
+	open:             func(dsn string) (*sql.DB, error) { return sql.Open("sqlite", withPragmas(dsn)) },
+	seq:              "rowid",
+	like:             "LIKE",
+	tableCount:       "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?",
+	adoptUnversioned: true,
+	hooks: map[int]func(ctx context.Context, tx *dbTx) error{
+		3: upgradeSQLiteContents,
+	},
+	// The log is checkpointed first, since VACUUM cannot shrink what it
+	// still holds
+	vacuum: []string{"PRAGMA wal_checkpoint(TRUNCATE)", "VACUUM"},
+}
+
+// dialectFor returns the dialect of a data source: PostgreSQL for a
+// postgres:// or postgresql:// URL, otherwise SQLite for a file path
+func dialectFor(dsn string) *dialect {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return postgresDialect
+	}
+	return sqliteDialect
+}
+
+// Describe returns a data source for logging, with any password redacted
+func Describe(dsn string) string {
+	if dialectFor(dsn) == sqliteDialect {
+		return dsn
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "postgres://<invalid URL>"
+	}
+	return u.Redacted()
+}
+
+// rebind rewrites the ? placeholders of query for the dialect. Queries must
+// not contain ? in literals.
+func (d *dialect) rebind(query string) string {
+	if !d.numbered || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + len(query)/4)
+	n := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] != '?' {
+			b.WriteByte(query[i])
+			continue
+		}
+		n++
+		b.WriteByte('$')
+		b.WriteString(strconv.Itoa(n))
+	}
+	return b.String()
+}
+
+// insert returns an INSERT of values into table, which is a table name with
+// its column list. With ignore, rows whose key already exists are skipped.
+func (d *dialect) insert(table, values string, ignore bool) string {
+	switch {
+	case !ignore:
+		return "INSERT INTO " + table + " VALUES " + values
+	case d.numbered:
+		return "INSERT INTO " + table + " VALUES " + values + " ON CONFLICT DO NOTHING"
+	default:
+		return "INSERT OR IGNORE INTO " + table + " VALUES " + values
+	}
+}
+
+// dbConn is a database whose queries are rebound for its dialect
+type dbConn struct {
+	*sql.DB
+	dialect *dialect
+}
+
+func (c *dbConn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return c.DB.ExecContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c *dbConn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return c.DB.QueryContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c *dbConn) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return c.DB.QueryRowContext(ctx, c.dialect.rebind(query), args...)
+}
+
+func (c *dbConn) BeginTx(ctx context.Context, opts *sql.TxOptions) (*dbTx, error) {
+	tx, err := c.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &dbTx{Tx: tx, dialect: c.dialect}, nil
+}
+
+// dbTx is a transaction whose queries are rebound for its dialect
+type dbTx struct {
+	*sql.Tx
+	dialect *dialect
+}
+
+func (t *dbTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return t.Tx.ExecContext(ctx, t.dialect.rebind(query), args...)
+}
+
+func (t *dbTx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return t.Tx.QueryContext(ctx, t.dialect.rebind(query), args...)
+}
+
+func (t *dbTx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return t.Tx.QueryRowContext(ctx, t.dialect.rebind(query), args...)
+}
+
+func (t *dbTx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return t.Tx.PrepareContext(ctx, t.dialect.rebind(query))
+}
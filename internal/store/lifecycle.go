@@ -0,0 +1,168 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrSnapshotNotFound is returned when a snapshot ID has not been saved
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// ErrSnapshotExists is returned by BeginSnapshot when a snapshot ID has
+// already been saved. ReplaceSnapshot overwrites it instead.
+var ErrSnapshotExists = errors.New("snapshot already exists")
+
+// RetentionPolicy decides which snapshots PruneSnapshots keeps. A snapshot
+// is kept if any rule keeps it; a zero rule keeps nothing.
+type RetentionPolicy struct {
+	// KeepLast keeps the most recent snapshots
+	KeepLast int
+	// KeepDailyDays keeps the most recent snapshot of each of the last
+	// KeepDailyDays UTC days, counting today
+	KeepDailyDays int
+}
+
+// Expired returns the snapshots the policy does not keep at now, most recent
+// first
+func (p RetentionPolicy) Expired(snapshots []Snapshot, now time.Time) []Snapshot {
+	sorted := append([]Snapshot(nil), snapshots...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].CreatedAt.Equal(sorted[j].CreatedAt) {
+			return sorted[i].CreatedAt.After(sorted[j].CreatedAt)
+		}
+		return sorted[i].ID > sorted[j].ID
+	})
+
+	today := now.UTC().Truncate(24 * time.Hour)
+	oldestDay := today.AddDate(0, 0, -p.KeepDailyDays+1)
+	days := make(map[string]bool)
+
+	var expired []Snapshot
+	for i, snap := range sorted {
+		keep := i < p.KeepLast
+
+		created := snap.CreatedAt.UTC()
+		if day := created.Format("2006-01-02"); p.KeepDailyDays > 0 && !created.Before(oldestDay) && !days[day] {
+			days[day] = true
+			keep = true
+		}
+
+		if !keep {
+			expired = append(expired, snap)
+		}
+	}
+	return expired
+}
+
+// DeleteSnapshot deletes a snapshot with its validation report, and the
+// node and edge contents no other snapshot shares. It fails with
+// ErrSnapshotNotFound if id has not been saved.
+func (s *Store) DeleteSnapshot(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := deleteSnapshot(ctx, tx, id); err != nil {
+		return err
+	}
+	if err := collectOrphans(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateLabel changes the label of a snapshot. It fails with
+// ErrSnapshotNotFound if id has not been saved.
+func (s *Store) UpdateLabel(ctx context.Context, id, label string) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE snapshots SET label = ? WHERE id = ?", label, id)
+	if err != nil {
+		return fmt.Errorf("updating label: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("%w: %s", ErrSnapshotNotFound, id)
+	}
+	return nil
+}
+
+// PruneSnapshots deletes the snapshots policy does not keep, in one
+// transaction, and returns them. With dryRun nothing is deleted. A policy
+// that keeps nothing is refused rather than emptying the store.
+func (s *Store) PruneSnapshots(ctx context.Context, policy RetentionPolicy, dryRun bool) ([]Snapshot, error) {
+	if policy.KeepLast <= 0 && policy.KeepDailyDays <= 0 {
+		return nil, errors.New("retention policy keeps no snapshots")
+	}
+
+	snapshots, err := s.ListSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	expired := policy.Expired(snapshots, time.Now())
+	if dryRun || len(expired) == 0 {
+		return expired, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, snap := range expired {
+		if err := deleteSnapshot(ctx, tx, snap.ID); err != nil {
+			return nil, err
+		}
+	}
+	if err := collectOrphans(ctx, tx); err != nil {
+		return nil, err
+	}
+	return expired, tx.Commit()
+}
+
+// Vacuum reclaims the space of deleted snapshots. SQLite returns it to the
+// file system, needing as much free disk as the database takes while it
+// runs; PostgreSQL makes it reusable for new rows.
+func (s *Store) Vacuum(ctx context.Context) error {
+	for _, stmt := range s.db.dialect.vacuum {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("vacuuming: %w", err)
+		}
+	}
+	return nil
+}
+
+// deleteSnapshot deletes a snapshot row, which cascades to its memberships
+// and validation issues
+func deleteSnapshot(ctx context.Context, tx *dbTx, id string) error {
+	res, err := tx.ExecContext(ctx, "DELETE FROM snapshots WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("deleting snapshot %s: %w", id, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("%w: %s", ErrSnapshotNotFound, id)
+	}
+	return nil
+}
+
+// collectOrphans deletes the node and edge contents no snapshot references
+func collectOrphans(ctx context.Context, tx *dbTx) error {
+	if _, err := tx.ExecContext(ctx,
+		"DELETE FROM edge_data WHERE NOT EXISTS (SELECT 1 FROM snapshot_edges s WHERE s.hash = edge_data.hash)",
+	); err != nil {
+		return fmt.Errorf("collecting edge contents: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		"DELETE FROM node_data WHERE NOT EXISTS (SELECT 1 FROM snapshot_nodes s WHERE s.hash = node_data.hash)",
+	); err != nil {
+		return fmt.Errorf("collecting node contents: %w", err)
+	}
+	return nil
+}
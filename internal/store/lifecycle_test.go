@@ -0,0 +1,253 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jamesolaitan/accessgraph/internal/graph"
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+// lifecycleGraph returns a graph of a principal that shares its policy with
+// every other snapshot and owns a bucket named after the snapshot
+func lifecycleGraph(t *testing.T, bucket string) *graph.Graph {
+	g := graph.New()
+	g.AddNode(ingest.Node{ID: "alice", Kind: ingest.KindPrincipal})
+	g.AddNode(ingest.Node{ID: "policy", Kind: ingest.KindPolicy})
+	g.AddNode(ingest.Node{ID: bucket, Kind: ingest.KindResource})
+	for _, e := range []ingest.Edge{
+		{Src: "alice", Dst: "policy", Kind: ingest.EdgeAttachedPolicy},
+		{Src: "policy", Dst: bucket, Kind: ingest.EdgeAppliesTo},
+	} {
+		if err := g.AddEdge(e); err != nil {
+			t.Fatalf("Failed to add edge: %v", err)
+		}
+	}
+	return g
+}
+
+func countRows(t *testing.T, s *Store, table string) int {
+	var n int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+		t.Fatalf("Failed to count %s: %v", table, err)
+	}
+	return n
+}
+
+func TestDeleteSnapshot(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	for _, id := range []string{"day1", "day2"} {
+		if err := store.SaveSnapshot(ctx, id, id, lifecycleGraph(t, "bucket-"+id)); err != nil {
+			t.Fatalf("Failed to save %s: %v", id, err)
+		}
+	}
+	report := ingest.Report{Issues: []ingest.Issue{{Kind: ingest.IssueDanglingEdge, EntityID: "x", Message: "m"}}}
+	if err := store.SaveReport(ctx, "day1", report); err != nil {
+		t.Fatalf("Failed to save report: %v", err)
+	}
+
+	if err := store.DeleteSnapshot(ctx, "day1"); err != nil {
+		t.Fatalf("Failed to delete snapshot: %v", err)
+	}
+
+	if _, err := store.GetSnapshot(ctx, "day1"); err == nil {
+		t.Error("Expected deleted snapshot to be gone")
+	}
+	if n := countRows(t, store, "validation_issues"); n != 0 {
+		t.Errorf("Expected the report to be deleted, got %d issues", n)
+	}
+
+	// Shared contents stay for day2; the bucket and its edge only day1 used go
+	if n := countRows(t, store, "node_data"); n != 3 {
+		t.Errorf("Expected 3 node contents left, got %d", n)
+	}
+	if n := countRows(t, store, "edge_data"); n != 2 {
+		t.Errorf("Expected 2 edge contents left, got %d", n)
+	}
+	if g, err := store.LoadSnapshot(ctx, "day2"); err != nil || g.NodeCount() != 3 {
+		t.Errorf("Expected day2 to load intact, got %v", err)
+	}
+
+	if err := store.DeleteSnapshot(ctx, "day1"); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("Expected ErrSnapshotNotFound, got %v", err)
+	}
+}
+
+func TestUpdateLabel(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.SaveSnapshot(ctx, "snap", "old", lifecycleGraph(t, "bucket")); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	if err := store.UpdateLabel(ctx, "snap", "new"); err != nil {
+		t.Fatalf("Failed to update label: %v", err)
+	}
+	if snap, err := store.GetSnapshot(ctx, "snap"); err != nil || snap.Label != "new" {
+		t.Errorf("Expected label new, got %+v, %v", snap, err)
+	}
+	if err := store.UpdateLabel(ctx, "missing", "x"); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("Expected ErrSnapshotNotFound, got %v", err)
+	}
+}
+
+func TestReplaceSnapshot(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.SaveSnapshot(ctx, "snap", "v1", lifecycleGraph(t, "bucket-v1")); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	if err := store.SaveSnapshot(ctx, "snap", "v1", lifecycleGraph(t, "bucket-v1")); !errors.Is(err, ErrSnapshotExists) {
+		t.Fatalf("Expected ErrSnapshotExists, got %v", err)
+	}
+
+	write := func(label, bucket string) *SnapshotWriter {
+		w, err := store.ReplaceSnapshot(ctx, "snap", label)
+		if err != nil {
+			t.Fatalf("Failed to replace snapshot: %v", err)
+		}
+		g := lifecycleGraph(t, bucket)
+		for _, node := range g.GetNodes() {
+			if err := w.AddNode(node); err != nil {
+				t.Fatalf("Failed to add node: %v", err)
+			}
+		}
+		for _, edge := range g.GetEdges() {
+			if err := w.AddEdge(edge); err != nil {
+				t.Fatalf("Failed to add edge: %v", err)
+			}
+		}
+		return w
+	}
+
+	// A rolled back replacement leaves the snapshot as it was
+	if err := write("v2", "bucket-v2").Rollback(); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if _, err := store.GetNode(ctx, "snap", "bucket-v1"); err != nil {
+		t.Errorf("Expected the original snapshot to survive rollback: %v", err)
+	}
+
+	if err := write("v2", "bucket-v2").Commit(); err != nil {
+		t.Fatalf("Failed to commit replacement: %v", err)
+	}
+	if snap, err := store.GetSnapshot(ctx, "snap"); err != nil || snap.Label != "v2" {
+		t.Errorf("Expected label v2, got %+v, %v", snap, err)
+	}
+	if _, err := store.GetNode(ctx, "snap", "bucket-v1"); err == nil {
+		t.Error("Expected the replaced snapshot's nodes to be gone")
+	}
+	if n := countRows(t, store, "node_data"); n != 3 {
+		t.Errorf("Expected replaced contents to be collected leaving 3 nodes, got %d", n)
+	}
+}
+
+func TestRetentionPolicyExpired(t *testing.T) {
+	now := time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC)
+	at := func(id string, daysAgo, hour int) Snapshot {
+		day := now.AddDate(0, 0, -daysAgo)
+		return Snapshot{ID: id, CreatedAt: time.Date(day.Year(), day.Month(), day.Day(), hour, 0, 0, 0, time.UTC)}
+	}
+
+	snapshots := []Snapshot{
+		at("today-early", 0, 1),
+		at("today-late", 0, 9),
+		at("yesterday", 1, 5),
+		at("two-days", 2, 5),
+		at("two-days-early", 2, 1),
+		at("old", 40, 5),
+	}
+
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		want   []string
+	}{
+		{"keep last", RetentionPolicy{KeepLast: 2}, []string{"yesterday", "two-days", "two-days-early", "old"}},
+		{"dailies", RetentionPolicy{KeepDailyDays: 2}, []string{"today-early", "two-days", "two-days-early", "old"}},
+		{"both", RetentionPolicy{KeepLast: 1, KeepDailyDays: 30}, []string{"today-early", "two-days-early", "old"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, snap := range tt.policy.Expired(snapshots, now) {
+				got = append(got, snap.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected expired %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPruneSnapshots(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	for i, id := range []string{"old", "older", "oldest"} {
+		if err := store.SaveSnapshot(ctx, id, id, lifecycleGraph(t, "bucket-"+id)); err != nil {
+			t.Fatalf("Failed to save %s: %v", id, err)
+		}
+		created := time.Now().UTC().AddDate(0, 0, -i).Format(time.RFC3339)
+		if _, err := store.db.ExecContext(ctx, "UPDATE snapshots SET created_at = ? WHERE id = ?", created, id); err != nil {
+			t.Fatalf("Failed to backdate %s: %v", id, err)
+		}
+	}
+
+	if _, err := store.PruneSnapshots(ctx, RetentionPolicy{}, false); err == nil {
+		t.Error("Expected a policy that keeps nothing to be refused")
+	}
+
+	expired, err := store.PruneSnapshots(ctx, RetentionPolicy{KeepLast: 1}, true)
+	if err != nil || len(expired) != 2 {
+		t.Fatalf("Expected a dry run to report 2 snapshots, got %v, %v", expired, err)
+	}
+	if n := countRows(t, store, "snapshots"); n != 3 {
+		t.Errorf("Expected a dry run to delete nothing, got %d snapshots", n)
+	}
+
+	expired, err = store.PruneSnapshots(ctx, RetentionPolicy{KeepLast: 1}, false)
+	if err != nil {
+		t.Fatalf("Failed to prune: %v", err)
+	}
+	if len(expired) != 2 || expired[0].ID != "older" || expired[1].ID != "oldest" {
+		t.Errorf("Expected older and oldest to be pruned, got %v", expired)
+	}
+	if n := countRows(t, store, "node_data"); n != 3 {
+		t.Errorf("Expected pruned contents to be collected leaving 3 nodes, got %d", n)
+	}
+
+	if err := store.Vacuum(ctx); err != nil {
+		t.Fatalf("Failed to vacuum: %v", err)
+	}
+	if snaps, err := store.ListSnapshots(ctx); err != nil || len(snaps) != 1 || snaps[0].ID != "old" {
+		t.Errorf("Expected only old to remain, got %v, %v", snaps, err)
+	}
+}
@@ -0,0 +1,507 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrSchemaTooNew is returned when a database was migrated by a newer build
+// than this one, whose schema this build cannot safely read or write
+var ErrSchemaTooNew = errors.New("database schema is newer than this build supports")
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migration is one step of the store schema. Migrations are numbered from 1
+// and applied in order, each in its own transaction. Each dialect has its own
+// sequence, in migrations/<dialect>.
+type Migration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+}
+
+// AppliedMigration is a migration recorded in schema_version
+type AppliedMigration struct {
+	Migration
+	AppliedAt time.Time `json:"appliedAt"`
+}
+
+// SchemaStatus describes where a database stands against the known
+// migrations
+type SchemaStatus struct {
+	// Version is the last applied migration, 0 for an empty database
+	Version int                `json:"version"`
+	Latest  int                `json:"latest"`
+	Applied []AppliedMigration `json:"applied"`
+	Pending []Migration        `json:"pending"`
+}
+
+// migrationStep is a migration with the SQL file that implements it and an
+// optional hook that runs after the SQL in the same transaction, for data
+// changes SQL alone cannot express
+type migrationStep struct {
+	Migration
+	sql  string
+	hook func(ctx context.Context, tx *dbTx) error
+}
+
+// migrations returns every known migration of a dialect in version order.
+// Files are named NNNN_name.sql.
+func migrations(d *dialect) ([]migrationStep, error) {
+	dir := path.Join("migrations", d.name)
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []migrationStep
+	for _, entry := range entries {
+		base := strings.TrimSuffix(entry.Name(), ".sql")
+		num, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+
+		data, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, migrationStep{
+			Migration: Migration{Version: version, Name: name},
+			sql:       string(data),
+			hook:      d.hooks[version],
+		})
+	}
+
+	sort.Slice(steps, func(i, j int) bool { return steps[i].Version < steps[j].Version })
+	for i, step := range steps {
+		if step.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+	}
+	return steps, nil
+}
+
+// LatestVersion returns the schema version this build migrates the store to
+func (s *Store) LatestVersion() int {
+	steps, err := migrations(s.db.dialect)
+	if err != nil || len(steps) == 0 {
+		return 0
+	}
+	return steps[len(steps)-1].Version
+}
+
+const createSchemaVersion = `CREATE TABLE IF NOT EXISTS schema_version (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at TEXT NOT NULL
+)`
+
+// prepareSchema creates schema_version, records the migrations an
+// unversioned database already has, and refuses a database migrated past
+// what this build knows
+func prepareSchema(ctx context.Context, db *dbConn) error {
+	steps, err := migrations(db.dialect)
+	if err != nil {
+		return err
+	}
+
+	var versioned int
+	if err := db.QueryRowContext(ctx, db.dialect.tableCount, "schema_version").Scan(&versioned); err != nil {
+		return err
+	}
+	switch {
+	case versioned > 0:
+	case db.dialect.adoptUnversioned:
+		if err := adoptUnversioned(ctx, db, steps); err != nil {
+			return fmt.Errorf("versioning existing schema: %w", err)
+		}
+	default:
+		if _, err := db.ExecContext(ctx, createSchemaVersion); err != nil {
+			return err
+		}
+	}
+
+	version, err := schemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if latest := steps[len(steps)-1].Version; version > latest {
+		return fmt.Errorf("%w: database is at version %d, this build supports up to %d", ErrSchemaTooNew, version, latest)
+	}
+	return nil
+}
+
+// adoptUnversioned creates schema_version for a database from before
+// migrations were versioned, recording the migrations its tables show were
+// applied: the content-addressed tables of version 2, or the per-snapshot
+// nodes table of version 1. Version 1 databases may predate some of its
+// tables and columns, so its idempotent migration is run again to fill them
+// in.
+func adoptUnversioned(ctx context.Context, db *dbConn, steps []migrationStep) error {
+	has := func(table string) (bool, error) {
+		var count int
+		err := db.QueryRowContext(ctx, db.dialect.tableCount, table).Scan(&count)
+		return count > 0, err
+	}
+
+	adopted := 0
+	if ok, err := has("node_data"); err != nil {
+		return err
+	} else if ok {
+		adopted = 2
+	} else if ok, err := has("nodes"); err != nil {
+		return err
+	} else if ok {
+		adopted = 1
+		// Databases created before provenance tracking lack the column
+		for _, table := range []string{"nodes", "edges"} {
+			if err := ensureColumn(db.DB, table, "provenance", "TEXT NOT NULL DEFAULT '[]'"); err != nil {
+				return fmt.Errorf("upgrading %s table: %w", table, err)
+			}
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, createSchemaVersion); err != nil {
+		return err
+	}
+	if adopted == 1 {
+		if _, err := tx.ExecContext(ctx, steps[0].sql); err != nil {
+			return err
+		}
+	}
+	for _, step := range steps[:adopted] {
+		if err := recordMigration(ctx, tx, step.Migration); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ensureColumn adds column to table if it is missing
+func ensureColumn(db *sql.DB, table, column, decl string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, typ        string
+			dflt             sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, decl))
+	return err
+}
+
+func recordMigration(ctx context.Context, tx *dbTx, m Migration) error {
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)",
+		m.Version, m.Name, time.Now().UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return fmt.Errorf("recording migration %d: %w", m.Version, err)
+	}
+	return nil
+}
+
+// schemaVersion returns the last applied migration
+func schemaVersion(ctx context.Context, db *dbConn) (int, error) {
+	var version int
+	err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	return version, err
+}
+
+// SchemaStatus reports the applied and pending migrations
+func (s *Store) SchemaStatus(ctx context.Context) (*SchemaStatus, error) {
+	steps, err := migrations(s.db.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &SchemaStatus{
+		Latest:  steps[len(steps)-1].Version,
+		Applied: []AppliedMigration{},
+		Pending: []Migration{},
+	}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT version, name, applied_at FROM schema_version ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m AppliedMigration
+		var appliedAt string
+		if err := rows.Scan(&m.Version, &m.Name, &appliedAt); err != nil {
+			return nil, err
+		}
+		m.AppliedAt, _ = time.Parse(time.RFC3339, appliedAt)
+		status.Applied = append(status.Applied, m)
+		status.Version = m.Version
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, step := range steps {
+		if step.Version > status.Version {
+			status.Pending = append(status.Pending, step.Migration)
+		}
+	}
+	return status, nil
+}
+
+// Migrate applies the pending migrations in order and returns them. Each
+// migration commits with its schema_version row, so a failure leaves the
+// database at the last migration that succeeded.
+func (s *Store) Migrate(ctx context.Context) ([]Migration, error) {
+	steps, err := migrations(s.db.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := schemaVersion(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []Migration{}
+	for _, step := range steps {
+		if step.Version <= version {
+			continue
+		}
+		ok, err := s.apply(ctx, step)
+		if err != nil {
+			return applied, fmt.Errorf("applying migration %d (%s): %w", step.Version, step.Name, err)
+		}
+		if ok {
+			applied = append(applied, step.Migration)
+		}
+	}
+	return applied, nil
+}
+
+// apply runs a migration unless another process sharing the database
+// applied it first, and reports whether it ran
+func (s *Store) apply(ctx context.Context, step migrationStep) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if lock := s.db.dialect.migrationLock; lock != "" {
+		if _, err := tx.ExecContext(ctx, lock); err != nil {
+			return false, fmt.Errorf("locking schema: %w", err)
+		}
+		var done int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_version WHERE version = ?", step.Version).Scan(&done); err != nil {
+			return false, err
+		}
+		if done > 0 {
+			return false, nil
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, step.sql); err != nil {
+		return false, err
+	}
+	if step.hook != nil {
+		if err := step.hook(ctx, tx); err != nil {
+			return false, err
+		}
+	}
+	if err := recordMigration(ctx, tx, step.Migration); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// upgradeSQLiteContents is the Go part of SQLite migration 3. Snapshots
+// still in the tables of version 1 are moved in the layout that migration
+// leaves, then contents written by version 2 are rehashed.
+func upgradeSQLiteContents(ctx context.Context, tx *dbTx) error {
+	if err := moveLegacySnapshots(ctx, tx); err != nil {
+		return err
+	}
+	return rehashContents(ctx, tx)
+}
+
+// moveLegacySnapshots moves snapshots from the nodes and edges tables of
+// version 1, which held a full copy of every row per snapshot, into the
+// content-addressed tables, then drops the old tables. Edges whose endpoints
+// are missing, which loading used to skip, are dropped. It does nothing if
+// the old tables are gone.
+func moveLegacySnapshots(ctx context.Context, tx *dbTx) error {
+	var legacy int
+	if err := tx.QueryRowContext(ctx, tx.dialect.tableCount, "nodes").Scan(&legacy); err != nil {
+		return err
+	}
+	if legacy == 0 {
+		return nil
+	}
+
+	var ids []string
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM snapshots ORDER BY id")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		w := newSnapshotWriter(ctx, tx, id)
+
+		nodes, err := legacyRows(ctx, tx, "SELECT id, kind, labels, props, provenance FROM nodes WHERE snapshot_id = ? ORDER BY rowid", id, scanNode)
+		if err != nil {
+			return err
+		}
+		for _, node := range nodes {
+			if err := w.AddNode(node); err != nil {
+				return err
+			}
+		}
+
+		edges, err := legacyRows(ctx, tx, "SELECT src, dst, kind, props, provenance FROM edges WHERE snapshot_id = ? ORDER BY rowid", id, scanEdge)
+		if err != nil {
+			return err
+		}
+		for _, edge := range edges {
+			if err := w.AddEdge(edge); err != nil {
+				return err
+			}
+		}
+
+		if _, err := w.DropDanglingEdges(); err != nil {
+			return err
+		}
+		if err := w.collect(); err != nil {
+			return err
+		}
+	}
+
+	for _, table := range []string{"edges", "nodes"} {
+		if _, err := tx.ExecContext(ctx, "DROP TABLE "+table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// legacyRows reads every row of a snapshot from a version 1 table, in full
+// before any of them is rewritten
+func legacyRows[T any](ctx context.Context, tx *dbTx, query, id string, scan func(scanner) (T, error)) ([]T, error) {
+	rows, err := tx.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []T
+	for rows.Next() {
+		v, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// rehashContents rehashes node_data and edge_data rows hashed with their
+// provenance, as version 2 wrote them, by their contents alone, pointing the
+// membership rows at the new hashes. Rows that differed only in provenance
+// become one.
+func rehashContents(ctx context.Context, tx *dbTx) error {
+	type content struct {
+		hash   []byte
+		fields []string
+	}
+	read := func(query string) ([]content, error) {
+		rows, err := tx.QueryContext(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var out []content
+		for rows.Next() {
+			var c content
+			c.fields = make([]string, 4)
+			if err := rows.Scan(&c.hash, &c.fields[0], &c.fields[1], &c.fields[2], &c.fields[3]); err != nil {
+				return nil, err
+			}
+			out = append(out, c)
+		}
+		return out, rows.Err()
+	}
+
+	for _, t := range []struct{ data, columns, members string }{
+		{"node_data", "hash, id, kind, labels, props", "snapshot_nodes"},
+		{"edge_data", "hash, src, dst, kind, props", "snapshot_edges"},
+	} {
+		contents, err := read("SELECT " + t.columns + " FROM " + t.data)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", t.data, err)
+		}
+
+		for _, c := range contents {
+			hash := contentHash(c.fields...)
+			if bytes.Equal(hash, c.hash) {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, tx.dialect.insert(t.data+" ("+t.columns+")", "(?, ?, ?, ?, ?)", true),
+				hash, c.fields[0], c.fields[1], c.fields[2], c.fields[3]); err != nil {
+				return fmt.Errorf("rehashing %s: %w", t.data, err)
+			}
+			if _, err := tx.ExecContext(ctx, "UPDATE "+t.members+" SET hash = ? WHERE hash = ?", hash, c.hash); err != nil {
+				return fmt.Errorf("rehashing %s: %w", t.members, err)
+			}
+			if _, err := tx.ExecContext(ctx, "DELETE FROM "+t.data+" WHERE hash = ?", c.hash); err != nil {
+				return fmt.Errorf("rehashing %s: %w", t.data, err)
+			}
+		}
+	}
+	return nil
+}
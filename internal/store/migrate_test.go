@@ -0,0 +1,238 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/jamesolaitan/accessgraph/internal/graph"
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := Open(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer store.Close()
+
+	status, err := store.SchemaStatus(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get schema status: %v", err)
+	}
+	if status.Version != 0 || status.Latest != store.LatestVersion() || len(status.Pending) != store.LatestVersion() {
+		t.Errorf("Expected every migration to be pending, got %+v", status)
+	}
+
+	applied, err := store.Migrate(ctx)
+	if err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	if len(applied) != store.LatestVersion() || applied[0].Version != 1 || applied[0].Name != "initial" {
+		t.Errorf("Expected migrations 1..%d to be applied, got %v", store.LatestVersion(), applied)
+	}
+
+	status, err = store.SchemaStatus(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get schema status: %v", err)
+	}
+	if status.Version != store.LatestVersion() || len(status.Applied) != store.LatestVersion() || len(status.Pending) != 0 {
+		t.Errorf("Expected the latest version with nothing pending, got %+v", status)
+	}
+
+	applied, err = store.Migrate(ctx)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("Expected migrating again to do nothing, got %v, %v", applied, err)
+	}
+}
+
+func TestRefuseNewerSchema(t *testing.T) {
+	ctx := context.Background()
+	path := t.TempDir() + "/test.db"
+
+	store, err := New(path)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if _, err := store.db.ExecContext(ctx,
+		"INSERT INTO schema_version (version, name, applied_at) VALUES (?, 'future', '2030-01-01T00:00:00Z')",
+		store.LatestVersion()+1,
+	); err != nil {
+		t.Fatalf("Failed to record future migration: %v", err)
+	}
+	store.Close()
+
+	for name, open := range map[string]func(string) (*Store, error){"New": New, "Open": Open} {
+		if _, err := open(path); !errors.Is(err, ErrSchemaTooNew) {
+			t.Errorf("Expected %s to refuse a newer schema, got %v", name, err)
+		}
+	}
+}
+
+func TestAdoptUnversionedSchema(t *testing.T) {
+	ctx := context.Background()
+	path := t.TempDir() + "/test.db"
+
+	// A database created before versioning, already in the layout of
+	// migration 2
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	steps, err := migrations(sqliteDialect)
+	if err != nil {
+		t.Fatalf("Failed to list migrations: %v", err)
+	}
+	for _, step := range steps[:2] {
+		if _, err := db.Exec(step.sql); err != nil {
+			t.Fatalf("Failed to apply %s: %v", step.Name, err)
+		}
+	}
+	db.Close()
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	defer store.Close()
+
+	status, err := store.SchemaStatus(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get schema status: %v", err)
+	}
+	if status.Version != 2 || len(status.Applied) != 2 {
+		t.Errorf("Expected the schema to be adopted at version 2, got %+v", status)
+	}
+}
+
+func TestMigrateLegacySnapshots(t *testing.T) {
+	ctx := context.Background()
+	path := t.TempDir() + "/test.db"
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	for _, stmt := range []string{
+		"CREATE TABLE snapshots (id TEXT PRIMARY KEY, created_at TEXT NOT NULL, label TEXT)",
+		"CREATE TABLE nodes (snapshot_id TEXT NOT NULL, id TEXT NOT NULL, kind TEXT NOT NULL, labels TEXT NOT NULL, props TEXT NOT NULL)",
+		"CREATE TABLE edges (snapshot_id TEXT NOT NULL, src TEXT NOT NULL, dst TEXT NOT NULL, kind TEXT NOT NULL, props TEXT NOT NULL)",
+		"INSERT INTO snapshots VALUES ('old', '2025-01-01T00:00:00Z', 'old')",
+		`INSERT INTO nodes VALUES ('old', 'role', 'PRINCIPAL', '["aws-role"]', '{"name":"role"}')`,
+		`INSERT INTO nodes VALUES ('old', 'bucket', 'RESOURCE', '[]', '{}')`,
+		`INSERT INTO edges VALUES ('old', 'role', 'bucket', 'APPLIES_TO', '{}')`,
+		`INSERT INTO edges VALUES ('old', 'role', 'ghost', 'ASSUMES_ROLE', '{}')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Failed to set up legacy database: %v", err)
+		}
+	}
+	db.Close()
+
+	store, err := New(path)
+	if err != nil {
+		t.Fatalf("Failed to open legacy database: %v", err)
+	}
+	defer store.Close()
+
+	g, err := store.LoadSnapshot(ctx, "old")
+	if err != nil {
+		t.Fatalf("Failed to load migrated snapshot: %v", err)
+	}
+	if role, ok := g.GetNode("role"); !ok || role.Props["name"] != "role" || len(role.Labels) != 1 {
+		t.Errorf("Expected migrated role, got %+v", role)
+	}
+	if edges := g.GetEdges(); len(edges) != 1 || edges[0].Dst != "bucket" {
+		t.Errorf("Expected the dangling edge to be dropped, got %v", edges)
+	}
+
+	var legacy int
+	if err := store.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE name IN ('nodes', 'edges')").Scan(&legacy); err != nil {
+		t.Fatalf("Failed to inspect schema: %v", err)
+	}
+	if legacy != 0 {
+		t.Errorf("Expected legacy tables to be dropped, %d remain", legacy)
+	}
+
+	status, err := store.SchemaStatus(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get schema status: %v", err)
+	}
+	if status.Version != store.LatestVersion() || len(status.Pending) != 0 {
+		t.Errorf("Expected legacy database to be migrated to version %d, got %+v", store.LatestVersion(), status)
+	}
+}
+
+func TestMigrateRehashesContents(t *testing.T) {
+	ctx := context.Background()
+	path := t.TempDir() + "/test.db"
+
+	// Two snapshots of a version 2 database whose role differs only in
+	// provenance, which that version hashed
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	steps, err := migrations(sqliteDialect)
+	if err != nil {
+		t.Fatalf("Failed to list migrations: %v", err)
+	}
+	for _, step := range steps[:2] {
+		if _, err := db.Exec(step.sql); err != nil {
+			t.Fatalf("Failed to apply %s: %v", step.Name, err)
+		}
+	}
+	for _, stmt := range []string{"DROP TABLE nodes", "DROP TABLE edges"} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Failed to drop legacy table: %v", err)
+		}
+	}
+	for snap, prov := range map[string]string{"day1": `[{"file":"users.json","line":3}]`, "day2": `[{"file":"users.json","line":9}]`} {
+		hash := contentHash("role", "PRINCIPAL", `["aws"]`, `{"name":"role"}`, prov)
+		for _, stmt := range []struct {
+			query string
+			args  []any
+		}{
+			{"INSERT INTO snapshots VALUES (?, '2025-01-01T00:00:00Z', ?)", []any{snap, snap}},
+			{`INSERT INTO node_data VALUES (?, 'role', 'PRINCIPAL', '["aws"]', '{"name":"role"}', ?)`, []any{hash, prov}},
+			{"INSERT INTO snapshot_nodes VALUES (?, 'role', ?)", []any{snap, hash}},
+		} {
+			if _, err := db.Exec(stmt.query, stmt.args...); err != nil {
+				t.Fatalf("Failed to set up version 2 database: %v", err)
+			}
+		}
+	}
+	db.Close()
+
+	store, err := New(path)
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	defer store.Close()
+
+	if n := countRows(t, store, "node_data"); n != 1 {
+		t.Errorf("Expected the role contents to be merged into one row, got %d", n)
+	}
+	for snap, line := range map[string]int{"day1": 3, "day2": 9} {
+		node, err := store.GetNode(ctx, snap, "role")
+		if err != nil {
+			t.Fatalf("Failed to get node: %v", err)
+		}
+		if len(node.Provenance) != 1 || node.Provenance[0].Line != line {
+			t.Errorf("%s: expected role at line %d, got %v", snap, line, node.Provenance)
+		}
+	}
+
+	// Saving the role again reuses the migrated row
+	g := graph.New()
+	g.AddNode(ingest.Node{ID: "role", Kind: ingest.KindPrincipal, Labels: []string{"aws"}, Props: map[string]string{"name": "role"}})
+	if err := store.SaveSnapshot(ctx, "day3", "day3", g); err != nil {
+		t.Fatalf("Failed to save snapshot: %v", err)
+	}
+	if n := countRows(t, store, "node_data"); n != 1 {
+		t.Errorf("Expected a new snapshot to share the rehashed row, got %d rows", n)
+	}
+}
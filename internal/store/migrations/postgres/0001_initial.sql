@@ -0,0 +1,65 @@
+-- The content-addressed schema of SQLite migration 2. Keys use the C
+-- collation so that they sort byte-wise, as in SQLite, and seq columns stand
+-- in for SQLite's rowid where rows are read back in insertion order.
+
+CREATE TABLE snapshots (
+    id TEXT COLLATE "C" PRIMARY KEY,
+    created_at TEXT COLLATE "C" NOT NULL,
+    label TEXT
+);
+
+-- Node and edge contents are stored once, keyed by a hash of the content, and
+-- shared by every snapshot that contains them unchanged
+CREATE TABLE node_data (
+    hash BYTEA PRIMARY KEY,
+    id TEXT COLLATE "C" NOT NULL,
+    kind TEXT COLLATE "C" NOT NULL,
+    labels TEXT NOT NULL,
+    props TEXT NOT NULL,
+    provenance TEXT NOT NULL
+);
+
+CREATE TABLE edge_data (
+    hash BYTEA PRIMARY KEY,
+    src TEXT COLLATE "C" NOT NULL,
+    dst TEXT COLLATE "C" NOT NULL,
+    kind TEXT COLLATE "C" NOT NULL,
+    props TEXT NOT NULL,
+    provenance TEXT NOT NULL
+);
+
+-- Membership tables list the contents of each snapshot
+CREATE TABLE snapshot_nodes (
+    snapshot_id TEXT COLLATE "C" NOT NULL REFERENCES snapshots(id) ON DELETE CASCADE,
+    node_id TEXT COLLATE "C" NOT NULL,
+    hash BYTEA NOT NULL REFERENCES node_data(hash),
+    PRIMARY KEY (snapshot_id, node_id)
+);
+
+-- Edges may be written before their endpoints, so the endpoint keys are only
+-- checked on commit
+CREATE TABLE snapshot_edges (
+    seq BIGINT GENERATED ALWAYS AS IDENTITY,
+    snapshot_id TEXT COLLATE "C" NOT NULL REFERENCES snapshots(id) ON DELETE CASCADE,
+    src TEXT COLLATE "C" NOT NULL,
+    dst TEXT COLLATE "C" NOT NULL,
+    kind TEXT COLLATE "C" NOT NULL,
+    hash BYTEA NOT NULL REFERENCES edge_data(hash),
+    PRIMARY KEY (snapshot_id, src, dst, kind),
+    FOREIGN KEY (snapshot_id, src) REFERENCES snapshot_nodes(snapshot_id, node_id) DEFERRABLE INITIALLY DEFERRED,
+    FOREIGN KEY (snapshot_id, dst) REFERENCES snapshot_nodes(snapshot_id, node_id) DEFERRABLE INITIALLY DEFERRED
+);
+
+CREATE TABLE validation_issues (
+    seq BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    snapshot_id TEXT COLLATE "C" NOT NULL REFERENCES snapshots(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    entity_id TEXT NOT NULL,
+    message TEXT NOT NULL,
+    provenance TEXT NOT NULL
+);
+
+CREATE INDEX idx_snapshot_nodes_hash ON snapshot_nodes(hash);
+CREATE INDEX idx_snapshot_edges_hash ON snapshot_edges(hash);
+CREATE INDEX idx_snapshot_edges_dst ON snapshot_edges(snapshot_id, dst);
+CREATE INDEX idx_issues_snapshot ON validation_issues(snapshot_id);
@@ -0,0 +1,11 @@
+-- As in SQLite migration 3, provenance moves from the shared contents to the
+-- membership rows, and contents are rehashed without it in Go, see
+-- rehashContents.
+ALTER TABLE snapshot_nodes ADD COLUMN provenance TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE snapshot_edges ADD COLUMN provenance TEXT NOT NULL DEFAULT '[]';
+
+UPDATE snapshot_nodes SET provenance = (SELECT d.provenance FROM node_data d WHERE d.hash = snapshot_nodes.hash);
+UPDATE snapshot_edges SET provenance = (SELECT d.provenance FROM edge_data d WHERE d.hash = snapshot_edges.hash);
+
+ALTER TABLE node_data DROP COLUMN provenance;
+ALTER TABLE edge_data DROP COLUMN provenance;
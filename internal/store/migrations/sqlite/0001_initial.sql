@@ -10,6 +10,7 @@ CREATE TABLE IF NOT EXISTS nodes (
     kind TEXT NOT NULL,
     labels TEXT NOT NULL,
     props TEXT NOT NULL,
+    provenance TEXT NOT NULL DEFAULT '[]',
     FOREIGN KEY (snapshot_id) REFERENCES snapshots(id)
 );
 
@@ -19,11 +20,23 @@ CREATE TABLE IF NOT EXISTS edges (
     dst TEXT NOT NULL,
     kind TEXT NOT NULL,
     props TEXT NOT NULL,
+    provenance TEXT NOT NULL DEFAULT '[]',
+    FOREIGN KEY (snapshot_id) REFERENCES snapshots(id)
+);
+
+CREATE TABLE IF NOT EXISTS validation_issues (
+    snapshot_id TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    entity_id TEXT NOT NULL,
+    message TEXT NOT NULL,
+    provenance TEXT NOT NULL,
     FOREIGN KEY (snapshot_id) REFERENCES snapshots(id)
 );
 
 CREATE INDEX IF NOT EXISTS idx_nodes_snapshot ON nodes(snapshot_id);
 CREATE INDEX IF NOT EXISTS idx_edges_snapshot ON edges(snapshot_id);
 CREATE INDEX IF NOT EXISTS idx_nodes_id ON nodes(snapshot_id, id);
+CREATE INDEX IF NOT EXISTS idx_edges_key ON edges(snapshot_id, src, dst, kind);
 CREATE INDEX IF NOT EXISTS idx_nodes_kind ON nodes(snapshot_id, kind);
+CREATE INDEX IF NOT EXISTS idx_issues_snapshot ON validation_issues(snapshot_id);
 
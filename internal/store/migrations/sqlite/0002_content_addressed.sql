@@ -0,0 +1,66 @@
+-- Snapshots move from full per-snapshot copies in nodes and edges to shared
+-- content-addressed rows; the rows themselves are moved in Go by migration
+-- 3, see moveLegacySnapshots
+
+-- Node and edge contents are stored once, keyed by a hash of the content, and
+-- shared by every snapshot that contains them unchanged
+CREATE TABLE node_data (
+    hash BLOB PRIMARY KEY,
+    id TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    labels TEXT NOT NULL,
+    props TEXT NOT NULL,
+    provenance TEXT NOT NULL
+) WITHOUT ROWID;
+
+CREATE TABLE edge_data (
+    hash BLOB PRIMARY KEY,
+    src TEXT NOT NULL,
+    dst TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    props TEXT NOT NULL,
+    provenance TEXT NOT NULL
+) WITHOUT ROWID;
+
+-- Membership tables list the contents of each snapshot
+CREATE TABLE snapshot_nodes (
+    snapshot_id TEXT NOT NULL REFERENCES snapshots(id) ON DELETE CASCADE,
+    node_id TEXT NOT NULL,
+    hash BLOB NOT NULL REFERENCES node_data(hash),
+    PRIMARY KEY (snapshot_id, node_id)
+) WITHOUT ROWID;
+
+-- Edges may be written before their endpoints, so the endpoint keys are only
+-- checked on commit
+CREATE TABLE snapshot_edges (
+    snapshot_id TEXT NOT NULL REFERENCES snapshots(id) ON DELETE CASCADE,
+    src TEXT NOT NULL,
+    dst TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    hash BLOB NOT NULL REFERENCES edge_data(hash),
+    PRIMARY KEY (snapshot_id, src, dst, kind),
+    FOREIGN KEY (snapshot_id, src) REFERENCES snapshot_nodes(snapshot_id, node_id) DEFERRABLE INITIALLY DEFERRED,
+    FOREIGN KEY (snapshot_id, dst) REFERENCES snapshot_nodes(snapshot_id, node_id) DEFERRABLE INITIALLY DEFERRED
+);
+
+-- Issues are deleted with their snapshot. Issues of snapshots that no longer
+-- exist are dropped.
+CREATE TABLE validation_issues_v2 (
+    snapshot_id TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    entity_id TEXT NOT NULL,
+    message TEXT NOT NULL,
+    provenance TEXT NOT NULL,
+    FOREIGN KEY (snapshot_id) REFERENCES snapshots(id) ON DELETE CASCADE
+);
+INSERT INTO validation_issues_v2 (snapshot_id, kind, entity_id, message, provenance)
+    SELECT snapshot_id, kind, entity_id, message, provenance FROM validation_issues
+    WHERE snapshot_id IN (SELECT id FROM snapshots)
+    ORDER BY rowid;
+DROP TABLE validation_issues;
+ALTER TABLE validation_issues_v2 RENAME TO validation_issues;
+
+CREATE INDEX idx_snapshot_nodes_hash ON snapshot_nodes(hash);
+CREATE INDEX idx_snapshot_edges_hash ON snapshot_edges(hash);
+CREATE INDEX idx_snapshot_edges_dst ON snapshot_edges(snapshot_id, dst);
+CREATE INDEX idx_issues_v2_snapshot ON validation_issues(snapshot_id);
@@ -0,0 +1,12 @@
+-- Provenance records where a snapshot's input held a node or edge, which
+-- moves whenever records are added above it, so it belongs to the snapshot
+-- rather than to the shared contents. Contents are rehashed without it in
+-- Go, see rehashContents.
+ALTER TABLE snapshot_nodes ADD COLUMN provenance TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE snapshot_edges ADD COLUMN provenance TEXT NOT NULL DEFAULT '[]';
+
+UPDATE snapshot_nodes SET provenance = (SELECT d.provenance FROM node_data d WHERE d.hash = snapshot_nodes.hash);
+UPDATE snapshot_edges SET provenance = (SELECT d.provenance FROM edge_data d WHERE d.hash = snapshot_edges.hash);
+
+ALTER TABLE node_data DROP COLUMN provenance;
+ALTER TABLE edge_data DROP COLUMN provenance;
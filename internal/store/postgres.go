@@ -0,0 +1,30 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// postgresDialect runs the store on PostgreSQL, so that several API replicas
+// can share one database. Its schema mirrors the SQLite one, with key columns
+// in the C collation so that rows sort byte-wise as they do in SQLite.
+var postgresDialect = &dialect{
+	name:     "postgres",
+	open:     func(dsn string) (*sql.DB, error) { return sql.Open("pgx", dsn) },
+	numbered: true,
+	seq:      "seq",
+	like:     "ILIKE",
+	hooks: map[int]func(ctx context.Context, tx *dbTx) error{
+		2: rehashContents,
+	},
+	tableCount: "SELECT COUNT(*) FROM pg_tables WHERE schemaname = current_schema() AND tablename = ?",
+	// Plain VACUUM makes the space reusable without the exclusive lock of
+	// VACUUM FULL, which readers on other replicas would wait on
+	vacuum: []string{"VACUUM (ANALYZE) node_data, edge_data, snapshot_nodes, snapshot_edges, validation_issues, snapshots"},
+	// Replicas starting together queue on a transaction-scoped advisory lock,
+	// keyed by an arbitrary constant, and the later ones skip what the first
+	// applied
+	migrationLock: "SELECT pg_advisory_xact_lock(7260457)",
+}
@@ -1,11 +1,15 @@
 package store
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jamesolaitan/accessgraph/internal/graph"
@@ -13,12 +17,9 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-//go:embed models.sql
-var schema string
-
-// Store manages SQLite persistence
+// Store persists snapshots in SQLite or PostgreSQL
 type Store struct {
-	db *sql.DB
+	db *dbConn
 }
 
 // Snapshot represents a saved graph snapshot
@@ -28,21 +29,74 @@ type Snapshot struct {
 	Label     string
 }
 
-// New creates a new store
-func New(path string) (*Store, error) {
-	db, err := sql.Open("sqlite", path)
+// createdAtFormat stores snapshot times to the nanosecond, so a replaced
+// snapshot gets a new CreatedAt however soon it follows, and at fixed width,
+// so the stored text sorts in time order. time.RFC3339 parses it.
+const createdAtFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// New opens a store and migrates its schema to the latest version. dsn is a
+// postgres:// URL or the path of a SQLite file, whose connections enforce
+// foreign keys and use the pragmas in connectionPragmas. It fails with
+// ErrSchemaTooNew if a newer build has migrated the database further.
+func New(dsn string) (*Store, error) {
+	s, err := Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.Migrate(context.Background()); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("migrating schema: %w", err)
+	}
+
+	return s, nil
+}
+
+// Open opens a store without applying pending migrations, so that they can
+// be inspected with SchemaStatus and applied with Migrate. Like New, it
+// fails with ErrSchemaTooNew on a database from a newer build.
+func Open(dsn string) (*Store, error) {
+	d := dialectFor(dsn)
+	sqlDB, err := d.open(dsn)
 	if err != nil {
 		return nil, fmt.Errorf("opening database: %w", err)
 	}
 
-	// Initialize schema
-	if _, err := db.Exec(schema); err != nil {
+	db := &dbConn{DB: sqlDB, dialect: d}
+	if err := prepareSchema(context.Background(), db); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("initializing schema: %w", err)
 	}
 
 	return &Store{db: db}, nil
 }
 
+// connectionPragmas are set on every pooled connection. WAL lets readers
+// carry on while a snapshot is written and, with synchronous=NORMAL, makes a
+// bulk load cost one sync per checkpoint rather than per commit; a commit can
+// only be lost on power failure, never corrupted. The busy timeout makes a
+// writer wait for another rather than fail.
+var connectionPragmas = []string{
+	"foreign_keys(1)",
+	"journal_mode(WAL)",
+	"synchronous(NORMAL)",
+	"busy_timeout(5000)",
+	"cache_size(-65536)",
+}
+
+// withPragmas adds connectionPragmas to a database path
+func withPragmas(path string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	for _, pragma := range connectionPragmas {
+		path += sep + "_pragma=" + pragma
+		sep = "&"
+	}
+	return path
+}
+
 // Close closes the database connection
 func (s *Store) Close() error {
 	return s.db.Close()
@@ -50,62 +104,677 @@ func (s *Store) Close() error {
 
 // SaveSnapshot saves a graph snapshot
 func (s *Store) SaveSnapshot(ctx context.Context, id, label string, g *graph.Graph) error {
-	tx, err := s.db.BeginTx(ctx, nil)
+	w, err := s.BeginSnapshot(ctx, id, label)
 	if err != nil {
 		return err
 	}
-	defer func() { _ = tx.Rollback() }()
+	defer func() { _ = w.Rollback() }()
 
-	// Insert snapshot
-	createdAt := time.Now().UTC().Format(time.RFC3339)
+	for _, node := range g.GetNodes() {
+		if err := w.AddNode(node); err != nil {
+			return err
+		}
+	}
+	for _, edge := range g.GetEdges() {
+		if err := w.AddEdge(edge); err != nil {
+			return err
+		}
+	}
+
+	return w.Commit()
+}
+
+// SnapshotWriter writes one snapshot incrementally inside a transaction, so
+// a snapshot can be saved while its input is still being parsed. Nodes and
+// edges may arrive in any order and more than once; duplicates are merged
+// with ingest.MergeNode and ingest.MergeEdge as they are written. Only the
+// IDs and edge keys seen so far, and the current batch, are held in memory.
+//
+// New rows are buffered and inserted writeBatch at a time with multi-row
+// prepared statements. Contents are stored by hash, so a node or edge that
+// is unchanged from an earlier snapshot only costs a membership row.
+// Provenance is kept on the membership row rather than hashed, so that
+// records moving within their input files do not count as changes.
+type SnapshotWriter struct {
+	ctx       context.Context
+	tx        *dbTx
+	id        string
+	nodes     map[string]struct{}
+	edges     map[string]struct{}
+	conflicts []ingest.Conflict
+	// replaced holds the content hashes that merges and dropped edges stopped
+	// referencing, to be deleted on commit unless another snapshot uses them
+	replacedNodes [][]byte
+	replacedEdges [][]byte
+
+	// batchNodes and batchEdges are written but not yet inserted, indexed by
+	// node ID and edge key so that duplicates merge in memory
+	batchNodes     []ingest.Node
+	batchNodeIndex map[string]int
+	batchEdges     []ingest.Edge
+	batchEdgeIndex map[string]int
+
+	// stmts caches the statements prepared on tx by query
+	stmts map[string]*sql.Stmt
+
+	start         time.Time
+	flushedNodes  int
+	flushedEdges  int
+	progress      func(Progress)
+	progressEvery int
+	reported      int
+
+	// early holds the keys of edges written before one of their endpoints,
+	// which must have arrived by Commit
+	early []ingest.Edge
+
+	// replacedSnapshot is set when the writer deleted an earlier snapshot with
+	// its ID, whose contents are then collected in full on commit
+	replacedSnapshot bool
+}
+
+// writeBatch is how many rows are inserted per statement. It keeps the
+// widest insert, snapshot_edges' six columns, well under SQLite's limit of
+// 32766 parameters.
+const writeBatch = 200
+
+// Progress reports how much of a snapshot has been inserted
+type Progress struct {
+	Nodes   int
+	Edges   int
+	Elapsed time.Duration
+}
+
+// BeginSnapshot starts writing a new snapshot. Nothing is visible to readers
+// until Commit; Rollback discards everything written. It fails with
+// ErrSnapshotExists if a snapshot with id has been saved.
+func (s *Store) BeginSnapshot(ctx context.Context, id, label string) (*SnapshotWriter, error) {
+	return s.beginSnapshot(ctx, id, label, false)
+}
+
+// ReplaceSnapshot is BeginSnapshot for an ID that may already be saved. The
+// earlier snapshot, with its validation report, is deleted in the same
+// transaction, so readers see it until Commit and keep it on Rollback.
+func (s *Store) ReplaceSnapshot(ctx context.Context, id, label string) (*SnapshotWriter, error) {
+	return s.beginSnapshot(ctx, id, label, true)
+}
+
+func (s *Store) beginSnapshot(ctx context.Context, id, label string, replace bool) (*SnapshotWriter, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var replaced int64
+	if replace {
+		res, err := tx.ExecContext(ctx, "DELETE FROM snapshots WHERE id = ?", id)
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, fmt.Errorf("deleting snapshot: %w", err)
+		}
+		replaced, _ = res.RowsAffected()
+	} else {
+		var exists int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM snapshots WHERE id = ?", id).Scan(&exists); err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+		if exists > 0 {
+			_ = tx.Rollback()
+			return nil, fmt.Errorf("%w: %s", ErrSnapshotExists, id)
+		}
+	}
+
+	createdAt := time.Now().UTC().Format(createdAtFormat)
 	_, err = tx.ExecContext(ctx,
 		"INSERT INTO snapshots (id, created_at, label) VALUES (?, ?, ?)",
 		id, createdAt, label,
 	)
 	if err != nil {
-		return fmt.Errorf("inserting snapshot: %w", err)
+		_ = tx.Rollback()
+		return nil, fmt.Errorf("inserting snapshot: %w", err)
+	}
+
+	w := newSnapshotWriter(ctx, tx, id)
+	w.replacedSnapshot = replaced > 0
+	return w, nil
+}
+
+func newSnapshotWriter(ctx context.Context, tx *dbTx, id string) *SnapshotWriter {
+	return &SnapshotWriter{
+		ctx:            ctx,
+		tx:             tx,
+		id:             id,
+		nodes:          make(map[string]struct{}),
+		edges:          make(map[string]struct{}),
+		batchNodeIndex: make(map[string]int),
+		batchEdgeIndex: make(map[string]int),
+		stmts:          make(map[string]*sql.Stmt),
+		start:          time.Now(),
+	}
+}
+
+// OnProgress calls fn each time at least every more nodes and edges have
+// been inserted, and once more on Commit
+func (w *SnapshotWriter) OnProgress(every int, fn func(Progress)) {
+	w.progress, w.progressEvery = fn, every
+}
+
+// stmt returns query prepared on the writer's transaction
+func (w *SnapshotWriter) stmt(query string) (*sql.Stmt, error) {
+	if st, ok := w.stmts[query]; ok {
+		return st, nil
+	}
+	st, err := w.tx.PrepareContext(w.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	w.stmts[query] = st
+	return st, nil
+}
+
+// exec runs query, prepared once per writer
+func (w *SnapshotWriter) exec(query string, args ...any) error {
+	st, err := w.stmt(query)
+	if err != nil {
+		return err
+	}
+	_, err = st.ExecContext(w.ctx, args...)
+	return err
+}
+
+// insertRows inserts rows of width values each into table with one
+// multi-row statement. With ignore, rows whose key exists are skipped.
+func (w *SnapshotWriter) insertRows(ignore bool, table string, width int, args []any) error {
+	row := "(?" + strings.Repeat(", ?", width-1) + ")"
+	rows := len(args) / width
+	return w.exec(w.tx.dialect.insert(table, row+strings.Repeat(", "+row, rows-1), ignore), args...)
+}
+
+// AddNode writes node, merging it into an already written node with the same ID
+func (w *SnapshotWriter) AddNode(node ingest.Node) error {
+	if i, ok := w.batchNodeIndex[node.ID]; ok {
+		// The batch holds the caller's node, which merging must not change
+		merged := ingest.CloneNode(w.batchNodes[i])
+		w.conflicts = append(w.conflicts, ingest.MergeNode(&merged, node)...)
+		w.batchNodes[i] = merged
+		return nil
+	}
+	if _, ok := w.nodes[node.ID]; ok {
+		return w.mergeNode(node)
+	}
+
+	w.nodes[node.ID] = struct{}{}
+	w.batchNodeIndex[node.ID] = len(w.batchNodes)
+	w.batchNodes = append(w.batchNodes, node)
+	if len(w.batchNodes) == writeBatch {
+		return w.flushNodes()
+	}
+	return nil
+}
+
+// encodeNode returns the node_data row of node, starting with its hash, and
+// its provenance for the snapshot_nodes row
+func encodeNode(node ingest.Node) ([]any, string, error) {
+	labelsJSON, err := json.Marshal(node.Labels)
+	if err != nil {
+		return nil, "", fmt.Errorf("marshaling labels for node %s: %w", node.ID, err)
+	}
+
+	propsJSON, err := json.Marshal(node.Props)
+	if err != nil {
+		return nil, "", fmt.Errorf("marshaling props for node %s: %w", node.ID, err)
+	}
+
+	provJSON, err := marshalProvenance(node.Provenance)
+	if err != nil {
+		return nil, "", fmt.Errorf("marshaling provenance for node %s: %w", node.ID, err)
 	}
 
-	// Insert nodes
-	nodes := g.GetNodes()
-	for _, node := range nodes {
-		labelsJSON, err := json.Marshal(node.Labels)
+	hash := contentHash(node.ID, string(node.Kind), string(labelsJSON), string(propsJSON))
+	return []any{hash, node.ID, string(node.Kind), string(labelsJSON), string(propsJSON)}, provJSON, nil
+}
+
+// flushNodes inserts the batched nodes
+func (w *SnapshotWriter) flushNodes() error {
+	if len(w.batchNodes) == 0 {
+		return nil
+	}
+
+	data := make([]any, 0, len(w.batchNodes)*5)
+	members := make([]any, 0, len(w.batchNodes)*4)
+	for _, node := range w.batchNodes {
+		row, provJSON, err := encodeNode(node)
 		if err != nil {
-			return fmt.Errorf("marshaling labels for node %s: %w", node.ID, err)
+			return err
 		}
+		data = append(data, row...)
+		members = append(members, w.id, node.ID, row[0], provJSON)
+	}
 
-		propsJSON, err := json.Marshal(node.Props)
+	if err := w.insertRows(true, "node_data (hash, id, kind, labels, props)", 5, data); err != nil {
+		return fmt.Errorf("storing nodes: %w", err)
+	}
+	if err := w.insertRows(false, "snapshot_nodes (snapshot_id, node_id, hash, provenance)", 4, members); err != nil {
+		return fmt.Errorf("inserting nodes: %w", err)
+	}
+
+	w.flushedNodes += len(w.batchNodes)
+	w.batchNodes = w.batchNodes[:0]
+	clear(w.batchNodeIndex)
+	w.reportProgress(false)
+	return nil
+}
+
+func (w *SnapshotWriter) mergeNode(node ingest.Node) error {
+	var old []byte
+	var id, kind, labelsJSON, propsJSON, provJSON string
+
+	st, err := w.stmt("SELECT s.hash, d.id, d.kind, d.labels, d.props, s.provenance FROM snapshot_nodes s JOIN node_data d ON d.hash = s.hash WHERE s.snapshot_id = ? AND s.node_id = ?")
+	if err != nil {
+		return err
+	}
+	err = st.QueryRowContext(w.ctx, w.id, node.ID).Scan(&old, &id, &kind, &labelsJSON, &propsJSON, &provJSON)
+	if err != nil {
+		return fmt.Errorf("loading node %s for merge: %w", node.ID, err)
+	}
+
+	existing, err := decodeNode(id, kind, labelsJSON, propsJSON, provJSON)
+	if err != nil {
+		return err
+	}
+
+	w.conflicts = append(w.conflicts, ingest.MergeNode(&existing, node)...)
+
+	row, newProvJSON, err := encodeNode(existing)
+	if err != nil {
+		return err
+	}
+	hash := row[0].([]byte)
+	changed := !bytes.Equal(hash, old)
+	if !changed && newProvJSON == provJSON {
+		return nil
+	}
+
+	if changed {
+		if err := w.insertRows(true, "node_data (hash, id, kind, labels, props)", 5, row); err != nil {
+			return fmt.Errorf("storing node %s: %w", node.ID, err)
+		}
+		w.replacedNodes = append(w.replacedNodes, old)
+	}
+	if err := w.exec("UPDATE snapshot_nodes SET hash = ?, provenance = ? WHERE snapshot_id = ? AND node_id = ?", hash, newProvJSON, w.id, node.ID); err != nil {
+		return fmt.Errorf("updating node %s: %w", node.ID, err)
+	}
+	return nil
+}
+
+// AddEdge writes edge, merging it into an already written edge with the same
+// Key. Edges may reference nodes that have not been written yet.
+func (w *SnapshotWriter) AddEdge(edge ingest.Edge) error {
+	key := edge.Key()
+	if i, ok := w.batchEdgeIndex[key]; ok {
+		merged := ingest.CloneEdge(w.batchEdges[i])
+		w.conflicts = append(w.conflicts, ingest.MergeEdge(&merged, edge)...)
+		w.batchEdges[i] = merged
+		return nil
+	}
+	if _, ok := w.edges[key]; ok {
+		return w.mergeEdge(edge)
+	}
+
+	w.edges[key] = struct{}{}
+	if !w.HasNode(edge.Src) || !w.HasNode(edge.Dst) {
+		w.early = append(w.early, ingest.Edge{Src: edge.Src, Dst: edge.Dst, Kind: edge.Kind})
+	}
+	w.batchEdgeIndex[key] = len(w.batchEdges)
+	w.batchEdges = append(w.batchEdges, edge)
+	if len(w.batchEdges) == writeBatch {
+		return w.flushEdges()
+	}
+	return nil
+}
+
+// encodeEdge returns the edge_data row of edge, starting with its hash, and
+// its provenance for the snapshot_edges row
+func encodeEdge(edge ingest.Edge) ([]any, string, error) {
+	propsJSON, err := json.Marshal(edge.Props)
+	if err != nil {
+		return nil, "", fmt.Errorf("marshaling props for edge %s->%s: %w", edge.Src, edge.Dst, err)
+	}
+
+	provJSON, err := marshalProvenance(edge.Provenance)
+	if err != nil {
+		return nil, "", fmt.Errorf("marshaling provenance for edge %s->%s: %w", edge.Src, edge.Dst, err)
+	}
+
+	hash := contentHash(edge.Src, edge.Dst, edge.Kind, string(propsJSON))
+	return []any{hash, edge.Src, edge.Dst, edge.Kind, string(propsJSON)}, provJSON, nil
+}
+
+// flushEdges inserts the batched edges
+func (w *SnapshotWriter) flushEdges() error {
+	if len(w.batchEdges) == 0 {
+		return nil
+	}
+
+	data := make([]any, 0, len(w.batchEdges)*5)
+	members := make([]any, 0, len(w.batchEdges)*6)
+	for _, edge := range w.batchEdges {
+		row, provJSON, err := encodeEdge(edge)
 		if err != nil {
-			return fmt.Errorf("marshaling props for node %s: %w", node.ID, err)
+			return err
 		}
+		data = append(data, row...)
+		members = append(members, w.id, edge.Src, edge.Dst, edge.Kind, row[0], provJSON)
+	}
 
-		_, err = tx.ExecContext(ctx,
-			"INSERT INTO nodes (snapshot_id, id, kind, labels, props) VALUES (?, ?, ?, ?, ?)",
-			id, node.ID, string(node.Kind), string(labelsJSON), string(propsJSON),
-		)
+	if err := w.insertRows(true, "edge_data (hash, src, dst, kind, props)", 5, data); err != nil {
+		return fmt.Errorf("storing edges: %w", err)
+	}
+	if err := w.insertRows(false, "snapshot_edges (snapshot_id, src, dst, kind, hash, provenance)", 6, members); err != nil {
+		return fmt.Errorf("inserting edges: %w", err)
+	}
+
+	w.flushedEdges += len(w.batchEdges)
+	w.batchEdges = w.batchEdges[:0]
+	clear(w.batchEdgeIndex)
+	w.reportProgress(false)
+	return nil
+}
+
+func (w *SnapshotWriter) mergeEdge(edge ingest.Edge) error {
+	var old []byte
+	var propsJSON, provJSON string
+
+	st, err := w.stmt("SELECT s.hash, d.props, s.provenance FROM snapshot_edges s JOIN edge_data d ON d.hash = s.hash WHERE s.snapshot_id = ? AND s.src = ? AND s.dst = ? AND s.kind = ?")
+	if err != nil {
+		return err
+	}
+	err = st.QueryRowContext(w.ctx, w.id, edge.Src, edge.Dst, edge.Kind).Scan(&old, &propsJSON, &provJSON)
+	if err != nil {
+		return fmt.Errorf("loading edge %s for merge: %w", edge.Key(), err)
+	}
+
+	existing, err := decodeEdge(edge.Src, edge.Dst, edge.Kind, propsJSON, provJSON)
+	if err != nil {
+		return err
+	}
+
+	w.conflicts = append(w.conflicts, ingest.MergeEdge(&existing, edge)...)
+
+	row, newProvJSON, err := encodeEdge(existing)
+	if err != nil {
+		return err
+	}
+	hash := row[0].([]byte)
+	changed := !bytes.Equal(hash, old)
+	if !changed && newProvJSON == provJSON {
+		return nil
+	}
+
+	if changed {
+		if err := w.insertRows(true, "edge_data (hash, src, dst, kind, props)", 5, row); err != nil {
+			return fmt.Errorf("storing edge %s: %w", edge.Key(), err)
+		}
+		w.replacedEdges = append(w.replacedEdges, old)
+	}
+	if err := w.exec("UPDATE snapshot_edges SET hash = ?, provenance = ? WHERE snapshot_id = ? AND src = ? AND dst = ? AND kind = ?", hash, newProvJSON, w.id, edge.Src, edge.Dst, edge.Kind); err != nil {
+		return fmt.Errorf("updating edge %s: %w", edge.Key(), err)
+	}
+	return nil
+}
+
+// flush inserts everything batched
+func (w *SnapshotWriter) flush() error {
+	if err := w.flushNodes(); err != nil {
+		return err
+	}
+	return w.flushEdges()
+}
+
+// reportProgress calls the progress callback if enough rows were inserted
+// since it was last called, or unconditionally if final
+func (w *SnapshotWriter) reportProgress(final bool) {
+	if w.progress == nil {
+		return
+	}
+	done := w.flushedNodes + w.flushedEdges
+	if !final && done-w.reported < w.progressEvery {
+		return
+	}
+	w.reported = done
+	w.progress(Progress{Nodes: w.flushedNodes, Edges: w.flushedEdges, Elapsed: time.Since(w.start)})
+}
+
+// HasNode reports whether a node with id has been written
+func (w *SnapshotWriter) HasNode(id string) bool {
+	_, ok := w.nodes[id]
+	return ok
+}
+
+// NodeCount returns the number of distinct nodes written
+func (w *SnapshotWriter) NodeCount() int {
+	return len(w.nodes)
+}
+
+// EdgeCount returns the number of distinct edges written
+func (w *SnapshotWriter) EdgeCount() int {
+	return len(w.edges)
+}
+
+// Conflicts returns the merge conflicts found so far
+func (w *SnapshotWriter) Conflicts() []ingest.Conflict {
+	return w.conflicts
+}
+
+// danglingCondition matches snapshot edges with an endpoint missing from the
+// snapshot
+const danglingCondition = `s.snapshot_id = ? AND (
+		NOT EXISTS (SELECT 1 FROM snapshot_nodes n WHERE n.snapshot_id = s.snapshot_id AND n.node_id = s.src)
+		OR NOT EXISTS (SELECT 1 FROM snapshot_nodes n WHERE n.snapshot_id = s.snapshot_id AND n.node_id = s.dst)
+	)`
+
+// DropDanglingEdges deletes edges whose source or destination was never
+// written and returns them, in the order they were added. Call it once all
+// nodes have been written: Commit fails while any edge is dangling.
+func (w *SnapshotWriter) DropDanglingEdges() ([]ingest.Edge, error) {
+	if err := w.flush(); err != nil {
+		return nil, err
+	}
+
+	rows, err := w.tx.QueryContext(w.ctx,
+		"SELECT s.hash, d.src, d.dst, d.kind, d.props, s.provenance FROM snapshot_edges s JOIN edge_data d ON d.hash = s.hash WHERE "+danglingCondition+" ORDER BY s."+w.tx.dialect.seq,
+		w.id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dangling []ingest.Edge
+	for rows.Next() {
+		var hash []byte
+		var src, dst, kind, propsJSON, provJSON string
+
+		if err := rows.Scan(&hash, &src, &dst, &kind, &propsJSON, &provJSON); err != nil {
+			return nil, err
+		}
+
+		edge, err := decodeEdge(src, dst, kind, propsJSON, provJSON)
 		if err != nil {
-			return fmt.Errorf("inserting node %s: %w", node.ID, err)
+			return nil, err
 		}
+		dangling = append(dangling, edge)
+		w.replacedEdges = append(w.replacedEdges, hash)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := w.tx.ExecContext(w.ctx, "DELETE FROM snapshot_edges AS s WHERE "+danglingCondition, w.id); err != nil {
+		return nil, fmt.Errorf("deleting dangling edges: %w", err)
+	}
+	for _, edge := range dangling {
+		delete(w.edges, edge.Key())
 	}
+	w.flushedEdges -= len(dangling)
+
+	return dangling, nil
+}
+
+// collect deletes the contents the snapshot stopped referencing that no
+// snapshot uses
+func (w *SnapshotWriter) collect() error {
+	if w.replacedSnapshot {
+		// Any content of the replaced snapshot may now be unused
+		w.replacedNodes, w.replacedEdges = nil, nil
+		return collectOrphans(w.ctx, w.tx)
+	}
+
+	for _, hash := range w.replacedNodes {
+		if _, err := w.tx.ExecContext(w.ctx,
+			"DELETE FROM node_data WHERE hash = ? AND NOT EXISTS (SELECT 1 FROM snapshot_nodes WHERE hash = ?)",
+			hash, hash,
+		); err != nil {
+			return fmt.Errorf("collecting node contents: %w", err)
+		}
+	}
+	for _, hash := range w.replacedEdges {
+		if _, err := w.tx.ExecContext(w.ctx,
+			"DELETE FROM edge_data WHERE hash = ? AND NOT EXISTS (SELECT 1 FROM snapshot_edges WHERE hash = ?)",
+			hash, hash,
+		); err != nil {
+			return fmt.Errorf("collecting edge contents: %w", err)
+		}
+	}
+	w.replacedNodes, w.replacedEdges = nil, nil
+	return nil
+}
+
+// Commit makes the snapshot visible. It fails, rolling back, if an edge
+// references a node that was never written.
+func (w *SnapshotWriter) Commit() error {
+	// The foreign keys would refuse such an edge too, but a COMMIT SQLite
+	// refuses leaves the transaction open on its pooled connection
+	for _, edge := range w.early {
+		if _, ok := w.edges[edge.Key()]; !ok {
+			continue // dropped
+		}
+		if !w.HasNode(edge.Src) || !w.HasNode(edge.Dst) {
+			_ = w.tx.Rollback()
+			return fmt.Errorf("edge %s references a node that was never written", edge.Key())
+		}
+	}
+
+	if err := w.flush(); err != nil {
+		return err
+	}
+	if err := w.collect(); err != nil {
+		return err
+	}
+	if err := w.tx.Commit(); err != nil {
+		return err
+	}
+	w.reportProgress(true)
+	return nil
+}
+
+// Rollback discards the snapshot. It is safe to call after Commit.
+func (w *SnapshotWriter) Rollback() error {
+	err := w.tx.Rollback()
+	if errors.Is(err, sql.ErrTxDone) {
+		return nil
+	}
+	return err
+}
+
+// contentHash identifies a node or edge by its encoded fields, which leave
+// out provenance
+func contentHash(fields ...string) []byte {
+	// Encoding the fields as a JSON array keeps their boundaries unambiguous
+	data, _ := json.Marshal(fields)
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// SaveReport stores the ingest validation report for a snapshot, replacing
+// any report saved earlier
+func (s *Store) SaveReport(ctx context.Context, snapshotID string, report ingest.Report) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := saveReport(ctx, tx, snapshotID, report); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SaveReport stores the validation report with the snapshot, replacing any
+// report saved earlier in the writer. It is committed or rolled back with
+// the snapshot.
+func (w *SnapshotWriter) SaveReport(report ingest.Report) error {
+	return saveReport(w.ctx, w.tx, w.id, report)
+}
 
-	// Insert edges
-	edges := g.GetEdges()
-	for _, edge := range edges {
-		propsJSON, err := json.Marshal(edge.Props)
+// saveReport replaces the validation report of a snapshot within tx
+func saveReport(ctx context.Context, tx *dbTx, snapshotID string, report ingest.Report) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM validation_issues WHERE snapshot_id = ?", snapshotID); err != nil {
+		return fmt.Errorf("clearing report: %w", err)
+	}
+
+	for _, issue := range report.Issues {
+		provJSON, err := json.Marshal(issue.Provenance)
 		if err != nil {
-			return fmt.Errorf("marshaling props for edge %s->%s: %w", edge.Src, edge.Dst, err)
+			return fmt.Errorf("marshaling provenance for issue %s: %w", issue.EntityID, err)
 		}
 
 		_, err = tx.ExecContext(ctx,
-			"INSERT INTO edges (snapshot_id, src, dst, kind, props) VALUES (?, ?, ?, ?, ?)",
-			id, edge.Src, edge.Dst, edge.Kind, string(propsJSON),
+			"INSERT INTO validation_issues (snapshot_id, kind, entity_id, message, provenance) VALUES (?, ?, ?, ?, ?)",
+			snapshotID, string(issue.Kind), issue.EntityID, issue.Message, string(provJSON),
 		)
 		if err != nil {
-			return fmt.Errorf("inserting edge: %w", err)
+			return fmt.Errorf("inserting issue: %w", err)
 		}
 	}
+	return nil
+}
 
-	return tx.Commit()
+// GetReport retrieves the ingest validation report for a snapshot
+func (s *Store) GetReport(ctx context.Context, snapshotID string) (ingest.Report, error) {
+	report := ingest.Report{Issues: []ingest.Issue{}}
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT kind, entity_id, message, provenance FROM validation_issues WHERE snapshot_id = ? ORDER BY "+s.db.dialect.seq,
+		snapshotID,
+	)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var issue ingest.Issue
+		var kind, provJSON string
+
+		if err := rows.Scan(&kind, &issue.EntityID, &issue.Message, &provJSON); err != nil {
+			return report, err
+		}
+
+		issue.Kind = ingest.IssueKind(kind)
+		if err := json.Unmarshal([]byte(provJSON), &issue.Provenance); err != nil {
+			return report, fmt.Errorf("unmarshaling issue provenance: %w", err)
+		}
+
+		report.Issues = append(report.Issues, issue)
+	}
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+
+	return report, nil
 }
 
 // LoadSnapshot loads a graph snapshot
@@ -114,7 +783,7 @@ func (s *Store) LoadSnapshot(ctx context.Context, id string) (*graph.Graph, erro
 
 	// Load nodes (ordered for determinism)
 	rows, err := s.db.QueryContext(ctx,
-		"SELECT id, kind, labels, props FROM nodes WHERE snapshot_id = ? ORDER BY id",
+		"SELECT "+nodeColumns+" FROM snapshot_nodes s JOIN node_data d ON d.hash = s.hash WHERE s.snapshot_id = ? ORDER BY s.node_id",
 		id,
 	)
 	if err != nil {
@@ -123,25 +792,10 @@ func (s *Store) LoadSnapshot(ctx context.Context, id string) (*graph.Graph, erro
 	defer rows.Close()
 
 	for rows.Next() {
-		var node ingest.Node
-		var labelsJSON, propsJSON string
-		var kind string
-
-		scanErr := rows.Scan(&node.ID, &kind, &labelsJSON, &propsJSON)
-		if scanErr != nil {
-			return nil, scanErr
-		}
-
-		node.Kind = ingest.Kind(kind)
-		unmarshalErr := json.Unmarshal([]byte(labelsJSON), &node.Labels)
-		if unmarshalErr != nil {
-			return nil, fmt.Errorf("unmarshaling labels for node %s: %w", node.ID, unmarshalErr)
-		}
-		propsErr := json.Unmarshal([]byte(propsJSON), &node.Props)
-		if propsErr != nil {
-			return nil, fmt.Errorf("unmarshaling props for node %s: %w", node.ID, propsErr)
+		node, err := scanNode(rows)
+		if err != nil {
+			return nil, err
 		}
-
 		g.AddNode(node)
 	}
 	if rowsErr := rows.Err(); rowsErr != nil {
@@ -150,7 +804,7 @@ func (s *Store) LoadSnapshot(ctx context.Context, id string) (*graph.Graph, erro
 
 	// Load edges (ordered for determinism)
 	edgeRows, err := s.db.QueryContext(ctx,
-		"SELECT src, dst, kind, props FROM edges WHERE snapshot_id = ? ORDER BY src, dst, kind",
+		"SELECT "+edgeColumns+" FROM snapshot_edges s JOIN edge_data d ON d.hash = s.hash WHERE s.snapshot_id = ? ORDER BY s.src, s.dst, s.kind",
 		id,
 	)
 	if err != nil {
@@ -159,17 +813,11 @@ func (s *Store) LoadSnapshot(ctx context.Context, id string) (*graph.Graph, erro
 	defer edgeRows.Close()
 
 	for edgeRows.Next() {
-		var edge ingest.Edge
-		var propsJSON string
-
-		if err := edgeRows.Scan(&edge.Src, &edge.Dst, &edge.Kind, &propsJSON); err != nil {
+		edge, err := scanEdge(edgeRows)
+		if err != nil {
 			return nil, err
 		}
 
-		if err := json.Unmarshal([]byte(propsJSON), &edge.Props); err != nil {
-			return nil, fmt.Errorf("unmarshaling edge props %s->%s: %w", edge.Src, edge.Dst, err)
-		}
-
 		if err := g.AddEdge(edge); err != nil {
 			// Skip edges with missing nodes
 			continue
@@ -179,6 +827,14 @@ func (s *Store) LoadSnapshot(ctx context.Context, id string) (*graph.Graph, erro
 		return nil, err
 	}
 
+	// Trust in an account root only becomes a concrete ASSUMES_ROLE edge once
+	// every principal's permissions are known
+	g.ExpandAccountTrust()
+
+	// Escalation techniques become CAN_ESCALATE_TO edges so that attack paths
+	// can take them
+	g.ExpandEscalations()
+
 	return g, nil
 }
 
@@ -240,14 +896,14 @@ func (s *Store) GetSnapshot(ctx context.Context, id string) (*Snapshot, error) {
 // CountNodes returns the number of nodes in a snapshot
 func (s *Store) CountNodes(ctx context.Context, snapshotID string) (int, error) {
 	var count int
-	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM nodes WHERE snapshot_id = ?", snapshotID).Scan(&count)
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM snapshot_nodes WHERE snapshot_id = ?", snapshotID).Scan(&count)
 	return count, err
 }
 
 // CountEdges returns the number of edges in a snapshot
 func (s *Store) CountEdges(ctx context.Context, snapshotID string) (int, error) {
 	var count int
-	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM edges WHERE snapshot_id = ?", snapshotID).Scan(&count)
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM snapshot_edges WHERE snapshot_id = ?", snapshotID).Scan(&count)
 	return count, err
 }
 
@@ -258,10 +914,10 @@ func (s *Store) SearchPrincipals(ctx context.Context, snapshotID, query string,
 	}
 
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, kind, labels, props FROM nodes
-		WHERE snapshot_id = ? AND kind = 'PRINCIPAL'
-		AND (id LIKE ? OR labels LIKE ?)
-		ORDER BY id
+		SELECT `+nodeColumns+` FROM snapshot_nodes s JOIN node_data d ON d.hash = s.hash
+		WHERE s.snapshot_id = ? AND d.kind = 'PRINCIPAL'
+		AND (d.id `+s.db.dialect.like+` ? OR d.labels `+s.db.dialect.like+` ?)
+		ORDER BY s.node_id
 		LIMIT ?
 	`, snapshotID, "%"+query+"%", "%"+query+"%", limit)
 
@@ -272,21 +928,10 @@ func (s *Store) SearchPrincipals(ctx context.Context, snapshotID, query string,
 
 	var nodes []ingest.Node
 	for rows.Next() {
-		var node ingest.Node
-		var labelsJSON, propsJSON, kind string
-
-		if err := rows.Scan(&node.ID, &kind, &labelsJSON, &propsJSON); err != nil {
+		node, err := scanNode(rows)
+		if err != nil {
 			return nil, err
 		}
-
-		node.Kind = ingest.Kind(kind)
-		if err := json.Unmarshal([]byte(labelsJSON), &node.Labels); err != nil {
-			return nil, fmt.Errorf("unmarshaling labels: %w", err)
-		}
-		if err := json.Unmarshal([]byte(propsJSON), &node.Props); err != nil {
-			return nil, fmt.Errorf("unmarshaling props: %w", err)
-		}
-
 		nodes = append(nodes, node)
 	}
 	if err := rows.Err(); err != nil {
@@ -298,33 +943,20 @@ func (s *Store) SearchPrincipals(ctx context.Context, snapshotID, query string,
 
 // GetNode retrieves a single node by ID
 func (s *Store) GetNode(ctx context.Context, snapshotID, nodeID string) (*ingest.Node, error) {
-	var node ingest.Node
-	var labelsJSON, propsJSON, kind string
-
-	err := s.db.QueryRowContext(ctx,
-		"SELECT id, kind, labels, props FROM nodes WHERE snapshot_id = ? AND id = ?",
+	node, err := scanNode(s.db.QueryRowContext(ctx,
+		"SELECT "+nodeColumns+" FROM snapshot_nodes s JOIN node_data d ON d.hash = s.hash WHERE s.snapshot_id = ? AND s.node_id = ?",
 		snapshotID, nodeID,
-	).Scan(&node.ID, &kind, &labelsJSON, &propsJSON)
-
+	))
 	if err != nil {
 		return nil, err
 	}
-
-	node.Kind = ingest.Kind(kind)
-	if err := json.Unmarshal([]byte(labelsJSON), &node.Labels); err != nil {
-		return nil, fmt.Errorf("unmarshaling labels: %w", err)
-	}
-	if err := json.Unmarshal([]byte(propsJSON), &node.Props); err != nil {
-		return nil, fmt.Errorf("unmarshaling props: %w", err)
-	}
-
 	return &node, nil
 }
 
 // GetEdges retrieves all edges for a snapshot (ordered for determinism)
 func (s *Store) GetEdges(ctx context.Context, snapshotID string) ([]ingest.Edge, error) {
 	rows, err := s.db.QueryContext(ctx,
-		"SELECT src, dst, kind, props FROM edges WHERE snapshot_id = ? ORDER BY src, dst, kind",
+		"SELECT "+edgeColumns+" FROM snapshot_edges s JOIN edge_data d ON d.hash = s.hash WHERE s.snapshot_id = ? ORDER BY s.src, s.dst, s.kind",
 		snapshotID,
 	)
 	if err != nil {
@@ -334,16 +966,10 @@ func (s *Store) GetEdges(ctx context.Context, snapshotID string) ([]ingest.Edge,
 
 	var edges []ingest.Edge
 	for rows.Next() {
-		var edge ingest.Edge
-		var propsJSON string
-
-		if err := rows.Scan(&edge.Src, &edge.Dst, &edge.Kind, &propsJSON); err != nil {
+		edge, err := scanEdge(rows)
+		if err != nil {
 			return nil, err
 		}
-
-		if err := json.Unmarshal([]byte(propsJSON), &edge.Props); err != nil {
-			return nil, fmt.Errorf("unmarshaling edge props: %w", err)
-		}
 		edges = append(edges, edge)
 	}
 	if err := rows.Err(); err != nil {
@@ -352,3 +978,71 @@ func (s *Store) GetEdges(ctx context.Context, snapshotID string) ([]ingest.Edge,
 
 	return edges, nil
 }
+
+// Columns selected by scanNode and scanEdge, from node_data or edge_data
+// aliased as d joined to its membership table aliased as s
+const (
+	nodeColumns = "d.id, d.kind, d.labels, d.props, s.provenance"
+	edgeColumns = "d.src, d.dst, d.kind, d.props, s.provenance"
+)
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanNode reads a node selected as nodeColumns
+func scanNode(row scanner) (ingest.Node, error) {
+	var id, kind, labelsJSON, propsJSON, provJSON string
+	if err := row.Scan(&id, &kind, &labelsJSON, &propsJSON, &provJSON); err != nil {
+		return ingest.Node{}, err
+	}
+	return decodeNode(id, kind, labelsJSON, propsJSON, provJSON)
+}
+
+// scanEdge reads an edge selected as edgeColumns
+func scanEdge(row scanner) (ingest.Edge, error) {
+	var src, dst, kind, propsJSON, provJSON string
+	if err := row.Scan(&src, &dst, &kind, &propsJSON, &provJSON); err != nil {
+		return ingest.Edge{}, err
+	}
+	return decodeEdge(src, dst, kind, propsJSON, provJSON)
+}
+
+func decodeNode(id, kind, labelsJSON, propsJSON, provJSON string) (ingest.Node, error) {
+	node := ingest.Node{ID: id, Kind: ingest.Kind(kind)}
+	if err := json.Unmarshal([]byte(labelsJSON), &node.Labels); err != nil {
+		return node, fmt.Errorf("unmarshaling labels for node %s: %w", id, err)
+	}
+	if err := json.Unmarshal([]byte(propsJSON), &node.Props); err != nil {
+		return node, fmt.Errorf("unmarshaling props for node %s: %w", id, err)
+	}
+	if err := json.Unmarshal([]byte(provJSON), &node.Provenance); err != nil {
+		return node, fmt.Errorf("unmarshaling provenance for node %s: %w", id, err)
+	}
+	return node, nil
+}
+
+func decodeEdge(src, dst, kind, propsJSON, provJSON string) (ingest.Edge, error) {
+	edge := ingest.Edge{Src: src, Dst: dst, Kind: kind}
+	if err := json.Unmarshal([]byte(propsJSON), &edge.Props); err != nil {
+		return edge, fmt.Errorf("unmarshaling edge props %s->%s: %w", src, dst, err)
+	}
+	if err := json.Unmarshal([]byte(provJSON), &edge.Provenance); err != nil {
+		return edge, fmt.Errorf("unmarshaling edge provenance %s->%s: %w", src, dst, err)
+	}
+	return edge, nil
+}
+
+// marshalProvenance encodes provenance for storage, using "[]" for none so
+// the column never holds JSON null.
+func marshalProvenance(prov []ingest.Provenance) (string, error) {
+	if len(prov) == 0 {
+		return "[]", nil
+	}
+	data, err := json.Marshal(prov)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
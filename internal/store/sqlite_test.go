@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"testing"
 
@@ -165,3 +166,494 @@ func TestSearchPrincipals(t *testing.T) {
 		t.Errorf("Expected ID %s, got %s", node.ID, results[0].ID)
 	}
 }
+
+func TestProvenanceRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	prov := []ingest.Provenance{{
+		Source: ingest.SourceAWS,
+		File:   "sample/aws/roles.json",
+		Path:   "/0",
+		Line:   2,
+	}}
+
+	g := graph.New()
+	g.AddNode(ingest.Node{ID: "a", Kind: ingest.KindPrincipal, Provenance: prov})
+	g.AddNode(ingest.Node{ID: "b", Kind: ingest.KindResource})
+	if err := g.AddEdge(ingest.Edge{Src: "a", Dst: "b", Kind: ingest.EdgeAppliesTo, Provenance: prov}); err != nil {
+		t.Fatalf("Failed to add edge: %v", err)
+	}
+
+	if err := store.SaveSnapshot(ctx, "snap", "snap", g); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	node, err := store.GetNode(ctx, "snap", "a")
+	if err != nil {
+		t.Fatalf("Failed to get node: %v", err)
+	}
+	if len(node.Provenance) != 1 || node.Provenance[0] != prov[0] {
+		t.Errorf("Expected node provenance %v, got %v", prov, node.Provenance)
+	}
+
+	edges, err := store.GetEdges(ctx, "snap")
+	if err != nil {
+		t.Fatalf("Failed to get edges: %v", err)
+	}
+	if len(edges) != 1 || len(edges[0].Provenance) != 1 || edges[0].Provenance[0] != prov[0] {
+		t.Errorf("Expected edge provenance %v, got %v", prov, edges)
+	}
+}
+
+func TestReportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	if err := store.SaveSnapshot(ctx, "snap", "snap", graph.New()); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	report := ingest.Report{Issues: []ingest.Issue{
+		{
+			Kind:       ingest.IssueDanglingEdge,
+			EntityID:   "a|b|ASSUMES_ROLE",
+			Message:    "ASSUMES_ROLE edge references unknown source a",
+			Provenance: ingest.Provenance{Source: ingest.SourceAWS, File: "roles.json", Line: 8},
+		},
+	}}
+
+	if err := store.SaveReport(ctx, "snap", report); err != nil {
+		t.Fatalf("Failed to save report: %v", err)
+	}
+
+	loaded, err := store.GetReport(ctx, "snap")
+	if err != nil {
+		t.Fatalf("Failed to get report: %v", err)
+	}
+	if len(loaded.Issues) != 1 || loaded.Issues[0] != report.Issues[0] {
+		t.Errorf("Expected %v, got %v", report.Issues, loaded.Issues)
+	}
+}
+
+func TestSnapshotWriterMergesAndDropsDangling(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	w, err := store.BeginSnapshot(ctx, "snap", "snap")
+	if err != nil {
+		t.Fatalf("Failed to begin snapshot: %v", err)
+	}
+	defer func() { _ = w.Rollback() }()
+
+	// Edges may arrive before their nodes
+	writes := []func() error{
+		func() error { return w.AddEdge(ingest.Edge{Src: "role", Dst: "bucket", Kind: "ALLOWS_ACCESS"}) },
+		func() error { return w.AddEdge(ingest.Edge{Src: "ghost", Dst: "bucket", Kind: "ASSUMES_ROLE"}) },
+		func() error {
+			return w.AddNode(ingest.Node{ID: "role", Kind: ingest.KindPrincipal, Props: map[string]string{"name": "first"}})
+		},
+		func() error {
+			return w.AddNode(ingest.Node{ID: "bucket", Kind: ingest.KindResource, Labels: []string{"s3"}})
+		},
+		func() error {
+			return w.AddNode(ingest.Node{ID: "bucket", Kind: ingest.KindResource, Labels: []string{"prod"}, Props: map[string]string{"sensitive": "true"}})
+		},
+		func() error {
+			return w.AddNode(ingest.Node{ID: "role", Kind: ingest.KindPrincipal, Props: map[string]string{"name": "second"}})
+		},
+	}
+	for _, write := range writes {
+		if err := write(); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	dangling, err := w.DropDanglingEdges()
+	if err != nil {
+		t.Fatalf("Failed to drop dangling edges: %v", err)
+	}
+	if len(dangling) != 1 || dangling[0].Src != "ghost" {
+		t.Errorf("Expected the ghost edge to be dangling, got %v", dangling)
+	}
+	if len(w.Conflicts()) != 1 || w.Conflicts()[0].Key != "name" {
+		t.Errorf("Expected one name conflict, got %v", w.Conflicts())
+	}
+
+	if err := w.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	bucket, err := store.GetNode(ctx, "snap", "bucket")
+	if err != nil {
+		t.Fatalf("Failed to get node: %v", err)
+	}
+	if len(bucket.Labels) != 2 || bucket.Props["sensitive"] != "true" {
+		t.Errorf("Expected merged bucket, got %+v", bucket)
+	}
+
+	nodes, _ := store.CountNodes(ctx, "snap")
+	edges, _ := store.CountEdges(ctx, "snap")
+	if nodes != 2 || edges != 1 {
+		t.Errorf("Expected 2 nodes and 1 edge, got %d and %d", nodes, edges)
+	}
+}
+
+func TestSnapshotWriterRollback(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	w, err := store.BeginSnapshot(ctx, "snap", "snap")
+	if err != nil {
+		t.Fatalf("Failed to begin snapshot: %v", err)
+	}
+	if err := w.AddNode(ingest.Node{ID: "n", Kind: ingest.KindPrincipal}); err != nil {
+		t.Fatalf("Failed to add node: %v", err)
+	}
+	if err := w.Rollback(); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+
+	snapshots, err := store.ListSnapshots(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list snapshots: %v", err)
+	}
+	if len(snapshots) != 0 {
+		t.Errorf("Expected no snapshots after rollback, got %v", snapshots)
+	}
+}
+
+func TestSnapshotsShareContent(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	g := graph.New()
+	g.AddNode(ingest.Node{ID: "role", Kind: ingest.KindPrincipal, Props: map[string]string{"name": "role"}})
+	g.AddNode(ingest.Node{ID: "bucket", Kind: ingest.KindResource})
+	if err := g.AddEdge(ingest.Edge{Src: "role", Dst: "bucket", Kind: ingest.EdgeAppliesTo}); err != nil {
+		t.Fatalf("Failed to add edge: %v", err)
+	}
+
+	rows := func(table string) int {
+		var count int
+		if err := store.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&count); err != nil {
+			t.Fatalf("Failed to count %s: %v", table, err)
+		}
+		return count
+	}
+
+	for _, id := range []string{"day1", "day2"} {
+		if err := store.SaveSnapshot(ctx, id, id, g); err != nil {
+			t.Fatalf("Failed to save %s: %v", id, err)
+		}
+	}
+	if rows("node_data") != 2 || rows("edge_data") != 1 {
+		t.Errorf("Expected unchanged snapshots to share 2 nodes and 1 edge, got %d and %d", rows("node_data"), rows("edge_data"))
+	}
+	if rows("snapshot_nodes") != 4 || rows("snapshot_edges") != 2 {
+		t.Errorf("Expected membership rows for both snapshots, got %d and %d", rows("snapshot_nodes"), rows("snapshot_edges"))
+	}
+
+	// Only the changed node is stored again
+	changed := g.Clone()
+	if err := changed.MarkSensitive("bucket"); err != nil {
+		t.Fatalf("Failed to mark bucket: %v", err)
+	}
+	if err := store.SaveSnapshot(ctx, "day3", "day3", changed); err != nil {
+		t.Fatalf("Failed to save day3: %v", err)
+	}
+	if rows("node_data") != 3 || rows("edge_data") != 1 {
+		t.Errorf("Expected one new node row, got %d nodes and %d edges", rows("node_data"), rows("edge_data"))
+	}
+
+	bucket, err := store.GetNode(ctx, "day3", "bucket")
+	if err != nil {
+		t.Fatalf("Failed to get node: %v", err)
+	}
+	if bucket.Props["sensitive"] != "true" {
+		t.Errorf("Expected day3 bucket to be sensitive, got %+v", bucket)
+	}
+	if bucket, _ := store.GetNode(ctx, "day1", "bucket"); bucket.Props["sensitive"] != "" {
+		t.Errorf("Expected day1 bucket to be unchanged, got %+v", bucket)
+	}
+}
+
+func TestSnapshotsShareContentAcrossLineShifts(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	// The same records, shifted down by a record added above them
+	build := func(offset int) *graph.Graph {
+		g := graph.New()
+		for i, id := range []string{"role", "bucket"} {
+			prov := []ingest.Provenance{{File: "users.json", Line: offset + 10*i}}
+			g.AddNode(ingest.Node{ID: id, Kind: ingest.KindPrincipal, Provenance: prov})
+		}
+		edge := ingest.Edge{Src: "role", Dst: "bucket", Kind: ingest.EdgeAssumesRole,
+			Provenance: []ingest.Provenance{{File: "users.json", Line: offset + 5}}}
+		if err := g.AddEdge(edge); err != nil {
+			t.Fatalf("Failed to add edge: %v", err)
+		}
+		return g
+	}
+
+	if err := store.SaveSnapshot(ctx, "day1", "day1", build(1)); err != nil {
+		t.Fatalf("Failed to save day1: %v", err)
+	}
+	if err := store.SaveSnapshot(ctx, "day2", "day2", build(7)); err != nil {
+		t.Fatalf("Failed to save day2: %v", err)
+	}
+
+	if n := countRows(t, store, "node_data"); n != 2 {
+		t.Errorf("Expected line shifts to share node contents, got %d rows", n)
+	}
+	if n := countRows(t, store, "edge_data"); n != 1 {
+		t.Errorf("Expected line shifts to share edge contents, got %d rows", n)
+	}
+
+	// Each snapshot still reports its own lines
+	for id, line := range map[string]int{"day1": 11, "day2": 17} {
+		node, err := store.GetNode(ctx, id, "bucket")
+		if err != nil {
+			t.Fatalf("Failed to get node: %v", err)
+		}
+		if len(node.Provenance) != 1 || node.Provenance[0].Line != line {
+			t.Errorf("%s: expected bucket at line %d, got %v", id, line, node.Provenance)
+		}
+		edges, err := store.GetEdges(ctx, id)
+		if err != nil {
+			t.Fatalf("Failed to get edges: %v", err)
+		}
+		if len(edges) != 1 || edges[0].Provenance[0].Line != line-5 {
+			t.Errorf("%s: expected edge at line %d, got %v", id, line-5, edges)
+		}
+	}
+}
+
+func TestSnapshotWriterCollectsMergedContent(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	w, err := store.BeginSnapshot(ctx, "snap", "snap")
+	if err != nil {
+		t.Fatalf("Failed to begin snapshot: %v", err)
+	}
+	defer func() { _ = w.Rollback() }()
+
+	for _, label := range []string{"a", "b", "c"} {
+		if err := w.AddNode(ingest.Node{ID: "n", Kind: ingest.KindPrincipal, Labels: []string{label}}); err != nil {
+			t.Fatalf("Failed to add node: %v", err)
+		}
+	}
+	if err := w.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	var count int
+	if err := store.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM node_data").Scan(&count); err != nil {
+		t.Fatalf("Failed to count node_data: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected intermediate merges to be collected, got %d node rows", count)
+	}
+}
+
+func TestSnapshotWriterBatches(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	w, err := store.BeginSnapshot(ctx, "snap", "snap")
+	if err != nil {
+		t.Fatalf("Failed to begin snapshot: %v", err)
+	}
+	defer func() { _ = w.Rollback() }()
+
+	var reports []Progress
+	w.OnProgress(writeBatch, func(p Progress) { reports = append(reports, p) })
+
+	// One full batch is inserted and the rest stays buffered
+	count := writeBatch + 10
+	for i := 0; i < count; i++ {
+		node := ingest.Node{ID: fmt.Sprintf("n%d", i), Kind: ingest.KindPrincipal, Props: map[string]string{"i": fmt.Sprint(i)}}
+		if err := w.AddNode(node); err != nil {
+			t.Fatalf("Failed to add node: %v", err)
+		}
+	}
+	if len(reports) != 1 || reports[0].Nodes != writeBatch {
+		t.Fatalf("Expected one progress report after the first batch, got %+v", reports)
+	}
+
+	// Duplicates merge whether their first copy was inserted or is buffered
+	for _, id := range []string{"n0", fmt.Sprintf("n%d", count-1)} {
+		if err := w.AddNode(ingest.Node{ID: id, Props: map[string]string{"dup": "yes"}}); err != nil {
+			t.Fatalf("Failed to add duplicate node: %v", err)
+		}
+	}
+	if err := w.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	if last := reports[len(reports)-1]; last.Nodes != count {
+		t.Errorf("Expected final progress to report %d nodes, got %+v", count, last)
+	}
+
+	for _, id := range []string{"n0", "n1", fmt.Sprintf("n%d", count-1)} {
+		node, err := store.GetNode(ctx, "snap", id)
+		if err != nil {
+			t.Fatalf("Failed to get node %s: %v", id, err)
+		}
+		if want := id != "n1"; (node.Props["dup"] == "yes") != want {
+			t.Errorf("Node %s: expected merged %v, got props %v", id, want, node.Props)
+		}
+	}
+
+	var rows int
+	if err := store.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM node_data").Scan(&rows); err != nil {
+		t.Fatalf("Failed to count node_data: %v", err)
+	}
+	if rows != count {
+		t.Errorf("Expected replaced contents to be collected leaving %d rows, got %d", count, rows)
+	}
+}
+
+func TestForeignKeysEnforced(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := New(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	var enabled int
+	if err := store.db.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&enabled); err != nil {
+		t.Fatalf("Failed to read pragma: %v", err)
+	}
+	if enabled != 1 {
+		t.Fatal("Expected foreign keys to be enforced")
+	}
+
+	w, err := store.BeginSnapshot(ctx, "snap", "snap")
+	if err != nil {
+		t.Fatalf("Failed to begin snapshot: %v", err)
+	}
+	defer func() { _ = w.Rollback() }()
+
+	if err := w.AddNode(ingest.Node{ID: "role", Kind: ingest.KindPrincipal}); err != nil {
+		t.Fatalf("Failed to add node: %v", err)
+	}
+	if err := w.AddEdge(ingest.Edge{Src: "role", Dst: "ghost", Kind: ingest.EdgeAssumesRole}); err != nil {
+		t.Fatalf("Failed to add edge: %v", err)
+	}
+	if err := w.Commit(); err == nil {
+		t.Error("Expected commit with a dangling edge to fail")
+	}
+
+	if err := store.SaveReport(ctx, "missing", ingest.Report{Issues: []ingest.Issue{{Kind: ingest.IssueDanglingEdge}}}); err == nil {
+		t.Error("Expected report for an unknown snapshot to fail")
+	}
+}
+
+// benchGraph builds a snapshot shaped like ingested AWS data with about
+// edges edges: principals attached to policies granting actions on buckets
+func benchGraph(tb testing.TB, edges int) *graph.Graph {
+	g := graph.New()
+	prov := func(file string, i int) []ingest.Provenance {
+		return []ingest.Provenance{{Source: ingest.SourceAWS, File: file, Path: fmt.Sprintf("/%d", i), Line: i + 1}}
+	}
+
+	const perms = 10
+	policies := edges / (perms*2 + 5)
+	for i := 0; i < policies; i++ {
+		principal := fmt.Sprintf("arn:aws:iam::111111111111:role/role-%d", i)
+		policy := fmt.Sprintf("arn:aws:iam::111111111111:policy/policy-%d", i)
+		bucket := fmt.Sprintf("arn:aws:s3:::bucket-%d", i)
+		g.AddNode(ingest.Node{ID: principal, Kind: ingest.KindPrincipal, Labels: []string{"aws-role"}, Props: map[string]string{"name": fmt.Sprintf("role-%d", i)}, Provenance: prov("roles.json", i)})
+		g.AddNode(ingest.Node{ID: policy, Kind: ingest.KindPolicy, Labels: []string{"aws-policy"}, Props: map[string]string{"name": fmt.Sprintf("policy-%d", i)}, Provenance: prov("policies.json", i)})
+		g.AddNode(ingest.Node{ID: bucket, Kind: ingest.KindResource, Provenance: prov("policies.json", i)})
+	}
+	add := func(e ingest.Edge) {
+		if err := g.AddEdge(e); err != nil {
+			tb.Fatalf("Failed to add edge: %v", err)
+		}
+	}
+	for i := 0; i < policies; i++ {
+		policy := fmt.Sprintf("arn:aws:iam::111111111111:policy/policy-%d", i)
+		for j := 0; j < 5; j++ {
+			add(ingest.Edge{Src: fmt.Sprintf("arn:aws:iam::111111111111:role/role-%d", (i+j*7)%policies), Dst: policy, Kind: ingest.EdgeAttachedPolicy, Provenance: prov("attachments.json", i)})
+		}
+		for j := 0; j < perms; j++ {
+			perm := fmt.Sprintf("%s#stmt%d#s3:GetObject", policy, j)
+			g.AddNode(ingest.Node{ID: perm, Kind: ingest.KindPerm, Props: map[string]string{"action": "s3:GetObject"}, Provenance: prov("policies.json", i)})
+			add(ingest.Edge{Src: policy, Dst: perm, Kind: ingest.EdgeAllowsAction, Provenance: prov("policies.json", i)})
+			add(ingest.Edge{Src: perm, Dst: fmt.Sprintf("arn:aws:s3:::bucket-%d", (i+j)%policies), Kind: ingest.EdgeAppliesTo, Provenance: prov("policies.json", i)})
+		}
+	}
+	return g
+}
+
+// BenchmarkSaveSnapshot saves a snapshot of 100k edges to a fresh database
+func BenchmarkSaveSnapshot(b *testing.B) {
+	ctx := context.Background()
+	g := benchGraph(b, 100000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		store, err := New(b.TempDir() + "/bench.db")
+		if err != nil {
+			b.Fatalf("Failed to create store: %v", err)
+		}
+		b.StartTimer()
+
+		if err := store.SaveSnapshot(ctx, "snap", "snap", g); err != nil {
+			b.Fatalf("Failed to save: %v", err)
+		}
+
+		b.StopTimer()
+		store.Close()
+		b.StartTimer()
+	}
+
+	b.ReportMetric(float64(g.EdgeCount()+g.NodeCount())*float64(b.N)/b.Elapsed().Seconds(), "rows/s")
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+
+	"github.com/jamesolaitan/accessgraph/internal/graph"
+	"github.com/jamesolaitan/accessgraph/internal/ingest"
+)
+
+// Storage is everything the store does, on whichever database it runs.
+// Store implements it on SQLite and PostgreSQL with the same semantics,
+// which the conformance tests check against both.
+type Storage interface {
+	Close() error
+
+	// Writing snapshots
+	SaveSnapshot(ctx context.Context, id, label string, g *graph.Graph) error
+	BeginSnapshot(ctx context.Context, id, label string) (*SnapshotWriter, error)
+	ReplaceSnapshot(ctx context.Context, id, label string) (*SnapshotWriter, error)
+	SaveReport(ctx context.Context, snapshotID string, report ingest.Report) error
+
+	// Reading snapshots
+	ListSnapshots(ctx context.Context) ([]Snapshot, error)
+	GetSnapshot(ctx context.Context, id string) (*Snapshot, error)
+	LoadSnapshot(ctx context.Context, id string) (*graph.Graph, error)
+	GetReport(ctx context.Context, snapshotID string) (ingest.Report, error)
+	CountNodes(ctx context.Context, snapshotID string) (int, error)
+	CountEdges(ctx context.Context, snapshotID string) (int, error)
+	SearchPrincipals(ctx context.Context, snapshotID, query string, limit int) ([]ingest.Node, error)
+	GetNode(ctx context.Context, snapshotID, nodeID string) (*ingest.Node, error)
+	GetEdges(ctx context.Context, snapshotID string) ([]ingest.Edge, error)
+
+	// Lifecycle
+	DeleteSnapshot(ctx context.Context, id string) error
+	UpdateLabel(ctx context.Context, id, label string) error
+	PruneSnapshots(ctx context.Context, policy RetentionPolicy, dryRun bool) ([]Snapshot, error)
+	Vacuum(ctx context.Context) error
+
+	// Schema
+	SchemaStatus(ctx context.Context) (*SchemaStatus, error)
+	Migrate(ctx context.Context) ([]Migration, error)
+	LatestVersion() int
+}
+
+var _ Storage = (*Store)(nil)
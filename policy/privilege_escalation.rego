@@ -0,0 +1,14 @@
+package accessgraph
+
+# IAM Privilege Escalation Detection
+violations[result] {
+    esc := input.escalations[esc_id]
+    
+    result := {
+        "ruleId": "IAM.PrivilegeEscalation",
+        "severity": "HIGH",
+        "entityRef": esc.principal,
+        "reason": sprintf("Principal '%s' can escalate to '%s' using technique '%s': %s", [esc.principal, esc.target, esc.technique, esc.technique_name]),
+        "remediation": sprintf("Remove or scope down %s for this principal, or deny them on the targeted identity with a permissions boundary or SCP", [concat(", ", esc.actions)])
+    }
+}
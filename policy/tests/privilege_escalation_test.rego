@@ -0,0 +1,28 @@
+package accessgraph
+
+test_privilege_escalation_detection {
+    count(violations) > 0 with input as {
+        "policies": {},
+        "roles": {},
+        "k8s": {"bindings": {}},
+        "escalations": {
+            "esc1": {
+                "principal": "arn:aws:iam::111111111111:user/dev",
+                "target": "arn:aws:iam::111111111111:role/Admin",
+                "technique": "passrole-ec2",
+                "technique_name": "Pass a role to a new EC2 instance profile",
+                "actions": ["iam:PassRole", "ec2:RunInstances"],
+                "self": false
+            }
+        }
+    }
+}
+
+test_no_escalation_no_violation {
+    count(violations) == 0 with input as {
+        "policies": {},
+        "roles": {},
+        "k8s": {"bindings": {}},
+        "escalations": {}
+    }
+}